@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/html"
+	"io"
+	"net/http"
+)
+
+type htmlWriter interface {
+	WriteHtml(writer io.Writer)
+}
+
+var htmlWriters []htmlWriter
+
+func addHtmlWriter(writer htmlWriter) {
+	htmlWriters = append(htmlWriters, writer)
+}
+
+func statusHandler(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	fmt.Fprintln(writer, "<title>caching-objectserver status page</title>")
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, "<center>")
+	fmt.Fprintln(writer, "<h1>caching-objectserver status page</h1>")
+	fmt.Fprintln(writer, "</center>")
+	html.WriteHeaderWithRequest(writer, req)
+	fmt.Fprintln(writer, "<h3>")
+	for _, htmlWriter := range htmlWriters {
+		htmlWriter.WriteHtml(writer)
+	}
+	fmt.Fprintln(writer, "</h3>")
+	fmt.Fprintln(writer, "<hr>")
+	html.WriteFooter(writer)
+	fmt.Fprintln(writer, "</body>")
+}
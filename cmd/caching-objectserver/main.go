@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/constants"
+	"github.com/Symantec/Dominator/lib/logbuf"
+	"github.com/Symantec/Dominator/lib/objectserver/cache"
+	"github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	objectserverRpcd "github.com/Symantec/Dominator/objectserver/rpcd"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"log"
+	"net"
+	"net/http"
+	"os"
+)
+
+var (
+	caFile = flag.String("CAfile", "/etc/ssl/CA.pem",
+		"Name of file containing the root of trust")
+	certFile = flag.String("certFile",
+		"/etc/ssl/caching-objectserver/cert.pem",
+		"Name of file containing the SSL certificate")
+	crlFile = flag.String("crlFile", "",
+		"Name of file containing CRLs for rejecting client certificates")
+	denyListFile = flag.String("denyListFile", "",
+		"Name of file containing denied certificate serials and usernames")
+	groupPolicyFile = flag.String("groupPolicyFile", "",
+		"Name of file containing the methods and directories groups may use")
+	keyFile = flag.String("keyFile", "/etc/ssl/caching-objectserver/key.pem",
+		"Name of file containing the SSL key")
+	logbufLines = flag.Uint("logbufLines", 1024,
+		"Number of lines to store in the log buffer")
+	maxCacheSize = flag.Uint64("maxCacheSize", 0,
+		"Maximum size (in bytes) of cached objects (0: unlimited)")
+	objectDir = flag.String("objectDir", "/var/lib/caching-objectserver",
+		"Name of directory to cache objects in")
+	portNum = flag.Uint("portNum", constants.CachingObjectServerPortNumber,
+		"Port number to allocate and listen on for HTTP/RPC")
+	prefetch = flag.Bool("prefetch", true,
+		"If true, fetch the objects for new images as they are added upstream")
+	upstreamHostname = flag.String("upstreamHostname", "",
+		"Hostname of image server to fetch objects from")
+	upstreamPortNum = flag.Uint("upstreamPortNum",
+		constants.ImageServerPortNumber,
+		"Port number of image server to fetch objects from")
+)
+
+func main() {
+	flag.Parse()
+	tricorder.RegisterFlags()
+	if os.Geteuid() == 0 {
+		fmt.Fprintln(os.Stderr, "Do not run the caching objectserver as root")
+		os.Exit(1)
+	}
+	if *upstreamHostname == "" {
+		fmt.Fprintln(os.Stderr, "-upstreamHostname required")
+		os.Exit(1)
+	}
+	tlsLoader := setupTls(*caFile, *certFile, *keyFile)
+	circularBuffer := logbuf.New(*logbufLines)
+	logger := log.New(circularBuffer, "", log.LstdFlags)
+	if tlsLoader != nil {
+		tlsLoader.Watch(logger)
+	}
+	if err := setupRevocation(*crlFile, *denyListFile, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load revocation lists\t%s\n", err)
+		os.Exit(1)
+	}
+	if _, err := setupGroupPolicy(*groupPolicyFile, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load group policy\t%s\n", err)
+		os.Exit(1)
+	}
+	localObjSrv, err := filesystem.NewObjectServer(*objectDir, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot create ObjectServer\t%s\n", err)
+		os.Exit(1)
+	}
+	upstreamAddress := fmt.Sprintf("%s:%d", *upstreamHostname,
+		*upstreamPortNum)
+	objSrv := cache.NewObjectServer(localObjSrv,
+		client.NewObjectClient(upstreamAddress), *maxCacheSize, logger)
+	metricsDir, err := tricorder.RegisterDirectory("/cache")
+	if err == nil {
+		err = objSrv.RegisterMetrics(metricsDir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to register metrics\t%s\n", err)
+		os.Exit(1)
+	}
+	objSrvRpcHtmlWriter := objectserverRpcd.Setup(objSrv, logger)
+	addHtmlWriter(objSrv)
+	if *prefetch {
+		addHtmlWriter(startPrefetcher(upstreamAddress, objSrv, logger))
+	}
+	addHtmlWriter(objSrvRpcHtmlWriter)
+	if tlsLoader != nil {
+		addHtmlWriter(tlsLoader)
+	}
+	addHtmlWriter(circularBuffer)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *portNum))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create http server\t%s\n", err)
+		os.Exit(1)
+	}
+	http.HandleFunc("/", statusHandler)
+	if err := http.Serve(listener, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to serve\t%s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	imgclient "github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/format"
+	"github.com/Symantec/Dominator/lib/objectserver/cache"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+type prefetcherType struct {
+	address    string
+	objSrv     *cache.ObjectServer
+	logger     *log.Logger
+	sync.Mutex // Protects everything below.
+	connected  bool
+	lastError  error // Connection error.
+	fetchError error // Error prefetching the most recent failed image.
+	lastImage  string
+	lastTime   time.Time
+	numImages  uint64
+}
+
+func startPrefetcher(address string, objSrv *cache.ObjectServer,
+	logger *log.Logger) *prefetcherType {
+	p := &prefetcherType{address: address, objSrv: objSrv, logger: logger}
+	go p.loop()
+	return p
+}
+
+func (p *prefetcherType) loop() {
+	initialTimeout := time.Second * 15
+	timeout := initialTimeout
+	var nextSleepStopTime time.Time
+	for {
+		nextSleepStopTime = time.Now().Add(timeout)
+		if client, err := srpc.DialHTTP("tcp", p.address, timeout); err != nil {
+			p.logger.Printf("Error dialling: %s %s\n", p.address, err)
+			p.setError(err)
+		} else {
+			if conn, err := client.Call(
+				"ImageServer.GetImageUpdates"); err != nil {
+				p.logger.Println(err)
+				p.setError(err)
+			} else {
+				if err := p.getUpdates(conn); err != nil {
+					if err == io.EOF {
+						p.logger.Println("Connection to image server closed")
+						if nextSleepStopTime.Sub(time.Now()) < 1 {
+							timeout = initialTimeout
+						}
+					} else {
+						p.logger.Println(err)
+					}
+					p.setError(err)
+				}
+				conn.Close()
+			}
+			client.Close()
+		}
+		time.Sleep(nextSleepStopTime.Sub(time.Now()))
+		if timeout < time.Minute {
+			timeout *= 2
+		}
+	}
+}
+
+// getUpdates prefetches the objects for images which are added after the
+// initial image list has been received. Images which already exist are fetched
+// on demand.
+func (p *prefetcherType) getUpdates(conn *srpc.Conn) error {
+	p.logger.Printf("Prefetcher: connected to: %s\n", p.address)
+	p.setConnected()
+	decoder := gob.NewDecoder(conn)
+	initialListReceived := false
+	for {
+		var imageUpdate imageserver.ImageUpdate
+		if err := decoder.Decode(&imageUpdate); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return errors.New("decode err: " + err.Error())
+		}
+		if imageUpdate.Operation != imageserver.OperationAddImage {
+			continue
+		}
+		if imageUpdate.Name == "" {
+			initialListReceived = true
+			continue
+		}
+		if !initialListReceived {
+			continue
+		}
+		// The update stream is not read while prefetching, which is fine since
+		// the image server buffers updates.
+		if err := p.prefetchImage(imageUpdate.Name); err != nil {
+			p.logger.Printf("Prefetcher(%s): %s\n", imageUpdate.Name, err)
+			p.setPrefetchError(err)
+		}
+	}
+}
+
+func (p *prefetcherType) prefetchImage(name string) error {
+	client, err := srpc.DialHTTP("tcp", p.address, time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	img, err := imgclient.GetImage(client, name)
+	if err != nil {
+		return err
+	}
+	if img == nil {
+		return errors.New("image not found")
+	}
+	startTime := time.Now()
+	hashes := img.ListObjects()
+	if err := p.objSrv.Prefetch(hashes); err != nil {
+		return err
+	}
+	p.logger.Printf("Prefetched %d objects for: %s in %s\n",
+		len(hashes), name, format.Duration(time.Since(startTime)))
+	p.Lock()
+	defer p.Unlock()
+	p.lastImage = name
+	p.lastTime = time.Now()
+	p.numImages++
+	p.fetchError = nil
+	return nil
+}
+
+func (p *prefetcherType) setConnected() {
+	p.Lock()
+	defer p.Unlock()
+	p.connected = true
+	p.lastError = nil
+}
+
+func (p *prefetcherType) setError(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.connected = false
+	p.lastError = err
+}
+
+func (p *prefetcherType) setPrefetchError(err error) {
+	p.Lock()
+	defer p.Unlock()
+	p.fetchError = err
+}
+
+func (p *prefetcherType) WriteHtml(writer io.Writer) {
+	p.Lock()
+	defer p.Unlock()
+	fmt.Fprintf(writer, "Prefetching images from: %s", p.address)
+	if p.connected {
+		fmt.Fprint(writer, ", connected")
+	} else if p.lastError != nil {
+		fmt.Fprintf(writer, ", <font color=\"red\">error: %s</font>",
+			p.lastError)
+	} else {
+		fmt.Fprint(writer, ", connecting")
+	}
+	fmt.Fprintf(writer, ", %d images prefetched", p.numImages)
+	if p.lastImage != "" {
+		fmt.Fprintf(writer, ", last: %s (%s ago)", p.lastImage,
+			format.Duration(time.Since(p.lastTime)))
+	}
+	if p.fetchError != nil {
+		fmt.Fprintf(writer, ", <font color=\"red\">last error: %s</font>",
+			p.fetchError)
+	}
+	fmt.Fprintln(writer, "<br>")
+}
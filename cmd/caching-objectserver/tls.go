@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/grouppolicy"
+	"github.com/Symantec/Dominator/lib/revocation"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/tlsloader"
+	"log"
+	"os"
+)
+
+func setupTls(caFile, certFile, keyFile string) *tlsloader.Loader {
+	if caFile == "" || certFile == "" || keyFile == "" {
+		return nil
+	}
+	// Load certificates and key.
+	loader, err := tlsloader.New(caFile, certFile, keyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load certificates\t%s\n",
+			err)
+		os.Exit(1)
+	}
+	// Setup server.
+	serverConfig := new(tls.Config)
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	serverConfig.MinVersion = tls.VersionTLS12
+	srpc.RegisterServerTlsConfig(loader.ServerConfig(serverConfig), true)
+	// Setup client.
+	clientConfig := new(tls.Config)
+	clientConfig.InsecureSkipVerify = true
+	clientConfig.MinVersion = tls.VersionTLS12
+	srpc.RegisterClientTlsConfig(loader.ClientConfig(clientConfig))
+	return loader
+}
+
+func setupRevocation(crlFile, denyListFile string, logger *log.Logger) error {
+	if crlFile == "" && denyListFile == "" {
+		return nil
+	}
+	list, err := revocation.New(crlFile, denyListFile, logger)
+	if err != nil {
+		return err
+	}
+	srpc.RegisterRevocationChecker(list)
+	return nil
+}
+
+func setupGroupPolicy(filename string, logger *log.Logger) (
+	*grouppolicy.Policy, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	policy, err := grouppolicy.New(filename, logger)
+	if err != nil {
+		return nil, err
+	}
+	srpc.RegisterGroupPolicy(policy)
+	return policy, nil
+}
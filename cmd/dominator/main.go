@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/Symantec/Dominator/dom/herd"
 	"github.com/Symantec/Dominator/lib/constants"
+	"github.com/Symantec/Dominator/lib/image"
 	"github.com/Symantec/Dominator/lib/logbuf"
 	"github.com/Symantec/Dominator/lib/mdb"
 	"github.com/Symantec/Dominator/lib/mdb/mdbd"
@@ -48,12 +49,19 @@ var (
 		"File to read MDB data from, relative to stateDir (default format is JSON)")
 	minInterval = flag.Uint("minInterval", 1,
 		"Minimum interval between loops (in seconds)")
+	objectServerHostname = flag.String("objectServerHostname", "",
+		"Hostname of object server subs fetch objects from (default: image server)")
+	objectServerPortNum = flag.Uint("objectServerPortNum",
+		constants.ImageServerPortNumber,
+		"Port number of object server subs fetch objects from")
 	objectsDir = flag.String("objectsDir", "objects",
 		"Directory containing computed objects, relative to stateDir")
 	portNum = flag.Uint("portNum", constants.DomPortNumber,
 		"Port number to allocate and listen on for HTTP/RPC")
 	stateDir = flag.String("stateDir", "/var/lib/Dominator",
 		"Name of dominator state directory.")
+	trustedKeysFile = flag.String("trustedKeysFile", "",
+		"File listing image directories and trusted signing keys (if set, only signed images are deployed)")
 	username = flag.String("username", "",
 		"If running as root, username to switch to.")
 )
@@ -128,7 +136,7 @@ func newObjectServer(objectsDir string, logger *log.Logger) (
 func main() {
 	flag.Parse()
 	tricorder.RegisterFlags()
-	setupTls(*caFile,
+	tlsLoader := setupTls(*caFile,
 		pathJoin(*certDir, *certFile), pathJoin(*certDir, *keyFile))
 	rlim := syscall.Rlimit{*fdLimit, *fdLimit}
 	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
@@ -153,6 +161,9 @@ func main() {
 	interval := time.Duration(*minInterval) * time.Second
 	circularBuffer := logbuf.New(*logbufLines)
 	logger := log.New(circularBuffer, "", log.LstdFlags)
+	if tlsLoader != nil {
+		tlsLoader.Watch(logger)
+	}
 	mdbChannel := mdbd.StartMdbDaemon(path.Join(*stateDir, *mdbFile), logger)
 	objectServer, err := newObjectServer(path.Join(*stateDir, *objectsDir),
 		logger)
@@ -162,6 +173,21 @@ func main() {
 	}
 	herd := herd.NewHerd(fmt.Sprintf("%s:%d", *imageServerHostname,
 		*imageServerPortNum), objectServer, logger)
+	if *trustedKeysFile != "" {
+		trustedKeys, err := image.LoadTrustedKeys(*trustedKeysFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load trusted keys: %s\n", err)
+			os.Exit(1)
+		}
+		herd.SetTrustedKeys(trustedKeys)
+	}
+	if *objectServerHostname != "" {
+		herd.SetObjectServerAddress(fmt.Sprintf("%s:%d", *objectServerHostname,
+			*objectServerPortNum))
+	}
+	if tlsLoader != nil {
+		herd.AddHtmlWriter(tlsLoader)
+	}
 	herd.AddHtmlWriter(circularBuffer)
 	if err = herd.StartServer(*portNum, true); err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to create http server\t%s\n", err)
@@ -2,44 +2,28 @@ package main
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"github.com/Symantec/Dominator/lib/srpc"
-	"io/ioutil"
+	"github.com/Symantec/Dominator/lib/tlsloader"
 	"os"
 )
 
-func setupTls(caFile, certFile, keyFile string) {
+func setupTls(caFile, certFile, keyFile string) *tlsloader.Loader {
 	if caFile == "" || certFile == "" || keyFile == "" {
-		return
+		return nil
 	}
-	caData, err := ioutil.ReadFile(caFile)
+	loader, err := tlsloader.New(caFile, certFile, keyFile)
 	if os.IsNotExist(err) {
-		return
+		return nil
 	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to load CA file\t%s\n",
+		fmt.Fprintf(os.Stderr, "Unable to load certificates\t%s\n",
 			err)
 		os.Exit(1)
 	}
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caData) {
-		fmt.Fprintln(os.Stderr, "Unable to parse CA file")
-		os.Exit(1)
-	}
 	clientConfig := new(tls.Config)
 	clientConfig.InsecureSkipVerify = true
 	clientConfig.MinVersion = tls.VersionTLS12
-	clientConfig.RootCAs = caCertPool
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if os.IsNotExist(err) {
-		return
-	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to load keypair\t%s\n",
-			err)
-		os.Exit(1)
-	}
-	clientConfig.Certificates = append(clientConfig.Certificates, cert)
-	srpc.RegisterClientTlsConfig(clientConfig)
+	srpc.RegisterClientTlsConfig(loader.ClientConfig(clientConfig))
+	return loader
 }
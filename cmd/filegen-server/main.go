@@ -20,8 +20,14 @@ var (
 		"Name of file containing the root of trust")
 	certFile = flag.String("certFile", "/etc/ssl/filegen-server/cert.pem",
 		"Name of file containing the SSL certificate")
+	crlFile = flag.String("crlFile", "",
+		"Name of file containing CRLs for rejecting client certificates")
+	denyListFile = flag.String("denyListFile", "",
+		"Name of file containing denied certificate serials and usernames")
 	configFile = flag.String("configFile", "/var/lib/filegen-server/config",
 		"Name of file containing the configuration")
+	groupPolicyFile = flag.String("groupPolicyFile", "",
+		"Name of file containing the methods and directories groups may use")
 	logbufLines = flag.Uint("logbufLines", 1024,
 		"Number of lines to store in the log buffer")
 	keyFile = flag.String("keyFile", "/etc/ssl/filegen-server/key.pem",
@@ -46,9 +52,20 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Do not run the filegen server as root")
 		os.Exit(1)
 	}
-	setupTls(*caFile, *certFile, *keyFile)
+	tlsLoader := setupTls(*caFile, *certFile, *keyFile)
 	circularBuffer := logbuf.New(*logbufLines)
 	logger := log.New(circularBuffer, "", log.LstdFlags)
+	if tlsLoader != nil {
+		tlsLoader.Watch(logger)
+	}
+	if err := setupRevocation(*crlFile, *denyListFile, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load revocation lists\t%s\n", err)
+		os.Exit(1)
+	}
+	if _, err := setupGroupPolicy(*groupPolicyFile, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load group policy\t%s\n", err)
+		os.Exit(1)
+	}
 	manager := filegen.New(logger)
 	if *configFile != "" {
 		if err := util.LoadConfiguration(manager, *configFile); err != nil {
@@ -66,6 +83,9 @@ func main() {
 		}()
 	}
 	httpd.AddHtmlWriter(manager)
+	if tlsLoader != nil {
+		httpd.AddHtmlWriter(tlsLoader)
+	}
 	httpd.AddHtmlWriter(circularBuffer)
 	for _, pathname := range flag.Args() {
 		if err := registerSourceDirectory(manager, pathname, "/"); err != nil {
@@ -2,46 +2,58 @@ package main
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
+	"github.com/Symantec/Dominator/lib/grouppolicy"
+	"github.com/Symantec/Dominator/lib/revocation"
 	"github.com/Symantec/Dominator/lib/srpc"
-	"io/ioutil"
+	"github.com/Symantec/Dominator/lib/tlsloader"
+	"log"
 	"os"
 )
 
-func setupTls(caFile, certFile, keyFile string) {
+func setupTls(caFile, certFile, keyFile string) *tlsloader.Loader {
 	if caFile == "" || certFile == "" || keyFile == "" {
-		return
+		return nil
 	}
 	// Load certificates and key.
-	caData, err := ioutil.ReadFile(caFile)
+	loader, err := tlsloader.New(caFile, certFile, keyFile)
 	if os.IsNotExist(err) {
-		return
+		return nil
 	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to load CA file\t%s\n",
+		fmt.Fprintf(os.Stderr, "Unable to load certificates\t%s\n",
 			err)
 		os.Exit(1)
 	}
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caData) {
-		fmt.Fprintln(os.Stderr, "Unable to parse CA file")
-		os.Exit(1)
-	}
 	// Setup server.
 	serverConfig := new(tls.Config)
 	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	serverConfig.MinVersion = tls.VersionTLS12
-	serverConfig.ClientCAs = caCertPool
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if os.IsNotExist(err) {
-		return
+	srpc.RegisterServerTlsConfig(loader.ServerConfig(serverConfig), true)
+	return loader
+}
+
+func setupRevocation(crlFile, denyListFile string, logger *log.Logger) error {
+	if crlFile == "" && denyListFile == "" {
+		return nil
 	}
+	list, err := revocation.New(crlFile, denyListFile, logger)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to load keypair\t%s\n",
-			err)
-		os.Exit(1)
+		return err
+	}
+	srpc.RegisterRevocationChecker(list)
+	return nil
+}
+
+func setupGroupPolicy(filename string, logger *log.Logger) (
+	*grouppolicy.Policy, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	policy, err := grouppolicy.New(filename, logger)
+	if err != nil {
+		return nil, err
 	}
-	serverConfig.Certificates = append(serverConfig.Certificates, cert)
-	srpc.RegisterServerTlsConfig(serverConfig, true)
+	srpc.RegisterGroupPolicy(policy)
+	return policy, nil
 }
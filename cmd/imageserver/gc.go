@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/scanner"
+	"github.com/Symantec/Dominator/lib/format"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	gcDryRun = flag.Bool("gcDryRun", false,
+		"If true, garbage collection only reports what would be deleted")
+	gcGracePeriod = flag.Duration("gcGracePeriod", time.Hour,
+		"Minimum age of unreferenced objects before they may be deleted")
+	gcInterval = flag.Duration("gcInterval", 0,
+		"Interval between garbage collections of objects (0 disables)")
+)
+
+type garbageCollectorType struct {
+	sync.Mutex
+	lastReport *scanner.GarbageReport
+	lastError  error
+}
+
+func startGarbageCollector(imdb *scanner.ImageDataBase,
+	logger *log.Logger) *garbageCollectorType {
+	gc := &garbageCollectorType{}
+	if *gcInterval > 0 {
+		go gc.loop(imdb, logger)
+	}
+	return gc
+}
+
+func (gc *garbageCollectorType) loop(imdb *scanner.ImageDataBase,
+	logger *log.Logger) {
+	for ; ; time.Sleep(*gcInterval) {
+		report, err := imdb.CollectGarbage(*gcGracePeriod, *gcDryRun)
+		gc.Lock()
+		gc.lastReport = &report
+		gc.lastError = err
+		gc.Unlock()
+		if err != nil {
+			logger.Printf("Error collecting garbage: %s\n", err)
+		}
+		action := "Deleted"
+		if report.DryRun {
+			action = "Would delete"
+		}
+		logger.Printf(
+			"%s %d unreferenced objects (%s), skipped %d recent, in %s\n",
+			action, report.NumObjects, format.FormatBytes(report.NumBytes),
+			report.NumSkippedObjects, format.Duration(report.Duration))
+	}
+}
+
+func (gc *garbageCollectorType) WriteHtml(writer io.Writer) {
+	if *gcInterval <= 0 {
+		return
+	}
+	gc.Lock()
+	report := gc.lastReport
+	err := gc.lastError
+	gc.Unlock()
+	if report == nil {
+		fmt.Fprintln(writer, "Garbage collection pending<br>")
+		return
+	}
+	action := "deleted"
+	if report.DryRun {
+		action = "would delete"
+	}
+	fmt.Fprintf(writer,
+		"Last garbage collection at %s %s %d objects (%s), skipped %d recent",
+		report.StartTime.Format(time.RFC3339), action,
+		report.NumObjects, format.FormatBytes(report.NumBytes),
+		report.NumSkippedObjects)
+	if err != nil {
+		fmt.Fprintf(writer, ", <font color=\"red\">error: %s</font>", err)
+	}
+	fmt.Fprintln(writer, "<br>")
+}
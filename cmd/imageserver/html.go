@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"github.com/Symantec/Dominator/lib/filesystem"
 	"github.com/Symantec/Dominator/lib/format"
 	"github.com/Symantec/tricorder/go/tricorder"
 	"github.com/Symantec/tricorder/go/tricorder/units"
@@ -37,17 +36,7 @@ func (imageObjectServers *imageObjectServersType) WriteHtml(writer io.Writer) {
 	numObjects := len(objectsMap)
 	fmt.Fprintf(writer, "Number of objects: %d, consumimg %s<br>\n",
 		numObjects, format.FormatBytes(totalBytes))
-	for _, imageName := range imageObjectServers.imdb.ListImages() {
-		image := imageObjectServers.imdb.GetImage(imageName)
-		if image == nil {
-			continue
-		}
-		for _, inode := range image.FileSystem.InodeTable {
-			if inode, ok := inode.(*filesystem.RegularInode); ok {
-				delete(objectsMap, inode.Hash)
-			}
-		}
-	}
+	imageObjectServers.imdb.RemoveReferencedObjects(objectsMap)
 	var unreferencedBytes uint64
 	for _, bytes := range objectsMap {
 		unreferencedBytes += bytes
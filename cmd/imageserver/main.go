@@ -7,8 +7,12 @@ import (
 	imageserverRpcd "github.com/Symantec/Dominator/imageserver/rpcd"
 	"github.com/Symantec/Dominator/imageserver/scanner"
 	"github.com/Symantec/Dominator/lib/constants"
+	"github.com/Symantec/Dominator/lib/flagutil"
+	"github.com/Symantec/Dominator/lib/image/lint"
 	"github.com/Symantec/Dominator/lib/logbuf"
+	"github.com/Symantec/Dominator/lib/objectserver"
 	"github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/Dominator/lib/srpc"
 	objectserverRpcd "github.com/Symantec/Dominator/objectserver/rpcd"
 	"github.com/Symantec/tricorder/go/tricorder"
 	"github.com/Symantec/tricorder/go/tricorder/units"
@@ -23,7 +27,21 @@ var (
 		"Name of file containing the root of trust")
 	certFile = flag.String("certFile", "/etc/ssl/imageserver/cert.pem",
 		"Name of file containing the SSL certificate")
-	debug    = flag.Bool("debug", false, "If true, show debugging output")
+	crlFile = flag.String("crlFile", "",
+		"Name of file containing CRLs for rejecting client certificates")
+	denyListFile = flag.String("denyListFile", "",
+		"Name of file containing denied certificate serials and usernames")
+	debug             = flag.Bool("debug", false, "If true, show debugging output")
+	getImageRateLimit = flag.Float64("getImageRateLimit", 0,
+		"Maximum GetImage calls per second for each user (0: unlimited)")
+	getObjectsConcurrencyLimit = flag.Uint("getObjectsConcurrencyLimit", 100,
+		"Maximum concurrent GetObjects calls (0: unlimited)")
+	getObjectsRateLimit = flag.Float64("getObjectsRateLimit", 0,
+		"Maximum GetObjects calls per second for each user (0: unlimited)")
+	groupPolicyFile = flag.String("groupPolicyFile", "",
+		"Name of file containing the methods and directories groups may use")
+	imageCacheSize = flag.Uint64("imageCacheSize", 1<<30,
+		"Maximum size (in bytes) of loaded images to cache (0: unlimited)")
 	imageDir = flag.String("imageDir", "/var/lib/imageserver",
 		"Name of image server data directory.")
 	imageServerHostname = flag.String("imageServerHostname", "",
@@ -31,16 +49,32 @@ var (
 	imageServerPortNum = flag.Uint("imageServerPortNum",
 		constants.ImageServerPortNumber,
 		"Port number of image server")
+	lintPolicyFile = flag.String("lintPolicyFile", "",
+		"Name of file containing image lint policy (default: no checks)")
 	logbufLines = flag.Uint("logbufLines", 1024,
 		"Number of lines to store in the log buffer")
 	keyFile = flag.String("keyFile", "/etc/ssl/imageserver/key.pem",
 		"Name of file containing the SSL key")
+	objectCompression = flag.String("objectCompression", "none",
+		"Compression for new objects which compress well (none, gzip)")
+	objectCompressionMinSize = flag.Uint64("objectCompressionMinSize", 4096,
+		"Minimum size of objects to compress")
 	objectDir = flag.String("objectDir", "/var/lib/objectserver",
 		"Name of image server data directory.")
 	portNum = flag.Uint("portNum", constants.ImageServerPortNumber,
 		"Port number to allocate and listen on for HTTP/RPC")
+	rejectLimitedCalls = flag.Bool("rejectLimitedCalls", false,
+		"If true, reject calls which reach a limit rather than queueing them")
+	replicationDirectories       flagutil.StringList
+	replicationMaxBytesPerSecond = flag.Uint64("replicationMaxBytesPerSecond",
+		0, "Maximum rate to download objects when replicating (0: unlimited)")
 )
 
+func init() {
+	flag.Var(&replicationDirectories, "replicationDirectories",
+		"Comma separated list of image directories to replicate (default all)")
+}
+
 type imageObjectServersType struct {
 	imdb   *scanner.ImageDataBase
 	objSrv *filesystem.ObjectServer
@@ -57,36 +91,108 @@ func main() {
 		fmt.Fprintln(os.Stderr, "-imageServerHostname required in archive mode")
 		os.Exit(1)
 	}
-	setupTls(*caFile, *certFile, *keyFile)
+	tlsLoader := setupTls(*caFile, *certFile, *keyFile)
 	circularBuffer := logbuf.New(*logbufLines)
 	logger := log.New(circularBuffer, "", log.LstdFlags)
+	if tlsLoader != nil {
+		tlsLoader.Watch(logger)
+	}
+	if err := setupRevocation(*crlFile, *denyListFile, logger); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load revocation lists\t%s\n", err)
+		os.Exit(1)
+	}
+	groupPolicy, err := setupGroupPolicy(*groupPolicyFile, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load group policy\t%s\n", err)
+		os.Exit(1)
+	}
+	compression, err := objectserver.ParseCompression(*objectCompression)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	objSrv, err := filesystem.NewObjectServer(*objectDir, logger)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Cannot create ObjectServer\t%s\n", err)
 		os.Exit(1)
 	}
+	objSrv.SetCompression(filesystem.CompressionParams{
+		Compression: compression,
+		MinSize:     *objectCompressionMinSize,
+	})
 	imdb, err := scanner.LoadImageDataBase(*imageDir, objSrv, logger)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Cannot load image database\t%s\n", err)
 		os.Exit(1)
 	}
+	imdb.SetImageCacheSize(*imageCacheSize)
+	if groupPolicy != nil {
+		imdb.SetDirectoryPolicy(groupPolicy)
+	}
 	tricorder.RegisterMetric("/image-count",
 		func() uint { return imdb.CountImages() },
 		units.None, "number of images")
-	imgSrvRpcHtmlWriter := imageserverRpcd.Setup(imdb, *imageServerHostname,
+	var lintPolicy *lint.Policy
+	if *lintPolicyFile != "" {
+		lintPolicy, err = lint.LoadPolicy(*lintPolicyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load lint policy\t%s\n", err)
+			os.Exit(1)
+		}
+	}
+	imgSrvRpcHtmlWriter := imageserverRpcd.SetupWithParams(imdb,
+		*imageServerHostname,
+		imageserverRpcd.Params{
+			LintPolicy: lintPolicy,
+			MethodPolicies: makeMethodPolicies("GetImage", 0,
+				*getImageRateLimit),
+		},
+		logger)
+	objSrvRpcHtmlWriter := objectserverRpcd.SetupWithParams(objSrv,
+		objectserverRpcd.Params{
+			DeleteObjects: imdb.DeleteUnreferencedObjects,
+			MethodPolicies: makeMethodPolicies("GetObjects",
+				*getObjectsConcurrencyLimit, *getObjectsRateLimit),
+		},
 		logger)
-	objSrvRpcHtmlWriter := objectserverRpcd.Setup(objSrv, logger)
 	httpd.AddHtmlWriter(imdb)
 	httpd.AddHtmlWriter(&imageObjectServersType{imdb, objSrv})
+	httpd.AddHtmlWriter(startGarbageCollector(imdb, logger))
+	var replicationMaster string
+	if *imageServerHostname != "" {
+		replicationMaster = fmt.Sprintf("%s:%d", *imageServerHostname,
+			*imageServerPortNum)
+		httpd.AddHtmlWriter(startReplicator(replicationMaster, imdb, objSrv,
+			*archiveMode, cleanDirectories(replicationDirectories),
+			*replicationMaxBytesPerSecond, logger))
+	}
+	if scrubber := startScrubber(objSrv, replicationMaster); scrubber != nil {
+		httpd.AddHtmlWriter(scrubber)
+	}
 	httpd.AddHtmlWriter(imgSrvRpcHtmlWriter)
 	httpd.AddHtmlWriter(objSrvRpcHtmlWriter)
-	httpd.AddHtmlWriter(circularBuffer)
-	if *imageServerHostname != "" {
-		go replicator(fmt.Sprintf("%s:%d", *imageServerHostname,
-			*imageServerPortNum), imdb, objSrv, *archiveMode, logger)
+	if tlsLoader != nil {
+		httpd.AddHtmlWriter(tlsLoader)
 	}
+	httpd.AddHtmlWriter(circularBuffer)
 	if err = httpd.StartServer(*portNum, imdb, objSrv, false); err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to create http server\t%s\n", err)
 		os.Exit(1)
 	}
 }
+
+func makeMethodPolicies(method string, maxConcurrent uint,
+	maxPerUserPerSecond float64) map[string]srpc.MethodPolicy {
+	burst := uint(maxPerUserPerSecond)
+	if burst < 1 {
+		burst = 1
+	}
+	return map[string]srpc.MethodPolicy{
+		method: {
+			MaxConcurrentCalls:       maxConcurrent,
+			MaxCallsPerUserPerSecond: maxPerUserPerSecond,
+			MaxBurstPerUser:          burst,
+			QueueWhenLimited:         !*rejectLimitedCalls,
+		},
+	}
+}
@@ -1,45 +1,80 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha512"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	imgclient "github.com/Symantec/Dominator/imageserver/client"
 	"github.com/Symantec/Dominator/imageserver/scanner"
-	"github.com/Symantec/Dominator/lib/filesystem"
 	"github.com/Symantec/Dominator/lib/hash"
 	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	fsdriver "github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/Dominator/lib/rateio"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/imageserver"
 	"io"
 	"log"
+	"path"
+	"strings"
 	"time"
 )
 
-func replicator(address string, imdb *scanner.ImageDataBase,
-	objSrv *fsdriver.ObjectServer, archiveMode bool, logger *log.Logger) {
+const (
+	objectBatchSize       = 1024
+	maxObjectBatchRetries = 4
+	retryFailedInterval   = time.Minute
+)
+
+func startReplicator(address string, imdb *scanner.ImageDataBase,
+	objSrv *fsdriver.ObjectServer, archiveMode bool, directories []string,
+	maxBytesPerSecond uint64, logger *log.Logger) *replicatorType {
+	r := &replicatorType{
+		address:     address,
+		archiveMode: archiveMode,
+		directories: directories,
+		imdb:        imdb,
+		objSrv:      objSrv,
+		logger:      logger,
+		images:      make(map[string]*replicationState),
+	}
+	if maxBytesPerSecond > 0 {
+		// The reader context limits to a percentage of the maximum speed and
+		// gets out of the way at 100%, so use half of twice the limit.
+		r.readerContext = rateio.NewReaderContext(maxBytesPerSecond*2, 50,
+			&rateio.ReadMeasurer{})
+	}
+	go r.loop()
+	go r.retryLoop()
+	return r
+}
+
+func (r *replicatorType) loop() {
 	initialTimeout := time.Second * 15
 	timeout := initialTimeout
 	var nextSleepStopTime time.Time
 	for {
 		nextSleepStopTime = time.Now().Add(timeout)
-		if client, err := srpc.DialHTTP("tcp", address, timeout); err != nil {
-			logger.Printf("Error dialling: %s %s\n", address, err)
+		if client, err := srpc.DialHTTP("tcp", r.address, timeout); err != nil {
+			r.logger.Printf("Error dialling: %s %s\n", r.address, err)
+			r.setConnectionError(err)
 		} else {
 			if conn, err := client.Call(
 				"ImageServer.GetImageUpdates"); err != nil {
-				logger.Println(err)
+				r.logger.Println(err)
+				r.setConnectionError(err)
 			} else {
-				if err := getUpdates(address, conn, imdb, objSrv, archiveMode,
-					logger); err != nil {
+				if err := r.getUpdates(conn); err != nil {
 					if err == io.EOF {
-						logger.Println("Connection to image replicator closed")
+						r.logger.Println("Connection to image replicator closed")
 						if nextSleepStopTime.Sub(time.Now()) < 1 {
 							timeout = initialTimeout
 						}
 					} else {
-						logger.Println(err)
+						r.logger.Println(err)
 					}
+					r.setConnectionError(err)
 				}
 				conn.Close()
 			}
@@ -52,12 +87,26 @@ func replicator(address string, imdb *scanner.ImageDataBase,
 	}
 }
 
-func getUpdates(address string, conn *srpc.Conn, imdb *scanner.ImageDataBase,
-	objSrv *fsdriver.ObjectServer, archiveMode bool, logger *log.Logger) error {
-	logger.Printf("Image replicator: connected to: %s\n", address)
-	decoder := gob.NewDecoder(conn)
+// retryLoop periodically retries images which failed to replicate, so that a
+// bad image does not hold up the update stream.
+func (r *replicatorType) retryLoop() {
+	for ; ; time.Sleep(retryFailedInterval) {
+		for _, name := range r.listFailedImages() {
+			if err := r.addImage(name); err != nil {
+				r.logger.Printf("Replicator(%s): %s\n", name, err)
+			}
+		}
+	}
+}
+
+func (r *replicatorType) getUpdates(reader io.Reader) error {
+	r.logger.Printf("Image replicator: connected to: %s\n", r.address)
+	r.setConnected()
+	decoder := gob.NewDecoder(reader)
+	initialChannels := make(map[string]struct{})
 	initialImages := make(map[string]struct{})
-	if archiveMode {
+	if r.archiveMode {
+		initialChannels = nil
 		initialImages = nil
 	}
 	for {
@@ -68,28 +117,37 @@ func getUpdates(address string, conn *srpc.Conn, imdb *scanner.ImageDataBase,
 			}
 			return errors.New("decode err: " + err.Error())
 		}
+		r.setLastUpdate()
 		switch imageUpdate.Operation {
 		case imageserver.OperationAddImage:
 			if imageUpdate.Name == "" {
 				if initialImages != nil {
-					deleteMissingImages(imdb, initialImages, logger)
+					r.deleteMissingChannels(initialChannels)
+					r.deleteMissingImages(initialImages)
+					initialChannels = nil
 					initialImages = nil
 				}
 				continue
 			}
+			if !r.isSelected(imageUpdate.Name) {
+				continue
+			}
 			if initialImages != nil {
 				initialImages[imageUpdate.Name] = struct{}{}
 			}
-			if err := addImage(address, imdb, objSrv, imageUpdate.Name,
-				logger); err != nil {
-				return err
+			if err := r.addImage(imageUpdate.Name); err != nil {
+				r.logger.Printf("Replicator(%s): %s\n", imageUpdate.Name, err)
 			}
 		case imageserver.OperationDeleteImage:
-			if archiveMode {
+			if r.archiveMode || !r.isSelected(imageUpdate.Name) {
 				continue
 			}
-			logger.Printf("Replicator(%s): delete image\n", imageUpdate.Name)
-			if err := imdb.DeleteImage(imageUpdate.Name, nil); err != nil {
+			r.forgetImage(imageUpdate.Name)
+			if !r.imdb.CheckImage(imageUpdate.Name) {
+				continue
+			}
+			r.logger.Printf("Replicator(%s): delete image\n", imageUpdate.Name)
+			if err := r.imdb.DeleteImage(imageUpdate.Name, nil); err != nil {
 				return err
 			}
 		case imageserver.OperationMakeDirectory:
@@ -97,42 +155,140 @@ func getUpdates(address string, conn *srpc.Conn, imdb *scanner.ImageDataBase,
 			if directory == nil {
 				return errors.New("nil imageUpdate.Directory")
 			}
-			if err := imdb.UpdateDirectory(*directory); err != nil {
+			if !r.isSelectedDirectory(directory.Name) {
+				continue
+			}
+			if err := r.imdb.UpdateDirectory(*directory); err != nil {
+				return err
+			}
+		case imageserver.OperationUpdateChannel:
+			channel := imageUpdate.Channel
+			if channel == nil {
+				return errors.New("nil imageUpdate.Channel")
+			}
+			if !r.isSelected(channel.Name) {
+				continue
+			}
+			if initialChannels != nil {
+				initialChannels[channel.Name] = struct{}{}
+			}
+			if !r.imdb.CheckImage(channel.ImageName) {
+				r.logger.Printf(
+					"Replicator(%s): skipping channel update to missing: %s\n",
+					channel.Name, channel.ImageName)
+				continue
+			}
+			r.logger.Printf("Replicator(%s): update channel to: %s\n",
+				channel.Name, channel.ImageName)
+			if err := r.imdb.UpdateChannel(*channel); err != nil {
+				return err
+			}
+		case imageserver.OperationDeleteChannel:
+			if r.archiveMode || !r.isSelected(imageUpdate.Name) {
+				continue
+			}
+			if r.imdb.GetChannel(imageUpdate.Name) == nil {
+				continue
+			}
+			r.logger.Printf("Replicator(%s): delete channel\n",
+				imageUpdate.Name)
+			if err := r.imdb.DeleteChannel(imageUpdate.Name, nil); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-func deleteMissingImages(imdb *scanner.ImageDataBase,
-	imagesToKeep map[string]struct{}, logger *log.Logger) {
+// isSelected returns true if the named image or channel is in one of the
+// directories being replicated.
+func (r *replicatorType) isSelected(name string) bool {
+	if len(r.directories) < 1 {
+		return true
+	}
+	for _, directory := range r.directories {
+		if name == directory || strings.HasPrefix(name, directory+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isSelectedDirectory returns true if the directory is being replicated or is
+// needed to hold a directory which is being replicated.
+func (r *replicatorType) isSelectedDirectory(name string) bool {
+	if r.isSelected(name) {
+		return true
+	}
+	for _, directory := range r.directories {
+		if strings.HasPrefix(directory, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *replicatorType) deleteMissingChannels(
+	channelsToKeep map[string]struct{}) {
+	for _, channelName := range r.imdb.ListChannels() {
+		if !r.isSelected(channelName) {
+			continue
+		}
+		if _, ok := channelsToKeep[channelName]; ok {
+			continue
+		}
+		r.logger.Printf("Replicator(%s): delete missing channel\n",
+			channelName)
+		if err := r.imdb.DeleteChannel(channelName, nil); err != nil {
+			r.logger.Println(err)
+		}
+	}
+}
+
+func (r *replicatorType) deleteMissingImages(
+	imagesToKeep map[string]struct{}) {
 	missingImages := make([]string, 0)
-	for _, imageName := range imdb.ListImages() {
+	for _, imageName := range r.imdb.ListImages() {
+		if !r.isSelected(imageName) {
+			continue
+		}
 		if _, ok := imagesToKeep[imageName]; !ok {
 			missingImages = append(missingImages, imageName)
 		}
 	}
 	for _, imageName := range missingImages {
-		logger.Printf("Replicator(%s): delete missing image\n", imageName)
-		if err := imdb.DeleteImage(imageName, nil); err != nil {
-			logger.Println(err)
+		r.logger.Printf("Replicator(%s): delete missing image\n", imageName)
+		r.forgetImage(imageName)
+		if err := r.imdb.DeleteImage(imageName, nil); err != nil {
+			r.logger.Println(err)
 		}
 	}
 }
 
-func addImage(address string, imdb *scanner.ImageDataBase,
-	objSrv *fsdriver.ObjectServer, name string, logger *log.Logger) error {
-	timeout := time.Second * 60
-	if imdb.CheckImage(name) {
+// addImage replicates one image at a time, so that the retry loop and the
+// update stream share the bandwidth limit.
+func (r *replicatorType) addImage(name string) error {
+	r.addLock.Lock()
+	defer r.addLock.Unlock()
+	if r.imdb.CheckImage(name) {
 		return nil
 	}
+	state := r.startImage(name)
+	err := r.replicateImage(name, state)
+	r.finishImage(name, err)
+	return err
+}
+
+func (r *replicatorType) replicateImage(name string,
+	state *replicationState) error {
+	timeout := time.Second * 60
+	logger := r.logger
 	logger.Printf("Replicator(%s): add image\n", name)
-	client, err := srpc.DialHTTP("tcp", address, timeout)
+	client, err := srpc.DialHTTP("tcp", r.address, timeout)
 	if err != nil {
 		return err
 	}
-	defer client.Close()
 	img, err := imgclient.GetImage(client, name)
+	client.Close()
 	if err != nil {
 		return err
 	}
@@ -141,30 +297,35 @@ func addImage(address string, imdb *scanner.ImageDataBase,
 	}
 	logger.Printf("Replicator(%s): downloaded image\n", name)
 	img.FileSystem.RebuildInodePointers()
-	if err := getMissingObjects(address, objSrv, img.FileSystem,
-		logger); err != nil {
+	if err := r.getMissingObjects(name, img.ListObjects(), state); err != nil {
 		return err
 	}
-	if err := imdb.AddImage(img, name, nil); err != nil {
-		return err
+	if err := r.imdb.AddImage(img, name, nil); err != nil {
+		// Objects which were already present may have been garbage collected
+		// since they were checked. Fetch them and try once more.
+		missingObjects, e := r.findMissingObjects(img.ListObjects())
+		if e != nil || len(missingObjects) < 1 {
+			return err
+		}
+		logger.Printf("Replicator(%s): %d objects disappeared, retrying\n",
+			name, len(missingObjects))
+		err = r.getMissingObjects(name, missingObjects, state)
+		if err != nil {
+			return err
+		}
+		if err := r.imdb.AddImage(img, name, nil); err != nil {
+			return err
+		}
 	}
 	logger.Printf("Replicator(%s): added image\n", name)
 	return nil
 }
 
-func getMissingObjects(address string, objSrv *fsdriver.ObjectServer,
-	fs *filesystem.FileSystem, logger *log.Logger) error {
-	hashes := make([]hash.Hash, 0, fs.NumRegularInodes)
-	for _, inode := range fs.InodeTable {
-		if inode, ok := inode.(*filesystem.RegularInode); ok {
-			if inode.Size > 0 {
-				hashes = append(hashes, inode.Hash)
-			}
-		}
-	}
-	objectSizes, err := objSrv.CheckObjects(hashes)
+func (r *replicatorType) findMissingObjects(hashes []hash.Hash) (
+	[]hash.Hash, error) {
+	objectSizes, err := r.objSrv.CheckObjects(hashes)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	missingObjects := make([]hash.Hash, 0)
 	for index, size := range objectSizes {
@@ -172,27 +333,135 @@ func getMissingObjects(address string, objSrv *fsdriver.ObjectServer,
 			missingObjects = append(missingObjects, hashes[index])
 		}
 	}
+	return missingObjects, nil
+}
+
+// getMissingObjects fetches the objects which are not already present in
+// batches. Objects are stored as they arrive, so a failed batch is retried
+// from where it stopped rather than from the beginning.
+func (r *replicatorType) getMissingObjects(name string, hashes []hash.Hash,
+	state *replicationState) error {
+	missingObjects, err := r.findMissingObjects(hashes)
+	if err != nil {
+		return err
+	}
+	r.setNumObjects(state, uint64(len(hashes)),
+		uint64(len(hashes)-len(missingObjects)))
 	if len(missingObjects) < 1 {
 		return nil
 	}
-	logger.Printf("Replicator: downloading %d of %d objects\n",
-		len(missingObjects), len(hashes))
-	objClient := objectclient.NewObjectClient(address)
-	objectsReader, err := objClient.GetObjects(missingObjects)
+	r.logger.Printf("Replicator(%s): downloading %d of %d objects\n",
+		name, len(missingObjects), len(hashes))
+	objClient := objectclient.NewObjectClient(r.address)
+	for len(missingObjects) > 0 {
+		batch := missingObjects
+		if len(batch) > objectBatchSize {
+			batch = batch[:objectBatchSize]
+		}
+		if err := r.getBatch(name, objClient, batch, state); err != nil {
+			return err
+		}
+		missingObjects = missingObjects[len(batch):]
+	}
+	return nil
+}
+
+func (r *replicatorType) getBatch(name string,
+	objClient *objectclient.ObjectClient, batch []hash.Hash,
+	state *replicationState) error {
+	sleepTime := time.Second
+	for retry := 0; ; retry++ {
+		missingObjects, err := r.findMissingObjects(batch)
+		if err != nil {
+			return err
+		}
+		if err = r.getObjects(objClient, missingObjects, state); err == nil {
+			return r.verifyObjects(missingObjects)
+		}
+		if retry >= maxObjectBatchRetries {
+			return err
+		}
+		r.logger.Printf("Replicator(%s): retrying batch: %s\n", name, err)
+		time.Sleep(sleepTime)
+		sleepTime *= 2
+	}
+}
+
+func (r *replicatorType) getObjects(objClient *objectclient.ObjectClient,
+	hashes []hash.Hash, state *replicationState) error {
+	if len(hashes) < 1 {
+		return nil
+	}
+	objectsReader, err := objClient.GetObjects(hashes)
 	if err != nil {
 		return err
 	}
 	defer objectsReader.Close()
-	for _, hash := range missingObjects {
+	for _, hashVal := range hashes {
 		length, reader, err := objectsReader.NextObject()
 		if err != nil {
 			return err
 		}
-		_, _, err = objSrv.AddObject(reader, length, &hash)
+		var rd io.Reader = reader
+		if r.readerContext != nil {
+			rd = r.readerContext.NewReader(reader)
+		}
+		// The object server verifies the data against the expected hash.
+		_, _, err = r.objSrv.AddObject(rd, length, &hashVal)
 		reader.Close()
 		if err != nil {
 			return err
 		}
+		r.addObjectDone(state, length)
 	}
 	return nil
 }
+
+// verifyObjects reads back the objects which were written and checks their
+// hashes. Corrupt objects are deleted so that they will be fetched again.
+func (r *replicatorType) verifyObjects(hashes []hash.Hash) error {
+	if len(hashes) < 1 {
+		return nil
+	}
+	objectsReader, err := r.objSrv.GetObjects(hashes)
+	if err != nil {
+		return err
+	}
+	defer objectsReader.Close()
+	var firstError error
+	for _, hashVal := range hashes {
+		_, reader, err := objectsReader.NextObject()
+		if err != nil {
+			return err
+		}
+		hasher := sha512.New()
+		_, err = io.Copy(hasher, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hasher.Sum(nil), hashVal[:]) {
+			r.logger.Printf("Replicator: object: %x failed verification\n",
+				hashVal)
+			if _, err := r.objSrv.DeleteStaleObject(hashVal, 0); err != nil {
+				r.logger.Println(err)
+			}
+			if firstError == nil {
+				firstError = fmt.Errorf("object: %x failed verification",
+					hashVal)
+			}
+		}
+	}
+	return firstError
+}
+
+func cleanDirectories(directories []string) []string {
+	cleaned := make([]string, 0, len(directories))
+	for _, directory := range directories {
+		directory = strings.Trim(path.Clean(directory), "/")
+		if directory != "" && directory != "." {
+			cleaned = append(cleaned, directory)
+		}
+	}
+	return cleaned
+}
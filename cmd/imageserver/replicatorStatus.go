@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/scanner"
+	"github.com/Symantec/Dominator/lib/format"
+	fsdriver "github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/Dominator/lib/rateio"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const numRecentImagesToShow = 10
+
+const (
+	replicationStateDownloading = iota
+	replicationStateFailed
+	replicationStateReplicated
+)
+
+type replicatorType struct {
+	address       string
+	archiveMode   bool
+	directories   []string
+	imdb          *scanner.ImageDataBase
+	objSrv        *fsdriver.ObjectServer
+	logger        *log.Logger
+	readerContext *rateio.ReaderContext // nil: no limit.
+	addLock       sync.Mutex            // Serialises image downloads.
+	sync.Mutex                          // Protects everything below.
+	connected     bool
+	connectError  error
+	lastUpdate    time.Time
+	images        map[string]*replicationState
+}
+
+type replicationState struct {
+	name        string
+	state       uint
+	firstSeen   time.Time // When the image was first seen in the update stream.
+	finishTime  time.Time
+	numAttempts uint
+	numObjects  uint64
+	objectsDone uint64
+	bytesDone   uint64
+	err         error
+}
+
+type replicationStateList []*replicationState
+
+func (list replicationStateList) Len() int { return len(list) }
+
+func (list replicationStateList) Less(left, right int) bool {
+	if list[left].state != list[right].state {
+		return list[left].state < list[right].state
+	}
+	if list[left].state == replicationStateReplicated {
+		return list[left].finishTime.After(list[right].finishTime)
+	}
+	return list[left].name < list[right].name
+}
+
+func (list replicationStateList) Swap(left, right int) {
+	list[left], list[right] = list[right], list[left]
+}
+
+// lag returns the time between the image being seen in the update stream and
+// it being available locally (or now, if it is not yet available).
+func (state *replicationState) lag() time.Duration {
+	if state.state == replicationStateReplicated {
+		return state.finishTime.Sub(state.firstSeen)
+	}
+	return time.Since(state.firstSeen)
+}
+
+func (state *replicationState) stateString() string {
+	switch state.state {
+	case replicationStateDownloading:
+		return "downloading"
+	case replicationStateFailed:
+		return "failed"
+	case replicationStateReplicated:
+		return "replicated"
+	}
+	return "unknown"
+}
+
+func (r *replicatorType) setConnected() {
+	r.Lock()
+	defer r.Unlock()
+	r.connected = true
+	r.connectError = nil
+}
+
+func (r *replicatorType) setConnectionError(err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.connected = false
+	r.connectError = err
+}
+
+func (r *replicatorType) setLastUpdate() {
+	r.Lock()
+	defer r.Unlock()
+	r.lastUpdate = time.Now()
+}
+
+func (r *replicatorType) startImage(name string) *replicationState {
+	r.Lock()
+	defer r.Unlock()
+	state := r.images[name]
+	if state == nil {
+		state = &replicationState{name: name, firstSeen: time.Now()}
+		r.images[name] = state
+	}
+	state.state = replicationStateDownloading
+	state.numAttempts++
+	state.err = nil
+	return state
+}
+
+func (r *replicatorType) finishImage(name string, err error) {
+	r.Lock()
+	defer r.Unlock()
+	state := r.images[name]
+	if state == nil {
+		return
+	}
+	state.finishTime = time.Now()
+	if err == nil {
+		state.state = replicationStateReplicated
+	} else {
+		state.state = replicationStateFailed
+		state.err = err
+	}
+}
+
+func (r *replicatorType) forgetImage(name string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.images, name)
+}
+
+func (r *replicatorType) listFailedImages() []string {
+	r.Lock()
+	defer r.Unlock()
+	var names []string
+	for name, state := range r.images {
+		if state.state == replicationStateFailed {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *replicatorType) setNumObjects(state *replicationState,
+	numObjects, objectsDone uint64) {
+	r.Lock()
+	defer r.Unlock()
+	state.numObjects = numObjects
+	state.objectsDone = objectsDone
+}
+
+func (r *replicatorType) addObjectDone(state *replicationState,
+	length uint64) {
+	r.Lock()
+	defer r.Unlock()
+	state.objectsDone++
+	state.bytesDone += length
+}
+
+func (r *replicatorType) WriteHtml(writer io.Writer) {
+	r.Lock()
+	defer r.Unlock()
+	fmt.Fprintf(writer, "Replicating from: %s", r.address)
+	if len(r.directories) > 0 {
+		fmt.Fprintf(writer, " (directories: %s)",
+			strings.Join(r.directories, ", "))
+	}
+	if r.readerContext != nil {
+		fmt.Fprintf(writer, ", limit: %s/s",
+			format.FormatBytes(r.readerContext.MaximumSpeed()/2))
+	}
+	if r.connected {
+		fmt.Fprint(writer, ", connected")
+	} else if r.connectError != nil {
+		fmt.Fprintf(writer, ", <font color=\"red\">disconnected: %s</font>",
+			r.connectError)
+	} else {
+		fmt.Fprint(writer, ", connecting")
+	}
+	if !r.lastUpdate.IsZero() {
+		fmt.Fprintf(writer, ", last update: %s ago",
+			format.Duration(time.Since(r.lastUpdate)))
+	}
+	fmt.Fprintln(writer, "<br>")
+	states := make(replicationStateList, 0, len(r.images))
+	for _, state := range r.images {
+		states = append(states, state)
+	}
+	if len(states) < 1 {
+		return
+	}
+	sort.Sort(states)
+	fmt.Fprintln(writer, "<table border=\"1\">")
+	fmt.Fprintln(writer, "  <tr>")
+	fmt.Fprintln(writer, "    <th>Image</th>")
+	fmt.Fprintln(writer, "    <th>State</th>")
+	fmt.Fprintln(writer, "    <th>Objects</th>")
+	fmt.Fprintln(writer, "    <th>Downloaded</th>")
+	fmt.Fprintln(writer, "    <th>Attempts</th>")
+	fmt.Fprintln(writer, "    <th>Lag</th>")
+	fmt.Fprintln(writer, "    <th>Error</th>")
+	fmt.Fprintln(writer, "  </tr>")
+	numReplicated := 0
+	for _, state := range states {
+		if state.state == replicationStateReplicated {
+			if numReplicated >= numRecentImagesToShow {
+				break
+			}
+			numReplicated++
+		}
+		fmt.Fprintln(writer, "  <tr>")
+		fmt.Fprintf(writer,
+			"    <td><a href=\"showImage?%s\">%s</a></td>\n",
+			state.name, state.name)
+		fmt.Fprintf(writer, "    <td>%s</td>\n", state.stateString())
+		fmt.Fprintf(writer, "    <td>%d/%d</td>\n",
+			state.objectsDone, state.numObjects)
+		fmt.Fprintf(writer, "    <td>%s</td>\n",
+			format.FormatBytes(state.bytesDone))
+		fmt.Fprintf(writer, "    <td>%d</td>\n", state.numAttempts)
+		fmt.Fprintf(writer, "    <td>%s</td>\n", format.Duration(state.lag()))
+		if state.err == nil {
+			fmt.Fprintln(writer, "    <td></td>")
+		} else {
+			fmt.Fprintf(writer, "    <td>%s</td>\n", state.err)
+		}
+		fmt.Fprintln(writer, "  </tr>")
+	}
+	fmt.Fprintln(writer, "</table>")
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"github.com/Symantec/Dominator/imageserver/scanner"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectcache"
+	fsdriver "github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"io"
+	"io/ioutil"
+	"log"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newTestReplicator(t *testing.T, archiveMode bool,
+	directories []string) *replicatorType {
+	logger := log.New(ioutil.Discard, "", 0)
+	objectDir := t.TempDir()
+	objSrv, err := fsdriver.NewObjectServer(objectDir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imdb, err := scanner.LoadImageDataBase(t.TempDir(), objSrv, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &replicatorType{
+		address:     objectDir, // Only used for display.
+		archiveMode: archiveMode,
+		directories: cleanDirectories(directories),
+		imdb:        imdb,
+		objSrv:      objSrv,
+		logger:      logger,
+		images:      make(map[string]*replicationState),
+	}
+}
+
+// addTestImage adds an image with one file, containing the image name.
+func (r *replicatorType) addTestImage(t *testing.T, name string) {
+	if dirname := path.Dir(name); dirname != "." &&
+		!r.hasDirectory(dirname) {
+		err := r.imdb.UpdateDirectory(image.Directory{Name: dirname})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hashVal, _, err := r.objSrv.AddObject(bytes.NewBufferString(name),
+		uint64(len(name)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			2: &filesystem.RegularInode{Mode: filesystem.FileMode(0644),
+				Size: uint64(len(name)), Hash: hashVal},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{Name: "name", InodeNumber: 2},
+			},
+			Mode: filesystem.FileMode(0755),
+		},
+		NumRegularInodes: 1,
+		TotalDataBytes:   uint64(len(name)),
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		t.Fatal(err)
+	}
+	img := &image.Image{FileSystem: fs}
+	if err := r.imdb.AddImage(img, name, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (r *replicatorType) hasDirectory(name string) bool {
+	for _, directory := range r.imdb.ListDirectories() {
+		if directory.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *replicatorType) listChannels() map[string]string {
+	channels := make(map[string]string)
+	for _, name := range r.imdb.ListChannels() {
+		channels[name] = r.imdb.GetChannel(name).ImageName
+	}
+	return channels
+}
+
+func TestCleanDirectories(t *testing.T) {
+	got := cleanDirectories([]string{"/web/", "db//prod", "/", ".", ""})
+	if want := []string{"web", "db/prod"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestIsSelected(t *testing.T) {
+	r := &replicatorType{directories: []string{"web", "db/prod"}}
+	var tests = []struct {
+		name              string
+		selected          bool
+		selectedDirectory bool
+	}{
+		{"web", true, true},
+		{"web/1", true, true},
+		{"webserver/1", false, false},
+		{"db", false, true},
+		{"db/prod/1", true, true},
+		{"db/dev/1", false, false},
+		{"base", false, false},
+	}
+	for _, test := range tests {
+		if got := r.isSelected(test.name); got != test.selected {
+			t.Errorf("isSelected(%s)=%v", test.name, got)
+		}
+		if got := r.isSelectedDirectory(test.name); got !=
+			test.selectedDirectory {
+			t.Errorf("isSelectedDirectory(%s)=%v", test.name, got)
+		}
+	}
+	r.directories = nil
+	if !r.isSelected("anything") {
+		t.Error("image not selected with no directories")
+	}
+}
+
+func encodeUpdates(t *testing.T, updates []imageserver.ImageUpdate) io.Reader {
+	buffer := &bytes.Buffer{}
+	encoder := gob.NewEncoder(buffer)
+	for _, update := range updates {
+		if err := encoder.Encode(update); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer
+}
+
+func TestGetUpdates(t *testing.T) {
+	// Images which are already present are not fetched, so no server is
+	// needed.
+	updates := []imageserver.ImageUpdate{
+		{Operation: imageserver.OperationMakeDirectory,
+			Directory: &image.Directory{Name: "web"}},
+		{Operation: imageserver.OperationAddImage, Name: "web/1"},
+		{Operation: imageserver.OperationAddImage, Name: "db/1"},
+		{Operation: imageserver.OperationUpdateChannel,
+			Channel: &image.Channel{Name: "web/stable", ImageName: "web/1"}},
+		{Operation: imageserver.OperationUpdateChannel,
+			Channel: &image.Channel{Name: "web/beta", ImageName: "web/9"}},
+		{Operation: imageserver.OperationAddImage}, // End of initial list.
+		{Operation: imageserver.OperationMakeDirectory,
+			Directory: &image.Directory{Name: "web/new"}},
+		{Operation: imageserver.OperationMakeDirectory,
+			Directory: &image.Directory{Name: "other"}},
+		{Operation: imageserver.OperationDeleteChannel, Name: "web/stable"},
+		{Operation: imageserver.OperationDeleteChannel, Name: "db/stable"},
+		{Operation: imageserver.OperationDeleteImage, Name: "web/1"},
+		{Operation: imageserver.OperationDeleteImage, Name: "db/1"},
+	}
+	var tests = []struct {
+		name            string
+		archiveMode     bool
+		directories     []string
+		wantImages      []string
+		wantChannels    map[string]string
+		wantDirectories []string
+	}{
+		{
+			name:            "selected directory",
+			directories:     []string{"web"},
+			wantImages:      []string{"db/1"},
+			wantChannels:    map[string]string{"db/stable": "db/1"},
+			wantDirectories: []string{"db", "web", "web/new"},
+		},
+		{
+			name:        "archive mode",
+			archiveMode: true,
+			directories: []string{"web"},
+			wantImages:  []string{"db/1", "web/1", "web/2"},
+			wantChannels: map[string]string{"db/stable": "db/1",
+				"web/old": "web/2", "web/stable": "web/1"},
+			wantDirectories: []string{"db", "web", "web/new"},
+		},
+		{
+			name:            "all directories",
+			wantImages:      []string{},
+			wantChannels:    map[string]string{},
+			wantDirectories: []string{"db", "other", "web", "web/new"},
+		},
+	}
+	for _, test := range tests {
+		r := newTestReplicator(t, test.archiveMode, test.directories)
+		for _, name := range []string{"web/1", "web/2", "db/1"} {
+			r.addTestImage(t, name)
+		}
+		for channel, imageName := range map[string]string{
+			"web/old": "web/2", "db/stable": "db/1"} {
+			err := r.imdb.UpdateChannel(image.Channel{Name: channel,
+				ImageName: imageName})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := r.getUpdates(encodeUpdates(t, updates)); err != io.EOF {
+			t.Errorf("%s: error: %v", test.name, err)
+		}
+		images := r.imdb.ListImages()
+		sort.Strings(images)
+		if !reflect.DeepEqual(images, test.wantImages) {
+			t.Errorf("%s: images: %v, want: %v", test.name, images,
+				test.wantImages)
+		}
+		if got := r.listChannels(); !reflect.DeepEqual(got,
+			test.wantChannels) {
+			t.Errorf("%s: channels: %v, want: %v", test.name, got,
+				test.wantChannels)
+		}
+		var directories []string
+		for _, directory := range r.imdb.ListDirectories() {
+			if directory.Name != "." { // The top-level directory.
+				directories = append(directories, directory.Name)
+			}
+		}
+		sort.Strings(directories)
+		if !reflect.DeepEqual(directories, test.wantDirectories) {
+			t.Errorf("%s: directories: %v, want: %v", test.name,
+				directories, test.wantDirectories)
+		}
+	}
+}
+
+func TestGetUpdatesRejectsBadUpdates(t *testing.T) {
+	for _, update := range []imageserver.ImageUpdate{
+		{Operation: imageserver.OperationMakeDirectory},
+		{Operation: imageserver.OperationUpdateChannel},
+	} {
+		r := newTestReplicator(t, false, nil)
+		err := r.getUpdates(encodeUpdates(t,
+			[]imageserver.ImageUpdate{update}))
+		if err == nil || err == io.EOF {
+			t.Errorf("operation: %d: error: %v", update.Operation, err)
+		}
+	}
+}
+
+func TestVerifyObjects(t *testing.T) {
+	r := newTestReplicator(t, false, nil)
+	var hashes []hash.Hash
+	for _, data := range []string{"good object", "corrupt object"} {
+		hashVal, _, err := r.objSrv.AddObject(bytes.NewBufferString(data),
+			uint64(len(data)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hashVal)
+	}
+	if err := r.verifyObjects(hashes); err != nil {
+		t.Fatal(err)
+	}
+	filename := path.Join(r.address, objectcache.HashToFilename(hashes[1]))
+	if err := ioutil.WriteFile(filename, []byte("CORRUPT object"),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	err := r.verifyObjects(hashes)
+	if err == nil || !strings.Contains(err.Error(), "failed verification") {
+		t.Errorf("error: %v", err)
+	}
+	missing, err := r.findMissingObjects(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(missing, hashes[1:]) {
+		t.Errorf("missing: %x, want: %x", missing, hashes[1:])
+	}
+}
+
+func TestReplicationStates(t *testing.T) {
+	r := &replicatorType{images: make(map[string]*replicationState)}
+	for _, name := range []string{"b", "a", "c"} {
+		state := r.startImage(name)
+		r.setNumObjects(state, 3, 1)
+		r.addObjectDone(state, 100)
+	}
+	r.finishImage("a", errors.New("failed"))
+	r.finishImage("b", errors.New("failed"))
+	r.finishImage("c", nil)
+	if got := r.listFailedImages(); !reflect.DeepEqual(got,
+		[]string{"a", "b"}) {
+		t.Errorf("failed images: %v", got)
+	}
+	// A retry counts as another attempt and clears the error.
+	state := r.startImage("a")
+	if state.numAttempts != 2 || state.err != nil ||
+		state.stateString() != "downloading" {
+		t.Errorf("retry: %+v", *state)
+	}
+	if state.objectsDone != 2 || state.bytesDone != 100 {
+		t.Errorf("progress: %d objects, %d bytes", state.objectsDone,
+			state.bytesDone)
+	}
+	r.forgetImage("b")
+	if got := r.listFailedImages(); len(got) != 0 {
+		t.Errorf("failed images: %v", got)
+	}
+	var states replicationStateList
+	for _, state := range r.images {
+		states = append(states, state)
+	}
+	sort.Sort(states)
+	if states[0].name != "a" || states[1].name != "c" ||
+		states[1].stateString() != "replicated" {
+		t.Errorf("order: %s (%s), %s (%s)", states[0].name,
+			states[0].stateString(), states[1].name, states[1].stateString())
+	}
+	buffer := &bytes.Buffer{}
+	r.WriteHtml(buffer)
+	if !strings.Contains(buffer.String(), "downloading") {
+		t.Errorf("status page: %s", buffer.String())
+	}
+}
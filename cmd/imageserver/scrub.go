@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"os"
+)
+
+var (
+	scrubInterval = flag.Duration("scrubInterval", 0,
+		"Minimum interval between passes verifying all objects (0 disables)")
+	scrubMaxBytesPerSecond = flag.Uint64("scrubMaxBytesPerSecond", 10<<20,
+		"Maximum rate to read objects when verifying (0: unlimited)")
+)
+
+// startScrubber starts the object scrubber, fetching good copies of corrupt
+// objects from the replication master (if any). It returns nil if scrubbing is
+// disabled.
+func startScrubber(objSrv *filesystem.ObjectServer,
+	replicaAddress string) *filesystem.Scrubber {
+	if *scrubInterval <= 0 {
+		return nil
+	}
+	params := filesystem.ScrubberParams{
+		Interval:          *scrubInterval,
+		MaxBytesPerSecond: *scrubMaxBytesPerSecond,
+	}
+	if replicaAddress != "" {
+		params.Replica = client.NewObjectClient(replicaAddress)
+	}
+	scrubber := objSrv.StartScrubber(params)
+	dir, err := tricorder.RegisterDirectory("/scrubber")
+	if err == nil {
+		err = scrubber.RegisterMetrics(dir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to register scrubber metrics\t%s\n",
+			err)
+		os.Exit(1)
+	}
+	return scrubber
+}
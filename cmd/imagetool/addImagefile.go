@@ -14,6 +14,7 @@ import (
 	"github.com/Symantec/Dominator/lib/image"
 	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/x509util"
 	"io"
 	"os"
 	"strings"
@@ -57,15 +58,46 @@ func addImagefile(imageSClient *srpc.Client,
 }
 
 func addImage(imageSClient *srpc.Client, name string, img *image.Image) error {
+	if len(labels) > 0 {
+		if img.Labels == nil {
+			img.Labels = make(map[string]string, len(labels))
+		}
+		for key, value := range labels {
+			img.Labels[key] = value
+		}
+	}
 	if err := img.Verify(); err != nil {
 		return err
 	}
 	if err := img.VerifyRequiredPaths(requiredPaths); err != nil {
 		return err
 	}
-	if err := client.AddImage(imageSClient, name, img); err != nil {
+	// Any signatures or package inventory copied from a base image are no
+	// longer valid.
+	img.Signatures = nil
+	img.Packages = nil
+	if *packageInventory {
+		_, objectClient := getClients()
+		if err := makePackageInventory(img, objectClient); err != nil {
+			return err
+		}
+	}
+	if *signingKeyFile != "" {
+		signer, err := x509util.LoadPrivateKey(*signingKeyFile)
+		if err != nil {
+			return errors.New("error loading signing key: " + err.Error())
+		}
+		if err := img.Sign(signer); err != nil {
+			return errors.New("error signing image: " + err.Error())
+		}
+	}
+	warnings, err := client.AddImageWithWarnings(imageSClient, name, img)
+	if err != nil {
 		return errors.New("remote error: " + err.Error())
 	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
 	return nil
 }
 
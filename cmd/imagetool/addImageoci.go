@@ -0,0 +1,282 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filesystem/untar"
+	"github.com/Symantec/Dominator/lib/filter"
+	"github.com/Symantec/Dominator/lib/image"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// An ociSource provides access to the files of an OCI image layout or a
+// "docker save" archive, either of which may be a directory or a tarfile.
+type ociSource interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+type directorySource string
+
+type tarfileSource string
+
+type tarMemberReader struct {
+	io.Reader
+	file *os.File
+}
+
+type ociDescriptor struct {
+	MediaType string
+	Digest    string
+	Platform  *struct {
+		Architecture string
+		OS           string
+	}
+}
+
+type ociManifest struct {
+	MediaType string
+	Manifests []ociDescriptor // Only present for an index.
+	Layers    []ociDescriptor
+}
+
+type dockerManifest struct {
+	Layers []string
+}
+
+func addImageociSubcommand(args []string) {
+	imageSClient, objectClient := getClients()
+	err := addImageoci(imageSClient, objectClient, args[0], args[1], args[2],
+		args[3])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding image: \"%s\"\t%s\n", args[0], err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func addImageoci(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient,
+	name, sourceName, filterFilename, triggersFilename string) error {
+	imageExists, err := client.CheckImage(imageSClient, name)
+	if err != nil {
+		return errors.New("error checking for image existance: " + err.Error())
+	}
+	if imageExists {
+		return errors.New("image exists")
+	}
+	newImage := new(image.Image)
+	if err := loadImageFiles(newImage, objectClient, filterFilename,
+		triggersFilename); err != nil {
+		return err
+	}
+	fi, err := os.Stat(sourceName)
+	if err != nil {
+		return err
+	}
+	var source ociSource
+	if fi.IsDir() {
+		source = directorySource(sourceName)
+	} else {
+		source = tarfileSource(sourceName)
+	}
+	newImage.FileSystem, err = buildImageFromLayers(imageSClient,
+		newImage.Filter, source)
+	if err != nil {
+		return errors.New("error building image: " + err.Error())
+	}
+	if err := spliceComputedFiles(newImage.FileSystem); err != nil {
+		return err
+	}
+	return addImage(imageSClient, name, newImage)
+}
+
+func buildImageFromLayers(imageSClient *srpc.Client, filter *filter.Filter,
+	source ociSource) (*filesystem.FileSystem, error) {
+	layerNames, err := getLayerNames(source, *architecture)
+	if err != nil {
+		return nil, err
+	}
+	var h hasher
+	h.objQ, err = objectclient.NewObjectAdderQueue(imageSClient)
+	if err != nil {
+		return nil, err
+	}
+	decoder := untar.NewLayerDecoder(&h, filter)
+	for _, layerName := range layerNames {
+		if err := addLayer(decoder, source, layerName); err != nil {
+			h.objQ.Close()
+			return nil, fmt.Errorf("error adding layer: %s: %s", layerName,
+				err)
+		}
+	}
+	if err := h.objQ.Close(); err != nil {
+		return nil, err
+	}
+	return decoder.FileSystem(), nil
+}
+
+func addLayer(decoder *untar.LayerDecoder, source ociSource,
+	layerName string) error {
+	file, err := source.Open(layerName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(4)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	var layerReader io.Reader = reader
+	if bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		layerReader = gzipReader
+	} else if bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		return errors.New("zstd compressed layers are not supported")
+	}
+	return decoder.AddLayer(tar.NewReader(layerReader))
+}
+
+// Get the names of the layer files, lowest layer first. A "docker save"
+// manifest is preferred, since newer versions of docker write both formats.
+func getLayerNames(source ociSource, architecture string) ([]string, error) {
+	var dockerManifests []dockerManifest
+	err := readJson(source, "manifest.json", &dockerManifests)
+	if err == nil {
+		if len(dockerManifests) != 1 {
+			return nil, fmt.Errorf("%d images in archive, expected 1",
+				len(dockerManifests))
+		}
+		return dockerManifests[0].Layers, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err := readJson(source, "index.json", &manifest); err != nil {
+		return nil, err
+	}
+	// Follow the index(es) to an image manifest.
+	for len(manifest.Manifests) > 0 {
+		descriptor, err := selectManifest(manifest.Manifests, architecture)
+		if err != nil {
+			return nil, err
+		}
+		blobName, err := getBlobName(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		manifest = ociManifest{}
+		if err := readJson(source, blobName, &manifest); err != nil {
+			return nil, err
+		}
+	}
+	if len(manifest.Layers) < 1 {
+		return nil, errors.New("no layers in image manifest")
+	}
+	layerNames := make([]string, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		blobName, err := getBlobName(layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layerNames = append(layerNames, blobName)
+	}
+	return layerNames, nil
+}
+
+// selectManifest returns the manifest for Linux on architecture. If no
+// manifest gives a platform, the first one is returned.
+func selectManifest(descriptors []ociDescriptor,
+	architecture string) (ociDescriptor, error) {
+	havePlatform := false
+	for _, descriptor := range descriptors {
+		if descriptor.Platform == nil {
+			continue
+		}
+		havePlatform = true
+		if descriptor.Platform.OS == "linux" &&
+			descriptor.Platform.Architecture == architecture {
+			return descriptor, nil
+		}
+	}
+	if havePlatform {
+		return ociDescriptor{},
+			errors.New("no image manifest for linux/" + architecture)
+	}
+	return descriptors[0], nil
+}
+
+func getBlobName(digest string) (string, error) {
+	fields := strings.SplitN(digest, ":", 2)
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" ||
+		strings.Contains(fields[1], "/") {
+		return "", errors.New("bad digest: " + digest)
+	}
+	return path.Join("blobs", fields[0], fields[1]), nil
+}
+
+func readJson(source ociSource, name string, value interface{}) error {
+	file, err := source.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(value); err != nil {
+		return errors.New("error decoding: " + name + ": " + err.Error())
+	}
+	return nil
+}
+
+func (dirname directorySource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(path.Join(string(dirname), path.Clean("/"+name)))
+}
+
+// Scan the archive for the member. This is slow for large archives but avoids
+// unpacking the archive.
+func (filename tarfileSource) Open(name string) (io.ReadCloser, error) {
+	name = path.Clean("/" + name)
+	file, err := os.Open(string(filename))
+	if err != nil {
+		return nil, err
+	}
+	tarReader := tar.NewReader(bufio.NewReader(file))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if path.Clean("/"+header.Name) == name &&
+			(header.Typeflag == tar.TypeReg ||
+				header.Typeflag == tar.TypeRegA) {
+			return &tarMemberReader{tarReader, file}, nil
+		}
+	}
+	file.Close()
+	return nil, &os.PathError{Op: "open", Path: string(filename) + ":" + name,
+		Err: os.ErrNotExist}
+}
+
+func (reader *tarMemberReader) Close() error {
+	return reader.file.Close()
+}
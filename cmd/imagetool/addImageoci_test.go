@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func makeDescriptor(digest, osName, architecture string) ociDescriptor {
+	descriptor := ociDescriptor{Digest: digest}
+	if osName != "" {
+		descriptor.Platform = &struct {
+			Architecture string
+			OS           string
+		}{architecture, osName}
+	}
+	return descriptor
+}
+
+func TestSelectManifest(t *testing.T) {
+	var tests = []struct {
+		name         string
+		descriptors  []ociDescriptor
+		architecture string
+		want         string // Empty: error.
+	}{
+		{"no platforms", []ociDescriptor{makeDescriptor("a", "", ""),
+			makeDescriptor("b", "", "")}, "arm64", "a"},
+		{"matching", []ociDescriptor{makeDescriptor("a", "linux", "amd64"),
+			makeDescriptor("b", "linux", "arm64")}, "arm64", "b"},
+		{"other OS", []ociDescriptor{makeDescriptor("a", "windows", "amd64"),
+			makeDescriptor("b", "linux", "amd64")}, "amd64", "b"},
+		{"no match", []ociDescriptor{makeDescriptor("a", "linux", "amd64"),
+			makeDescriptor("b", "", "")}, "arm64", ""},
+	}
+	for _, test := range tests {
+		descriptor, err := selectManifest(test.descriptors, test.architecture)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: selected: %s", test.name, descriptor.Digest)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if descriptor.Digest != test.want {
+			t.Errorf("%s: selected: %s, want: %s", test.name,
+				descriptor.Digest, test.want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filter"
+	"github.com/Symantec/Dominator/lib/image"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/triggers"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// buildManifest describes how to build an image. Relative filenames are
+// relative to the directory containing the manifest.
+type buildManifest struct {
+	BaseImage     string `json:",omitempty"` // Optional.
+	Layers        []buildLayer
+	Overrides     []buildOverride    `json:",omitempty"`
+	ComputedFiles []computedFileType `json:",omitempty"`
+	Filter        []string           `json:",omitempty"` // Nil: sparse image.
+	FilterFile    string             `json:",omitempty"`
+	Triggers      []*triggers.Trigger
+	TriggersFile  string            `json:",omitempty"`
+	BuildLog      string            `json:",omitempty"` // Filename or URL.
+	ReleaseNotes  string            `json:",omitempty"` // Filename or URL.
+	Labels        map[string]string `json:",omitempty"`
+}
+
+// buildLayer specifies the source of a layer. Exactly one field must be set.
+type buildLayer struct {
+	Directory string `json:",omitempty"`
+	Tarfile   string `json:",omitempty"` // .tar, .tar.gz or .tgz
+	Image     string `json:",omitempty"` // Name of an image on the server.
+}
+
+type buildOverride struct {
+	Pathname string
+	Mode     string  `json:",omitempty"` // Octal permission bits.
+	Uid      *uint32 `json:",omitempty"`
+	Gid      *uint32 `json:",omitempty"`
+}
+
+type direntList []*filesystem.DirectoryEntry
+
+func buildManifestSubcommand(args []string) {
+	imageSClient, objectClient := getClients()
+	err := buildFromManifest(imageSClient, objectClient, args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building image: \"%s\"\t%s\n", args[0],
+			err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func buildFromManifest(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient,
+	name, manifestFilename string) error {
+	imageExists, err := client.CheckImage(imageSClient, name)
+	if err != nil {
+		return errors.New("error checking for image existance: " + err.Error())
+	}
+	if imageExists {
+		return errors.New("image exists")
+	}
+	manifestData, err := ioutil.ReadFile(manifestFilename)
+	if err != nil {
+		return err
+	}
+	var manifest buildManifest
+	err = json.NewDecoder(bytes.NewReader(manifestData)).Decode(&manifest)
+	if err != nil {
+		return errors.New("error decoding manifest: " + err.Error())
+	}
+	manifest.resolveFilenames(path.Dir(manifestFilename))
+	newImage, err := manifest.loadImageFiles(objectClient)
+	if err != nil {
+		return err
+	}
+	newImage.FileSystem, err = manifest.buildFileSystem(imageSClient,
+		newImage.Filter)
+	if err != nil {
+		return err
+	}
+	err = applyOverrides(newImage.FileSystem, manifest.Overrides)
+	if err != nil {
+		return err
+	}
+	err = spliceComputedFileList(newImage.FileSystem, manifest.ComputedFiles)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Labels) > 0 {
+		newImage.Labels = manifest.Labels
+	}
+	hashVal, _, err := objectClient.AddObject(bytes.NewReader(manifestData),
+		uint64(len(manifestData)), nil)
+	if err != nil {
+		return errors.New("error uploading manifest: " + err.Error())
+	}
+	newImage.Manifest = &image.Annotation{Object: &hashVal}
+	return addImage(imageSClient, name, newImage)
+}
+
+func (manifest *buildManifest) resolveFilenames(dirname string) {
+	resolve := func(filename *string) {
+		if *filename != "" && !path.IsAbs(*filename) {
+			*filename = path.Join(dirname, *filename)
+		}
+	}
+	for index := range manifest.Layers {
+		resolve(&manifest.Layers[index].Directory)
+		resolve(&manifest.Layers[index].Tarfile)
+	}
+	resolve(&manifest.FilterFile)
+	resolve(&manifest.TriggersFile)
+	// Annotations which are not files are URLs.
+	for _, filename := range []*string{&manifest.BuildLog,
+		&manifest.ReleaseNotes} {
+		if *filename != "" && !path.IsAbs(*filename) {
+			pathname := path.Join(dirname, *filename)
+			if _, err := os.Stat(pathname); err == nil {
+				*filename = pathname
+			}
+		}
+	}
+}
+
+func (manifest *buildManifest) loadImageFiles(
+	objectClient *objectclient.ObjectClient) (*image.Image, error) {
+	newImage := new(image.Image)
+	var err error
+	if manifest.FilterFile != "" {
+		if manifest.Filter != nil {
+			return nil, errors.New("both Filter and FilterFile specified")
+		}
+		newImage.Filter, err = filter.LoadFilter(manifest.FilterFile)
+	} else if manifest.Filter != nil {
+		newImage.Filter, err = filter.NewFilter(manifest.Filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if manifest.TriggersFile != "" {
+		if manifest.Triggers != nil {
+			return nil, errors.New("both Triggers and TriggersFile specified")
+		}
+		if err := loadTriggers(newImage, manifest.TriggersFile); err != nil {
+			return nil, err
+		}
+	} else {
+		newImage.Triggers = &triggers.Triggers{Triggers: manifest.Triggers}
+	}
+	newImage.BuildLog, err = getAnnotation(objectClient, manifest.BuildLog)
+	if err != nil {
+		return nil, err
+	}
+	newImage.ReleaseNotes, err = getAnnotation(objectClient,
+		manifest.ReleaseNotes)
+	if err != nil {
+		return nil, err
+	}
+	return newImage, nil
+}
+
+// buildFileSystem stacks the layers on top of the base image. Entries in later
+// layers replace entries in earlier layers, except that directories present in
+// both are merged (taking the metadata from the later layer). The metadata
+// for the root directory come from the base image (or first layer).
+func (manifest *buildManifest) buildFileSystem(imageSClient *srpc.Client,
+	filter *filter.Filter) (*filesystem.FileSystem, error) {
+	var root *filesystem.DirectoryInode
+	if manifest.BaseImage != "" {
+		baseImage, err := getImage(imageSClient, manifest.BaseImage)
+		if err != nil {
+			return nil, err
+		}
+		root = &baseImage.FileSystem.DirectoryInode
+	}
+	if root == nil && len(manifest.Layers) < 1 {
+		return nil, errors.New("no base image or layers")
+	}
+	for index, layer := range manifest.Layers {
+		fs, err := buildLayerFileSystem(imageSClient, filter, layer)
+		if err != nil {
+			return nil, fmt.Errorf("error building layer: %d: %s", index, err)
+		}
+		if root == nil {
+			root = &fs.DirectoryInode
+		} else {
+			overlayDirectory(root, &fs.DirectoryInode)
+		}
+	}
+	return makeFileSystem(root).Filter(filter), nil
+}
+
+func buildLayerFileSystem(imageSClient *srpc.Client, filter *filter.Filter,
+	layer buildLayer) (*filesystem.FileSystem, error) {
+	switch {
+	case layer.Directory != "" && layer.Tarfile == "" && layer.Image == "":
+		return buildImage(imageSClient, filter, layer.Directory)
+	case layer.Directory == "" && layer.Tarfile != "" && layer.Image == "":
+		return buildImage(imageSClient, filter, layer.Tarfile)
+	case layer.Directory == "" && layer.Tarfile == "" && layer.Image != "":
+		return getFsOfImage(imageSClient, layer.Image)
+	}
+	return nil, errors.New("layer must have one of Directory, Tarfile, Image")
+}
+
+func overlayDirectory(lower, upper *filesystem.DirectoryInode) {
+	entries := make(map[string]*filesystem.DirectoryEntry,
+		len(lower.EntryList)+len(upper.EntryList))
+	for _, dirent := range lower.EntryList {
+		entries[dirent.Name] = dirent
+	}
+	for _, dirent := range upper.EntryList {
+		if lowerDirent, ok := entries[dirent.Name]; ok {
+			lowerDir, ok := lowerDirent.Inode().(*filesystem.DirectoryInode)
+			upperDir, upperIsDir := dirent.Inode().(*filesystem.DirectoryInode)
+			if ok && upperIsDir {
+				lowerDir.Mode = upperDir.Mode
+				lowerDir.Uid = upperDir.Uid
+				lowerDir.Gid = upperDir.Gid
+				overlayDirectory(lowerDir, upperDir)
+				continue
+			}
+		}
+		entries[dirent.Name] = dirent
+	}
+	lower.EntryList = make([]*filesystem.DirectoryEntry, 0, len(entries))
+	for _, dirent := range entries {
+		lower.EntryList = append(lower.EntryList, dirent)
+	}
+	sort.Sort(direntList(lower.EntryList))
+	lower.EntriesByName = nil
+}
+
+// makeFileSystem creates a file-system from a directory tree, numbering the
+// inodes in tree order. Hard links (entries sharing an inode) are preserved.
+func makeFileSystem(root *filesystem.DirectoryInode) *filesystem.FileSystem {
+	fs := &filesystem.FileSystem{InodeTable: make(filesystem.InodeTable)}
+	fs.DirectoryInode = *root
+	inodeNumbers := make(map[filesystem.GenericInode]uint64)
+	fs.DirectoryCount = 1 + numberInodes(fs, &fs.DirectoryInode, inodeNumbers)
+	fs.ComputeTotalDataBytes()
+	return fs
+}
+
+func numberInodes(fs *filesystem.FileSystem,
+	directory *filesystem.DirectoryInode,
+	inodeNumbers map[filesystem.GenericInode]uint64) uint64 {
+	var numDirectories uint64
+	for _, dirent := range directory.EntryList {
+		inode := dirent.Inode()
+		if inum, ok := inodeNumbers[inode]; ok {
+			dirent.InodeNumber = inum
+			continue
+		}
+		inum := uint64(len(inodeNumbers) + 1)
+		inodeNumbers[inode] = inum
+		fs.InodeTable[inum] = inode
+		dirent.InodeNumber = inum
+		if inode, ok := inode.(*filesystem.DirectoryInode); ok {
+			numDirectories += 1 + numberInodes(fs, inode, inodeNumbers)
+		}
+	}
+	return numDirectories
+}
+
+func applyOverrides(fs *filesystem.FileSystem,
+	overrides []buildOverride) error {
+	filenameToInodeTable := fs.FilenameToInodeTable()
+	for _, override := range overrides {
+		pathname := path.Clean("/" + override.Pathname)
+		var inode filesystem.GenericInode
+		if pathname == "/" {
+			inode = &fs.DirectoryInode
+		} else if inum, ok := filenameToInodeTable[pathname]; ok {
+			inode = fs.InodeTable[inum]
+		} else {
+			return errors.New(pathname + ": missing from image")
+		}
+		var mode *filesystem.FileMode
+		var uid, gid *uint32
+		switch inode := inode.(type) {
+		case *filesystem.DirectoryInode:
+			mode, uid, gid = &inode.Mode, &inode.Uid, &inode.Gid
+		case *filesystem.RegularInode:
+			mode, uid, gid = &inode.Mode, &inode.Uid, &inode.Gid
+		case *filesystem.ComputedRegularInode:
+			mode, uid, gid = &inode.Mode, &inode.Uid, &inode.Gid
+		case *filesystem.SpecialInode:
+			mode, uid, gid = &inode.Mode, &inode.Uid, &inode.Gid
+		case *filesystem.SymlinkInode:
+			if override.Mode != "" {
+				return errors.New(pathname + ": cannot set mode of symlink")
+			}
+			uid, gid = &inode.Uid, &inode.Gid
+		default:
+			return fmt.Errorf("%s: cannot override type: %T", pathname, inode)
+		}
+		if override.Mode != "" {
+			perms, err := strconv.ParseUint(override.Mode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("%s: bad mode: %s", pathname, override.Mode)
+			}
+			if perms&^07777 != 0 {
+				return fmt.Errorf("%s: mode: %s has type bits", pathname,
+					override.Mode)
+			}
+			*mode = *mode&syscall.S_IFMT | filesystem.FileMode(perms)
+		}
+		if override.Uid != nil {
+			*uid = *override.Uid
+		}
+		if override.Gid != nil {
+			*gid = *override.Gid
+		}
+	}
+	return nil
+}
+
+func (list direntList) Len() int {
+	return len(list)
+}
+
+func (list direntList) Less(left, right int) bool {
+	return list[left].Name < list[right].Name
+}
+
+func (list direntList) Swap(left, right int) {
+	list[left], list[right] = list[right], list[left]
+}
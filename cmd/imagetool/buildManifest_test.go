@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type treeEntry struct {
+	pathname string
+	inode    filesystem.GenericInode
+}
+
+// makeTree makes a directory tree containing the inodes, with inode pointers
+// set but no inode numbers. Parent directories must be listed before their
+// entries. An inode may be listed more than once to make hard links.
+func makeTree(t *testing.T, mode filesystem.FileMode,
+	entries []treeEntry) *filesystem.DirectoryInode {
+	root := &filesystem.DirectoryInode{Mode: syscall.S_IFDIR | mode}
+	directories := map[string]*filesystem.DirectoryInode{"/": root}
+	for _, entry := range entries {
+		directory := directories[path.Dir(entry.pathname)]
+		if directory == nil {
+			t.Fatalf("%s: no parent directory", entry.pathname)
+		}
+		dirent := &filesystem.DirectoryEntry{Name: path.Base(entry.pathname)}
+		dirent.SetInode(entry.inode)
+		directory.EntryList = append(directory.EntryList, dirent)
+		if inode, ok := entry.inode.(*filesystem.DirectoryInode); ok {
+			directories[entry.pathname] = inode
+		}
+	}
+	return root
+}
+
+func testDirectory(mode filesystem.FileMode,
+	uid uint32) *filesystem.DirectoryInode {
+	return &filesystem.DirectoryInode{Mode: syscall.S_IFDIR | mode, Uid: uid}
+}
+
+func testFile(size uint64) *filesystem.RegularInode {
+	return &filesystem.RegularInode{Mode: syscall.S_IFREG | 0644, Size: size}
+}
+
+// describeFileSystem returns a map of pathnames to a description of the inode:
+// the mode and UID for directories, the size and inode number for regular
+// files, the target of symlinks and the source of computed files.
+func describeFileSystem(fs *filesystem.FileSystem) map[string]string {
+	descriptions := map[string]string{
+		"/": fmt.Sprintf("%o:%d", fs.Mode, fs.Uid),
+	}
+	describeDirectory(fs, &fs.DirectoryInode, "", descriptions)
+	return descriptions
+}
+
+func describeDirectory(fs *filesystem.FileSystem,
+	directory *filesystem.DirectoryInode, dirname string,
+	descriptions map[string]string) {
+	for _, dirent := range directory.EntryList {
+		pathname := dirname + "/" + dirent.Name
+		switch inode := fs.InodeTable[dirent.InodeNumber].(type) {
+		case *filesystem.DirectoryInode:
+			descriptions[pathname] = fmt.Sprintf("%o:%d", inode.Mode,
+				inode.Uid)
+			describeDirectory(fs, inode, pathname, descriptions)
+		case *filesystem.RegularInode:
+			descriptions[pathname] = fmt.Sprintf("%d#%d", inode.Size,
+				dirent.InodeNumber)
+		case *filesystem.SymlinkInode:
+			descriptions[pathname] = "->" + inode.Symlink
+		case *filesystem.ComputedRegularInode:
+			descriptions[pathname] = "@" + inode.Source
+		}
+	}
+}
+
+func TestOverlayDirectory(t *testing.T) {
+	hardlinked := testFile(5)
+	lower := makeTree(t, 0755, []treeEntry{
+		{"/bin", testDirectory(0755, 0)},
+		{"/bin/sh", testFile(1)},
+		{"/etc", testDirectory(0755, 0)},
+		{"/etc/a", testFile(2)},
+		{"/etc/b", testFile(3)},
+		{"/lib", testDirectory(0755, 0)},
+		{"/x", hardlinked},
+		{"/y", hardlinked},
+	})
+	upper := makeTree(t, 0700, []treeEntry{
+		{"/bin", &filesystem.SymlinkInode{Symlink: "usr/bin"}},
+		{"/etc", testDirectory(0750, 5)},
+		{"/etc/b", testFile(4)},
+		{"/etc/c", testFile(6)},
+		{"/lib", testFile(7)},
+	})
+	overlayDirectory(lower, upper)
+	fs := makeFileSystem(lower)
+	want := map[string]string{
+		"/":      "40755:0",
+		"/bin":   "->usr/bin",
+		"/etc":   "40750:5",
+		"/etc/a": "2#3",
+		"/etc/b": "4#4",
+		"/etc/c": "6#5",
+		"/lib":   "7#6",
+		"/x":     "5#7",
+		"/y":     "5#7",
+	}
+	if got := describeFileSystem(fs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if len(fs.InodeTable) != 7 {
+		t.Errorf("%d inodes, want: 7", len(fs.InodeTable))
+	}
+	if fs.DirectoryCount != 2 {
+		t.Errorf("%d directories, want: 2", fs.DirectoryCount)
+	}
+	if fs.TotalDataBytes != 2+4+6+7+5 {
+		t.Errorf("%d data bytes", fs.TotalDataBytes)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	uid := uint32(10)
+	gid := uint32(20)
+	var tests = []struct {
+		override  buildOverride
+		pathname  string
+		wantMode  filesystem.FileMode
+		wantUid   uint32
+		wantGid   uint32
+		wantError string
+	}{
+		{
+			override: buildOverride{Pathname: "etc/shadow", Mode: "0600",
+				Uid: &uid},
+			pathname: "/etc/shadow",
+			wantMode: syscall.S_IFREG | 0600,
+			wantUid:  10,
+		},
+		{
+			override: buildOverride{Pathname: "/", Mode: "1777", Gid: &gid},
+			pathname: "/",
+			wantMode: syscall.S_IFDIR | 01777,
+			wantGid:  20,
+		},
+		{
+			override: buildOverride{Pathname: "/link", Uid: &uid},
+			pathname: "/link",
+			wantUid:  10,
+		},
+		{
+			override:  buildOverride{Pathname: "/link", Mode: "0644"},
+			wantError: "cannot set mode of symlink",
+		},
+		{
+			override:  buildOverride{Pathname: "/missing", Uid: &uid},
+			wantError: "missing from image",
+		},
+		{
+			override:  buildOverride{Pathname: "/etc/shadow", Mode: "rw"},
+			wantError: "bad mode",
+		},
+		{
+			override:  buildOverride{Pathname: "/etc/shadow", Mode: "100644"},
+			wantError: "has type bits",
+		},
+	}
+	for _, test := range tests {
+		fs := makeFileSystem(makeTree(t, 0755, []treeEntry{
+			{"/etc", testDirectory(0755, 0)},
+			{"/etc/shadow", testFile(1)},
+			{"/link", &filesystem.SymlinkInode{Symlink: "etc"}},
+		}))
+		err := applyOverrides(fs, []buildOverride{test.override})
+		if test.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("%+v: error: %v, want: %s", test.override, err,
+					test.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %s", test.override, err)
+			continue
+		}
+		var inode filesystem.GenericInode = &fs.DirectoryInode
+		if test.pathname != "/" {
+			inode = fs.InodeTable[fs.FilenameToInodeTable()[test.pathname]]
+		}
+		var mode filesystem.FileMode
+		var gotUid, gotGid uint32
+		switch inode := inode.(type) {
+		case *filesystem.DirectoryInode:
+			mode, gotUid, gotGid = inode.Mode, inode.Uid, inode.Gid
+		case *filesystem.RegularInode:
+			mode, gotUid, gotGid = inode.Mode, inode.Uid, inode.Gid
+		case *filesystem.SymlinkInode:
+			gotUid, gotGid = inode.Uid, inode.Gid
+		}
+		if mode != test.wantMode || gotUid != test.wantUid ||
+			gotGid != test.wantGid {
+			t.Errorf("%+v: got: %o %d %d", test.override, mode, gotUid,
+				gotGid)
+		}
+	}
+}
+
+func TestResolveFilenames(t *testing.T) {
+	dirname := t.TempDir()
+	err := ioutil.WriteFile(path.Join(dirname, "notes"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := buildManifest{
+		Layers: []buildLayer{
+			{Directory: "rootfs"},
+			{Tarfile: "/abs/layer.tar"},
+			{Image: "base/1"},
+		},
+		FilterFile:   "filter",
+		BuildLog:     "http://builds.example.com/1",
+		ReleaseNotes: "notes",
+	}
+	manifest.resolveFilenames(dirname)
+	want := buildManifest{
+		Layers: []buildLayer{
+			{Directory: path.Join(dirname, "rootfs")},
+			{Tarfile: "/abs/layer.tar"},
+			{Image: "base/1"},
+		},
+		FilterFile:   path.Join(dirname, "filter"),
+		BuildLog:     "http://builds.example.com/1",
+		ReleaseNotes: path.Join(dirname, "notes"),
+	}
+	if !reflect.DeepEqual(manifest, want) {
+		t.Errorf("got: %+v, want: %+v", manifest, want)
+	}
+}
+
+func TestLoadImageFiles(t *testing.T) {
+	dirname := t.TempDir()
+	filterFile := path.Join(dirname, "filter")
+	if err := ioutil.WriteFile(filterFile, []byte("/tmp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name       string
+		manifest   buildManifest
+		wantFilter []string
+		wantError  string
+	}{
+		{
+			name:     "sparse",
+			manifest: buildManifest{},
+		},
+		{
+			name:       "filter",
+			manifest:   buildManifest{Filter: []string{"/var/log"}},
+			wantFilter: []string{"/var/log"},
+		},
+		{
+			name:       "filter file",
+			manifest:   buildManifest{FilterFile: filterFile},
+			wantFilter: []string{"/tmp"},
+		},
+		{
+			name: "filter and filter file",
+			manifest: buildManifest{Filter: []string{"/tmp"},
+				FilterFile: filterFile},
+			wantError: "both Filter and FilterFile",
+		},
+		{
+			name:      "bad triggers file",
+			manifest:  buildManifest{TriggersFile: filterFile},
+			wantError: "error decoding triggers",
+		},
+	}
+	for _, test := range tests {
+		img, err := test.manifest.loadImageFiles(nil)
+		if test.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("%s: error: %v, want: %s", test.name, err,
+					test.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		var gotFilter []string
+		if img.Filter != nil {
+			gotFilter = img.Filter.FilterLines
+		}
+		if !reflect.DeepEqual(gotFilter, test.wantFilter) {
+			t.Errorf("%s: filter: %v, want: %v", test.name, gotFilter,
+				test.wantFilter)
+		}
+		if img.Triggers == nil {
+			t.Errorf("%s: no triggers", test.name)
+		}
+	}
+}
+
+func TestBuildLayerFileSystemNeedsOneSource(t *testing.T) {
+	for _, layer := range []buildLayer{
+		{},
+		{Directory: "a", Tarfile: "b"},
+		{Tarfile: "b", Image: "c"},
+	} {
+		if _, err := buildLayerFileSystem(nil, nil, layer); err == nil {
+			t.Errorf("%+v: accepted", layer)
+		}
+	}
+}
@@ -26,6 +26,11 @@ func spliceComputedFiles(fs *filesystem.FileSystem) error {
 		return errors.New("cannot load computed files list from: " +
 			*computedFiles + ": " + err.Error())
 	}
+	return spliceComputedFileList(fs, computedFileList)
+}
+
+func spliceComputedFileList(fs *filesystem.FileSystem,
+	computedFileList []computedFileType) error {
 	filenameToInodeTable := fs.FilenameToInodeTable()
 	inodeToFilenamesTable := fs.InodeToFilenamesTable()
 	for _, computedFile := range computedFileList {
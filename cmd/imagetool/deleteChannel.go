@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"os"
+)
+
+func deleteChannelSubcommand(args []string) {
+	imageSClient, _ := getClients()
+	if err := client.DeleteChannel(imageSClient, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting channel\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
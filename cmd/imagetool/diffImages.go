@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
 	imgclient "github.com/Symantec/Dominator/imageserver/client"
@@ -18,7 +19,11 @@ import (
 )
 
 func diffSubcommand(args []string) {
-	diffTypedImages(args[0], args[1], args[2])
+	if len(args) == 2 {
+		diffTypedImages("", args[0], args[1])
+	} else {
+		diffTypedImages(args[0], args[1], args[2])
+	}
 }
 
 func diffTypedImages(tool string, lName string, rName string) {
@@ -36,7 +41,11 @@ func diffTypedImages(tool string, lName string, rName string) {
 		fmt.Fprintf(os.Stderr, "Error filtering right image\t%s\n", err)
 		os.Exit(1)
 	}
-	err = diffImages(tool, lfs, rfs)
+	if tool == "" {
+		err = diffImagesNative(lfs, rfs)
+	} else {
+		err = diffImages(tool, lfs, rfs)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error diffing images\t%s\n", err)
 		os.Exit(1)
@@ -131,6 +140,21 @@ func diffImages(tool string, lfs, rfs *filesystem.FileSystem) error {
 	return cmd.Run()
 }
 
+func diffImagesNative(lfs, rfs *filesystem.FileSystem) error {
+	diff := filesystem.DiffFileSystems(lfs, rfs, listFilter)
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	switch *diffFormat {
+	case "json":
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(diff)
+	case "text":
+		return diff.WriteText(writer)
+	}
+	return errors.New("unknown diff format: " + *diffFormat)
+}
+
 func writeImage(fs *filesystem.FileSystem) (string, error) {
 	file, err := ioutil.TempFile("", "imagetool")
 	if err != nil {
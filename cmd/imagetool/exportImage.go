@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"io"
+	"os"
+)
+
+func exportImageSubcommand(args []string) {
+	imageSClient, _ := getClients()
+	err := exportImage(imageSClient, args[0], args[1], args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting image\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func exportImage(imageClient *srpc.Client, exportType, name,
+	filename string) error {
+	var writer io.Writer
+	if filename == "-" {
+		writer = os.Stdout
+	} else {
+		file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+			filePerms)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		writer = file
+	}
+	bufferedWriter := bufio.NewWriter(writer)
+	err := client.ExportImage(imageClient, imageserver.ExportImageRequest{
+		ImageName:    name,
+		Type:         exportType,
+		Architecture: *architecture,
+	}, bufferedWriter)
+	if err != nil {
+		if filename != "-" {
+			os.Remove(filename)
+		}
+		return err
+	}
+	return bufferedWriter.Flush()
+}
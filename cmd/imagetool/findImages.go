@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/verstr"
+	"os"
+	"strings"
+)
+
+func findImagesSubcommand(args []string) {
+	imageClient, _ := getClients()
+	if err := findImages(imageClient, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding images\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func findImages(imageSClient *srpc.Client, args []string) error {
+	selector := make(map[string]string, len(args))
+	for _, arg := range args {
+		fields := strings.SplitN(arg, "=", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return errors.New("invalid label: " + arg)
+		}
+		selector[fields[0]] = fields[1]
+	}
+	imageNames, err := client.FindImages(imageSClient, selector)
+	if err != nil {
+		return err
+	}
+	verstr.Sort(imageNames)
+	for _, name := range imageNames {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/verstr"
+	"os"
+	"strings"
+)
+
+func findImagesContainingSubcommand(args []string) {
+	imageClient, _ := getClients()
+	if err := findImagesContaining(imageClient, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding images\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Each argument is either a pathname (starting with "/") or an object hash.
+func findImagesContaining(imageSClient *srpc.Client, args []string) error {
+	var pathname string
+	var object *hash.Hash
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "/") {
+			if pathname != "" {
+				return errors.New("only one pathname may be specified")
+			}
+			pathname = arg
+			continue
+		}
+		if object != nil {
+			return errors.New("only one object may be specified")
+		}
+		data, err := hex.DecodeString(arg)
+		if err != nil {
+			return fmt.Errorf("bad object: %s: %s", arg, err)
+		}
+		var hashVal hash.Hash
+		if len(data) != len(hashVal) {
+			return errors.New("bad object hash length: " + arg)
+		}
+		copy(hashVal[:], data)
+		object = &hashVal
+	}
+	imageNames, err := client.FindImagesContaining(imageSClient, pathname,
+		object)
+	if err != nil {
+		return err
+	}
+	verstr.Sort(imageNames)
+	for _, name := range imageNames {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/image/lint"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"os"
+)
+
+func lintImageSubcommand(args []string) {
+	imageSClient, objectClient := getClients()
+	var previousName string
+	if len(args) > 1 {
+		previousName = args[1]
+	}
+	rejected, err := lintImage(imageSClient, objectClient, args[0],
+		previousName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error linting image\t%s\n", err)
+		os.Exit(1)
+	}
+	if rejected {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func lintImage(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient, name, previousName string) (
+	bool, error) {
+	policy, err := loadLintPolicy()
+	if err != nil {
+		return false, err
+	}
+	img, err := getImage(imageSClient, name)
+	if err != nil {
+		return false, err
+	}
+	if previousName == "" {
+		imageNames, err := client.ListImages(imageSClient)
+		if err != nil {
+			return false, err
+		}
+		previousName = lint.FindPreviousImage(name, imageNames)
+	}
+	var previousImage *image.Image
+	if previousName != "" {
+		previousImage, err = getImage(imageSClient, previousName)
+		if err != nil {
+			return false, err
+		}
+	}
+	violations, err := policy.Check(name, img, &lint.Context{
+		PreviousImage: previousImage,
+		ObjectsGetter: objectClient,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, violation := range violations {
+		fmt.Println(violation)
+	}
+	return lint.Rejected(violations), nil
+}
+
+func loadLintPolicy() (*lint.Policy, error) {
+	if *lintPolicyFile == "" {
+		return lint.NewDefaultPolicy()
+	}
+	policy, err := lint.LoadPolicy(*lintPolicyFile)
+	if err != nil {
+		return nil, errors.New("error loading lint policy: " + err.Error())
+	}
+	return policy, nil
+}
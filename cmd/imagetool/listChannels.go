@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/verstr"
+	"os"
+)
+
+func listChannelsSubcommand(args []string) {
+	imageSClient, _ := getClients()
+	channelNames, err := client.ListChannels(imageSClient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing channels\t%s\n", err)
+		os.Exit(1)
+	}
+	verstr.Sort(channelNames)
+	for _, name := range channelNames {
+		fmt.Println(name)
+	}
+	os.Exit(0)
+}
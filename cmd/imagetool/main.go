@@ -14,6 +14,8 @@ import (
 )
 
 var (
+	architecture = flag.String("architecture", "amd64",
+		"Architecture (GOARCH name) of the image binaries for OCI images")
 	buildLog = flag.String("buildLog", "",
 		"Filename or URL containing build log")
 	certFile = flag.String("certFile",
@@ -25,6 +27,8 @@ var (
 		"If true, show debugging output")
 	deleteFilter = flag.String("deleteFilter", "",
 		"Name of delete filter file for addi, adds subcommand and right image")
+	diffFormat = flag.String("diffFormat", "text",
+		"Output format for built-in diff: text or json")
 	filterFile = flag.String("filterFile", "",
 		"Filter file to apply when diffing images")
 	imageServerHostname = flag.String("imageServerHostname", "localhost",
@@ -32,19 +36,28 @@ var (
 	imageServerPortNum = flag.Uint("imageServerPortNum",
 		constants.ImageServerPortNumber,
 		"Port number of image server")
+	labels  flagutil.StringToStringMap
 	keyFile = flag.String("keyFile",
 		path.Join(os.Getenv("HOME"), ".ssl/key.pem"),
 		"Name of file containing the user SSL key")
+	lintPolicyFile = flag.String("lintPolicyFile", "",
+		"Name of file containing lint policy (default: warn for all checks)")
+	packageInventory = flag.Bool("packageInventory", true,
+		"If true, store the inventory of installed packages with new images")
 	releaseNotes = flag.String("releaseNotes", "",
 		"Filename or URL containing release notes")
-	requiredPaths = flagutil.StringToRuneMap(constants.RequiredPaths)
-	skipFields    = flag.String("skipFields", "",
+	requiredPaths  = flagutil.StringToRuneMap(constants.RequiredPaths)
+	signingKeyFile = flag.String("signingKeyFile", "",
+		"Name of file containing the PEM encoded key used to sign new images")
+	skipFields = flag.String("skipFields", "",
 		"Fields to skip when showing or diffing images")
 )
 
 func init() {
 	flag.Var(&requiredPaths, "requiredPaths",
 		"Comma separated list of required path:type entries")
+	flag.Var(&labels, "labels",
+		"Comma separated list of key=value labels to add to new images")
 }
 
 func printUsage() {
@@ -56,22 +69,38 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "  add    name imagefile filterfile triggerfile")
 	fmt.Fprintln(os.Stderr, "  addi   name imagename filterfile triggerfile")
 	fmt.Fprintln(os.Stderr, "  adds   name subname filterfile triggerfile")
+	fmt.Fprintln(os.Stderr, "  add-oci name ocidir|docker-save.tar filterfile triggerfile")
 	fmt.Fprintln(os.Stderr, "  addrep name baseimage layerimage...")
+	fmt.Fprintln(os.Stderr, "  build  name manifest.json")
 	fmt.Fprintln(os.Stderr, "  bulk-addrep layerimage...")
 	fmt.Fprintln(os.Stderr, "  check  name")
 	fmt.Fprintln(os.Stderr, "  chown  dirname ownerGroup")
 	fmt.Fprintln(os.Stderr, "  delete name")
-	fmt.Fprintln(os.Stderr, "  diff   tool left right")
+	fmt.Fprintln(os.Stderr, "  deletechannel channel")
+	fmt.Fprintln(os.Stderr, "  diff   [tool] left right")
+	fmt.Fprintln(os.Stderr, "         if tool is omitted, a built-in diff is shown")
 	fmt.Fprintln(os.Stderr, "         left & right are image sources. Format:")
 	fmt.Fprintln(os.Stderr, "         type:name where type is one of:")
 	fmt.Fprintln(os.Stderr, "           f: name of file containing an image")
 	fmt.Fprintln(os.Stderr, "           i: name of an image on the imageserver")
 	fmt.Fprintln(os.Stderr, "           s: name of sub to poll")
+	fmt.Fprintln(os.Stderr, "  export type name file")
+	fmt.Fprintln(os.Stderr, "         type is one of: tar, oci. file may be -")
+	fmt.Fprintln(os.Stderr, "  find   pathname|object [pathname|object]")
+	fmt.Fprintln(os.Stderr, "  findimages key=value...")
 	fmt.Fprintln(os.Stderr, "  get    name directory")
+	fmt.Fprintln(os.Stderr, "  lint   name [previousimage]")
 	fmt.Fprintln(os.Stderr, "  list")
+	fmt.Fprintln(os.Stderr, "  listchannels")
 	fmt.Fprintln(os.Stderr, "  listdirs")
 	fmt.Fprintln(os.Stderr, "  mkdir  name")
+	fmt.Fprintln(os.Stderr, "  patch  name baseimage patchspec.json")
+	fmt.Fprintln(os.Stderr, "  rollbackchannel channel [image]")
+	fmt.Fprintln(os.Stderr, "  sbom   name")
+	fmt.Fprintln(os.Stderr, "  sbomdiff left right")
+	fmt.Fprintln(os.Stderr, "  setchannel channel image")
 	fmt.Fprintln(os.Stderr, "  show   name")
+	fmt.Fprintln(os.Stderr, "  showchannel channel")
 	fmt.Fprintln(os.Stderr, "Fields:")
 	fmt.Fprintln(os.Stderr, "  m: mode")
 	fmt.Fprintln(os.Stderr, "  l: number of hardlinks")
@@ -96,17 +125,31 @@ var subcommands = []subcommand{
 	{"add", 4, 4, addImagefileSubcommand},
 	{"adds", 4, 4, addImagesubSubcommand},
 	{"addi", 4, 4, addImageimageSubcommand},
+	{"add-oci", 4, 4, addImageociSubcommand},
 	{"addrep", 3, -1, addReplaceImageSubcommand},
+	{"build", 2, 2, buildManifestSubcommand},
 	{"bulk-addrep", 1, -1, bulkAddReplaceImagesSubcommand},
 	{"check", 1, 1, checkImageSubcommand},
 	{"chown", 2, 2, chownDirectorySubcommand},
 	{"delete", 1, 1, deleteImageSubcommand},
-	{"diff", 3, 3, diffSubcommand},
+	{"deletechannel", 1, 1, deleteChannelSubcommand},
+	{"diff", 2, 3, diffSubcommand},
+	{"export", 3, 3, exportImageSubcommand},
+	{"find", 1, 2, findImagesContainingSubcommand},
+	{"findimages", 1, -1, findImagesSubcommand},
 	{"get", 2, 2, getImageSubcommand},
+	{"lint", 1, 2, lintImageSubcommand},
 	{"list", 0, 0, listImagesSubcommand},
+	{"listchannels", 0, 0, listChannelsSubcommand},
 	{"listdirs", 0, 0, listDirectoriesSubcommand},
 	{"mkdir", 1, 1, makeDirectorySubcommand},
+	{"patch", 3, 3, patchImageSubcommand},
+	{"rollbackchannel", 1, 2, rollbackChannelSubcommand},
+	{"sbom", 1, 1, listPackagesSubcommand},
+	{"sbomdiff", 2, 2, diffPackagesSubcommand},
+	{"setchannel", 2, 2, setChannelSubcommand},
 	{"show", 1, 1, showImageSubcommand},
+	{"showchannel", 1, 1, showChannelSubcommand},
 }
 
 var imageSrpcClient *srpc.Client
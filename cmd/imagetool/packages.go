@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/image/packages"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"os"
+)
+
+func listPackagesSubcommand(args []string) {
+	imageSClient, objectClient := getClients()
+	if err := listPackages(imageSClient, objectClient, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing packages\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func diffPackagesSubcommand(args []string) {
+	imageSClient, objectClient := getClients()
+	err := diffPackages(imageSClient, objectClient, args[0], args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error diffing packages\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func listPackages(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient, name string) error {
+	inventory, err := getPackageInventory(imageSClient, objectClient, name)
+	if err != nil {
+		return err
+	}
+	return inventory.WriteText(os.Stdout)
+}
+
+func diffPackages(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient, left, right string) error {
+	leftInventory, err := getPackageInventory(imageSClient, objectClient, left)
+	if err != nil {
+		return err
+	}
+	rightInventory, err := getPackageInventory(imageSClient, objectClient,
+		right)
+	if err != nil {
+		return err
+	}
+	return packages.DiffInventories(leftInventory, rightInventory).WriteText(
+		os.Stdout)
+}
+
+// getPackageInventory returns the inventory stored with the image, or if
+// there is none (older images), extracts it from the image file-system.
+func getPackageInventory(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient, name string) (
+	*packages.Inventory, error) {
+	img, err := getImage(imageSClient, name)
+	if err != nil {
+		return nil, err
+	}
+	if img.Packages == nil || img.Packages.Object == nil {
+		return packages.Extract(img.FileSystem, objectClient)
+	}
+	_, reader, err := objectClient.GetObject(*img.Packages.Object)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return packages.Decode(reader)
+}
+
+// makePackageInventory extracts the package inventory from the image and
+// uploads it. All the objects in the image must already be present in the
+// object server.
+func makePackageInventory(img *image.Image,
+	objectClient *objectclient.ObjectClient) error {
+	img.Packages = nil
+	inventory, err := packages.Extract(img.FileSystem, objectClient)
+	if err != nil {
+		return errors.New("error extracting package inventory: " +
+			err.Error())
+	}
+	if len(inventory.Packages) < 1 {
+		return nil
+	}
+	buffer := &bytes.Buffer{}
+	if err := inventory.Encode(buffer); err != nil {
+		return err
+	}
+	hashVal, _, err := objectClient.AddObject(buffer, uint64(buffer.Len()),
+		nil)
+	if err != nil {
+		return err
+	}
+	img.Packages = &image.Annotation{Object: &hashVal}
+	return nil
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filesystem/scanner"
+	"github.com/Symantec/Dominator/lib/filter"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/triggers"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// patchSpec describes changes to make to an image. They are applied in this
+// order: Delete, RemoveComputedFiles, Add, AddComputedFiles, the filter and
+// trigger changes and finally Overrides. Relative local filenames are
+// relative to the directory containing the spec.
+type patchSpec struct {
+	Delete              []string            `json:",omitempty"`
+	RemoveComputedFiles []string            `json:",omitempty"`
+	Add                 []patchAddition     `json:",omitempty"`
+	AddComputedFiles    []computedFileType  `json:",omitempty"`
+	AddFilterLines      []string            `json:",omitempty"`
+	RemoveFilterLines   []string            `json:",omitempty"`
+	AddTriggers         []*triggers.Trigger `json:",omitempty"`
+	RemoveTriggers      []string            `json:",omitempty"` // Services.
+	Overrides           []buildOverride     `json:",omitempty"`
+}
+
+// patchAddition adds or replaces a path. Exactly one of Source (a local file
+// or directory) and Symlink (the link target) must be set. New files are owned
+// by root and a replaced regular file keeps its metadata, unless changed by
+// Overrides.
+type patchAddition struct {
+	Pathname string
+	Source   string `json:",omitempty"`
+	Symlink  string `json:",omitempty"`
+}
+
+// pendingObjects records a local file for each object, so that only the
+// objects which are missing from the server are uploaded. The files are read
+// again at upload time rather than being held in memory.
+type pendingObjects map[hash.Hash]string
+
+func patchImageSubcommand(args []string) {
+	imageSClient, objectClient := getClients()
+	err := patchImage(imageSClient, objectClient, args[0], args[1], args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error patching image: \"%s\"\t%s\n", args[0],
+			err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func patchImage(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient,
+	name, baseImageName, specFilename string) error {
+	imageExists, err := client.CheckImage(imageSClient, name)
+	if err != nil {
+		return errors.New("error checking for image existance: " + err.Error())
+	}
+	if imageExists {
+		return errors.New("image exists")
+	}
+	spec, err := loadPatchSpec(specFilename)
+	if err != nil {
+		return err
+	}
+	newImage, err := getImage(imageSClient, baseImageName)
+	if err != nil {
+		return err
+	}
+	// The manifest no longer describes the contents.
+	newImage.Manifest = nil
+	if *buildLog != "" {
+		newImage.BuildLog, err = getAnnotation(objectClient, *buildLog)
+		if err != nil {
+			return err
+		}
+	}
+	if *releaseNotes != "" {
+		newImage.ReleaseNotes, err = getAnnotation(objectClient, *releaseNotes)
+		if err != nil {
+			return err
+		}
+	}
+	objects := make(pendingObjects)
+	root := &newImage.FileSystem.DirectoryInode
+	if err := spec.patchTree(root, objects); err != nil {
+		return err
+	}
+	if err := objects.upload(objectClient); err != nil {
+		return err
+	}
+	if err := spec.patchFilter(newImage); err != nil {
+		return err
+	}
+	spec.patchTriggers(newImage)
+	newImage.FileSystem = makeFileSystem(root).Filter(newImage.Filter)
+	if err := applyOverrides(newImage.FileSystem, spec.Overrides); err != nil {
+		return err
+	}
+	return addImage(imageSClient, name, newImage)
+}
+
+func loadPatchSpec(filename string) (*patchSpec, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var spec patchSpec
+	if err := json.NewDecoder(file).Decode(&spec); err != nil {
+		return nil, errors.New("error decoding patch spec: " + err.Error())
+	}
+	for index := range spec.Add {
+		source := &spec.Add[index].Source
+		if *source != "" && !path.IsAbs(*source) {
+			*source = path.Join(path.Dir(filename), *source)
+		}
+	}
+	return &spec, nil
+}
+
+func (spec *patchSpec) patchTree(root *filesystem.DirectoryInode,
+	objects pendingObjects) error {
+	for _, pathname := range spec.Delete {
+		if _, err := removePath(root, pathname); err != nil {
+			return err
+		}
+	}
+	for _, pathname := range spec.RemoveComputedFiles {
+		inode, err := removePath(root, pathname)
+		if err != nil {
+			return err
+		}
+		if _, ok := inode.(*filesystem.ComputedRegularInode); !ok {
+			return errors.New(pathname + ": not a computed file")
+		}
+	}
+	for _, addition := range spec.Add {
+		if err := addPath(root, addition, objects); err != nil {
+			return fmt.Errorf("error adding: %s: %s", addition.Pathname, err)
+		}
+	}
+	for _, computedFile := range spec.AddComputedFiles {
+		if computedFile.Source == "" {
+			return errors.New(computedFile.Filename + ": no source")
+		}
+		inode := &filesystem.ComputedRegularInode{
+			Mode:   syscall.S_IFREG | 0644,
+			Source: computedFile.Source,
+		}
+		parent, name, err := lookupParent(root, computedFile.Filename)
+		if err != nil {
+			return err
+		}
+		switch oldInode := lookupEntry(parent, name).(type) {
+		case *filesystem.RegularInode:
+			inode.Mode, inode.Uid, inode.Gid =
+				oldInode.Mode, oldInode.Uid, oldInode.Gid
+		case *filesystem.ComputedRegularInode:
+			inode.Mode, inode.Uid, inode.Gid =
+				oldInode.Mode, oldInode.Uid, oldInode.Gid
+		}
+		setEntry(parent, name, inode)
+	}
+	return nil
+}
+
+func (spec *patchSpec) patchFilter(img *image.Image) error {
+	if len(spec.AddFilterLines) < 1 && len(spec.RemoveFilterLines) < 1 {
+		return nil
+	}
+	var filterLines []string
+	if img.Filter != nil {
+		filterLines = img.Filter.FilterLines
+	}
+	for _, line := range spec.RemoveFilterLines {
+		found := false
+		newLines := make([]string, 0, len(filterLines))
+		for _, filterLine := range filterLines {
+			if filterLine == line {
+				found = true
+			} else {
+				newLines = append(newLines, filterLine)
+			}
+		}
+		if !found {
+			return errors.New("filter line not found: " + line)
+		}
+		filterLines = newLines
+	}
+	filterLines = append(filterLines, spec.AddFilterLines...)
+	newFilter, err := filter.NewFilter(filterLines)
+	if err != nil {
+		return err
+	}
+	img.Filter = newFilter
+	return nil
+}
+
+func (spec *patchSpec) patchTriggers(img *image.Image) {
+	if len(spec.AddTriggers) < 1 && len(spec.RemoveTriggers) < 1 {
+		return
+	}
+	removeServices := make(map[string]struct{}, len(spec.RemoveTriggers))
+	for _, service := range spec.RemoveTriggers {
+		removeServices[service] = struct{}{}
+	}
+	newTriggers := &triggers.Triggers{}
+	if img.Triggers != nil {
+		for _, trigger := range img.Triggers.Triggers {
+			if _, ok := removeServices[trigger.Service]; !ok {
+				newTriggers.Triggers = append(newTriggers.Triggers, trigger)
+			}
+		}
+	}
+	newTriggers.Triggers = append(newTriggers.Triggers, spec.AddTriggers...)
+	img.Triggers = newTriggers
+}
+
+func addPath(root *filesystem.DirectoryInode, addition patchAddition,
+	objects pendingObjects) error {
+	parent, name, err := lookupParent(root, addition.Pathname)
+	if err != nil {
+		return err
+	}
+	if addition.Symlink != "" {
+		if addition.Source != "" {
+			return errors.New("both Source and Symlink specified")
+		}
+		setEntry(parent, name, &filesystem.SymlinkInode{
+			Symlink: addition.Symlink,
+		})
+		return nil
+	}
+	if addition.Source == "" {
+		return errors.New("no Source or Symlink specified")
+	}
+	fi, err := os.Lstat(addition.Source)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		sfs, err := scanner.ScanFileSystem(addition.Source, nil, nil, nil, nil,
+			nil)
+		if err != nil {
+			return err
+		}
+		objects.addFileSystem(&sfs.FileSystem, addition.Source)
+		directory := &sfs.FileSystem.DirectoryInode
+		clearOwners(directory)
+		oldDirectory, ok := lookupEntry(parent,
+			name).(*filesystem.DirectoryInode)
+		if ok {
+			oldDirectory.Mode = directory.Mode
+			oldDirectory.Uid = directory.Uid
+			oldDirectory.Gid = directory.Gid
+			overlayDirectory(oldDirectory, directory)
+		} else {
+			setEntry(parent, name, directory)
+		}
+		return nil
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.New("not a regular file or directory")
+	}
+	file, err := os.Open(addition.Source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	inode := &filesystem.RegularInode{
+		Mode:             syscall.S_IFREG | filesystem.FileMode(fi.Mode().Perm()),
+		MtimeSeconds:     fi.ModTime().Unix(),
+		MtimeNanoSeconds: int32(fi.ModTime().Nanosecond()),
+		Size:             uint64(fi.Size()),
+	}
+	if inode.Size > 0 {
+		if inode.Hash, err = hashFile(file, inode.Size); err != nil {
+			return err
+		}
+		objects[inode.Hash] = addition.Source
+	}
+	switch oldInode := lookupEntry(parent, name).(type) {
+	case *filesystem.RegularInode:
+		inode.Mode, inode.Uid, inode.Gid =
+			oldInode.Mode, oldInode.Uid, oldInode.Gid
+	case *filesystem.ComputedRegularInode:
+		inode.Mode, inode.Uid, inode.Gid =
+			oldInode.Mode, oldInode.Uid, oldInode.Gid
+	}
+	setEntry(parent, name, inode)
+	return nil
+}
+
+// clearOwners makes root the owner of a directory tree scanned from the local
+// file-system.
+func clearOwners(directory *filesystem.DirectoryInode) {
+	directory.Uid = 0
+	directory.Gid = 0
+	for _, dirent := range directory.EntryList {
+		switch inode := dirent.Inode().(type) {
+		case *filesystem.DirectoryInode:
+			clearOwners(inode)
+		case *filesystem.RegularInode:
+			inode.Uid, inode.Gid = 0, 0
+		case *filesystem.SymlinkInode:
+			inode.Uid, inode.Gid = 0, 0
+		case *filesystem.SpecialInode:
+			inode.Uid, inode.Gid = 0, 0
+		}
+	}
+}
+
+// lookupParent returns the directory containing pathname (which must exist)
+// and the last component of pathname.
+func lookupParent(root *filesystem.DirectoryInode, pathname string) (
+	*filesystem.DirectoryInode, string, error) {
+	pathname = path.Clean("/" + pathname)
+	if pathname == "/" {
+		return nil, "", errors.New("cannot change root directory")
+	}
+	directory := root
+	dirname, name := path.Split(pathname)
+	for _, component := range strings.Split(dirname, "/") {
+		if component == "" {
+			continue
+		}
+		inode, ok := lookupEntry(directory,
+			component).(*filesystem.DirectoryInode)
+		if !ok {
+			return nil, "", errors.New(path.Clean(dirname) +
+				": not a directory in image")
+		}
+		directory = inode
+	}
+	return directory, name, nil
+}
+
+func lookupEntry(directory *filesystem.DirectoryInode,
+	name string) filesystem.GenericInode {
+	for _, dirent := range directory.EntryList {
+		if dirent.Name == name {
+			return dirent.Inode()
+		}
+	}
+	return nil
+}
+
+func removePath(root *filesystem.DirectoryInode, pathname string) (
+	filesystem.GenericInode, error) {
+	parent, name, err := lookupParent(root, pathname)
+	if err != nil {
+		return nil, err
+	}
+	for index, dirent := range parent.EntryList {
+		if dirent.Name == name {
+			parent.EntryList = append(parent.EntryList[:index:index],
+				parent.EntryList[index+1:]...)
+			parent.EntriesByName = nil
+			return dirent.Inode(), nil
+		}
+	}
+	return nil, errors.New(pathname + ": missing from image")
+}
+
+// setEntry adds or replaces the entry for name in directory.
+func setEntry(directory *filesystem.DirectoryInode, name string,
+	inode filesystem.GenericInode) {
+	dirent := &filesystem.DirectoryEntry{Name: name}
+	dirent.SetInode(inode)
+	directory.EntriesByName = nil
+	for index, oldDirent := range directory.EntryList {
+		if oldDirent.Name == name {
+			directory.EntryList[index] = dirent
+			return
+		}
+	}
+	directory.EntryList = append(directory.EntryList, dirent)
+	sort.Sort(direntList(directory.EntryList))
+}
+
+func hashFile(reader io.Reader, length uint64) (hash.Hash, error) {
+	hasher := sha512.New()
+	var hashVal hash.Hash
+	if _, err := io.CopyN(hasher, reader, int64(length)); err != nil {
+		return hashVal, err
+	}
+	copy(hashVal[:], hasher.Sum(nil))
+	return hashVal, nil
+}
+
+// addFileSystem records the local files for the objects in a file-system which
+// was scanned from dirname.
+func (objects pendingObjects) addFileSystem(fs *filesystem.FileSystem,
+	dirname string) {
+	inodeToFilenamesTable := fs.InodeToFilenamesTable()
+	for hashVal, inums := range fs.HashToInodesTable() {
+		if filenames := inodeToFilenamesTable[inums[0]]; len(filenames) > 0 {
+			objects[hashVal] = path.Join(dirname, filenames[0])
+		}
+	}
+}
+
+func (objects pendingObjects) upload(
+	objectClient *objectclient.ObjectClient) error {
+	if len(objects) < 1 {
+		return nil
+	}
+	hashes := make([]hash.Hash, 0, len(objects))
+	for hashVal := range objects {
+		hashes = append(hashes, hashVal)
+	}
+	sizes, err := objectClient.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	for index, hashVal := range hashes {
+		if sizes[index] > 0 {
+			continue
+		}
+		if err := uploadFile(objectClient, objects[hashVal],
+			hashVal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadFile uploads the contents of filename, which must still match hashVal.
+func uploadFile(objectClient *objectclient.ObjectClient, filename string,
+	hashVal hash.Hash) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	_, _, err = objectClient.AddObject(bufio.NewReader(file),
+		uint64(fi.Size()), &hashVal)
+	if err != nil {
+		return fmt.Errorf("error uploading: %s: %s", filename, err)
+	}
+	return nil
+}
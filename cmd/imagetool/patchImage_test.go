@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/sha512"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filter"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/triggers"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, pathname, data string) {
+	if err := os.MkdirAll(path.Dir(pathname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pathname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func makePatchTestTree(t *testing.T) *filesystem.DirectoryInode {
+	return makeTree(t, 0755, []treeEntry{
+		{"/etc", testDirectory(0755, 0)},
+		{"/etc/hostname", &filesystem.ComputedRegularInode{
+			Mode: syscall.S_IFREG | 0644, Source: "filegen:6969"}},
+		{"/etc/motd", &filesystem.RegularInode{Mode: syscall.S_IFREG | 0600,
+			Uid: 7, Size: 2}},
+		{"/var", testDirectory(0755, 0)},
+		{"/var/cache", testFile(3)},
+	})
+}
+
+func TestPatchTree(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, path.Join(source, "motd"), "welcome")
+	writeTestFile(t, path.Join(source, "app/bin/run"), "run")
+	writeTestFile(t, path.Join(source, "app/lib/run"), "run")
+	writeTestFile(t, path.Join(source, "app/empty"), "")
+	var tests = []struct {
+		name      string
+		spec      patchSpec
+		want      map[string]string
+		wantFiles map[string]string // Object data to local pathname.
+		wantError string
+	}{
+		{
+			name: "delete",
+			spec: patchSpec{Delete: []string{"/var"},
+				RemoveComputedFiles: []string{"etc/hostname"}},
+			want: map[string]string{"/": "40755:0", "/etc": "40755:0",
+				"/etc/motd": "2#2"},
+		},
+		{
+			name: "replace file and add symlink",
+			spec: patchSpec{Add: []patchAddition{
+				{Pathname: "/etc/motd", Source: path.Join(source, "motd")},
+				{Pathname: "/etc/hostname", Symlink: "motd"},
+			}},
+			want: map[string]string{"/": "40755:0", "/etc": "40755:0",
+				"/etc/hostname": "->motd", "/etc/motd": "7#3",
+				"/var": "40755:0", "/var/cache": "3#5"},
+			wantFiles: map[string]string{"welcome": "motd"},
+		},
+		{
+			name: "add directory",
+			spec: patchSpec{Add: []patchAddition{
+				{Pathname: "/opt", Source: path.Join(source, "app")},
+			}},
+			want: map[string]string{"/": "40755:0", "/etc": "40755:0",
+				"/etc/hostname": "@filegen:6969", "/etc/motd": "2#3",
+				"/opt":     "40755:0",
+				"/opt/bin": "40755:0", "/opt/bin/run": "3#6",
+				"/opt/empty": "0#7", "/opt/lib": "40755:0",
+				"/opt/lib/run": "3#9", "/var": "40755:0",
+				"/var/cache": "3#11"},
+			wantFiles: map[string]string{"run": "app/bin/run"},
+		},
+		{
+			name: "computed file keeps metadata",
+			spec: patchSpec{AddComputedFiles: []computedFileType{
+				{Filename: "/etc/motd", Source: "filegen:6969"},
+				{Filename: "/etc/issue", Source: "filegen:6969"},
+			}},
+			want: map[string]string{"/": "40755:0", "/etc": "40755:0",
+				"/etc/hostname": "@filegen:6969",
+				"/etc/issue":    "@filegen:6969",
+				"/etc/motd":     "@filegen:6969",
+				"/var":          "40755:0", "/var/cache": "3#6"},
+		},
+		{
+			name:      "delete missing",
+			spec:      patchSpec{Delete: []string{"/etc/missing"}},
+			wantError: "missing from image",
+		},
+		{
+			name:      "remove regular file as computed",
+			spec:      patchSpec{RemoveComputedFiles: []string{"/etc/motd"}},
+			wantError: "not a computed file",
+		},
+		{
+			name: "add below file",
+			spec: patchSpec{Add: []patchAddition{
+				{Pathname: "/var/cache/x", Symlink: "y"},
+			}},
+			wantError: "not a directory in image",
+		},
+		{
+			name: "add with source and symlink",
+			spec: patchSpec{Add: []patchAddition{
+				{Pathname: "/x", Source: path.Join(source, "motd"),
+					Symlink: "y"},
+			}},
+			wantError: "both Source and Symlink",
+		},
+		{
+			name: "computed file without source",
+			spec: patchSpec{AddComputedFiles: []computedFileType{
+				{Filename: "/etc/issue"},
+			}},
+			wantError: "no source",
+		},
+		{
+			name:      "delete root",
+			spec:      patchSpec{Delete: []string{"/"}},
+			wantError: "cannot change root directory",
+		},
+	}
+	for _, test := range tests {
+		root := makePatchTestTree(t)
+		objects := make(pendingObjects)
+		err := test.spec.patchTree(root, objects)
+		if test.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("%s: error: %v, want: %s", test.name, err,
+					test.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		fs := makeFileSystem(root)
+		if got := describeFileSystem(fs); !reflect.DeepEqual(got,
+			test.want) {
+			t.Errorf("%s: got: %v, want: %v", test.name, got, test.want)
+		}
+		wantObjects := make(pendingObjects)
+		for data, filename := range test.wantFiles {
+			wantObjects[sha512.Sum512([]byte(data))] = path.Join(source,
+				filename)
+		}
+		// Either copy of a duplicated file may be recorded.
+		for hashVal, filename := range objects {
+			objects[hashVal] = strings.Replace(filename, "/lib/", "/bin/", 1)
+		}
+		if !reflect.DeepEqual(objects, wantObjects) {
+			t.Errorf("%s: objects: %v, want: %v", test.name, objects,
+				wantObjects)
+		}
+	}
+}
+
+func TestPatchTreeKeepsMetadata(t *testing.T) {
+	source := t.TempDir()
+	writeTestFile(t, path.Join(source, "motd"), "welcome")
+	root := makePatchTestTree(t)
+	spec := patchSpec{
+		Add: []patchAddition{
+			{Pathname: "/etc/motd", Source: path.Join(source, "motd")},
+		},
+		AddComputedFiles: []computedFileType{
+			{Filename: "/etc/hostname", Source: "other:6969"},
+		},
+	}
+	if err := spec.patchTree(root, make(pendingObjects)); err != nil {
+		t.Fatal(err)
+	}
+	fs := makeFileSystem(root)
+	table := fs.FilenameToInodeTable()
+	motd := fs.InodeTable[table["/etc/motd"]].(*filesystem.RegularInode)
+	if motd.Mode != syscall.S_IFREG|0600 || motd.Uid != 7 {
+		t.Errorf("/etc/motd: mode: %o, uid: %d", motd.Mode, motd.Uid)
+	}
+	inode := fs.InodeTable[table["/etc/hostname"]]
+	hostname := inode.(*filesystem.ComputedRegularInode)
+	if hostname.Source != "other:6969" {
+		t.Errorf("/etc/hostname: source: %s", hostname.Source)
+	}
+}
+
+func TestPatchFilter(t *testing.T) {
+	var tests = []struct {
+		filter      []string // Nil: sparse image.
+		add, remove []string
+		want        []string // Nil: no filter.
+		wantError   bool
+	}{
+		{nil, nil, nil, nil, false},
+		{[]string{"/tmp"}, nil, nil, []string{"/tmp"}, false},
+		{[]string{"/tmp", "/var/log"}, []string{"/home"}, []string{"/tmp"},
+			[]string{"/var/log", "/home"}, false},
+		{nil, []string{"/tmp"}, nil, []string{"/tmp"}, false},
+		{[]string{"/tmp"}, nil, []string{"/var"}, nil, true},
+	}
+	for index, test := range tests {
+		img := &image.Image{}
+		if test.filter != nil {
+			var err error
+			if img.Filter, err = filter.NewFilter(test.filter); err != nil {
+				t.Fatal(err)
+			}
+		}
+		spec := patchSpec{AddFilterLines: test.add,
+			RemoveFilterLines: test.remove}
+		err := spec.patchFilter(img)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("test %d: error: %v", index, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got []string
+		if img.Filter != nil {
+			got = img.Filter.FilterLines
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: got: %v, want: %v", index, got, test.want)
+		}
+	}
+}
+
+func TestPatchTriggers(t *testing.T) {
+	img := &image.Image{Triggers: &triggers.Triggers{
+		Triggers: []*triggers.Trigger{
+			{Service: "sshd"}, {Service: "nginx"}, {Service: "sshd"},
+		},
+	}}
+	spec := patchSpec{
+		AddTriggers:    []*triggers.Trigger{{Service: "cron"}},
+		RemoveTriggers: []string{"sshd"},
+	}
+	spec.patchTriggers(img)
+	var got []string
+	for _, trigger := range img.Triggers.Triggers {
+		got = append(got, trigger.Service)
+	}
+	if want := []string{"nginx", "cron"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestLoadPatchSpec(t *testing.T) {
+	dirname := t.TempDir()
+	filename := path.Join(dirname, "patch.json")
+	writeTestFile(t, filename, `{"Add": [
+		{"Pathname": "/a", "Source": "files/a"},
+		{"Pathname": "/b", "Source": "/abs/b"},
+		{"Pathname": "/c", "Symlink": "a"}
+	]}`)
+	spec, err := loadPatchSpec(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []patchAddition{
+		{Pathname: "/a", Source: path.Join(dirname, "files/a")},
+		{Pathname: "/b", Source: "/abs/b"},
+		{Pathname: "/c", Symlink: "a"},
+	}
+	if !reflect.DeepEqual(spec.Add, want) {
+		t.Errorf("got: %+v, want: %+v", spec.Add, want)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	data := "some data"
+	hashVal, err := hashFile(strings.NewReader(data), uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashVal != hash.Hash(sha512.Sum512([]byte(data))) {
+		t.Errorf("hash mismatch: %x", hashVal)
+	}
+	if _, err := hashFile(strings.NewReader(data), 100); err == nil {
+		t.Error("short file accepted")
+	}
+}
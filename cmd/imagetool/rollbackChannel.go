@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"os"
+)
+
+func rollbackChannelSubcommand(args []string) {
+	imageSClient, _ := getClients()
+	var imageName string
+	if len(args) > 1 {
+		imageName = args[1]
+	}
+	imageName, err := client.RollbackChannel(imageSClient, args[0], imageName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rolling back channel\t%s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(imageName)
+	os.Exit(0)
+}
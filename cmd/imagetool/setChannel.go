@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"os"
+)
+
+func setChannelSubcommand(args []string) {
+	imageSClient, _ := getClients()
+	if err := client.SetChannel(imageSClient, args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting channel\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
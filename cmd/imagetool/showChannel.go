@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/imageserver/client"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"os"
+	"time"
+)
+
+func showChannelSubcommand(args []string) {
+	imageSClient, _ := getClients()
+	if err := showChannel(imageSClient, args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error showing channel\t%s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func showChannel(imageSClient *srpc.Client, name string) error {
+	channel, err := client.GetChannel(imageSClient, name)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return errors.New("channel: " + name + " does not exist")
+	}
+	fmt.Println(channel.ImageName)
+	for index := len(channel.History) - 1; index >= 0; index-- {
+		event := channel.History[index]
+		username := event.Username
+		if username == "" {
+			username = "-"
+		}
+		operation := "set"
+		if event.Rollback {
+			operation = "rollback"
+		}
+		fmt.Printf("  %s  %-8s  %-8s  %s\n",
+			event.Time.Format(time.RFC3339), operation, username,
+			event.ImageName)
+	}
+	return nil
+}
@@ -3,13 +3,12 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"github.com/Symantec/Dominator/lib/objectserver"
 	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"os"
 )
 
-func addObjectsSubcommand(objSrv objectserver.ObjectServer, args []string) {
+func addObjectsSubcommand(objSrv *objectclient.ObjectClient, args []string) {
 	if err := addObjects(fmt.Sprintf("%s:%d",
 		*objectServerHostname, *objectServerPortNum), args); err != nil {
 		fmt.Fprintf(os.Stderr, "Error adding obnects hash\t%s\n", err)
@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectcache"
-	"github.com/Symantec/Dominator/lib/objectserver"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	"os"
 )
 
-func checkObjectSubcommand(objSrv objectserver.ObjectServer, args []string) {
+func checkObjectSubcommand(objSrv *objectclient.ObjectClient, args []string) {
 	hashes := make([]hash.Hash, 1)
 	var err error
 	hashes[0], err = objectcache.FilenameToHash(args[0])
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/format"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectcache"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"os"
+)
+
+func deleteObjectsSubcommand(objSrv *objectclient.ObjectClient,
+	args []string) {
+	if err := deleteObjects(objSrv, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting objects\t%s\n", err)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func deleteObjects(objSrv *objectclient.ObjectClient,
+	hashStrings []string) error {
+	hashes := make([]hash.Hash, 0, len(hashStrings))
+	for _, hashString := range hashStrings {
+		hashVal, err := objectcache.FilenameToHash(hashString)
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, hashVal)
+	}
+	sizes, err := objSrv.DeleteObjects(hashes)
+	if err != nil {
+		return err
+	}
+	var numDeleted, totalFreed uint64
+	for index, size := range sizes {
+		if size < 1 {
+			fmt.Fprintf(os.Stderr, "Object: %x not found\n", hashes[index])
+			continue
+		}
+		numDeleted++
+		totalFreed += size
+	}
+	if *debug {
+		fmt.Printf("Deleted %d objects, freed %s\n",
+			numDeleted, format.FormatBytes(totalFreed))
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/format"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"os"
+)
+
+func duSubcommand(objSrv *objectclient.ObjectClient, args []string) {
+	if err := showStorageUsage(objSrv); err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting storage usage\t%s\n", err)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func showStorageUsage(objSrv *objectclient.ObjectClient) error {
+	usage, err := objSrv.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Objects:          %d (%d compressed)\n",
+		usage.NumObjects, usage.NumCompressed)
+	fmt.Printf("Object data:      %s\n", format.FormatBytes(usage.ObjectBytes))
+	fmt.Printf("Stored data:      %s\n", format.FormatBytes(usage.StoredBytes))
+	fmt.Printf("File-system:      %s\n",
+		format.FormatBytes(usage.FileSystemBytes))
+	fmt.Printf("File-system free: %s\n",
+		format.FormatBytes(usage.FileSystemFreeBytes))
+	return nil
+}
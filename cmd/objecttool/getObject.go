@@ -6,13 +6,14 @@ import (
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectcache"
 	"github.com/Symantec/Dominator/lib/objectserver"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	"os"
 	"syscall"
 )
 
 const filePerms = syscall.S_IRUSR | syscall.S_IWUSR | syscall.S_IRGRP
 
-func getObjectSubcommand(objSrv objectserver.ObjectServer, args []string) {
+func getObjectSubcommand(objSrv *objectclient.ObjectClient, args []string) {
 	hash, err := objectcache.FilenameToHash(args[0])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing hash\t%s\n", err)
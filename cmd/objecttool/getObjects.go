@@ -7,12 +7,13 @@ import (
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectcache"
 	"github.com/Symantec/Dominator/lib/objectserver"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	"io"
 	"os"
 	"syscall"
 )
 
-func getObjectsSubcommand(objSrv objectserver.ObjectServer, args []string) {
+func getObjectsSubcommand(objSrv *objectclient.ObjectClient, args []string) {
 	if err := getObjects(objSrv, args[0], args[1]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error getting objects\t%s\n", err)
 		os.Exit(2)
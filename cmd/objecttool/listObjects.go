@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"os"
+)
+
+func listObjectsSubcommand(objSrv *objectclient.ObjectClient, args []string) {
+	if err := listObjects(objSrv); err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing objects\t%s\n", err)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func listObjects(objSrv *objectclient.ObjectClient) error {
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	return objSrv.ListObjects(func(hashVal hash.Hash, size uint64) error {
+		_, err := fmt.Fprintf(writer, "%x %d\n", hashVal, size)
+		return err
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"github.com/Symantec/Dominator/lib/constants"
-	"github.com/Symantec/Dominator/lib/objectserver"
 	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
 	"os"
 	"path"
@@ -19,6 +18,8 @@ var (
 	keyFile = flag.String("keyFile",
 		path.Join(os.Getenv("HOME"), ".ssl/key.pem"),
 		"Name of file containing the user SSL key")
+	maxBytesPerSecond = flag.Uint64("maxBytesPerSecond", 0,
+		"Maximum server read rate when verifying objects (0: server maximum)")
 	objectServerHostname = flag.String("objectServerHostname", "localhost",
 		"Hostname of image server")
 	objectServerPortNum = flag.Uint("objectServerPortNum",
@@ -28,17 +29,21 @@ var (
 
 func printUsage() {
 	fmt.Fprintln(os.Stderr,
-		"Usage: objecttool [flags...] check|delete|list [args...]")
+		"Usage: objecttool [flags...] command [args...]")
 	fmt.Fprintln(os.Stderr, "Common flags:")
 	flag.PrintDefaults()
 	fmt.Fprintln(os.Stderr, "Commands:")
 	fmt.Fprintln(os.Stderr, "  add    files...")
 	fmt.Fprintln(os.Stderr, "  check  hash")
+	fmt.Fprintln(os.Stderr, "  delete hash...")
+	fmt.Fprintln(os.Stderr, "  du")
 	fmt.Fprintln(os.Stderr, "  get    hash baseOutputFilename")
+	fmt.Fprintln(os.Stderr, "  list")
 	fmt.Fprintln(os.Stderr, "  mget   hashesFile directory")
+	fmt.Fprintln(os.Stderr, "  verify [hash...]")
 }
 
-type commandFunc func(objectserver.ObjectServer, []string)
+type commandFunc func(*objectclient.ObjectClient, []string)
 
 type subcommand struct {
 	command string
@@ -50,8 +55,12 @@ type subcommand struct {
 var subcommands = []subcommand{
 	{"add", 1, -1, addObjectsSubcommand},
 	{"check", 1, 1, checkObjectSubcommand},
+	{"delete", 1, -1, deleteObjectsSubcommand},
+	{"du", 0, 0, duSubcommand},
 	{"get", 2, 2, getObjectSubcommand},
+	{"list", 0, 0, listObjectsSubcommand},
 	{"mget", 2, 2, getObjectsSubcommand},
+	{"verify", 0, -1, verifyObjectsSubcommand},
 }
 
 func main() {
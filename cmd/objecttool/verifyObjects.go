@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectcache"
+	objectclient "github.com/Symantec/Dominator/lib/objectserver/client"
+	"os"
+)
+
+func verifyObjectsSubcommand(objSrv *objectclient.ObjectClient,
+	args []string) {
+	numFailed, err := verifyObjects(objSrv, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error verifying objects\t%s\n", err)
+		os.Exit(2)
+	}
+	if numFailed > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func verifyObjects(objSrv *objectclient.ObjectClient,
+	hashStrings []string) (uint64, error) {
+	hashes := make([]hash.Hash, 0, len(hashStrings))
+	for _, hashString := range hashStrings {
+		hashVal, err := objectcache.FilenameToHash(hashString)
+		if err != nil {
+			return 0, err
+		}
+		hashes = append(hashes, hashVal)
+	}
+	var numFailed uint64
+	numVerified, err := objSrv.VerifyObjects(hashes, *maxBytesPerSecond,
+		func(hashVal hash.Hash, err error) {
+			numFailed++
+			fmt.Printf("%x: %s\n", hashVal, err)
+		})
+	if err != nil {
+		return numFailed, err
+	}
+	fmt.Fprintf(os.Stderr, "Verified %d objects, %d failed\n",
+		numVerified, numFailed)
+	return numFailed, nil
+}
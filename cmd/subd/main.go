@@ -32,6 +32,12 @@ var (
 		"Name of file containing the root of trust")
 	certFile = flag.String("certFile", "/etc/ssl/subd/cert.pem",
 		"Name of file containing the SSL certificate")
+	crlFile = flag.String("crlFile", "",
+		"Name of file containing CRLs for rejecting client certificates")
+	denyListFile = flag.String("denyListFile", "",
+		"Name of file containing denied certificate serials and usernames")
+	groupPolicyFile = flag.String("groupPolicyFile", "",
+		"Name of file containing the methods and directories groups may use")
 	keyFile = flag.String("keyFile", "/etc/ssl/subd/key.pem",
 		"Name of file containing the SSL key")
 	logbufLines = flag.Uint("logbufLines", 1024,
@@ -280,13 +286,26 @@ func main() {
 	circularBuffer := logbuf.New(*logbufLines)
 	logger := log.New(circularBuffer, "", log.LstdFlags)
 	insecureMode := false
-	if err := setupTls(*caFile, *certFile, *keyFile); err != nil {
+	tlsLoader, err := setupTls(*caFile, *certFile, *keyFile)
+	if err != nil {
 		insecureMode = true
 		logger.Println(err)
 		circularBuffer.Flush()
 		if !*permitInsecureMode {
 			os.Exit(1)
 		}
+	} else {
+		tlsLoader.Watch(logger)
+	}
+	if err := setupRevocation(*crlFile, *denyListFile, logger); err != nil {
+		logger.Println(err)
+		circularBuffer.Flush()
+		os.Exit(1)
+	}
+	if _, err := setupGroupPolicy(*groupPolicyFile, logger); err != nil {
+		logger.Println(err)
+		circularBuffer.Flush()
+		os.Exit(1)
 	}
 	bytesPerSecond, blocksPerSecond, firstScan, ok := getCachedFsSpeed(
 		workingRootDir, tmpDir)
@@ -295,7 +314,6 @@ func main() {
 	}
 	publishFsSpeed(bytesPerSecond, blocksPerSecond)
 	var configuration scanner.Configuration
-	var err error
 	configuration.ScanFilter, err = filter.NewFilter(constants.ScanExcludeList)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to set default scan exclusions\t%s\n",
@@ -335,6 +353,9 @@ func main() {
 		}
 		httpd.AddHtmlWriter(&fsh)
 		httpd.AddHtmlWriter(&configuration)
+		if tlsLoader != nil {
+			httpd.AddHtmlWriter(tlsLoader)
+		}
 		httpd.AddHtmlWriter(circularBuffer)
 		html.RegisterHtmlWriterForPattern("/dumpFileSystem",
 			"Scanned File System",
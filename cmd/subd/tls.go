@@ -2,38 +2,54 @@ package main
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
+	"github.com/Symantec/Dominator/lib/grouppolicy"
+	"github.com/Symantec/Dominator/lib/revocation"
 	"github.com/Symantec/Dominator/lib/srpc"
-	"io/ioutil"
+	"github.com/Symantec/Dominator/lib/tlsloader"
+	"log"
 )
 
-func setupTls(caFile, certFile, keyFile string) error {
+func setupTls(caFile, certFile, keyFile string) (*tlsloader.Loader, error) {
 	// Load certificates and key.
-	caData, err := ioutil.ReadFile(caFile)
+	loader, err := tlsloader.New(caFile, certFile, keyFile)
 	if err != nil {
-		return fmt.Errorf("unable to load CA file: \"%s\": %s", caFile, err)
-	}
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caData) {
-		return fmt.Errorf("unable to parse CA file")
+		return nil, fmt.Errorf("unable to load certificates: %s", err)
 	}
 	// Setup server.
 	serverConfig := new(tls.Config)
 	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	serverConfig.MinVersion = tls.VersionTLS12
-	serverConfig.ClientCAs = caCertPool
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return fmt.Errorf("unable to load keypair: %s", err)
-	}
-	serverConfig.Certificates = append(serverConfig.Certificates, cert)
-	srpc.RegisterServerTlsConfig(serverConfig, true)
+	srpc.RegisterServerTlsConfig(loader.ServerConfig(serverConfig), true)
 	// Setup client.
 	clientConfig := new(tls.Config)
 	clientConfig.InsecureSkipVerify = true
 	clientConfig.MinVersion = tls.VersionTLS12
-	clientConfig.Certificates = append(clientConfig.Certificates, cert)
-	srpc.RegisterClientTlsConfig(clientConfig)
+	srpc.RegisterClientTlsConfig(loader.ClientConfig(clientConfig))
+	return loader, nil
+}
+
+func setupRevocation(crlFile, denyListFile string, logger *log.Logger) error {
+	if crlFile == "" && denyListFile == "" {
+		return nil
+	}
+	list, err := revocation.New(crlFile, denyListFile, logger)
+	if err != nil {
+		return err
+	}
+	srpc.RegisterRevocationChecker(list)
 	return nil
 }
+
+func setupGroupPolicy(filename string, logger *log.Logger) (
+	*grouppolicy.Policy, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	policy, err := grouppolicy.New(filename, logger)
+	if err != nil {
+		return nil, err
+	}
+	srpc.RegisterGroupPolicy(policy)
+	return policy, nil
+}
@@ -101,6 +101,7 @@ type missingImage struct {
 type Herd struct {
 	sync.RWMutex         // Protect map and slice mutations.
 	imageServerAddress   string
+	objectServerAddress  string // Where subs fetch objects from.
 	objectServer         objectserver.ObjectServer
 	computedFilesManager *filegenclient.Manager
 	logger               *log.Logger
@@ -109,6 +110,10 @@ type Herd struct {
 	subsByName           map[string]*Sub
 	subsByIndex          []*Sub // Sorted by Sub.hostname.
 	imagesByName         map[string]*image.Image
+	channels             map[string]string // Channel name to image name.
+	channelsChanged      bool
+	lastMdb              *mdb.Mdb           // Channels not resolved.
+	trustedKeys          *image.TrustedKeys // If nil, all images are trusted.
 	missingImages        map[string]missingImage
 	connectionSemaphore  chan struct{}
 	pollSemaphore        chan struct{}
@@ -131,6 +136,20 @@ func (herd *Herd) PollNextSub() bool {
 	return herd.pollNextSub()
 }
 
+// SetTrustedKeys will restrict the images that are deployed to those signed by
+// keys which are trusted for the image directory. This should be called
+// before polling starts.
+func (herd *Herd) SetTrustedKeys(trustedKeys *image.TrustedKeys) {
+	herd.trustedKeys = trustedKeys
+}
+
+// SetObjectServerAddress will direct subs to fetch objects from the specified
+// object server (such as a caching objectserver near the subs) instead of from
+// the image server. This should be called before polling starts.
+func (herd *Herd) SetObjectServerAddress(address string) {
+	herd.objectServerAddress = address
+}
+
 func (herd *Herd) StartServer(portNum uint, daemon bool) error {
 	return herd.startServer(portNum, daemon)
 }
@@ -0,0 +1,112 @@
+package herd
+
+import (
+	"encoding/gob"
+	"errors"
+	"github.com/Symantec/Dominator/lib/mdb"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"io"
+	"time"
+)
+
+// watchChannels follows the image update stream from the imageserver to keep
+// the table of channels up to date. It never returns.
+func (herd *Herd) watchChannels() {
+	initialTimeout := time.Second * 15
+	timeout := initialTimeout
+	for {
+		nextSleepStopTime := time.Now().Add(timeout)
+		if client, err := srpc.DialHTTP("tcp", herd.imageServerAddress,
+			timeout); err != nil {
+			herd.logger.Printf("Error dialling: %s %s\n",
+				herd.imageServerAddress, err)
+		} else {
+			if conn, err := client.Call(
+				"ImageServer.GetImageUpdates"); err != nil {
+				herd.logger.Println(err)
+			} else {
+				if err := herd.getChannelUpdates(conn); err != nil {
+					if err == io.EOF {
+						herd.logger.Println(
+							"Connection to imageserver for channels closed")
+						if nextSleepStopTime.Sub(time.Now()) < 1 {
+							timeout = initialTimeout
+						}
+					} else {
+						herd.logger.Println(err)
+					}
+				}
+				conn.Close()
+			}
+			client.Close()
+		}
+		time.Sleep(nextSleepStopTime.Sub(time.Now()))
+		if timeout < time.Minute {
+			timeout *= 2
+		}
+	}
+}
+
+func (herd *Herd) getChannelUpdates(conn *srpc.Conn) error {
+	decoder := gob.NewDecoder(conn)
+	initialChannels := make(map[string]string)
+	for {
+		var imageUpdate imageserver.ImageUpdate
+		if err := decoder.Decode(&imageUpdate); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return errors.New("decode err: " + err.Error())
+		}
+		switch imageUpdate.Operation {
+		case imageserver.OperationAddImage:
+			if imageUpdate.Name == "" && initialChannels != nil {
+				herd.Lock()
+				herd.channels = initialChannels
+				herd.channelsChanged = true
+				herd.Unlock()
+				initialChannels = nil
+			}
+		case imageserver.OperationUpdateChannel:
+			channel := imageUpdate.Channel
+			if channel == nil {
+				return errors.New("nil imageUpdate.Channel")
+			}
+			if initialChannels != nil {
+				initialChannels[channel.Name] = channel.ImageName
+				continue
+			}
+			herd.logger.Printf("Channel: %s now points to: %s\n",
+				channel.Name, channel.ImageName)
+			herd.Lock()
+			herd.channels[channel.Name] = channel.ImageName
+			herd.channelsChanged = true
+			herd.Unlock()
+		}
+	}
+}
+
+// checkChannelUpdates will re-apply the last MDB if channels have changed.
+func (herd *Herd) checkChannelUpdates() {
+	herd.RLock()
+	changed := herd.channelsChanged
+	mdb := herd.lastMdb
+	herd.RUnlock()
+	if !changed || mdb == nil {
+		return
+	}
+	herd.logger.Println("Channels changed: re-applying MDB")
+	herd.mdbUpdate(mdb)
+}
+
+// This must be called with the lock held.
+func (herd *Herd) resolveChannels(machine mdb.Machine) mdb.Machine {
+	if imageName, ok := herd.channels[machine.RequiredImage]; ok {
+		machine.RequiredImage = imageName
+	}
+	if imageName, ok := herd.channels[machine.PlannedImage]; ok {
+		machine.PlannedImage = imageName
+	}
+	return machine
+}
@@ -16,6 +16,7 @@ func newHerd(imageServerAddress string, objectServer objectserver.ObjectServer,
 	logger *log.Logger) *Herd {
 	var herd Herd
 	herd.imageServerAddress = imageServerAddress
+	herd.objectServerAddress = imageServerAddress
 	herd.objectServer = objectServer
 	herd.computedFilesManager = filegenclient.New(objectServer, logger)
 	herd.logger = logger
@@ -40,10 +41,12 @@ func newHerd(imageServerAddress string, objectServer objectserver.ObjectServer,
 	herd.pushSemaphore = make(chan struct{}, runtime.NumCPU())
 	herd.computeSemaphore = make(chan struct{}, runtime.NumCPU())
 	herd.currentScanStartTime = time.Now()
+	go herd.watchChannels()
 	return &herd
 }
 
 func (herd *Herd) pollNextSub() bool {
+	herd.checkChannelUpdates()
 	if herd.nextSubToPoll >= uint(len(herd.subsByIndex)) {
 		herd.nextSubToPoll = 0
 		herd.previousScanDuration = time.Since(herd.currentScanStartTime)
@@ -30,6 +30,11 @@ func (herd *Herd) writeHtml(writer io.Writer) {
 	}
 	fmt.Fprintf(writer, "Image server: <a href=\"http://%s/\">%s</a><br>\n",
 		herd.imageServerAddress, herd.imageServerAddress)
+	if herd.objectServerAddress != herd.imageServerAddress {
+		fmt.Fprintf(writer,
+			"Object server: <a href=\"http://%s/\">%s</a><br>\n",
+			herd.objectServerAddress, herd.objectServerAddress)
+	}
 	fmt.Fprintf(writer,
 		"Number of <a href=\"listSubs\">subs</a>: <a href=\"showAllSubs\">%d</a><br>\n",
 		numSubs)
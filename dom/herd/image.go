@@ -58,6 +58,13 @@ func (herd *Herd) getImageHaveLock(name string) (*image.Image, error) {
 	if img == nil {
 		herd.missingImages[name] = missingImage{time.Now(), nil}
 	} else {
+		if herd.trustedKeys != nil {
+			if err := herd.trustedKeys.VerifyImage(name, img); err != nil {
+				herd.missingImages[name] = missingImage{time.Now(), err}
+				herd.logger.Printf("Untrusted image: %s\n", err)
+				return nil, err
+			}
+		}
 		if err := img.FileSystem.RebuildInodePointers(); err != nil {
 			herd.logger.Printf("Error building inode pointers for image: %s %s",
 				name, err)
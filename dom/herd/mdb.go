@@ -29,6 +29,8 @@ func (herd *Herd) mdbUpdateNoLogging(mdb *mdb.Mdb) (int, int, int) {
 	herd.Lock()
 	defer herd.Unlock()
 	startTime := time.Now()
+	herd.lastMdb = mdb
+	herd.channelsChanged = false
 	numNew := 0
 	numDeleted := 0
 	numChanged := 0
@@ -39,6 +41,7 @@ func (herd *Herd) mdbUpdateNoLogging(mdb *mdb.Mdb) (int, int, int) {
 		subsToDelete[sub.mdb.Hostname] = struct{}{}
 	}
 	for _, machine := range mdb.Machines { // Sorted by Hostname.
+		machine = herd.resolveChannels(machine)
 		sub := herd.subsByName[machine.Hostname]
 		img, _ := herd.getImageHaveLock(machine.RequiredImage) // Preload.
 		if sub == nil {
@@ -1,6 +1,7 @@
 package herd
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/Symantec/Dominator/lib/constants"
@@ -18,7 +19,11 @@ import (
 	"time"
 )
 
+const minimumPushRate = 1 << 20 // Bytes per second.
+
 var (
+	subCallTimeout = flag.Uint("subCallTimeout", 300,
+		"Seconds per sub call, plus 1s per MiB pushed. If zero, no limit")
 	subConnectTimeout = flag.Uint("subConnectTimeout", 15,
 		"Timeout in seconds for sub connections. If zero, OS timeout is used")
 	logUnknownSubConnectErrors = flag.Bool("logUnknownSubConnectErrors", false,
@@ -48,6 +53,18 @@ func (sub *Sub) getComputedFiles(im *image.Image) []filegenclient.ComputedFile {
 	return computedFiles
 }
 
+// newCallContext returns the context for a call to a sub, which is abandoned if
+// the sub does not finish it in time. Calls which send numBytes of data are
+// given longer, so that large pushes are not abandoned while making progress.
+func newCallContext(numBytes uint64) (context.Context, context.CancelFunc) {
+	if *subCallTimeout < 1 {
+		return context.WithCancel(context.Background())
+	}
+	timeout := time.Second * time.Duration(*subCallTimeout)
+	timeout += time.Second * time.Duration(numBytes/minimumPushRate)
+	return context.WithTimeout(context.Background(), timeout)
+}
+
 func (sub *Sub) tryMakeBusy() bool {
 	sub.busyMutex.Lock()
 	defer sub.busyMutex.Unlock()
@@ -202,7 +219,10 @@ func (sub *Sub) poll(srpcClient *srpc.Client, previousStatus subStatus) {
 		haveImage = true
 	}
 	logger := sub.herd.logger
-	if err := client.CallPoll(srpcClient, request, &reply); err != nil {
+	ctx, cancel := newCallContext(0)
+	err := client.CallPollContext(ctx, srpcClient, request, &reply)
+	cancel()
+	if err != nil {
 		sub.pollTime = time.Time{}
 		if err == srpc.ErrorAccessToMethodDenied {
 			sub.status = statusPollDenied
@@ -344,7 +364,7 @@ func (sub *Sub) fetchMissingObjects(srpcClient *srpc.Client, imageName string,
 	}
 	logger := sub.herd.logger
 	objectsToFetch := make(map[hash.Hash]struct{})
-	objectsToPush := make(map[hash.Hash]struct{})
+	objectsToPush := make(map[hash.Hash]uint64)
 	for inum, inode := range image.FileSystem.InodeTable {
 		if rInode, ok := inode.(*filesystem.RegularInode); ok {
 			if rInode.Size > 0 {
@@ -359,7 +379,7 @@ func (sub *Sub) fetchMissingObjects(srpcClient *srpc.Client, imageName string,
 						sub, pathname)
 					return false, statusMissingComputedFile
 				} else {
-					objectsToPush[inode.Hash] = struct{}{}
+					objectsToPush[inode.Hash] = inode.Size
 				}
 			}
 		}
@@ -385,7 +405,10 @@ func (sub *Sub) fetchMissingObjects(srpcClient *srpc.Client, imageName string,
 		for hash := range objectsToFetch {
 			hashes = append(hashes, hash)
 		}
-		err := client.Fetch(srpcClient, sub.herd.imageServerAddress, hashes)
+		ctx, cancel := newCallContext(0)
+		err := client.FetchContext(ctx, srpcClient,
+			sub.herd.objectServerAddress, hashes)
+		cancel()
 		if err != nil {
 			logger.Printf("Error calling %s.Fetch()\t%s\n", sub, err)
 			if err == srpc.ErrorAccessToMethodDenied {
@@ -400,7 +423,13 @@ func (sub *Sub) fetchMissingObjects(srpcClient *srpc.Client, imageName string,
 		sub.herd.pushSemaphore <- struct{}{}
 		defer func() { <-sub.herd.pushSemaphore }()
 		sub.status = statusPushing
-		objQ, err := objectclient.NewObjectAdderQueue(srpcClient)
+		var numBytes uint64
+		for _, size := range objectsToPush {
+			numBytes += size
+		}
+		ctx, cancel := newCallContext(numBytes)
+		defer cancel()
+		objQ, err := objectclient.NewObjectAdderQueueContext(ctx, srpcClient)
 		if err != nil {
 			logger.Printf("Error creating object adder queue for: %s: %s\n",
 				sub, err)
@@ -452,7 +481,10 @@ func (sub *Sub) sendUpdate(srpcClient *srpc.Client) (bool, subStatus) {
 	}
 	sub.status = statusSendingUpdate
 	sub.lastUpdateTime = time.Now()
-	if err := client.CallUpdate(srpcClient, request, &reply); err != nil {
+	ctx, cancel := newCallContext(0)
+	defer cancel()
+	if err := client.CallUpdateContext(ctx, srpcClient, request,
+		&reply); err != nil {
 		logger.Printf("Error calling %s:Subd.Update()\t%s\n", sub, err)
 		if err == srpc.ErrorAccessToMethodDenied {
 			return false, statusUpdateDenied
@@ -496,7 +528,9 @@ func (sub *Sub) cleanup(srpcClient *srpc.Client, plannedImageName string) {
 	for hash := range unusedObjects {
 		hashes = append(hashes, hash)
 	}
-	if err := client.Cleanup(srpcClient, hashes); err != nil {
+	ctx, cancel := newCallContext(0)
+	defer cancel()
+	if err := client.CleanupContext(ctx, srpcClient, hashes); err != nil {
 		logger.Printf("Error calling %s:Subd.Cleanup()\t%s\n", sub, err)
 	}
 }
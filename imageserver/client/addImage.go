@@ -2,12 +2,18 @@ package client
 
 import (
 	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/image/lint"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/imageserver"
 )
 
-func addImage(client *srpc.Client, name string, img *image.Image) error {
+func addImage(client *srpc.Client, name string, img *image.Image) (
+	[]lint.Violation, error) {
 	request := imageserver.AddImageRequest{name, img}
 	var reply imageserver.AddImageResponse
-	return client.RequestReply("ImageServer.AddImage", request, &reply)
+	err := client.RequestReply("ImageServer.AddImage", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Warnings, nil
 }
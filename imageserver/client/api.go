@@ -1,11 +1,23 @@
 package client
 
 import (
+	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/image/lint"
 	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"io"
 )
 
 func AddImage(client *srpc.Client, name string, img *image.Image) error {
+	_, err := addImage(client, name, img)
+	return err
+}
+
+// AddImageWithWarnings is like AddImage, but it also returns the policy
+// violations which the imageserver reported as warnings.
+func AddImageWithWarnings(client *srpc.Client, name string,
+	img *image.Image) ([]lint.Violation, error) {
 	return addImage(client, name, img)
 }
 
@@ -17,14 +29,47 @@ func ChownDirectory(client *srpc.Client, dirname, ownerGroup string) error {
 	return chownDirectory(client, dirname, ownerGroup)
 }
 
+func DeleteChannel(client *srpc.Client, name string) error {
+	return deleteChannel(client, name)
+}
+
 func DeleteImage(client *srpc.Client, name string) error {
 	return deleteImage(client, name)
 }
 
+// ExportImage writes the image specified by request.ImageName to writer, as a
+// tar archive or an OCI image layout in a tar archive.
+func ExportImage(client *srpc.Client, request imageserver.ExportImageRequest,
+	writer io.Writer) error {
+	return exportImage(client, request, writer)
+}
+
+func FindImages(client *srpc.Client, labels map[string]string) (
+	[]string, error) {
+	return findImages(client, labels)
+}
+
+// FindImagesContaining returns the names of images which contain the
+// specified pathname and/or object. If both are specified, images must contain
+// both.
+func FindImagesContaining(client *srpc.Client, pathname string,
+	object *hash.Hash) ([]string, error) {
+	return findImagesContaining(client, pathname, object)
+}
+
+// GetChannel returns the channel, or nil if it does not exist.
+func GetChannel(client *srpc.Client, name string) (*image.Channel, error) {
+	return getChannel(client, name)
+}
+
 func GetImage(client *srpc.Client, name string) (*image.Image, error) {
 	return getImage(client, name)
 }
 
+func ListChannels(client *srpc.Client) ([]string, error) {
+	return listChannels(client)
+}
+
 func ListDirectories(client *srpc.Client) ([]image.Directory, error) {
 	return listDirectories(client)
 }
@@ -36,3 +81,15 @@ func ListImages(client *srpc.Client) ([]string, error) {
 func MakeDirectory(client *srpc.Client, dirname string) error {
 	return makeDirectory(client, dirname)
 }
+
+// RollbackChannel sets the channel to an image from its history. If imageName
+// is empty, the image prior to the current image is used. The image selected
+// is returned.
+func RollbackChannel(client *srpc.Client, channelName, imageName string) (
+	string, error) {
+	return rollbackChannel(client, channelName, imageName)
+}
+
+func SetChannel(client *srpc.Client, channelName, imageName string) error {
+	return setChannel(client, channelName, imageName)
+}
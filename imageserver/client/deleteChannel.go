@@ -0,0 +1,12 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func deleteChannel(client *srpc.Client, name string) error {
+	request := imageserver.DeleteChannelRequest{ChannelName: name}
+	var reply imageserver.DeleteChannelResponse
+	return client.RequestReply("ImageServer.DeleteChannel", request, &reply)
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"encoding/gob"
+	"errors"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"io"
+)
+
+func exportImage(client *srpc.Client, request imageserver.ExportImageRequest,
+	writer io.Writer) error {
+	conn, err := client.Call("ImageServer.ExportImage")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := gob.NewEncoder(conn).Encode(request); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	decoder := gob.NewDecoder(conn)
+	for {
+		var chunk imageserver.ExportImageChunk
+		if err := decoder.Decode(&chunk); err != nil {
+			return err
+		}
+		if chunk.Error != "" {
+			return errors.New(chunk.Error)
+		}
+		if len(chunk.Data) < 1 {
+			return nil
+		}
+		if _, err := writer.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
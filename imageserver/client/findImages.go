@@ -0,0 +1,17 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func findImages(client *srpc.Client, labels map[string]string) (
+	[]string, error) {
+	request := imageserver.FindImagesRequest{Labels: labels}
+	var reply imageserver.FindImagesResponse
+	err := client.RequestReply("ImageServer.FindImages", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.ImageNames, nil
+}
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func findImagesContaining(client *srpc.Client, pathname string,
+	object *hash.Hash) ([]string, error) {
+	request := imageserver.FindImagesContainingRequest{
+		Pathname: pathname,
+		Object:   object,
+	}
+	var reply imageserver.FindImagesContainingResponse
+	err := client.RequestReply("ImageServer.FindImagesContaining", request,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.ImageNames, nil
+}
@@ -0,0 +1,17 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func getChannel(client *srpc.Client, name string) (*image.Channel, error) {
+	request := imageserver.GetChannelRequest{ChannelName: name}
+	var reply imageserver.GetChannelResponse
+	err := client.RequestReply("ImageServer.GetChannel", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Channel, nil
+}
@@ -0,0 +1,16 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func listChannels(client *srpc.Client) ([]string, error) {
+	var request imageserver.ListChannelsRequest
+	var reply imageserver.ListChannelsResponse
+	err := client.RequestReply("ImageServer.ListChannels", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.ChannelNames, nil
+}
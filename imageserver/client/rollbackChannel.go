@@ -0,0 +1,20 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func rollbackChannel(client *srpc.Client, channelName, imageName string) (
+	string, error) {
+	request := imageserver.RollbackChannelRequest{
+		ChannelName: channelName,
+		ImageName:   imageName,
+	}
+	var reply imageserver.RollbackChannelResponse
+	err := client.RequestReply("ImageServer.RollbackChannel", request, &reply)
+	if err != nil {
+		return "", err
+	}
+	return reply.ImageName, nil
+}
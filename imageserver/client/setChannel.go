@@ -0,0 +1,15 @@
+package client
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func setChannel(client *srpc.Client, channelName, imageName string) error {
+	request := imageserver.SetChannelRequest{
+		ChannelName: channelName,
+		ImageName:   imageName,
+	}
+	var reply imageserver.SetChannelResponse
+	return client.RequestReply("ImageServer.SetChannel", request, &reply)
+}
@@ -28,12 +28,19 @@ func StartServer(portNum uint, imdb *scanner.ImageDataBase,
 	}
 	myState := state{imageDataBase: imdb, objectServer: objSrv}
 	http.HandleFunc("/", statusHandler)
+	http.HandleFunc("/diffImages", myState.diffImagesHandler)
+	http.HandleFunc("/exportImage", myState.exportImageHandler)
+	http.HandleFunc("/findImages", myState.findImagesHandler)
+	http.HandleFunc("/findImagesContaining",
+		myState.findImagesContainingHandler)
 	http.HandleFunc("/listBuildLog", myState.listBuildLogHandler)
 	http.HandleFunc("/listComputedInodes", myState.listComputedInodesHandler)
 	http.HandleFunc("/listDirectories", myState.listDirectoriesHandler)
 	http.HandleFunc("/listFilter", myState.listFilterHandler)
 	http.HandleFunc("/listImage", myState.listImageHandler)
 	http.HandleFunc("/listImages", myState.listImagesHandler)
+	http.HandleFunc("/listManifest", myState.listManifestHandler)
+	http.HandleFunc("/listPackages", myState.listPackagesHandler)
 	http.HandleFunc("/listReleaseNotes", myState.listReleaseNotesHandler)
 	http.HandleFunc("/listTriggers", myState.listTriggersHandler)
 	http.HandleFunc("/showImage", myState.showImageHandler)
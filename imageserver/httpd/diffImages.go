@@ -0,0 +1,79 @@
+package httpd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"html"
+	"net/http"
+)
+
+func (s state) diffImagesHandler(w http.ResponseWriter, req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	query := req.URL.Query()
+	leftName := query.Get("left")
+	rightName := query.Get("right")
+	leftImage := s.imageDataBase.GetImage(leftName)
+	rightImage := s.imageDataBase.GetImage(rightName)
+	output := query.Get("output")
+	if leftImage == nil || rightImage == nil {
+		if output == "" {
+			fmt.Fprintln(writer, "<title>imageserver image diff</title>")
+			fmt.Fprintln(writer, "<body>")
+			fmt.Fprintln(writer, `<form action="diffImages" method="get">`)
+			fmt.Fprintf(writer,
+				"Left: <input type=\"text\" name=\"left\" value=\"%s\">\n",
+				html.EscapeString(leftName))
+			fmt.Fprintf(writer,
+				"Right: <input type=\"text\" name=\"right\" value=\"%s\">\n",
+				html.EscapeString(rightName))
+			fmt.Fprintln(writer, `<input type="submit" value="Compare">`)
+			fmt.Fprintln(writer, "</form>")
+			if leftName != "" || rightName != "" {
+				fmt.Fprintln(writer, "Unknown image(s)<br>")
+			}
+			fmt.Fprintln(writer, "</body>")
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	diff := filesystem.DiffFileSystems(leftImage.FileSystem,
+		rightImage.FileSystem, nil)
+	switch output {
+	case "json":
+		json.NewEncoder(writer).Encode(diff)
+		return
+	case "text":
+		diff.WriteText(writer)
+		return
+	}
+	fmt.Fprintf(writer, "<title>diff %s %s</title>\n",
+		html.EscapeString(leftName), html.EscapeString(rightName))
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintf(writer, "<h3>Differences from: %s to: %s</h3>\n",
+		html.EscapeString(leftName), html.EscapeString(rightName))
+	if diff.Empty() {
+		fmt.Fprintln(writer, "No differences<br>")
+	} else {
+		fmt.Fprintf(writer, "%d added, %d removed, %d changed<br>\n",
+			len(diff.Added), len(diff.Removed), len(diff.Changed))
+		fmt.Fprintln(writer, "<pre>")
+		diff.WriteText(&htmlEscaper{writer})
+		fmt.Fprintln(writer, "</pre>")
+	}
+	fmt.Fprintln(writer, "</body>")
+}
+
+type htmlEscaper struct {
+	writer *bufio.Writer
+}
+
+func (w *htmlEscaper) Write(p []byte) (int, error) {
+	if _, err := w.writer.WriteString(html.EscapeString(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
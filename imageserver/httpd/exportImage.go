@@ -0,0 +1,51 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/image/export"
+	"net/http"
+	"path"
+)
+
+func (s state) exportImageHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	imageName := query.Get("name")
+	image := s.imageDataBase.GetImage(imageName)
+	if image == nil {
+		http.NotFound(w, req)
+		return
+	}
+	exportType := query.Get("type")
+	if exportType == "" {
+		exportType = "tar"
+	}
+	if exportType != "tar" && exportType != "oci" {
+		http.Error(w, "unknown export type: "+exportType,
+			http.StatusBadRequest)
+		return
+	}
+	// Images do not record the architecture of their binaries.
+	architecture := query.Get("architecture")
+	if architecture == "" {
+		architecture = "amd64"
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename=\"%s.%s.tar\"", path.Base(imageName),
+		exportType))
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	var err error
+	if exportType == "oci" {
+		err = export.WriteOCI(writer, image, path.Base(imageName),
+			architecture, s.objectServer)
+	} else {
+		err = export.WriteTar(writer, image.FileSystem, s.objectServer)
+	}
+	if err != nil {
+		// Headers have already been sent, so abort the connection to ensure
+		// the client sees a truncated stream.
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,86 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/verstr"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func (s state) findImagesHandler(w http.ResponseWriter, req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	selector := make(map[string]string)
+	textOutput := false
+	for key, values := range req.URL.Query() {
+		if key == "output" {
+			textOutput = len(values) > 0 && values[0] == "text"
+			continue
+		}
+		if key == "q" { // From the search form: key=value,key=value...
+			for _, value := range values {
+				parseLabelsQuery(selector, value)
+			}
+			continue
+		}
+		if len(values) > 0 {
+			selector[key] = values[0]
+		} else {
+			selector[key] = ""
+		}
+	}
+	imageNames := s.imageDataBase.FindImages(selector)
+	verstr.Sort(imageNames)
+	if textOutput {
+		for _, name := range imageNames {
+			fmt.Fprintln(writer, name)
+		}
+		return
+	}
+	fmt.Fprintln(writer, "<title>imageserver image search</title>")
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, `<form action="findImages" method="get">`)
+	fmt.Fprintln(writer,
+		`Labels (key=value,...): <input type="text" name="q">`)
+	fmt.Fprintln(writer, `<input type="submit" value="Search">`)
+	fmt.Fprintln(writer, "</form>")
+	fmt.Fprintf(writer, "Images matching: %s<br>\n",
+		html.EscapeString(formatLabels(selector)))
+	s.writeImagesTable(writer, imageNames)
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := sortedLabelKeys(labels)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func parseLabelsQuery(selector map[string]string, query string) {
+	for _, entry := range strings.Split(query, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, "=", 2)
+		if len(fields) < 2 {
+			selector[fields[0]] = ""
+		} else {
+			selector[fields[0]] = fields[1]
+		}
+	}
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
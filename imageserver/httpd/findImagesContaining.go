@@ -0,0 +1,81 @@
+package httpd
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/verstr"
+	"html"
+	"net/http"
+	"strings"
+)
+
+func (s state) findImagesContainingHandler(w http.ResponseWriter,
+	req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	query := req.URL.Query()
+	pathname := strings.TrimSpace(query.Get("path"))
+	objectString := strings.TrimSpace(query.Get("object"))
+	textOutput := query.Get("output") == "text"
+	if !textOutput {
+		fmt.Fprintln(writer, "<title>imageserver file search</title>")
+		fmt.Fprintln(writer, "<body>")
+		fmt.Fprintln(writer,
+			`<form action="findImagesContaining" method="get">`)
+		fmt.Fprintf(writer,
+			"Pathname: <input type=\"text\" name=\"path\" value=\"%s\">\n",
+			html.EscapeString(pathname))
+		fmt.Fprintf(writer,
+			"Object: <input type=\"text\" name=\"object\" value=\"%s\">\n",
+			html.EscapeString(objectString))
+		fmt.Fprintln(writer, `<input type="submit" value="Search">`)
+		fmt.Fprintln(writer, "</form>")
+	}
+	if pathname == "" && objectString == "" {
+		return
+	}
+	var object *hash.Hash
+	if objectString != "" {
+		hashVal, err := parseHash(objectString)
+		if err != nil {
+			if textOutput {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			fmt.Fprintln(writer, html.EscapeString(err.Error()))
+			return
+		}
+		object = &hashVal
+	}
+	imageNames, err := s.imageDataBase.FindImagesContaining(pathname, object)
+	if err != nil {
+		if textOutput {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprintln(writer, html.EscapeString(err.Error()))
+		return
+	}
+	verstr.Sort(imageNames)
+	if textOutput {
+		for _, name := range imageNames {
+			fmt.Fprintln(writer, name)
+		}
+		return
+	}
+	s.writeImagesTable(writer, imageNames)
+}
+
+func parseHash(hexString string) (hash.Hash, error) {
+	var hashVal hash.Hash
+	data, err := hex.DecodeString(hexString)
+	if err != nil {
+		return hashVal, err
+	}
+	if len(data) != len(hashVal) {
+		return hashVal, errors.New("bad hash length")
+	}
+	copy(hashVal[:], data)
+	return hashVal, nil
+}
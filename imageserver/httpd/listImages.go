@@ -3,9 +3,10 @@ package httpd
 import (
 	"bufio"
 	"fmt"
+	"github.com/Symantec/Dominator/imageserver/scanner"
 	"github.com/Symantec/Dominator/lib/format"
-	"github.com/Symantec/Dominator/lib/image"
 	"github.com/Symantec/Dominator/lib/verstr"
+	"html"
 	"io"
 	"net/http"
 )
@@ -22,6 +23,10 @@ func (s state) listImagesHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	fmt.Fprintln(writer, "<title>imageserver images</title>")
+	s.writeImagesTable(writer, imageNames)
+}
+
+func (s state) writeImagesTable(writer io.Writer, imageNames []string) {
 	fmt.Fprintln(writer, `<style>
                           table, th, td {
                           border-collapse: collapse;
@@ -37,23 +42,30 @@ func (s state) listImagesHandler(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintln(writer, "    <th>Computed Inodes</th>")
 	fmt.Fprintln(writer, "    <th>Filter Lines</th>")
 	fmt.Fprintln(writer, "    <th>Triggers</th>")
+	fmt.Fprintln(writer, "    <th>Labels</th>")
 	fmt.Fprintln(writer, "  </tr>")
 	for _, name := range imageNames {
-		showImage(writer, name, s.imageDataBase.GetImage(name))
+		if summary := s.imageDataBase.GetImageSummary(name); summary != nil {
+			showImage(writer, name, summary)
+		}
 	}
 	fmt.Fprintln(writer, "</table>")
 	fmt.Fprintln(writer, "</body>")
 }
 
-func showImage(writer io.Writer, name string, image *image.Image) {
+func showImage(writer io.Writer, name string, summary *scanner.ImageSummary) {
+	image := summary.Image
 	fmt.Fprintf(writer, "  <tr>\n")
 	fmt.Fprintf(writer, "    <td><a href=\"showImage?%s\">%s</a></td>\n",
 		name, name)
 	fmt.Fprintf(writer, "    <td><a href=\"listImage?%s\">%s</a></td>\n",
-		name, format.FormatBytes(image.FileSystem.TotalDataBytes))
+		name, format.FormatBytes(summary.TotalDataBytes))
 	fmt.Fprintf(writer, "    <td><a href=\"listImage?%s\">%d</a></td>\n",
-		name, image.FileSystem.NumRegularInodes)
-	if numInodes := image.FileSystem.NumComputedRegularInodes(); numInodes < 1 {
+		name, summary.NumRegularInodes)
+	if !summary.ComputedInodesKnown {
+		fmt.Fprintf(writer,
+			"    <td><a href=\"listComputedInodes?%s\">?</a></td>\n", name)
+	} else if numInodes := summary.NumComputedRegularInodes; numInodes < 1 {
 		fmt.Fprintln(writer, "    <td>0</td>")
 	} else {
 		fmt.Fprintf(writer,
@@ -68,5 +80,7 @@ func showImage(writer io.Writer, name string, image *image.Image) {
 	}
 	fmt.Fprintf(writer, "    <td><a href=\"listTriggers?%s\">%d</a></td>\n",
 		name, len(image.Triggers.Triggers))
+	fmt.Fprintf(writer, "    <td>%s</td>\n",
+		html.EscapeString(formatLabels(image.Labels)))
 	fmt.Fprintf(writer, "  </tr>\n")
 }
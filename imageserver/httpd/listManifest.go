@@ -0,0 +1,33 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+)
+
+func (s state) listManifestHandler(w http.ResponseWriter, req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	imageName := req.URL.RawQuery
+	fmt.Fprintf(writer, "<title>image %s</title>\n", imageName)
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, "<h3>")
+	image := s.imageDataBase.GetImage(imageName)
+	if image == nil {
+		fmt.Fprintf(writer, "Image: %s UNKNOWN!\n", imageName)
+		return
+	}
+	if image.Manifest == nil {
+		fmt.Fprintf(writer, "No build manifest for image: %s\n", imageName)
+		return
+	}
+	if image.Manifest.Object == nil {
+		fmt.Fprintf(writer, "No build manifest data for image: %s\n", imageName)
+		return
+	}
+	fmt.Fprintf(writer, "Build manifest for image: %s<br>\n", imageName)
+	fmt.Fprintln(writer, "</h3>")
+	listObject(writer, s.objectServer, image.Manifest.Object)
+	fmt.Fprintln(writer, "</body>")
+}
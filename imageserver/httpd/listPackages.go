@@ -0,0 +1,57 @@
+package httpd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/image/packages"
+	"html"
+	"net/http"
+)
+
+func (s state) listPackagesHandler(w http.ResponseWriter, req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	imageName := req.URL.RawQuery
+	fmt.Fprintf(writer, "<title>image %s</title>\n", imageName)
+	fmt.Fprintln(writer, "<body>")
+	fmt.Fprintln(writer, "<h3>")
+	image := s.imageDataBase.GetImage(imageName)
+	if image == nil {
+		fmt.Fprintf(writer, "Image: %s UNKNOWN!\n", imageName)
+		return
+	}
+	if image.Packages == nil {
+		fmt.Fprintf(writer, "No package inventory for image: %s\n", imageName)
+		return
+	}
+	if image.Packages.Object == nil {
+		fmt.Fprintf(writer, "No package inventory data for image: %s\n",
+			imageName)
+		return
+	}
+	_, reader, err := s.objectServer.GetObject(*image.Packages.Object)
+	if err != nil {
+		fmt.Fprintln(writer, err)
+		return
+	}
+	defer reader.Close()
+	inventory, err := packages.Decode(reader)
+	if err != nil {
+		fmt.Fprintf(writer, "Error decoding package inventory: %s\n", err)
+		return
+	}
+	fmt.Fprintf(writer, "Packages in image: %s<br>\n", imageName)
+	fmt.Fprintln(writer, "</h3>")
+	fmt.Fprintln(writer, `<table border="1">`)
+	fmt.Fprintln(writer,
+		"  <tr><th>Name</th><th>Version</th><th>Architecture</th><th>Manager</th></tr>")
+	for _, pkg := range inventory.Packages {
+		fmt.Fprintf(writer,
+			"  <tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(pkg.Name), html.EscapeString(pkg.Version),
+			html.EscapeString(pkg.Architecture), pkg.Manager)
+	}
+	fmt.Fprintln(writer, "</table>")
+	fmt.Fprintf(writer, "%d packages<br>\n", len(inventory.Packages))
+	fmt.Fprintln(writer, "</body>")
+}
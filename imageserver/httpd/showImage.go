@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"github.com/Symantec/Dominator/lib/format"
 	"github.com/Symantec/Dominator/lib/image"
+	"html"
 	"io"
 	"net/http"
+	"net/url"
 )
 
 func (s state) showImageHandler(w http.ResponseWriter, req *http.Request) {
@@ -46,6 +48,28 @@ func (s state) showImageHandler(w http.ResponseWriter, req *http.Request) {
 		"listReleaseNotes")
 	showAnnotation(writer, image.BuildLog, imageName, "Build log",
 		"listBuildLog")
+	showAnnotation(writer, image.Manifest, imageName, "Build manifest",
+		"listManifest")
+	showAnnotation(writer, image.Packages, imageName, "Packages",
+		"listPackages")
+	if len(image.Labels) > 0 {
+		fmt.Fprintln(writer, "Labels:<br>")
+		for _, key := range sortedLabelKeys(image.Labels) {
+			fmt.Fprintf(writer,
+				"&nbsp;&nbsp;<a href=\"findImages?%s\">%s</a>=%s<br>\n",
+				url.Values{key: {image.Labels[key]}}.Encode(),
+				html.EscapeString(key), html.EscapeString(image.Labels[key]))
+		}
+	}
+	if len(image.Signatures) > 0 {
+		fmt.Fprintf(writer, "Number of signatures: %d<br>\n",
+			len(image.Signatures))
+	}
+	fmt.Fprintf(writer,
+		"Export: <a href=\"exportImage?%s\">tar</a> "+
+			"<a href=\"exportImage?%s\">OCI</a><br>\n",
+		url.Values{"name": {imageName}}.Encode(),
+		url.Values{"name": {imageName}, "type": {"oci"}}.Encode())
 	if image.CreatedBy != "" {
 		fmt.Fprintf(writer, "Created by: %s\n<br>", image.CreatedBy)
 	}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"github.com/Symantec/Dominator/lib/filesystem"
 	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/image/lint"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/imageserver"
+	"strings"
 )
 
 func (t *srpcType) AddImage(conn *srpc.Conn,
@@ -45,11 +48,46 @@ func (t *srpcType) AddImage(conn *srpc.Conn,
 		}
 	}
 	request.Image.FileSystem.RebuildInodePointers()
+	if err := t.lintImage(request.ImageName, request.Image,
+		reply); err != nil {
+		return err
+	}
 	username := request.Image.CreatedBy
 	if username == "" {
 		t.logger.Printf("AddImage(%s)\n", request.ImageName)
 	} else {
 		t.logger.Printf("AddImage(%s) by %s\n", request.ImageName, username)
 	}
-	return t.imageDataBase.AddImage(request.Image, request.ImageName, &username)
+	return t.imageDataBase.AddImage(request.Image, request.ImageName,
+		getAuthInfo(conn))
+}
+
+func (t *srpcType) lintImage(name string, img *image.Image,
+	reply *imageserver.AddImageResponse) error {
+	if t.lintPolicy == nil {
+		return nil
+	}
+	context := &lint.Context{
+		ObjectsGetter: t.imageDataBase.ObjectServer(),
+	}
+	previousName := lint.FindPreviousImage(name,
+		t.imageDataBase.ListImages())
+	if previousName != "" {
+		context.PreviousImage = t.imageDataBase.GetImage(previousName)
+	}
+	violations, err := t.lintPolicy.Check(name, img, context)
+	if err != nil {
+		return err
+	}
+	if lint.Rejected(violations) {
+		t.logger.Printf("AddImage(%s) rejected by policy\n", name)
+		messages := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			messages = append(messages, violation.String())
+		}
+		return errors.New("image rejected by policy:\n" +
+			strings.Join(messages, "\n"))
+	}
+	reply.Warnings = violations
+	return nil
 }
@@ -2,6 +2,7 @@ package rpcd
 
 import (
 	"github.com/Symantec/Dominator/imageserver/scanner"
+	"github.com/Symantec/Dominator/lib/image/lint"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"io"
 	"log"
@@ -11,26 +12,50 @@ import (
 type srpcType struct {
 	imageDataBase             *scanner.ImageDataBase
 	replicationMaster         string
+	lintPolicy                *lint.Policy // May be nil.
 	logger                    *log.Logger
 	numReplicationClientsLock sync.RWMutex // Protect numReplicationClients.
 	numReplicationClients     uint
 }
 
+// Params holds optional parameters for SetupWithParams.
+type Params struct {
+	// LintPolicy, if not nil, is checked by the AddImage() RPC. Images which
+	// violate a rule with the reject action are refused.
+	LintPolicy *lint.Policy
+	// MethodPolicies limits calls to the methods. The key is the method name.
+	MethodPolicies map[string]srpc.MethodPolicy
+}
+
 type htmlWriter srpcType
 
 func (hw *htmlWriter) WriteHtml(writer io.Writer) {
 	hw.writeHtml(writer)
 }
 
+func getAuthInfo(conn *srpc.Conn) *scanner.AuthInformation {
+	return &scanner.AuthInformation{
+		Username: conn.Username(),
+		Groups:   conn.Groups(),
+	}
+}
+
 var replicationMessage = "cannot make changes while under replication control" +
 	", go to master: "
 
 func Setup(imdb *scanner.ImageDataBase, replicationMaster string,
 	lg *log.Logger) *htmlWriter {
+	return SetupWithParams(imdb, replicationMaster, Params{}, lg)
+}
+
+func SetupWithParams(imdb *scanner.ImageDataBase, replicationMaster string,
+	params Params, lg *log.Logger) *htmlWriter {
 	srpcObj := srpcType{
 		imageDataBase:     imdb,
 		replicationMaster: replicationMaster,
+		lintPolicy:        params.LintPolicy,
 		logger:            lg}
-	srpc.RegisterName("ImageServer", &srpcObj)
+	srpc.RegisterNameWithOptions("ImageServer", &srpcObj,
+		srpc.ReceiverOptions{MethodPolicies: params.MethodPolicies})
 	return (*htmlWriter)(&srpcObj)
 }
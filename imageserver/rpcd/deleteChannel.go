@@ -0,0 +1,23 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) DeleteChannel(conn *srpc.Conn,
+	request imageserver.DeleteChannelRequest,
+	reply *imageserver.DeleteChannelResponse) error {
+	username := conn.Username()
+	if err := t.checkMutability(); err != nil {
+		return err
+	}
+	if username == "" {
+		t.logger.Printf("DeleteChannel(%s)\n", request.ChannelName)
+	} else {
+		t.logger.Printf("DeleteChannel(%s) by %s\n",
+			request.ChannelName, username)
+	}
+	return t.imageDataBase.DeleteChannel(request.ChannelName,
+		getAuthInfo(conn))
+}
@@ -21,5 +21,5 @@ func (t *srpcType) DeleteImage(conn *srpc.Conn,
 	} else {
 		t.logger.Printf("DeleteImage(%s) by %s\n", request.ImageName, username)
 	}
-	return t.imageDataBase.DeleteImage(request.ImageName, &username)
+	return t.imageDataBase.DeleteImage(request.ImageName, getAuthInfo(conn))
 }
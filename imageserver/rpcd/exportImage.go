@@ -0,0 +1,70 @@
+package rpcd
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"github.com/Symantec/Dominator/lib/image/export"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+	"path"
+)
+
+const exportChunkSize = 64 << 10
+
+// chunkWriter sends each write as an ExportImageChunk message.
+type chunkWriter struct {
+	encoder *gob.Encoder
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) < 1 {
+		return 0, nil
+	}
+	err := w.encoder.Encode(imageserver.ExportImageChunk{Data: p})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *srpcType) ExportImage(conn *srpc.Conn) error {
+	defer conn.Flush()
+	var request imageserver.ExportImageRequest
+	if err := gob.NewDecoder(conn).Decode(&request); err != nil {
+		return err
+	}
+	if username := conn.Username(); username == "" {
+		t.logger.Printf("ExportImage(%s)\n", request.ImageName)
+	} else {
+		t.logger.Printf("ExportImage(%s) by %s\n", request.ImageName, username)
+	}
+	encoder := gob.NewEncoder(conn)
+	writer := bufio.NewWriterSize(&chunkWriter{encoder}, exportChunkSize)
+	err := t.exportImage(request, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	var lastChunk imageserver.ExportImageChunk
+	if err != nil {
+		lastChunk.Error = err.Error()
+	}
+	return encoder.Encode(lastChunk)
+}
+
+func (t *srpcType) exportImage(request imageserver.ExportImageRequest,
+	writer *bufio.Writer) error {
+	img := t.imageDataBase.GetImage(request.ImageName)
+	if img == nil {
+		return errors.New("image: " + request.ImageName + " does not exist")
+	}
+	objectServer := t.imageDataBase.ObjectServer()
+	switch request.Type {
+	case "tar":
+		return export.WriteTar(writer, img.FileSystem, objectServer)
+	case "oci":
+		return export.WriteOCI(writer, img, path.Base(request.ImageName),
+			request.Architecture, objectServer)
+	}
+	return errors.New("unknown export type: " + request.Type)
+}
@@ -0,0 +1,15 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) FindImages(conn *srpc.Conn,
+	request imageserver.FindImagesRequest,
+	reply *imageserver.FindImagesResponse) error {
+	var response imageserver.FindImagesResponse
+	response.ImageNames = t.imageDataBase.FindImages(request.Labels)
+	*reply = response
+	return nil
+}
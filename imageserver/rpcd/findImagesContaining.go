@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) FindImagesContaining(conn *srpc.Conn,
+	request imageserver.FindImagesContainingRequest,
+	reply *imageserver.FindImagesContainingResponse) error {
+	imageNames, err := t.imageDataBase.FindImagesContaining(request.Pathname,
+		request.Object)
+	if err != nil {
+		return err
+	}
+	reply.ImageNames = imageNames
+	return nil
+}
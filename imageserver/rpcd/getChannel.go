@@ -0,0 +1,15 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) GetChannel(conn *srpc.Conn,
+	request imageserver.GetChannelRequest,
+	reply *imageserver.GetChannelResponse) error {
+	var response imageserver.GetChannelResponse
+	response.Channel = t.imageDataBase.GetChannel(request.ChannelName)
+	*reply = response
+	return nil
+}
@@ -14,9 +14,11 @@ func (t *srpcType) GetImageUpdates(conn *srpc.Conn) error {
 	t.incrementNumReplicationClients(true)
 	defer t.incrementNumReplicationClients(false)
 	addChannel := t.imageDataBase.RegisterAddNotifier()
+	channelChannel := t.imageDataBase.RegisterChannelNotifier()
 	deleteChannel := t.imageDataBase.RegisterDeleteNotifier()
 	mkdirChannel := t.imageDataBase.RegisterMakeDirectoryNotifier()
 	defer t.imageDataBase.UnregisterAddNotifier(addChannel)
+	defer t.imageDataBase.UnregisterChannelNotifier(channelChannel)
 	defer t.imageDataBase.UnregisterDeleteNotifier(deleteChannel)
 	defer t.imageDataBase.UnregisterMakeDirectoryNotifier(mkdirChannel)
 	encoder := gob.NewEncoder(conn)
@@ -37,6 +39,12 @@ func (t *srpcType) GetImageUpdates(conn *srpc.Conn) error {
 			return err
 		}
 	}
+	for _, channelName := range t.imageDataBase.ListChannels() {
+		if err := t.sendChannel(encoder, channelName); err != nil {
+			t.logger.Println(err)
+			return err
+		}
+	}
 	// Signal end of initial image list.
 	if err := encoder.Encode(imageserver.ImageUpdate{}); err != nil {
 		t.logger.Println(err)
@@ -57,6 +65,11 @@ func (t *srpcType) GetImageUpdates(conn *srpc.Conn) error {
 				t.logger.Println(err)
 				return err
 			}
+		case channelName := <-channelChannel:
+			if err := t.sendChannel(encoder, channelName); err != nil {
+				t.logger.Println(err)
+				return err
+			}
 		case imageName := <-deleteChannel:
 			if err := sendUpdate(encoder, imageName,
 				imageserver.OperationDeleteImage); err != nil {
@@ -119,3 +132,15 @@ func sendMakeDirectory(encoder *gob.Encoder, directory image.Directory) error {
 	}
 	return encoder.Encode(imageUpdate)
 }
+
+func (t *srpcType) sendChannel(encoder *gob.Encoder, name string) error {
+	channel := t.imageDataBase.GetChannel(name)
+	if channel == nil {
+		return sendUpdate(encoder, name, imageserver.OperationDeleteChannel)
+	}
+	imageUpdate := imageserver.ImageUpdate{
+		Channel:   channel,
+		Operation: imageserver.OperationUpdateChannel,
+	}
+	return encoder.Encode(imageUpdate)
+}
@@ -0,0 +1,15 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) ListChannels(conn *srpc.Conn,
+	request imageserver.ListChannelsRequest,
+	reply *imageserver.ListChannelsResponse) error {
+	var response imageserver.ListChannelsResponse
+	response.ChannelNames = t.imageDataBase.ListChannels()
+	*reply = response
+	return nil
+}
@@ -18,5 +18,6 @@ func (t *srpcType) MakeDirectory(conn *srpc.Conn,
 		t.logger.Printf("MakeDirectory(%s) by %s\n",
 			request.DirectoryName, username)
 	}
-	return t.imageDataBase.MakeDirectory(request.DirectoryName, username)
+	return t.imageDataBase.MakeDirectory(request.DirectoryName,
+		getAuthInfo(conn))
 }
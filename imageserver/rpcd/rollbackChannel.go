@@ -0,0 +1,29 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) RollbackChannel(conn *srpc.Conn,
+	request imageserver.RollbackChannelRequest,
+	reply *imageserver.RollbackChannelResponse) error {
+	username := conn.Username()
+	if err := t.checkMutability(); err != nil {
+		return err
+	}
+	imageName, err := t.imageDataBase.RollbackChannel(request.ChannelName,
+		request.ImageName, getAuthInfo(conn))
+	if err != nil {
+		return err
+	}
+	if username == "" {
+		t.logger.Printf("RollbackChannel(%s) to %s\n",
+			request.ChannelName, imageName)
+	} else {
+		t.logger.Printf("RollbackChannel(%s) to %s by %s\n",
+			request.ChannelName, imageName, username)
+	}
+	reply.ImageName = imageName
+	return nil
+}
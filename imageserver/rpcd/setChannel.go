@@ -0,0 +1,24 @@
+package rpcd
+
+import (
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) SetChannel(conn *srpc.Conn,
+	request imageserver.SetChannelRequest,
+	reply *imageserver.SetChannelResponse) error {
+	username := conn.Username()
+	if err := t.checkMutability(); err != nil {
+		return err
+	}
+	if username == "" {
+		t.logger.Printf("SetChannel(%s, %s)\n",
+			request.ChannelName, request.ImageName)
+	} else {
+		t.logger.Printf("SetChannel(%s, %s) by %s\n",
+			request.ChannelName, request.ImageName, username)
+	}
+	return t.imageDataBase.SetChannel(request.ChannelName, request.ImageName,
+		getAuthInfo(conn))
+}
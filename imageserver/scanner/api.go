@@ -1,11 +1,13 @@
 package scanner
 
 import (
+	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/image"
 	"github.com/Symantec/Dominator/lib/objectserver"
 	"io"
 	"log"
 	"sync"
+	"time"
 )
 
 // TODO: the types should probably be moved into a separate package, leaving
@@ -20,18 +22,65 @@ type Object struct {
 type notifiers map[<-chan string]chan<- string
 type makeDirectoryNotifiers map[<-chan image.Directory]chan<- image.Directory
 
+// ImageSummary contains the metadata for an image, which is always kept in
+// memory. The full image (including the file-system) is loaded on demand.
+type ImageSummary struct {
+	Image                    *image.Image // FileSystem is nil.
+	NumRegularInodes         uint64
+	TotalDataBytes           uint64
+	NumComputedRegularInodes uint64
+	ComputedInodesKnown      bool // False until the full image is loaded.
+}
+
+// AuthInformation identifies the user who requested a change. Changes with a
+// nil *AuthInformation (such as replicated changes) are always permitted.
+type AuthInformation struct {
+	Username string
+	Groups   map[string]struct{} // Groups given in the user certificate.
+}
+
+// DirectoryPolicy grants groups the right to change the images and channels
+// in directories, in addition to the members of the directory OwnerGroup.
+type DirectoryPolicy interface {
+	PermitsDirectory(groups map[string]struct{}, dirname string) bool
+}
+
+type imageEntry struct {
+	summary  ImageSummary
+	fileSize uint64
+}
+
 type ImageDataBase struct {
 	sync.RWMutex
 	// Protected by lock.
-	baseDir         string
-	directoryMap    map[string]image.DirectoryMetadata
-	imageMap        map[string]*image.Image
-	addNotifiers    notifiers
-	deleteNotifiers notifiers
-	mkdirNotifiers  makeDirectoryNotifiers
+	baseDir          string
+	directoryMap     map[string]image.DirectoryMetadata
+	imageMap         map[string]*imageEntry
+	channelMap       map[string]*image.Channel
+	addNotifiers     notifiers
+	channelNotifiers notifiers
+	deleteNotifiers  notifiers
+	mkdirNotifiers   makeDirectoryNotifiers
+	objectRefCounts  map[hash.Hash]uint64 // References by images.
+	// Protected by indexLock. Changes require lock to be held.
+	indexLock      sync.Mutex
+	index          *imageIndex // nil until first needed.
+	indexBuildLock sync.Mutex  // Serialises building the index.
 	// Unprotected by lock.
-	objectServer objectserver.ObjectServer
-	logger       *log.Logger
+	imageCache      *imageCache
+	objectServer    objectserver.ObjectServer
+	directoryPolicy DirectoryPolicy // May be nil.
+	logger          *log.Logger
+}
+
+// GarbageReport summarises a garbage collection pass over the object server.
+type GarbageReport struct {
+	StartTime         time.Time
+	Duration          time.Duration
+	DryRun            bool   // If true, nothing was deleted.
+	NumObjects        uint64 // Unreferenced objects deleted (or to delete).
+	NumBytes          uint64 // Bytes freed (or which would be freed).
+	NumSkippedObjects uint64 // Unreferenced objects within the grace period.
 }
 
 func LoadImageDataBase(baseDir string, objSrv objectserver.ObjectServer,
@@ -40,8 +89,8 @@ func LoadImageDataBase(baseDir string, objSrv objectserver.ObjectServer,
 }
 
 func (imdb *ImageDataBase) AddImage(image *image.Image, name string,
-	username *string) error {
-	return imdb.addImage(image, name, username)
+	authInfo *AuthInformation) error {
+	return imdb.addImage(image, name, authInfo)
 }
 
 func (imdb *ImageDataBase) CheckImage(name string) bool {
@@ -52,6 +101,14 @@ func (imdb *ImageDataBase) ChownDirectory(dirname, ownerGroup string) error {
 	return imdb.chownDirectory(dirname, ownerGroup)
 }
 
+// CollectGarbage deletes objects which are not referenced by any image and
+// which have not been added within gracePeriod. If dryRun is true, nothing is
+// deleted but the report shows what would have been deleted.
+func (imdb *ImageDataBase) CollectGarbage(gracePeriod time.Duration,
+	dryRun bool) (GarbageReport, error) {
+	return imdb.collectGarbage(gracePeriod, dryRun)
+}
+
 func (imdb *ImageDataBase) CountDirectories() uint {
 	return imdb.countDirectories()
 }
@@ -60,14 +117,57 @@ func (imdb *ImageDataBase) CountImages() uint {
 	return imdb.countImages()
 }
 
-func (imdb *ImageDataBase) DeleteImage(name string, username *string) error {
-	return imdb.deleteImage(name, username)
+// DeleteChannel deletes the channel (including history). The same permissions
+// as for deleting an image apply.
+func (imdb *ImageDataBase) DeleteChannel(channelName string,
+	authInfo *AuthInformation) error {
+	return imdb.deleteChannel(channelName, authInfo)
+}
+
+// DeleteImage deletes the image. Images used by a channel may not be deleted,
+// except for replicated deletions (with a nil authInfo), which delete the
+// channels.
+func (imdb *ImageDataBase) DeleteImage(name string,
+	authInfo *AuthInformation) error {
+	return imdb.deleteImage(name, authInfo)
+}
+
+// FindImages returns the names of images which have all the labels in
+// selector. An empty value in selector matches any value for that key.
+func (imdb *ImageDataBase) FindImages(selector map[string]string) []string {
+	return imdb.findImages(selector)
 }
 
+// FindImagesContaining returns the names of images which contain the
+// specified pathname and/or object. If both are specified, images must contain
+// both (not necessarily in the same file). The index is built on first use,
+// which requires reading every image, and is then kept in memory.
+func (imdb *ImageDataBase) FindImagesContaining(pathname string,
+	object *hash.Hash) ([]string, error) {
+	return imdb.findImagesContaining(pathname, object)
+}
+
+// GetChannel returns a copy of the channel, or nil if it does not exist.
+func (imdb *ImageDataBase) GetChannel(name string) *image.Channel {
+	return imdb.getChannel(name)
+}
+
+// GetImage returns the image, loading it into the image cache if needed. The
+// image must not be modified. If the image does not exist, nil is returned.
 func (imdb *ImageDataBase) GetImage(name string) *image.Image {
 	return imdb.getImage(name)
 }
 
+// GetImageSummary returns the in-memory metadata for the image, without
+// loading the image. If the image does not exist, nil is returned.
+func (imdb *ImageDataBase) GetImageSummary(name string) *ImageSummary {
+	return imdb.getImageSummary(name)
+}
+
+func (imdb *ImageDataBase) ListChannels() []string {
+	return imdb.listChannels()
+}
+
 func (imdb *ImageDataBase) ListDirectories() []image.Directory {
 	return imdb.listDirectories()
 }
@@ -76,8 +176,17 @@ func (imdb *ImageDataBase) ListImages() []string {
 	return imdb.listImages()
 }
 
-func (imdb *ImageDataBase) MakeDirectory(dirname, username string) error {
-	return imdb.makeDirectory(image.Directory{Name: dirname}, username, true)
+// DeleteUnreferencedObjects deletes objects from the object server, refusing
+// if any object is referenced by an image (including annotations). No object
+// is deleted unless all may be. The sizes freed are returned.
+func (imdb *ImageDataBase) DeleteUnreferencedObjects(hashes []hash.Hash) (
+	[]uint64, error) {
+	return imdb.deleteUnreferencedObjects(hashes)
+}
+
+func (imdb *ImageDataBase) MakeDirectory(dirname string,
+	authInfo *AuthInformation) error {
+	return imdb.makeDirectory(image.Directory{Name: dirname}, authInfo, true)
 }
 
 func (imdb *ImageDataBase) ObjectServer() objectserver.ObjectServer {
@@ -88,6 +197,10 @@ func (imdb *ImageDataBase) RegisterAddNotifier() <-chan string {
 	return imdb.registerAddNotifier()
 }
 
+func (imdb *ImageDataBase) RegisterChannelNotifier() <-chan string {
+	return imdb.registerChannelNotifier()
+}
+
 func (imdb *ImageDataBase) RegisterDeleteNotifier() <-chan string {
 	return imdb.registerDeleteNotifier()
 }
@@ -100,6 +213,39 @@ func (imdb *ImageDataBase) UnregisterAddNotifier(channel <-chan string) {
 	imdb.unregisterAddNotifier(channel)
 }
 
+// RemoveReferencedObjects removes the objects which are referenced by images
+// from objectSizes, leaving the unreferenced objects.
+func (imdb *ImageDataBase) RemoveReferencedObjects(
+	objectSizes map[hash.Hash]uint64) {
+	imdb.removeReferencedObjects(objectSizes)
+}
+
+// RollbackChannel sets the channel to an image from its history. If imageName
+// is empty, the image prior to the current image is used (so repeated
+// rollbacks alternate between two images). The image selected is returned.
+func (imdb *ImageDataBase) RollbackChannel(channelName, imageName string,
+	authInfo *AuthInformation) (string, error) {
+	return imdb.rollbackChannel(channelName, imageName, authInfo)
+}
+
+// SetChannel creates or updates the channel to point to the specified image
+// and records the change in the channel history. The parent directory of the
+// channel must exist and the same permissions as for adding an image apply.
+func (imdb *ImageDataBase) SetChannel(channelName, imageName string,
+	authInfo *AuthInformation) error {
+	return imdb.setChannel(channelName, imageName, authInfo)
+}
+
+// SetDirectoryPolicy sets the policy which grants groups the right to change
+// directories. It must be called before any changes are requested.
+func (imdb *ImageDataBase) SetDirectoryPolicy(policy DirectoryPolicy) {
+	imdb.directoryPolicy = policy
+}
+
+func (imdb *ImageDataBase) UnregisterChannelNotifier(channel <-chan string) {
+	imdb.unregisterChannelNotifier(channel)
+}
+
 func (imdb *ImageDataBase) UnregisterDeleteNotifier(channel <-chan string) {
 	imdb.unregisterDeleteNotifier(channel)
 }
@@ -109,8 +255,21 @@ func (imdb *ImageDataBase) UnregisterMakeDirectoryNotifier(
 	imdb.unregisterMakeDirectoryNotifier(channel)
 }
 
+// SetImageCacheSize sets the maximum size of the cache of loaded images, based
+// on the encoded (on-disk) size of the images. Zero means no limit. Images in
+// use may exceed the limit.
+func (imdb *ImageDataBase) SetImageCacheSize(maxSize uint64) {
+	imdb.imageCache.setMaxSize(maxSize)
+}
+
+// UpdateChannel replaces the channel (including history) without any checks.
+// This is used for replication.
+func (imdb *ImageDataBase) UpdateChannel(channel image.Channel) error {
+	return imdb.updateChannel(channel)
+}
+
 func (imdb *ImageDataBase) UpdateDirectory(directory image.Directory) error {
-	return imdb.makeDirectory(directory, "", false)
+	return imdb.makeDirectory(directory, nil, false)
 }
 
 func (imdb *ImageDataBase) WriteHtml(writer io.Writer) {
@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"container/list"
+	"github.com/Symantec/Dominator/lib/image"
+	"sync"
+)
+
+type imageCache struct {
+	sync.Mutex
+	maxSize uint64 // Zero: unlimited.
+	size    uint64
+	lru     *list.List // Front is most recently used.
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	name  string
+	image *image.Image
+	size  uint64
+}
+
+func newImageCache() *imageCache {
+	return &imageCache{
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (cache *imageCache) get(name string) *image.Image {
+	cache.Lock()
+	defer cache.Unlock()
+	if element, ok := cache.entries[name]; ok {
+		cache.lru.MoveToFront(element)
+		return element.Value.(*cacheEntry).image
+	}
+	return nil
+}
+
+func (cache *imageCache) put(name string, img *image.Image, size uint64) {
+	cache.Lock()
+	defer cache.Unlock()
+	if element, ok := cache.entries[name]; ok {
+		cache.removeElement(element)
+	}
+	cache.entries[name] = cache.lru.PushFront(
+		&cacheEntry{name: name, image: img, size: size})
+	cache.size += size
+	cache.evict()
+}
+
+func (cache *imageCache) remove(name string) {
+	cache.Lock()
+	defer cache.Unlock()
+	if element, ok := cache.entries[name]; ok {
+		cache.removeElement(element)
+	}
+}
+
+func (cache *imageCache) setMaxSize(maxSize uint64) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.maxSize = maxSize
+	cache.evict()
+}
+
+// This must be called with the lock held.
+func (cache *imageCache) evict() {
+	if cache.maxSize < 1 {
+		return
+	}
+	// Always keep the most recently used image.
+	for cache.size > cache.maxSize && cache.lru.Len() > 1 {
+		cache.removeElement(cache.lru.Back())
+	}
+}
+
+// This must be called with the lock held.
+func (cache *imageCache) removeElement(element *list.Element) {
+	entry := cache.lru.Remove(element).(*cacheEntry)
+	delete(cache.entries, entry.name)
+	cache.size -= entry.size
+}
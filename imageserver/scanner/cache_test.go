@@ -0,0 +1,56 @@
+package scanner
+
+import (
+	"github.com/Symantec/Dominator/lib/image"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestImageCache(t *testing.T) {
+	var tests = []struct {
+		operation string // put, get, remove or limit.
+		name      string
+		size      uint64
+		want      []string // Cached images afterwards.
+	}{
+		{"put", "a", 10, []string{"a"}},
+		{"put", "b", 10, []string{"a", "b"}},
+		{"put", "c", 10, []string{"a", "b", "c"}},
+		{"limit", "", 25, []string{"b", "c"}},
+		{"get", "b", 0, []string{"b", "c"}},
+		{"put", "d", 10, []string{"b", "d"}},
+		{"remove", "b", 0, []string{"d"}},
+		{"put", "e", 30, []string{"e"}}, // The newest image is always kept.
+		{"limit", "", 0, []string{"e"}},
+		{"put", "f", 30, []string{"e", "f"}},
+	}
+	cache := newImageCache()
+	for index, test := range tests {
+		switch test.operation {
+		case "put":
+			cache.put(test.name, &image.Image{}, test.size)
+		case "get":
+			if cache.get(test.name) == nil {
+				t.Errorf("test %d: %s not cached", index, test.name)
+			}
+		case "remove":
+			cache.remove(test.name)
+		case "limit":
+			cache.setMaxSize(test.size)
+		}
+		names := make([]string, 0, len(cache.entries))
+		var size uint64
+		for name, element := range cache.entries {
+			names = append(names, name)
+			size += element.Value.(*cacheEntry).size
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("test %d: cached: %v, want: %v", index, names, test.want)
+		}
+		if size != cache.size {
+			t.Errorf("test %d: size: %d, want: %d", index, cache.size, size)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/fsutil"
+	"github.com/Symantec/Dominator/lib/image"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+const (
+	channelsFile      = ".channels"
+	maxChannelHistory = 1000
+)
+
+func (imdb *ImageDataBase) loadChannels() error {
+	file, err := os.Open(path.Join(imdb.baseDir, channelsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	reader := fsutil.NewChecksumReader(file)
+	var channels []image.Channel
+	if err := gob.NewDecoder(reader).Decode(&channels); err != nil {
+		return fmt.Errorf("unable to read channels: %s", err)
+	}
+	if err := reader.VerifyChecksum(); err != nil {
+		return fmt.Errorf("unable to read channels: %s", err)
+	}
+	for index := range channels {
+		channel := &channels[index]
+		imdb.channelMap[channel.Name] = channel
+	}
+	return nil
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) writeChannels() error {
+	channels := make([]*image.Channel, 0, len(imdb.channelMap))
+	for _, channel := range imdb.channelMap {
+		channels = append(channels, channel)
+	}
+	filename := path.Join(imdb.baseDir, channelsFile)
+	tmpFilename := filename + "~"
+	file, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_RDWR,
+		filePerms)
+	if err != nil {
+		return err
+	}
+	if err := writeChannels(file, channels); err != nil {
+		file.Close()
+		os.Remove(tmpFilename)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+func writeChannels(file io.Writer, channels []*image.Channel) error {
+	w := bufio.NewWriter(file)
+	writer := fsutil.NewChecksumWriter(w)
+	if err := gob.NewEncoder(writer).Encode(channels); err != nil {
+		return err
+	}
+	if err := writer.WriteChecksum(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (imdb *ImageDataBase) deleteChannel(channelName string,
+	authInfo *AuthInformation) error {
+	imdb.Lock()
+	defer imdb.Unlock()
+	if _, ok := imdb.channelMap[channelName]; !ok {
+		return errors.New("channel: " + channelName + " does not exist")
+	}
+	err := imdb.checkDirectoryPermissions(path.Dir(channelName), authInfo)
+	if err != nil {
+		return err
+	}
+	return imdb.removeChannels([]string{channelName})
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) removeChannels(channelNames []string) error {
+	oldChannels := make(map[string]*image.Channel, len(channelNames))
+	for _, name := range channelNames {
+		oldChannels[name] = imdb.channelMap[name]
+		delete(imdb.channelMap, name)
+	}
+	if err := imdb.writeChannels(); err != nil {
+		for name, channel := range oldChannels {
+			imdb.channelMap[name] = channel
+		}
+		return err
+	}
+	for _, name := range channelNames {
+		imdb.channelNotifiers.sendPlain(name, "channel", imdb.logger)
+	}
+	return nil
+}
+
+func (imdb *ImageDataBase) getChannel(name string) *image.Channel {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	if channel, ok := imdb.channelMap[name]; ok {
+		return copyChannel(channel)
+	}
+	return nil
+}
+
+func (imdb *ImageDataBase) listChannels() []string {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	names := make([]string, 0, len(imdb.channelMap))
+	for name := range imdb.channelMap {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (imdb *ImageDataBase) rollbackChannel(channelName, imageName string,
+	authInfo *AuthInformation) (string, error) {
+	imdb.Lock()
+	defer imdb.Unlock()
+	channel, ok := imdb.channelMap[channelName]
+	if !ok {
+		return "", errors.New("channel: " + channelName + " does not exist")
+	}
+	if imageName == "" {
+		if len(channel.History) < 2 {
+			return "", errors.New("channel: " + channelName +
+				" has no previous image")
+		}
+		imageName = channel.History[len(channel.History)-2].ImageName
+	} else {
+		found := false
+		for _, event := range channel.History {
+			if event.ImageName == imageName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("image: %s is not in the history of: %s",
+				imageName, channelName)
+		}
+	}
+	err := imdb.setChannelWithLock(channelName, imageName, authInfo, true)
+	if err != nil {
+		return "", err
+	}
+	return imageName, nil
+}
+
+func (imdb *ImageDataBase) setChannel(channelName, imageName string,
+	authInfo *AuthInformation) error {
+	imdb.Lock()
+	defer imdb.Unlock()
+	return imdb.setChannelWithLock(channelName, imageName, authInfo, false)
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) setChannelWithLock(channelName, imageName string,
+	authInfo *AuthInformation, rollback bool) error {
+	if channelName == "" || path.Clean(channelName) != channelName ||
+		channelName == "." {
+		return errors.New("bad channel name: " + channelName)
+	}
+	if _, ok := imdb.imageMap[channelName]; ok {
+		return errors.New("an image named: " + channelName + " exists")
+	}
+	if _, ok := imdb.imageMap[imageName]; !ok {
+		return errors.New("image: " + imageName + " does not exist")
+	}
+	dirname := path.Dir(channelName)
+	if _, ok := imdb.directoryMap[dirname]; !ok {
+		return fmt.Errorf("directory: %s does not exist", dirname)
+	}
+	if err := imdb.checkDirectoryPermissions(dirname, authInfo); err != nil {
+		return err
+	}
+	event := image.ChannelEvent{
+		ImageName: imageName,
+		Time:      time.Now(),
+		Rollback:  rollback,
+	}
+	if authInfo != nil {
+		event.Username = authInfo.Username
+	}
+	channel := &image.Channel{Name: channelName, ImageName: imageName}
+	if oldChannel, ok := imdb.channelMap[channelName]; ok {
+		channel.History = oldChannel.History
+	}
+	channel.History = append(channel.History, event)
+	if len(channel.History) > maxChannelHistory {
+		channel.History = channel.History[len(channel.History)-
+			maxChannelHistory:]
+	}
+	return imdb.storeChannel(channel)
+}
+
+func (imdb *ImageDataBase) updateChannel(channel image.Channel) error {
+	imdb.Lock()
+	defer imdb.Unlock()
+	return imdb.storeChannel(copyChannel(&channel))
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) storeChannel(channel *image.Channel) error {
+	oldChannel, ok := imdb.channelMap[channel.Name]
+	imdb.channelMap[channel.Name] = channel
+	if err := imdb.writeChannels(); err != nil {
+		if ok {
+			imdb.channelMap[channel.Name] = oldChannel
+		} else {
+			delete(imdb.channelMap, channel.Name)
+		}
+		return err
+	}
+	imdb.channelNotifiers.sendPlain(channel.Name, "channel", imdb.logger)
+	return nil
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) findChannelsUsingImage(imageName string) []string {
+	var names []string
+	for name, channel := range imdb.channelMap {
+		if channel.ImageName == imageName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func copyChannel(channel *image.Channel) *image.Channel {
+	newChannel := *channel
+	newChannel.History = make([]image.ChannelEvent, len(channel.History))
+	copy(newChannel.History, channel.History)
+	return &newChannel
+}
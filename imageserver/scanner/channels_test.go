@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"testing"
+)
+
+func TestDeleteChannel(t *testing.T) {
+	tdb := newTestDataBase(t)
+	tdb.addImage("one", map[string]string{"a": "one"})
+	tdb.addImage("two", map[string]string{"a": "two"})
+	user := &AuthInformation{Username: "user"}
+	var tests = []struct {
+		operation    string // setchannel, deletechannel or delete.
+		name         string
+		imageName    string
+		authInfo     *AuthInformation
+		wantError    bool
+		wantChannels map[string]string // Channel name: image name.
+	}{
+		{"setchannel", "stable", "one", user, false,
+			map[string]string{"stable": "one"}},
+		{"setchannel", "beta", "one", user, false,
+			map[string]string{"stable": "one", "beta": "one"}},
+		{"delete", "one", "", user, true,
+			map[string]string{"stable": "one", "beta": "one"}},
+		{"deletechannel", "beta", "", user, false,
+			map[string]string{"stable": "one"}},
+		{"deletechannel", "beta", "", user, true,
+			map[string]string{"stable": "one"}},
+		{"setchannel", "beta", "two", user, false,
+			map[string]string{"stable": "one", "beta": "two"}},
+		{"delete", "one", "", nil, false, // Replicated.
+			map[string]string{"beta": "two"}},
+		{"setchannel", "stable", "one", user, true,
+			map[string]string{"beta": "two"}},
+	}
+	for index, test := range tests {
+		var err error
+		switch test.operation {
+		case "setchannel":
+			err = tdb.SetChannel(test.name, test.imageName, test.authInfo)
+		case "deletechannel":
+			err = tdb.DeleteChannel(test.name, test.authInfo)
+		case "delete":
+			err = tdb.DeleteImage(test.name, test.authInfo)
+		}
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("test %d: %s(%s): error: %v", index, test.operation,
+				test.name, err)
+		}
+		for _, reload := range []bool{false, true} {
+			if reload {
+				tdb.reload()
+			}
+			channels := make(map[string]string)
+			for _, name := range tdb.ListChannels() {
+				channels[name] = tdb.GetChannel(name).ImageName
+			}
+			if len(channels) != len(test.wantChannels) {
+				t.Errorf("test %d: reload: %v: channels: %v, want: %v",
+					index, reload, channels, test.wantChannels)
+				continue
+			}
+			for name, imageName := range test.wantChannels {
+				if channels[name] != imageName {
+					t.Errorf("test %d: reload: %v: channels: %v, want: %v",
+						index, reload, channels, test.wantChannels)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestDeleteChannelNotifies(t *testing.T) {
+	tdb := newTestDataBase(t)
+	tdb.addImage("one", map[string]string{"a": "one"})
+	if err := tdb.SetChannel("stable", "one", nil); err != nil {
+		t.Fatal(err)
+	}
+	notifier := tdb.RegisterChannelNotifier()
+	defer tdb.UnregisterChannelNotifier(notifier)
+	if err := tdb.DeleteImage("one", nil); err != nil {
+		t.Fatal(err)
+	}
+	if name := <-notifier; name != "stable" {
+		t.Errorf("notified: %s", name)
+	}
+	if tdb.GetChannel("stable") != nil {
+		t.Error("dangling channel not deleted")
+	}
+}
@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"time"
+)
+
+const gcBatchSize = 1024
+
+type staleObjectDeleter interface {
+	CheckStaleObject(hashVal hash.Hash, gracePeriod time.Duration) (
+		uint64, error)
+	DeleteStaleObject(hashVal hash.Hash, gracePeriod time.Duration) (
+		uint64, error)
+	ListObjectSizes() map[hash.Hash]uint64
+}
+
+// deleteUnreferencedObjects holds the lock while checking references and
+// deleting, so that AddImage() (which checks that its objects are present
+// with the write lock held) cannot add references to objects being deleted.
+func (imdb *ImageDataBase) deleteUnreferencedObjects(hashes []hash.Hash) (
+	[]uint64, error) {
+	objSrv, ok := imdb.objectServer.(objectserver.ObjectDeleter)
+	if !ok {
+		return nil, errors.New("object server does not support deletion")
+	}
+	imdb.RLock()
+	defer imdb.RUnlock()
+	for _, hashVal := range hashes {
+		if _, ok := imdb.objectRefCounts[hashVal]; ok {
+			return nil, fmt.Errorf("object: %x is in use", hashVal)
+		}
+	}
+	sizes := make([]uint64, 0, len(hashes))
+	for _, hashVal := range hashes {
+		size, err := objSrv.DeleteObject(hashVal)
+		if err != nil {
+			return sizes, fmt.Errorf("error deleting object: %x: %s", hashVal,
+				err)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+func (imdb *ImageDataBase) removeReferencedObjects(
+	objectSizes map[hash.Hash]uint64) {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	for hashVal := range objectSizes {
+		if _, ok := imdb.objectRefCounts[hashVal]; ok {
+			delete(objectSizes, hashVal)
+		}
+	}
+}
+
+// This must be called with the write lock held.
+func (imdb *ImageDataBase) addObjectReferences(
+	references map[hash.Hash]uint64) {
+	for hashVal, count := range references {
+		imdb.objectRefCounts[hashVal] += count
+	}
+}
+
+// This must be called with the write lock held.
+func (imdb *ImageDataBase) deleteObjectReferences(
+	references map[hash.Hash]uint64) {
+	for hashVal, count := range references {
+		if imdb.objectRefCounts[hashVal] <= count {
+			delete(imdb.objectRefCounts, hashVal)
+		} else {
+			imdb.objectRefCounts[hashVal] -= count
+		}
+	}
+}
+
+// checkObjectsPresent checks that the object server has all the objects
+// referenced by the image. Clients skip uploading objects which are already
+// present, and these may be unreferenced and old enough to be collected.
+// Since the garbage collector only deletes objects with the lock held, checking
+// with the write lock held ensures the objects cannot be deleted before the
+// image is added.
+// This must be called with the write lock held.
+func (imdb *ImageDataBase) checkObjectsPresent(img *image.Image) error {
+	hashesMap := make(map[hash.Hash]struct{})
+	forEachReferencedObject(img, func(hashVal hash.Hash) {
+		hashesMap[hashVal] = struct{}{}
+	})
+	hashes := make([]hash.Hash, 0, len(hashesMap))
+	for hashVal := range hashesMap {
+		hashes = append(hashes, hashVal)
+	}
+	objectSizes, err := imdb.objectServer.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	for index, size := range objectSizes {
+		if size < 1 {
+			return fmt.Errorf("object: %x is not available", hashes[index])
+		}
+	}
+	return nil
+}
+
+// forEachReferencedObject calls fn once for each reference to an object by the
+// image, including annotations.
+func forEachReferencedObject(img *image.Image, fn func(hash.Hash)) {
+	for _, inode := range img.FileSystem.InodeTable {
+		if inode, ok := inode.(*filesystem.RegularInode); ok {
+			if inode.Size > 0 {
+				fn(inode.Hash)
+			}
+		}
+	}
+	for _, annotation := range []*image.Annotation{img.ReleaseNotes,
+		img.BuildLog, img.Manifest, img.Packages} {
+		if annotation != nil && annotation.Object != nil {
+			fn(*annotation.Object)
+		}
+	}
+}
+
+func (imdb *ImageDataBase) collectGarbage(gracePeriod time.Duration,
+	dryRun bool) (GarbageReport, error) {
+	report := GarbageReport{DryRun: dryRun, StartTime: time.Now()}
+	objSrv, ok := imdb.objectServer.(staleObjectDeleter)
+	if !ok {
+		return report, errors.New("object server does not support deletion")
+	}
+	objectSizes := objSrv.ListObjectSizes()
+	imdb.removeReferencedObjects(objectSizes)
+	unreferencedObjects := make([]hash.Hash, 0, len(objectSizes))
+	for hashVal := range objectSizes {
+		unreferencedObjects = append(unreferencedObjects, hashVal)
+	}
+	objectSizes = nil
+	// Delete in batches, holding the lock for each batch so that AddImage()
+	// (which checks that its objects are present with the write lock held)
+	// cannot complete with references to objects which are being deleted. The
+	// references are checked again, since images may have been added.
+	for len(unreferencedObjects) > 0 {
+		numInBatch := len(unreferencedObjects)
+		if numInBatch > gcBatchSize {
+			numInBatch = gcBatchSize
+		}
+		batch := unreferencedObjects[:numInBatch]
+		unreferencedObjects = unreferencedObjects[numInBatch:]
+		err := imdb.collectGarbageBatch(objSrv, batch, gracePeriod, &report)
+		if err != nil {
+			report.Duration = time.Since(report.StartTime)
+			return report, err
+		}
+	}
+	report.Duration = time.Since(report.StartTime)
+	return report, nil
+}
+
+func (imdb *ImageDataBase) collectGarbageBatch(objSrv staleObjectDeleter,
+	batch []hash.Hash, gracePeriod time.Duration,
+	report *GarbageReport) error {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	for _, hashVal := range batch {
+		if _, ok := imdb.objectRefCounts[hashVal]; ok {
+			continue
+		}
+		var size uint64
+		var err error
+		if report.DryRun {
+			size, err = objSrv.CheckStaleObject(hashVal, gracePeriod)
+		} else {
+			size, err = objSrv.DeleteStaleObject(hashVal, gracePeriod)
+		}
+		if err != nil {
+			return err
+		}
+		if size < 1 {
+			report.NumSkippedObjects++
+			continue
+		}
+		report.NumObjects++
+		report.NumBytes += size
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package scanner
+
+import (
+	"bytes"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	objectserver "github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	_ "github.com/Symantec/Dominator/proto/imageserver" // Register inodes.
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type testDataBase struct {
+	*ImageDataBase
+	imageDir string
+	objSrv   *objectserver.ObjectServer
+	t        *testing.T
+}
+
+func newTestDataBase(t *testing.T) *testDataBase {
+	logger := log.New(ioutil.Discard, "", 0)
+	objSrv, err := objectserver.NewObjectServer(t.TempDir(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdb := &testDataBase{imageDir: t.TempDir(), objSrv: objSrv, t: t}
+	tdb.reload()
+	return tdb
+}
+
+// reload loads the image database again from disk.
+func (tdb *testDataBase) reload() {
+	imdb, err := LoadImageDataBase(tdb.imageDir, tdb.objSrv,
+		log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		tdb.t.Fatal(err)
+	}
+	tdb.ImageDataBase = imdb
+}
+
+func (tdb *testDataBase) addObject(data string) hash.Hash {
+	hashVal, _, err := tdb.objSrv.AddObject(bytes.NewBufferString(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		tdb.t.Fatal(err)
+	}
+	return hashVal
+}
+
+// addImage adds an image with a file for each pathname, containing the data.
+func (tdb *testDataBase) addImage(name string,
+	files map[string]string) *image.Image {
+	img := makeTestImage(files, tdb.addObject)
+	if err := tdb.AddImage(img, name, nil); err != nil {
+		tdb.t.Fatal(err)
+	}
+	return img
+}
+
+// makeTestImage makes an image with a file in the root directory for each
+// entry in files. The data are hashed with hasher.
+func makeTestImage(files map[string]string,
+	hasher func(data string) hash.Hash) *image.Image {
+	fs := &filesystem.FileSystem{InodeTable: make(filesystem.InodeTable)}
+	inodeNumber := uint64(1)
+	for name, data := range files {
+		inodeNumber++
+		fs.InodeTable[inodeNumber] = &filesystem.RegularInode{
+			Mode: filesystem.FileMode(0644),
+			Size: uint64(len(data)),
+			Hash: hasher(data),
+		}
+		fs.EntryList = append(fs.EntryList,
+			&filesystem.DirectoryEntry{Name: name, InodeNumber: inodeNumber})
+		fs.NumRegularInodes++
+		fs.TotalDataBytes += uint64(len(data))
+	}
+	fs.Mode = filesystem.FileMode(0755)
+	if err := fs.RebuildInodePointers(); err != nil {
+		panic(err)
+	}
+	fs.BuildEntryMap()
+	return &image.Image{FileSystem: fs}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	tdb := newTestDataBase(t)
+	tdb.addImage("kept", map[string]string{"a": "kept data"})
+	tdb.addImage("deleted", map[string]string{"b": "deleted data"})
+	tdb.addObject("never referenced")
+	if err := tdb.DeleteImage("deleted", nil); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		gracePeriod              time.Duration
+		dryRun                   bool
+		wantDeleted, wantSkipped uint64
+		wantNumObjectsAfterwards int
+	}{
+		{time.Hour, false, 0, 2, 3},
+		{0, true, 2, 0, 3},
+		{0, false, 2, 0, 1},
+		{0, false, 0, 0, 1},
+	}
+	for index, test := range tests {
+		report, err := tdb.CollectGarbage(test.gracePeriod, test.dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.NumObjects != test.wantDeleted ||
+			report.NumSkippedObjects != test.wantSkipped {
+			t.Errorf("test %d: deleted: %d, skipped: %d, want: %d, %d",
+				index, report.NumObjects, report.NumSkippedObjects,
+				test.wantDeleted, test.wantSkipped)
+		}
+		if got := len(tdb.objSrv.ListObjectSizes()); got !=
+			test.wantNumObjectsAfterwards {
+			t.Errorf("test %d: %d objects remain, want: %d",
+				index, got, test.wantNumObjectsAfterwards)
+		}
+	}
+	if tdb.GetImage("kept") == nil {
+		t.Error("referenced image lost")
+	}
+}
+
+func TestAddImageChecksObjectsWithLock(t *testing.T) {
+	tdb := newTestDataBase(t)
+	// Simulate a client which found the object present (and so skipped the
+	// upload) before it was garbage collected.
+	present := makeTestImage(map[string]string{"a": "unreferenced"},
+		tdb.addObject)
+	if _, err := tdb.CollectGarbage(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := tdb.AddImage(present, "image", nil); err == nil {
+		t.Error("image with collected object added")
+	}
+	if tdb.CheckImage("image") {
+		t.Error("image committed")
+	}
+	tdb.addObject("unreferenced")
+	if err := tdb.AddImage(present, "image", nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddImageChecksAnnotations(t *testing.T) {
+	tdb := newTestDataBase(t)
+	missing := hash.Hash{1}
+	present := tdb.addObject("inventory")
+	var tests = []struct {
+		name       string
+		annotation *image.Annotation
+		wantError  bool
+	}{
+		{"missing", &image.Annotation{Object: &missing}, true},
+		{"present", &image.Annotation{Object: &present}, false},
+		{"URL", &image.Annotation{URL: "http://example.com/"}, false},
+	}
+	for _, test := range tests {
+		img := makeTestImage(map[string]string{"a": "data"}, tdb.addObject)
+		img.Packages = test.annotation
+		err := tdb.AddImage(img, test.name, nil)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("%s: error: %v", test.name, err)
+		}
+		if tdb.CheckImage(test.name) == test.wantError {
+			t.Errorf("%s: committed: %v", test.name, !test.wantError)
+		}
+	}
+}
+
+// unreferencedObjects returns the data of the objects which are not referenced
+// by any image.
+func (tdb *testDataBase) unreferencedObjects(
+	objects map[hash.Hash]string) map[string]struct{} {
+	objectSizes := tdb.objSrv.ListObjectSizes()
+	tdb.RemoveReferencedObjects(objectSizes)
+	unreferenced := make(map[string]struct{}, len(objectSizes))
+	for hashVal := range objectSizes {
+		unreferenced[objects[hashVal]] = struct{}{}
+	}
+	return unreferenced
+}
+
+func TestObjectRefCounts(t *testing.T) {
+	tdb := newTestDataBase(t)
+	objects := make(map[hash.Hash]string)
+	hasher := func(data string) hash.Hash {
+		hashVal := tdb.addObject(data)
+		objects[hashVal] = data
+		return hashVal
+	}
+	notes := hasher("release notes")
+	img := makeTestImage(map[string]string{"a": "shared", "b": "one"}, hasher)
+	img.ReleaseNotes = &image.Annotation{Object: &notes}
+	if err := tdb.AddImage(img, "one", nil); err != nil {
+		t.Fatal(err)
+	}
+	img = makeTestImage(map[string]string{"a": "shared", "c": "two"}, hasher)
+	if err := tdb.AddImage(img, "two", nil); err != nil {
+		t.Fatal(err)
+	}
+	hasher("unused")
+	var tests = []struct {
+		deleteImage string
+		reload      bool
+		want        []string
+	}{
+		{"", false, []string{"unused"}},
+		{"", true, []string{"unused"}},
+		{"one", false, []string{"unused", "one", "release notes"}},
+		{"", true, []string{"unused", "one", "release notes"}},
+		{"two", false, []string{"unused", "one", "release notes", "shared",
+			"two"}},
+	}
+	for index, test := range tests {
+		if test.deleteImage != "" {
+			if err := tdb.DeleteImage(test.deleteImage, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.reload {
+			tdb.reload()
+		}
+		want := make(map[string]struct{}, len(test.want))
+		for _, data := range test.want {
+			want[data] = struct{}{}
+		}
+		if got := tdb.unreferencedObjects(objects); !reflect.DeepEqual(got,
+			want) {
+			t.Errorf("test %d: unreferenced: %v, want: %v", index, got, want)
+		}
+	}
+}
+
+func TestDeleteUnreferencedObjects(t *testing.T) {
+	var tests = []struct {
+		name        string
+		objects     []string
+		wantError   bool
+		wantDeleted []string
+	}{
+		{"unreferenced", []string{"unused 1", "unused 2"}, false,
+			[]string{"unused 1", "unused 2"}},
+		{"referenced", []string{"image data"}, true, nil},
+		{"mixed", []string{"unused 1", "image data"}, true, nil},
+		{"annotation", []string{"release notes"}, true, nil},
+	}
+	for _, test := range tests {
+		tdb := newTestDataBase(t)
+		img := makeTestImage(map[string]string{"a": "image data"},
+			tdb.addObject)
+		notesHash := tdb.addObject("release notes")
+		img.ReleaseNotes = &image.Annotation{Object: &notesHash}
+		if err := tdb.AddImage(img, "image", nil); err != nil {
+			t.Fatal(err)
+		}
+		objects := make(map[hash.Hash]string)
+		var hashes []hash.Hash
+		for _, data := range test.objects {
+			hashVal := tdb.addObject(data)
+			objects[hashVal] = data
+			hashes = append(hashes, hashVal)
+		}
+		sizes, err := tdb.DeleteUnreferencedObjects(hashes)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("%s: error: %v", test.name, err)
+		}
+		var deleted []string
+		present := tdb.objSrv.ListObjectSizes()
+		for _, hashVal := range hashes {
+			if _, ok := present[hashVal]; !ok {
+				deleted = append(deleted, objects[hashVal])
+			}
+		}
+		if !reflect.DeepEqual(deleted, test.wantDeleted) {
+			t.Errorf("%s: deleted: %v, want: %v", test.name, deleted,
+				test.wantDeleted)
+		}
+		if len(sizes) != len(test.wantDeleted) {
+			t.Errorf("%s: %d sizes returned", test.name, len(sizes))
+		}
+	}
+}
+
+// corruptFile overwrites the file with the same number of zero bytes.
+func (tdb *testDataBase) corruptFile(name string) {
+	filename := filepath.Join(tdb.imageDir, name)
+	fi, err := os.Stat(filename)
+	if err != nil {
+		tdb.t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filename, make([]byte, fi.Size()), 0644)
+	if err != nil {
+		tdb.t.Fatal(err)
+	}
+}
+
+func TestImageSummaries(t *testing.T) {
+	tdb := newTestDataBase(t)
+	objects := make(map[hash.Hash]string)
+	hasher := func(data string) hash.Hash {
+		hashVal := tdb.addObject(data)
+		objects[hashVal] = data
+		return hashVal
+	}
+	for _, name := range []string{"one", "two"} {
+		img := makeTestImage(map[string]string{"a": name}, hasher)
+		img.Labels = map[string]string{"name": name}
+		if err := tdb.AddImage(img, name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summaryFilename := filepath.Join(tdb.imageDir, ".one"+summarySuffix)
+	var tests = []struct {
+		name         string
+		modify       func()
+		wantImages   []string
+		unreferenced []string
+	}{
+		{"summary rewritten", func() {
+			if err := os.Remove(summaryFilename); err != nil {
+				t.Fatal(err)
+			}
+			tdb.reload()
+			if _, err := os.Stat(summaryFilename); err != nil {
+				t.Error(err)
+			}
+		}, []string{"one", "two"}, nil},
+		// Only the summary is read at startup, so a corrupt inode table is
+		// not noticed.
+		{"image not decoded", func() {
+			tdb.corruptFile("one")
+			tdb.reload()
+		}, []string{"one", "two"}, nil},
+		{"unreadable image deleted", func() {
+			if err := tdb.DeleteImage("one", nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(summaryFilename); !os.IsNotExist(err) {
+				t.Errorf("summary not removed: %v", err)
+			}
+		}, []string{"two"}, []string{"one"}},
+		{"deleted image reloaded", tdb.reload, []string{"two"},
+			[]string{"one"}},
+	}
+	for _, test := range tests {
+		test.modify()
+		images := tdb.ListImages()
+		sort.Strings(images)
+		if !reflect.DeepEqual(images, test.wantImages) {
+			t.Errorf("%s: images: %v, want: %v", test.name, images,
+				test.wantImages)
+		}
+		for _, name := range test.wantImages {
+			summary := tdb.GetImageSummary(name)
+			if summary == nil || summary.Image.Labels["name"] != name ||
+				summary.NumRegularInodes != 1 {
+				t.Errorf("%s: %s: summary: %+v", test.name, name, summary)
+			}
+		}
+		want := make(map[string]struct{}, len(test.unreferenced))
+		for _, data := range test.unreferenced {
+			want[data] = struct{}{}
+		}
+		if got := tdb.unreferencedObjects(objects); !reflect.DeepEqual(got,
+			want) {
+			t.Errorf("%s: unreferenced: %v, want: %v", test.name, got, want)
+		}
+	}
+}
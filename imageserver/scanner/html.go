@@ -14,4 +14,7 @@ func (imdb *ImageDataBase) writeHtml(writer io.Writer) {
 		"Number of  <a href=\"listDirectories?output=text\">directories</a>: "+
 			"<a href=\"listDirectories\">%d</a><br>\n",
 		imdb.CountDirectories())
+	fmt.Fprintln(writer, "<a href=\"findImages\">Search images</a> "+
+		"<a href=\"findImagesContaining\">Search files</a> "+
+		"<a href=\"diffImages\">Compare images</a><br>")
 }
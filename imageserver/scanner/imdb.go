@@ -24,58 +24,113 @@ const (
 )
 
 func (imdb *ImageDataBase) addImage(image *image.Image, name string,
-	username *string) error {
+	authInfo *AuthInformation) error {
 	if err := image.Verify(); err != nil {
 		return err
 	}
+	if err := image.VerifySignatures(); err != nil {
+		return err
+	}
 	imdb.Lock()
 	defer imdb.Unlock()
 	if _, ok := imdb.imageMap[name]; ok {
 		return errors.New("image: " + name + " already exists")
+	} else if _, ok := imdb.channelMap[name]; ok {
+		return errors.New("a channel named: " + name + " exists")
 	} else {
-		err := imdb.checkDirectoryPermissions(path.Dir(name), username)
+		err := imdb.checkDirectoryPermissions(path.Dir(name), authInfo)
 		if err != nil {
 			return err
 		}
-		filename := path.Join(imdb.baseDir, name)
-		file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_RDWR,
-			filePerms)
+		if err := imdb.checkObjectsPresent(image); err != nil {
+			return err
+		}
+		fileSize, err := writeImage(path.Join(imdb.baseDir, name), image)
 		if err != nil {
-			if os.IsExist(err) {
-				return errors.New("cannot add a previously deleted image")
-			}
 			return err
 		}
-		defer file.Close()
-		w := bufio.NewWriter(file)
-		defer w.Flush()
-		writer := fsutil.NewChecksumWriter(w)
-		defer writer.WriteChecksum()
-		encoder := gob.NewEncoder(writer)
-		encoder.Encode(image)
-		imdb.imageMap[name] = image
+		// The summary is written once the image is complete, so that it is
+		// never trusted for a partially written image.
+		summary := &summaryFile{
+			ImageFileSize:    fileSize,
+			Summary:          makeSummary(image),
+			ObjectReferences: getObjectReferences(image),
+		}
+		if err := imdb.writeSummary(name, summary); err != nil {
+			imdb.logger.Printf("Error writing summary for image: %s: %s\n",
+				name, err)
+		}
+		imdb.imageMap[name] = &imageEntry{
+			summary:  summary.Summary,
+			fileSize: fileSize,
+		}
+		imdb.imageCache.put(name, image, fileSize)
+		imdb.addObjectReferences(summary.ObjectReferences)
+		imdb.addToIndex(name, image)
 		imdb.addNotifiers.sendPlain(name, "add", imdb.logger)
 		return nil
 	}
 }
 
+// writeImage writes the image to a new file. The size of the file is returned.
+func writeImage(filename string, img *image.Image) (uint64, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_RDWR,
+		filePerms)
+	if err != nil {
+		if os.IsExist(err) {
+			return 0, errors.New("cannot add a previously deleted image")
+		}
+		return 0, err
+	}
+	w := bufio.NewWriter(file)
+	countingWriter := &countingWriter{writer: w}
+	writer := fsutil.NewChecksumWriter(countingWriter)
+	err = gob.NewEncoder(writer).Encode(img)
+	if err == nil {
+		err = writer.WriteChecksum()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return 0, err
+	}
+	return countingWriter.count, nil
+}
+
 // This must be called with the lock held.
 func (imdb *ImageDataBase) checkDirectoryPermissions(dirname string,
-	username *string) error {
-	if username == nil {
+	authInfo *AuthInformation) error {
+	if authInfo == nil {
 		return nil
 	}
 	directoryMetadata, ok := imdb.directoryMap[dirname]
 	if !ok {
 		return fmt.Errorf("no metadata for: \"%s\"", dirname)
 	}
-	if directoryMetadata.OwnerGroup == "" {
+	return imdb.checkOwnerGroup(dirname, directoryMetadata.OwnerGroup,
+		authInfo)
+}
+
+// checkOwnerGroup checks that the user is a member of the owner group of the
+// directory or belongs to a group which the directory policy permits.
+func (imdb *ImageDataBase) checkOwnerGroup(dirname, ownerGroup string,
+	authInfo *AuthInformation) error {
+	if ownerGroup == "" || authInfo == nil {
 		return nil
 	}
-	if *username == "" {
+	if imdb.directoryPolicy != nil &&
+		imdb.directoryPolicy.PermitsDirectory(authInfo.Groups, dirname) {
+		return nil
+	}
+	if authInfo.Username == "" {
 		return errors.New("no username: unauthenticated connection")
 	}
-	return checkUserInGroup(*username, directoryMetadata.OwnerGroup)
+	return checkUserInGroup(authInfo.Username, ownerGroup)
 }
 
 func (imdb *ImageDataBase) checkImage(name string) bool {
@@ -161,30 +216,135 @@ func (imdb *ImageDataBase) countImages() uint {
 	return uint(len(imdb.imageMap))
 }
 
-func (imdb *ImageDataBase) deleteImage(name string, username *string) error {
+func (imdb *ImageDataBase) deleteImage(name string,
+	authInfo *AuthInformation) error {
+	if !imdb.checkImage(name) {
+		return errors.New("image: " + name + " does not exist")
+	}
+	// The object references are read from the summary, so that they are
+	// released even if the image cannot be read. The image is needed to update
+	// the index. Read both before taking the lock, so that other changes are
+	// not blocked.
+	references, err := imdb.readObjectReferences(name)
+	if err != nil {
+		imdb.logger.Printf("Error reading summary: %s for delete: %s\n",
+			name, err)
+	}
+	oldImage, err := imdb.peekImage(name)
+	if err != nil {
+		imdb.logger.Printf("Error loading image: %s for delete: %s\n",
+			name, err)
+	} else if references == nil {
+		references = getObjectReferences(oldImage)
+	}
 	imdb.Lock()
 	defer imdb.Unlock()
-	if _, ok := imdb.imageMap[name]; ok {
-		err := imdb.checkDirectoryPermissions(path.Dir(name), username)
-		if err != nil {
-			return err
+	if _, ok := imdb.imageMap[name]; !ok {
+		return errors.New("image: " + name + " does not exist")
+	}
+	err = imdb.checkDirectoryPermissions(path.Dir(name), authInfo)
+	if err != nil {
+		return err
+	}
+	channelNames := imdb.findChannelsUsingImage(name)
+	if len(channelNames) > 0 {
+		// Replicated deletions (no username) are always permitted, since the
+		// channel updates may not have arrived yet. The channels are removed
+		// rather than left dangling: if the channels were moved to another
+		// image, the updates will re-create them.
+		if authInfo != nil {
+			return fmt.Errorf("image: %s is used by channel: %s",
+				name, channelNames[0])
 		}
-		filename := path.Join(imdb.baseDir, name)
-		if err := os.Truncate(filename, 0); err != nil {
+		if err := imdb.removeChannels(channelNames); err != nil {
 			return err
 		}
-		delete(imdb.imageMap, name)
-		imdb.deleteNotifiers.sendPlain(name, "delete", imdb.logger)
-		return nil
+	}
+	filename := path.Join(imdb.baseDir, name)
+	if err := os.Truncate(filename, 0); err != nil {
+		return err
+	}
+	if err := imdb.removeSummary(name); err != nil {
+		imdb.logger.Printf("Error removing summary: %s: %s\n", name, err)
+	}
+	if references == nil {
+		imdb.logger.Printf(
+			"Objects used by: %s will not be collected until restart\n",
+			name)
 	} else {
-		return errors.New("image: " + name + " does not exist")
+		imdb.deleteObjectReferences(references)
 	}
+	if oldImage == nil {
+		// Drop the index rather than keep stale data: it will be rebuilt when
+		// next needed.
+		imdb.dropIndex()
+	} else {
+		imdb.deleteFromIndex(name, oldImage)
+	}
+	delete(imdb.imageMap, name)
+	imdb.imageCache.remove(name)
+	imdb.deleteNotifiers.sendPlain(name, "delete", imdb.logger)
+	return nil
+}
+
+func (imdb *ImageDataBase) findImages(selector map[string]string) []string {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	names := make([]string, 0)
+	for name, entry := range imdb.imageMap {
+		if entry.summary.Image.MatchLabels(selector) {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 func (imdb *ImageDataBase) getImage(name string) *image.Image {
+	imdb.RLock()
+	entry, ok := imdb.imageMap[name]
+	imdb.RUnlock()
+	if !ok {
+		return nil
+	}
+	if img := imdb.imageCache.get(name); img != nil {
+		return img
+	}
+	img, err := imdb.readImage(name)
+	if err != nil {
+		imdb.logger.Printf("Error loading image: %s: %s\n", name, err)
+		return nil
+	}
+	imdb.Lock()
+	defer imdb.Unlock()
+	if imdb.imageMap[name] != entry {
+		return img // Deleted while loading: do not cache.
+	}
+	if !entry.summary.ComputedInodesKnown {
+		entry.summary.NumComputedRegularInodes =
+			img.FileSystem.NumComputedRegularInodes()
+		entry.summary.ComputedInodesKnown = true
+	}
+	imdb.imageCache.put(name, img, entry.fileSize)
+	return img
+}
+
+func (imdb *ImageDataBase) getImageSummary(name string) *ImageSummary {
 	imdb.RLock()
 	defer imdb.RUnlock()
-	return imdb.imageMap[name]
+	if entry, ok := imdb.imageMap[name]; ok {
+		summary := entry.summary
+		return &summary
+	}
+	return nil
+}
+
+// Get the image for internal use. The image is not added to the cache, to
+// avoid flushing the cache when scanning all images.
+func (imdb *ImageDataBase) peekImage(name string) (*image.Image, error) {
+	if img := imdb.imageCache.get(name); img != nil {
+		return img, nil
+	}
+	return imdb.readImage(name)
 }
 
 func (imdb *ImageDataBase) listDirectories() []image.Directory {
@@ -209,7 +369,7 @@ func (imdb *ImageDataBase) listImages() []string {
 }
 
 func (imdb *ImageDataBase) makeDirectory(directory image.Directory,
-	username string, userRpc bool) error {
+	authInfo *AuthInformation, userRpc bool) error {
 	directory.Name = path.Clean(directory.Name)
 	pathname := path.Join(imdb.baseDir, directory.Name)
 	imdb.Lock()
@@ -224,11 +384,10 @@ func (imdb *ImageDataBase) makeDirectory(directory image.Directory,
 		if !ok {
 			return fmt.Errorf("no metadata for: %s", path.Dir(directory.Name))
 		}
-		if parentMetadata.OwnerGroup != "" {
-			if err := checkUserInGroup(username,
-				parentMetadata.OwnerGroup); err != nil {
-				return err
-			}
+		err := imdb.checkOwnerGroup(path.Dir(directory.Name),
+			parentMetadata.OwnerGroup, authInfo)
+		if err != nil {
+			return err
 		}
 		directory.Metadata.OwnerGroup = parentMetadata.OwnerGroup
 	}
@@ -238,6 +397,17 @@ func (imdb *ImageDataBase) makeDirectory(directory image.Directory,
 	return imdb.updateDirectoryMetadata(directory)
 }
 
+type countingWriter struct {
+	writer io.Writer
+	count  uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	nWritten, err := w.writer.Write(p)
+	w.count += uint64(nWritten)
+	return nWritten, err
+}
+
 func checkUserInGroup(username, ownerGroup string) error {
 	userData, err := user.Lookup(username)
 	if err != nil {
@@ -266,6 +436,14 @@ func (imdb *ImageDataBase) registerAddNotifier() <-chan string {
 	return channel
 }
 
+func (imdb *ImageDataBase) registerChannelNotifier() <-chan string {
+	channel := make(chan string, 1)
+	imdb.Lock()
+	defer imdb.Unlock()
+	imdb.channelNotifiers[channel] = channel
+	return channel
+}
+
 func (imdb *ImageDataBase) registerDeleteNotifier() <-chan string {
 	channel := make(chan string, 1)
 	imdb.Lock()
@@ -288,6 +466,12 @@ func (imdb *ImageDataBase) unregisterAddNotifier(channel <-chan string) {
 	delete(imdb.addNotifiers, channel)
 }
 
+func (imdb *ImageDataBase) unregisterChannelNotifier(channel <-chan string) {
+	imdb.Lock()
+	defer imdb.Unlock()
+	delete(imdb.channelNotifiers, channel)
+}
+
 func (imdb *ImageDataBase) unregisterDeleteNotifier(channel <-chan string) {
 	imdb.Lock()
 	defer imdb.Unlock()
@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFindImages(t *testing.T) {
+	tdb := newTestDataBase(t)
+	for name, labels := range map[string]map[string]string{
+		"web-1": {"app": "web", "tier": "prod"},
+		"web-2": {"app": "web", "tier": "dev"},
+		"db-1":  {"app": "db"},
+		"bare":  nil,
+	} {
+		img := makeTestImage(map[string]string{"file": name}, tdb.addObject)
+		img.Labels = labels
+		if err := tdb.AddImage(img, name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tests = []struct {
+		selector map[string]string
+		want     []string
+	}{
+		{map[string]string{"app": "web"}, []string{"web-1", "web-2"}},
+		{map[string]string{"app": "web", "tier": "prod"}, []string{"web-1"}},
+		{map[string]string{"tier": ""}, []string{"web-1", "web-2"}},
+		{map[string]string{"app": "cache"}, []string{}},
+		{nil, []string{"bare", "db-1", "web-1", "web-2"}},
+	}
+	// Labels must survive a reload, which only decodes image metadata.
+	for _, reload := range []bool{false, true} {
+		if reload {
+			tdb.reload()
+		}
+		for _, test := range tests {
+			got := tdb.FindImages(test.selector)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("reload: %v, FindImages(%v) = %v, want: %v",
+					reload, test.selector, got, test.want)
+			}
+		}
+	}
+}
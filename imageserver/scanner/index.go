@@ -0,0 +1,236 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"path"
+)
+
+// imageIndex maps pathnames and objects to the names of the images which
+// contain them. Unlike the object reference counts, it is only built when first
+// needed (this requires reading every image) and is then kept up to date as
+// images are added and deleted. The memory used is dominated by the pathnames:
+// each pathname in each image costs a 16 byte reference to the image name, and
+// each distinct pathname is stored once.
+type imageIndex struct {
+	objects   map[hash.Hash][]string
+	pathnames map[string][]string
+}
+
+func newImageIndex() *imageIndex {
+	return &imageIndex{
+		objects:   make(map[hash.Hash][]string),
+		pathnames: make(map[string][]string),
+	}
+}
+
+func (imdb *ImageDataBase) findImagesContaining(pathname string,
+	object *hash.Hash) ([]string, error) {
+	if pathname == "" && object == nil {
+		return nil, errors.New("no pathname or object specified")
+	}
+	index, err := imdb.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	imdb.indexLock.Lock()
+	defer imdb.indexLock.Unlock()
+	var pathnameMatches, objectMatches []string
+	if pathname != "" {
+		pathnameMatches = index.pathnames[path.Clean("/"+pathname)]
+	}
+	if object != nil {
+		objectMatches = index.objects[*object]
+	}
+	switch {
+	case pathname != "" && object != nil:
+		return intersectNames(pathnameMatches, objectMatches), nil
+	case pathname != "":
+		return copyNames(pathnameMatches), nil
+	default:
+		return copyNames(objectMatches), nil
+	}
+}
+
+// getIndex returns the index, building it if needed. The images are read
+// without holding the lock, so that images may be added and deleted while the
+// index is built. Changes made meanwhile are applied with the lock held.
+func (imdb *ImageDataBase) getIndex() (*imageIndex, error) {
+	imdb.indexBuildLock.Lock()
+	defer imdb.indexBuildLock.Unlock()
+	imdb.indexLock.Lock()
+	index := imdb.index
+	imdb.indexLock.Unlock()
+	if index != nil {
+		return index, nil
+	}
+	index = newImageIndex()
+	indexedImages := make(map[string]struct{})
+	for _, name := range imdb.ListImages() {
+		img, err := imdb.peekImage(name)
+		if err != nil {
+			if !imdb.CheckImage(name) {
+				continue // Deleted while building.
+			}
+			return nil, fmt.Errorf("error loading image: %s: %s", name, err)
+		}
+		index.add(name, img)
+		indexedImages[name] = struct{}{}
+	}
+	imdb.Lock()
+	defer imdb.Unlock()
+	deletedImages := make(map[string]struct{})
+	for name := range indexedImages {
+		if _, ok := imdb.imageMap[name]; !ok {
+			deletedImages[name] = struct{}{}
+		}
+	}
+	if len(deletedImages) > 0 {
+		index.removeImages(deletedImages)
+	}
+	for name := range imdb.imageMap {
+		if _, ok := indexedImages[name]; ok {
+			continue
+		}
+		img, err := imdb.peekImage(name) // Probably in the cache.
+		if err != nil {
+			return nil, fmt.Errorf("error loading image: %s: %s", name, err)
+		}
+		index.add(name, img)
+	}
+	imdb.indexLock.Lock()
+	defer imdb.indexLock.Unlock()
+	imdb.index = index
+	return index, nil
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) addToIndex(name string, img *image.Image) {
+	imdb.indexLock.Lock()
+	defer imdb.indexLock.Unlock()
+	if imdb.index != nil {
+		imdb.index.add(name, img)
+	}
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) deleteFromIndex(name string, img *image.Image) {
+	if img == nil {
+		return
+	}
+	imdb.indexLock.Lock()
+	defer imdb.indexLock.Unlock()
+	if imdb.index != nil {
+		imdb.index.remove(name, img)
+	}
+}
+
+// This must be called with the lock held.
+func (imdb *ImageDataBase) dropIndex() {
+	imdb.indexLock.Lock()
+	defer imdb.indexLock.Unlock()
+	imdb.index = nil
+}
+
+func (index *imageIndex) add(name string, img *image.Image) {
+	objects := make(map[hash.Hash]struct{})
+	forEachReferencedObject(img, func(hashVal hash.Hash) {
+		objects[hashVal] = struct{}{}
+	})
+	for hashVal := range objects {
+		index.objects[hashVal] = append(index.objects[hashVal], name)
+	}
+	forEachPathname(&img.FileSystem.DirectoryInode, "",
+		func(pathname string) {
+			index.pathnames[pathname] = append(index.pathnames[pathname], name)
+		})
+}
+
+func (index *imageIndex) remove(name string, img *image.Image) {
+	forEachReferencedObject(img, func(hashVal hash.Hash) {
+		if names := removeName(index.objects[hashVal], name); len(names) < 1 {
+			delete(index.objects, hashVal)
+		} else {
+			index.objects[hashVal] = names
+		}
+	})
+	forEachPathname(&img.FileSystem.DirectoryInode, "",
+		func(pathname string) {
+			names := removeName(index.pathnames[pathname], name)
+			if len(names) < 1 {
+				delete(index.pathnames, pathname)
+			} else {
+				index.pathnames[pathname] = names
+			}
+		})
+}
+
+// removeImages removes the images without reading them, by scanning the
+// whole index.
+func (index *imageIndex) removeImages(names map[string]struct{}) {
+	for hashVal, imageNames := range index.objects {
+		if imageNames = removeNames(imageNames, names); len(imageNames) < 1 {
+			delete(index.objects, hashVal)
+		} else {
+			index.objects[hashVal] = imageNames
+		}
+	}
+	for pathname, imageNames := range index.pathnames {
+		if imageNames = removeNames(imageNames, names); len(imageNames) < 1 {
+			delete(index.pathnames, pathname)
+		} else {
+			index.pathnames[pathname] = imageNames
+		}
+	}
+}
+
+func forEachPathname(directory *filesystem.DirectoryInode, dirname string,
+	fn func(string)) {
+	for _, dirent := range directory.EntryList {
+		pathname := dirname + "/" + dirent.Name
+		fn(pathname)
+		if inode, ok := dirent.Inode().(*filesystem.DirectoryInode); ok {
+			forEachPathname(inode, pathname, fn)
+		}
+	}
+}
+
+func copyNames(names []string) []string {
+	return append(make([]string, 0, len(names)), names...)
+}
+
+func intersectNames(left, right []string) []string {
+	rightNames := make(map[string]struct{}, len(right))
+	for _, name := range right {
+		rightNames[name] = struct{}{}
+	}
+	names := make([]string, 0)
+	for _, name := range left {
+		if _, ok := rightNames[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func removeNames(names []string, namesToRemove map[string]struct{}) []string {
+	newNames := names[:0:0]
+	for _, name := range names {
+		if _, ok := namesToRemove[name]; !ok {
+			newNames = append(newNames, name)
+		}
+	}
+	return newNames
+}
+
+func removeName(names []string, name string) []string {
+	for index, entry := range names {
+		if entry == name {
+			return append(names[:index:index], names[index+1:]...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func (tdb *testDataBase) findImagesContaining(pathname string,
+	object *hash.Hash) []string {
+	names, err := tdb.FindImagesContaining(pathname, object)
+	if err != nil {
+		tdb.t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFindImagesContaining(t *testing.T) {
+	tdb := newTestDataBase(t)
+	tdb.addImage("one", map[string]string{"a": "shared", "b": "one"})
+	tdb.addImage("two", map[string]string{"a": "shared", "c": "two"})
+	shared := tdb.addObject("shared")
+	two := tdb.addObject("two")
+	var tests = []struct {
+		operation string // add, delete, reload or "".
+		name      string
+		pathname  string
+		object    *hash.Hash
+		want      []string
+	}{
+		{"", "", "/a", nil, []string{"one", "two"}},
+		{"", "", "b", nil, []string{"one"}},
+		{"", "", "", &shared, []string{"one", "two"}},
+		{"", "", "/c", &shared, []string{"two"}},
+		{"", "", "/b", &two, []string{}},
+		{"add", "three", "/c", nil, []string{"three", "two"}},
+		{"delete", "two", "/c", nil, []string{"three"}},
+		{"", "", "", &two, []string{"three"}},
+		{"reload", "", "/a", nil, []string{"one"}},
+		{"delete", "one", "/b", nil, []string{}},
+	}
+	for index, test := range tests {
+		switch test.operation {
+		case "add":
+			tdb.addImage(test.name, map[string]string{"c": "two"})
+		case "delete":
+			if err := tdb.DeleteImage(test.name, nil); err != nil {
+				t.Fatal(err)
+			}
+		case "reload":
+			tdb.reload()
+		}
+		got := tdb.findImagesContaining(test.pathname, test.object)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: FindImagesContaining(%q, %v) = %v, want: %v",
+				index, test.pathname, test.object != nil, got, test.want)
+		}
+	}
+	if _, err := tdb.FindImagesContaining("", nil); err == nil {
+		t.Error("no error for empty search")
+	}
+}
+
+func TestIndexRemoveImages(t *testing.T) {
+	index := newImageIndex()
+	for _, name := range []string{"one", "two", "three"} {
+		index.add(name, makeTestImage(map[string]string{"a": "shared",
+			name: name}, func(data string) hash.Hash {
+			return hash.Hash{byte(len(data))}
+		}))
+	}
+	index.removeImages(map[string]struct{}{"one": {}, "three": {}})
+	want := map[string][]string{"/a": {"two"}, "/two": {"two"}}
+	if !reflect.DeepEqual(index.pathnames, want) {
+		t.Errorf("pathnames: %v, want: %v", index.pathnames, want)
+	}
+	if len(index.objects) != 2 {
+		t.Errorf("objects: %v", index.objects)
+	}
+}
+
+// Build the index while images are added and deleted. The index must end up
+// consistent with the images.
+func TestBuildIndexConcurrently(t *testing.T) {
+	tdb := newTestDataBase(t)
+	for count := 0; count < 20; count++ {
+		name := fmt.Sprintf("old-%d", count)
+		tdb.addImage(name, map[string]string{"a": name})
+	}
+	done := make(chan struct{})
+	go func() {
+		for count := 0; count < 20; count++ {
+			tdb.addImage(fmt.Sprintf("new-%d", count),
+				map[string]string{"a": "new"})
+			if err := tdb.DeleteImage(fmt.Sprintf("old-%d", count),
+				nil); err != nil {
+				t.Error(err)
+			}
+		}
+		close(done)
+	}()
+	for building := true; building; {
+		select {
+		case <-done:
+			building = false
+		default:
+		}
+		tdb.indexLock.Lock()
+		tdb.index = nil
+		tdb.indexLock.Unlock()
+		tdb.findImagesContaining("/a", nil)
+	}
+	got := tdb.findImagesContaining("/a", nil)
+	want := tdb.ListImages()
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
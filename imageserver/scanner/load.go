@@ -5,9 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Symantec/Dominator/lib/concurrent"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filter"
 	"github.com/Symantec/Dominator/lib/fsutil"
+	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/image"
 	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/triggers"
 	"io"
 	"log"
 	"os"
@@ -16,6 +20,28 @@ import (
 	"time"
 )
 
+// imageMetadata mirrors image.Image, but only the summary fields and the inode
+// table of the file-system are decoded. It is used to make the summary for
+// images which do not have one.
+type imageMetadata struct {
+	CreatedBy    string
+	Filter       *filter.Filter
+	FileSystem   *fileSystemSummary
+	Triggers     *triggers.Triggers
+	ReleaseNotes *image.Annotation
+	BuildLog     *image.Annotation
+	Manifest     *image.Annotation
+	Packages     *image.Annotation
+	Labels       map[string]string
+	Signatures   []image.Signature
+}
+
+type fileSystemSummary struct {
+	InodeTable       filesystem.InodeTable // Needed for object references.
+	NumRegularInodes uint64
+	TotalDataBytes   uint64
+}
+
 func loadImageDataBase(baseDir string, objSrv objectserver.ObjectServer,
 	logger *log.Logger) (*ImageDataBase, error) {
 	fi, err := os.Stat(baseDir)
@@ -29,10 +55,14 @@ func loadImageDataBase(baseDir string, objSrv objectserver.ObjectServer,
 	imdb := new(ImageDataBase)
 	imdb.baseDir = baseDir
 	imdb.directoryMap = make(map[string]image.DirectoryMetadata)
-	imdb.imageMap = make(map[string]*image.Image)
+	imdb.imageMap = make(map[string]*imageEntry)
+	imdb.channelMap = make(map[string]*image.Channel)
 	imdb.addNotifiers = make(notifiers)
+	imdb.channelNotifiers = make(notifiers)
 	imdb.deleteNotifiers = make(notifiers)
 	imdb.mkdirNotifiers = make(makeDirectoryNotifiers)
+	imdb.objectRefCounts = make(map[hash.Hash]uint64)
+	imdb.imageCache = newImageCache()
 	imdb.objectServer = objSrv
 	imdb.logger = logger
 	state := concurrent.NewState(0)
@@ -45,6 +75,9 @@ func loadImageDataBase(baseDir string, objSrv objectserver.ObjectServer,
 	if err := state.Reap(); err != nil {
 		return nil, err
 	}
+	if err := imdb.loadChannels(); err != nil {
+		return nil, err
+	}
 	if logger != nil {
 		plural := ""
 		if imdb.CountImages() != 1 {
@@ -124,33 +157,136 @@ func (imdb *ImageDataBase) readDirectoryMetadata(dirname string) (
 	return metadata, reader.VerifyChecksum()
 }
 
+// Only load the image summary, which includes the object references, so the
+// directory tree is not built and the image is not kept in memory. Images
+// without a valid summary (such as those added by older versions) are decoded
+// to make one, which is saved for the next startup.
 func (imdb *ImageDataBase) loadFile(filename string, logger *log.Logger) error {
-	file, err := os.Open(path.Join(imdb.baseDir, filename))
+	fi, err := os.Stat(path.Join(imdb.baseDir, filename))
 	if err != nil {
 		return err
 	}
+	fileSize := uint64(fi.Size())
+	summary, err := imdb.readSummary(filename, fileSize)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Printf("Error reading summary for image: %s: %s\n",
+				filename, err)
+		}
+		summary, err = imdb.makeSummaryFromFile(filename, fileSize, logger)
+		if err != nil {
+			return err
+		}
+		if summary == nil {
+			return nil
+		}
+		if err := imdb.writeSummary(filename, summary); err != nil {
+			logger.Printf("Error writing summary for image: %s: %s\n",
+				filename, err)
+		}
+	}
+	imdb.Lock()
+	defer imdb.Unlock()
+	imdb.imageMap[filename] = &imageEntry{
+		summary:  summary.Summary,
+		fileSize: fileSize,
+	}
+	imdb.addObjectReferences(summary.ObjectReferences)
+	return nil
+}
+
+// makeSummaryFromFile decodes the image metadata and inode table to make the
+// summary. If the image is corrupt, nil is returned.
+func (imdb *ImageDataBase) makeSummaryFromFile(filename string,
+	fileSize uint64, logger *log.Logger) (*summaryFile, error) {
+	file, err := os.Open(path.Join(imdb.baseDir, filename))
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 	reader := fsutil.NewChecksumReader(file)
 	decoder := gob.NewDecoder(reader)
-	var image image.Image
-	if err := decoder.Decode(&image); err != nil {
-		return err
+	var metadata imageMetadata
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, err
 	}
 	if err := reader.VerifyChecksum(); err != nil {
 		if err == fsutil.ErrorChecksumMismatch {
 			logger.Printf("Checksum mismatch for image: %s\n", filename)
-			return nil
+			return nil, nil
 		}
 		if err != io.EOF {
-			return err
+			return nil, err
 		}
 	}
-	image.FileSystem.RebuildInodePointers()
-	if err := image.Verify(); err != nil {
-		return err
+	summary := &summaryFile{
+		ImageFileSize: fileSize,
+		Summary: ImageSummary{
+			Image: &image.Image{
+				CreatedBy:    metadata.CreatedBy,
+				Filter:       metadata.Filter,
+				Triggers:     metadata.Triggers,
+				ReleaseNotes: metadata.ReleaseNotes,
+				BuildLog:     metadata.BuildLog,
+				Manifest:     metadata.Manifest,
+				Packages:     metadata.Packages,
+				Labels:       metadata.Labels,
+				Signatures:   metadata.Signatures,
+			},
+			ComputedInodesKnown: true,
+		},
+	}
+	references := *summary.Summary.Image
+	references.FileSystem = &filesystem.FileSystem{}
+	if metadata.FileSystem != nil {
+		summary.Summary.NumRegularInodes = metadata.FileSystem.NumRegularInodes
+		summary.Summary.TotalDataBytes = metadata.FileSystem.TotalDataBytes
+		references.FileSystem.InodeTable = metadata.FileSystem.InodeTable
+		summary.Summary.NumComputedRegularInodes =
+			references.FileSystem.NumComputedRegularInodes()
+	}
+	summary.ObjectReferences = getObjectReferences(&references)
+	return summary, nil
+}
+
+// Load the full image from disk. The image is not added to the cache.
+func (imdb *ImageDataBase) readImage(name string) (*image.Image, error) {
+	file, err := os.Open(path.Join(imdb.baseDir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := fsutil.NewChecksumReader(file)
+	decoder := gob.NewDecoder(reader)
+	var img image.Image
+	if err := decoder.Decode(&img); err != nil {
+		return nil, err
+	}
+	if err := reader.VerifyChecksum(); err != nil {
+		if err == fsutil.ErrorChecksumMismatch {
+			return nil, errors.New("checksum mismatch for image: " + name)
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+	}
+	if err := img.FileSystem.RebuildInodePointers(); err != nil {
+		return nil, err
+	}
+	if err := img.Verify(); err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
+
+func makeSummary(img *image.Image) ImageSummary {
+	metadata := *img
+	metadata.FileSystem = nil
+	return ImageSummary{
+		Image:                    &metadata,
+		NumRegularInodes:         img.FileSystem.NumRegularInodes,
+		TotalDataBytes:           img.FileSystem.TotalDataBytes,
+		NumComputedRegularInodes: img.FileSystem.NumComputedRegularInodes(),
+		ComputedInodesKnown:      true,
 	}
-	imdb.Lock()
-	defer imdb.Unlock()
-	imdb.imageMap[filename] = &image
-	return nil
 }
@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"github.com/Symantec/Dominator/lib/fsutil"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"os"
+	"path"
+)
+
+const summarySuffix = ".summary"
+
+// summaryFile is written next to each image, so that the metadata and object
+// references of the images can be loaded at startup without decoding their
+// inode tables. Since the name starts with ".", it is skipped when scanning for
+// images.
+type summaryFile struct {
+	ImageFileSize    uint64 // Detects images replaced behind our back.
+	Summary          ImageSummary
+	ObjectReferences map[hash.Hash]uint64 // The number of references.
+}
+
+func getSummaryFilename(name string) string {
+	return path.Join(path.Dir(name), "."+path.Base(name)+summarySuffix)
+}
+
+// getObjectReferences counts the references to each object by the image.
+func getObjectReferences(img *image.Image) map[hash.Hash]uint64 {
+	references := make(map[hash.Hash]uint64)
+	forEachReferencedObject(img, func(hashVal hash.Hash) {
+		references[hashVal]++
+	})
+	return references
+}
+
+// readSummary reads the summary for the image, which must be imageFileSize
+// bytes long.
+func (imdb *ImageDataBase) readSummary(name string,
+	imageFileSize uint64) (*summaryFile, error) {
+	file, err := os.Open(path.Join(imdb.baseDir, getSummaryFilename(name)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := fsutil.NewChecksumReader(bufio.NewReader(file))
+	var summary summaryFile
+	if err := gob.NewDecoder(reader).Decode(&summary); err != nil {
+		return nil, err
+	}
+	if err := reader.VerifyChecksum(); err != nil {
+		return nil, err
+	}
+	if summary.ImageFileSize != imageFileSize {
+		return nil, errors.New("summary is for a different image file")
+	}
+	if summary.Summary.Image == nil {
+		return nil, errors.New("summary has no image metadata")
+	}
+	return &summary, nil
+}
+
+// readObjectReferences reads the object references of the image from its
+// summary.
+func (imdb *ImageDataBase) readObjectReferences(name string) (
+	map[hash.Hash]uint64, error) {
+	fi, err := os.Stat(path.Join(imdb.baseDir, name))
+	if err != nil {
+		return nil, err
+	}
+	summary, err := imdb.readSummary(name, uint64(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	return summary.ObjectReferences, nil
+}
+
+// writeSummary replaces the summary for the image, so that a partially
+// written summary is never read.
+func (imdb *ImageDataBase) writeSummary(name string,
+	summary *summaryFile) error {
+	filename := path.Join(imdb.baseDir, getSummaryFilename(name))
+	tmpFilename := filename + "~"
+	file, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_RDWR,
+		filePerms)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	writer := fsutil.NewChecksumWriter(w)
+	err = gob.NewEncoder(writer).Encode(summary)
+	if err == nil {
+		err = writer.WriteChecksum()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+func (imdb *ImageDataBase) removeSummary(name string) error {
+	err := os.Remove(path.Join(imdb.baseDir, getSummaryFilename(name)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -1,15 +1,17 @@
 package constants
 
 const (
-	SubPortNumber                = 6969
-	DomPortNumber                = 6970
-	ImageServerPortNumber        = 6971
-	BasicFileGenServerPortNumber = 6972
+	SubPortNumber                 = 6969
+	DomPortNumber                 = 6970
+	ImageServerPortNumber         = 6971
+	BasicFileGenServerPortNumber  = 6972
+	CachingObjectServerPortNumber = 6973
 
 	DefaultNetworkSpeedPercent = 10
 
 	AssignedOIDBase        = "1.3.6.1.4.1.9586.100.7"
 	PermittedMethodListOID = AssignedOIDBase + ".1"
+	GroupListOID           = AssignedOIDBase + ".2"
 )
 
 var RequiredPaths = map[string]rune{
@@ -265,6 +265,68 @@ func (mode FileMode) String() string {
 	return mode.string()
 }
 
+// DiffAttributes is a bit mask of the attributes which differ for a path.
+type DiffAttributes uint
+
+const (
+	DiffType      = 1 << iota // The inode type changed: nothing else compared.
+	DiffMode                  // Permissions.
+	DiffOwner                 // UID or GID.
+	DiffMtime                 // Modification time.
+	DiffSize                  // Size.
+	DiffData                  // Content hash or computed source.
+	DiffHardlinks             // The set of paths linked to the inode.
+	DiffSymlink               // Symlink target.
+	DiffRdev                  // Device number.
+)
+
+func (attributes DiffAttributes) MarshalJSON() ([]byte, error) {
+	return attributes.marshalJSON()
+}
+
+func (attributes DiffAttributes) String() string {
+	return attributes.string()
+}
+
+func (attributes *DiffAttributes) UnmarshalJSON(data []byte) error {
+	return attributes.unmarshalJSON(data)
+}
+
+type ChangedPath struct {
+	Path       string
+	Attributes DiffAttributes
+}
+
+// FileSystemDiff records the differences between two file-systems. Paths are
+// sorted.
+type FileSystemDiff struct {
+	Added   []string      // Paths only in the right file-system.
+	Removed []string      // Paths only in the left file-system.
+	Changed []ChangedPath // Paths in both which differ.
+}
+
+// DiffFileSystems computes the differences between the left and right
+// file-systems. Paths matching filter (if not nil) are ignored, including
+// their descendants. The file-systems do not need their inode pointers
+// rebuilt.
+func DiffFileSystems(left, right *FileSystem,
+	filter *filter.Filter) *FileSystemDiff {
+	return diffFileSystems(left, right, filter)
+}
+
+// Empty returns true if there are no differences.
+func (diff *FileSystemDiff) Empty() bool {
+	return len(diff.Added) < 1 && len(diff.Removed) < 1 &&
+		len(diff.Changed) < 1
+}
+
+// WriteText writes the differences in a line-oriented text format to writer.
+// Removed paths are prefixed with "- ", added paths with "+ " and changed paths
+// with "M " and followed by the list of changed attributes.
+func (diff *FileSystemDiff) WriteText(writer io.Writer) error {
+	return diff.writeText(writer)
+}
+
 func CompareFileSystems(left, right *FileSystem, logWriter io.Writer) bool {
 	return compareFileSystems(left, right, logWriter)
 }
@@ -0,0 +1,265 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filter"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+var diffAttributeNames = []string{
+	"type",
+	"mode",
+	"owner",
+	"mtime",
+	"size",
+	"data",
+	"hardlinks",
+	"symlink",
+	"rdev",
+}
+
+type diffState struct {
+	fs             *FileSystem
+	filter         *filter.Filter
+	pathToInode    map[string]uint64
+	inodeToPaths   map[uint64][]string
+	orderedEntries []string
+}
+
+func diffFileSystems(left, right *FileSystem,
+	filter *filter.Filter) *FileSystemDiff {
+	leftState := newDiffState(left, filter)
+	rightState := newDiffState(right, filter)
+	diff := &FileSystemDiff{}
+	for _, name := range leftState.orderedEntries {
+		if _, ok := rightState.pathToInode[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for _, name := range rightState.orderedEntries {
+		leftInum, ok := leftState.pathToInode[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		rightInum := rightState.pathToInode[name]
+		attributes := diffInodes(left.InodeTable[leftInum],
+			right.InodeTable[rightInum])
+		if attributes&DiffType == 0 {
+			if _, ok := left.InodeTable[leftInum].(*DirectoryInode); !ok {
+				if !sameLinks(leftState.inodeToPaths[leftInum],
+					rightState.inodeToPaths[rightInum]) {
+					attributes |= DiffHardlinks
+				}
+			}
+		}
+		if attributes != 0 {
+			diff.Changed = append(diff.Changed,
+				ChangedPath{Path: name, Attributes: attributes})
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Sort(changedPathList(diff.Changed))
+	return diff
+}
+
+func newDiffState(fs *FileSystem, filter *filter.Filter) *diffState {
+	state := &diffState{
+		fs:           fs,
+		filter:       filter,
+		pathToInode:  make(map[string]uint64),
+		inodeToPaths: make(map[uint64][]string),
+	}
+	state.walk(&fs.DirectoryInode, "/")
+	return state
+}
+
+func (state *diffState) walk(directory *DirectoryInode, name string) {
+	for _, dirent := range directory.EntryList {
+		pathname := path.Join(name, dirent.Name)
+		if state.filter != nil && state.filter.Match(pathname) {
+			continue
+		}
+		state.pathToInode[pathname] = dirent.InodeNumber
+		state.inodeToPaths[dirent.InodeNumber] = append(
+			state.inodeToPaths[dirent.InodeNumber], pathname)
+		state.orderedEntries = append(state.orderedEntries, pathname)
+		inode := state.fs.InodeTable[dirent.InodeNumber]
+		if inode, ok := inode.(*DirectoryInode); ok {
+			state.walk(inode, pathname)
+		}
+	}
+}
+
+func sameLinks(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	leftSorted := append([]string(nil), left...)
+	rightSorted := append([]string(nil), right...)
+	sort.Strings(leftSorted)
+	sort.Strings(rightSorted)
+	for index, name := range leftSorted {
+		if name != rightSorted[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func diffInodes(left, right GenericInode) DiffAttributes {
+	var attributes DiffAttributes
+	switch left := left.(type) {
+	case *DirectoryInode:
+		if right, ok := right.(*DirectoryInode); ok {
+			attributes |= diffMode(left.Mode, right.Mode)
+			attributes |= diffOwner(left.Uid, left.Gid, right.Uid, right.Gid)
+			return attributes
+		}
+	case *RegularInode:
+		if right, ok := right.(*RegularInode); ok {
+			attributes |= diffMode(left.Mode, right.Mode)
+			attributes |= diffOwner(left.Uid, left.Gid, right.Uid, right.Gid)
+			if left.MtimeSeconds != right.MtimeSeconds ||
+				left.MtimeNanoSeconds != right.MtimeNanoSeconds {
+				attributes |= DiffMtime
+			}
+			if left.Size != right.Size {
+				attributes |= DiffSize
+			}
+			if left.Hash != right.Hash {
+				attributes |= DiffData
+			}
+			return attributes
+		}
+	case *ComputedRegularInode:
+		if right, ok := right.(*ComputedRegularInode); ok {
+			attributes |= diffMode(left.Mode, right.Mode)
+			attributes |= diffOwner(left.Uid, left.Gid, right.Uid, right.Gid)
+			if left.Source != right.Source {
+				attributes |= DiffData
+			}
+			return attributes
+		}
+	case *SymlinkInode:
+		if right, ok := right.(*SymlinkInode); ok {
+			attributes |= diffOwner(left.Uid, left.Gid, right.Uid, right.Gid)
+			if left.Symlink != right.Symlink {
+				attributes |= DiffSymlink
+			}
+			return attributes
+		}
+	case *SpecialInode:
+		if right, ok := right.(*SpecialInode); ok {
+			if left.Mode&syscall.S_IFMT != right.Mode&syscall.S_IFMT {
+				return DiffType
+			}
+			attributes |= diffMode(left.Mode, right.Mode)
+			attributes |= diffOwner(left.Uid, left.Gid, right.Uid, right.Gid)
+			if left.MtimeSeconds != right.MtimeSeconds ||
+				left.MtimeNanoSeconds != right.MtimeNanoSeconds {
+				attributes |= DiffMtime
+			}
+			if left.Rdev != right.Rdev {
+				attributes |= DiffRdev
+			}
+			return attributes
+		}
+	}
+	return DiffType
+}
+
+func diffMode(left, right FileMode) DiffAttributes {
+	if left != right {
+		return DiffMode
+	}
+	return 0
+}
+
+func diffOwner(leftUid, leftGid, rightUid, rightGid uint32) DiffAttributes {
+	if leftUid != rightUid || leftGid != rightGid {
+		return DiffOwner
+	}
+	return 0
+}
+
+func (attributes DiffAttributes) strings() []string {
+	names := make([]string, 0, len(diffAttributeNames))
+	for index, name := range diffAttributeNames {
+		if attributes&(1<<uint(index)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (attributes DiffAttributes) string() string {
+	return strings.Join(attributes.strings(), ",")
+}
+
+func (attributes DiffAttributes) marshalJSON() ([]byte, error) {
+	return json.Marshal(attributes.strings())
+}
+
+func (attributes *DiffAttributes) unmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*attributes = 0
+	for _, name := range names {
+		found := false
+		for index, knownName := range diffAttributeNames {
+			if name == knownName {
+				*attributes |= 1 << uint(index)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown diff attribute: %s", name)
+		}
+	}
+	return nil
+}
+
+func (diff *FileSystemDiff) writeText(writer io.Writer) error {
+	for _, name := range diff.Removed {
+		if _, err := fmt.Fprintf(writer, "- %s\n", name); err != nil {
+			return err
+		}
+	}
+	for _, name := range diff.Added {
+		if _, err := fmt.Fprintf(writer, "+ %s\n", name); err != nil {
+			return err
+		}
+	}
+	for _, changed := range diff.Changed {
+		_, err := fmt.Fprintf(writer, "M %s (%s)\n", changed.Path,
+			changed.Attributes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type changedPathList []ChangedPath
+
+func (list changedPathList) Len() int {
+	return len(list)
+}
+
+func (list changedPathList) Less(left, right int) bool {
+	return list[left].Path < list[right].Path
+}
+
+func (list changedPathList) Swap(left, right int) {
+	list[left], list[right] = list[right], list[left]
+}
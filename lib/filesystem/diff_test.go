@@ -0,0 +1,243 @@
+package filesystem
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Symantec/Dominator/lib/filter"
+	"github.com/Symantec/Dominator/lib/hash"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// makeDiffTestFileSystem makes a file-system with /etc/passwd, a hard link
+// /etc/passwd.link, a symlink /etc/alias, a device /dev/null and a computed
+// file /etc/hostname.
+func makeDiffTestFileSystem() *FileSystem {
+	return &FileSystem{
+		InodeTable: InodeTable{
+			2: &DirectoryInode{
+				EntryList: []*DirectoryEntry{
+					{Name: "alias", InodeNumber: 4},
+					{Name: "hostname", InodeNumber: 7},
+					{Name: "passwd", InodeNumber: 3},
+					{Name: "passwd.link", InodeNumber: 3},
+				},
+				Mode: syscall.S_IFDIR | 0755,
+			},
+			3: &RegularInode{Mode: syscall.S_IFREG | 0644, Size: 1,
+				Hash: hash.Hash{1}},
+			4: &SymlinkInode{Symlink: "passwd"},
+			5: &DirectoryInode{
+				EntryList: []*DirectoryEntry{{Name: "null", InodeNumber: 6}},
+				Mode:      syscall.S_IFDIR | 0755,
+			},
+			6: &SpecialInode{Mode: syscall.S_IFCHR | 0666, Rdev: 1<<8 | 3},
+			7: &ComputedRegularInode{Mode: syscall.S_IFREG | 0644,
+				Source: "localhost:6969"},
+		},
+		DirectoryInode: DirectoryInode{
+			EntryList: []*DirectoryEntry{
+				{Name: "dev", InodeNumber: 5},
+				{Name: "etc", InodeNumber: 2},
+			},
+			Mode: syscall.S_IFDIR | 0755,
+		},
+	}
+}
+
+func getDirectory(fs *FileSystem, inum uint64) *DirectoryInode {
+	return fs.InodeTable[inum].(*DirectoryInode)
+}
+
+func TestDiffFileSystems(t *testing.T) {
+	var tests = []struct {
+		name   string
+		modify func(fs *FileSystem)
+		filter []string
+		want   FileSystemDiff
+	}{
+		{
+			name:   "identical",
+			modify: func(fs *FileSystem) {},
+		},
+		{
+			name: "content and mtime",
+			modify: func(fs *FileSystem) {
+				inode := fs.InodeTable[3].(*RegularInode)
+				inode.Hash = hash.Hash{2}
+				inode.MtimeSeconds = 1
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/etc/passwd", DiffMtime | DiffData},
+				{"/etc/passwd.link", DiffMtime | DiffData},
+			}},
+		},
+		{
+			name: "mode, owner and size",
+			modify: func(fs *FileSystem) {
+				inode := fs.InodeTable[3].(*RegularInode)
+				inode.Mode = syscall.S_IFREG | 0600
+				inode.Uid = 1
+				inode.Size = 2
+				getDirectory(fs, 2).Gid = 1
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/etc", DiffOwner},
+				{"/etc/passwd", DiffMode | DiffOwner | DiffSize},
+				{"/etc/passwd.link", DiffMode | DiffOwner | DiffSize},
+			}},
+		},
+		{
+			name: "symlink target",
+			modify: func(fs *FileSystem) {
+				fs.InodeTable[4].(*SymlinkInode).Symlink = "group"
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/etc/alias", DiffSymlink},
+			}},
+		},
+		{
+			name: "computed source",
+			modify: func(fs *FileSystem) {
+				fs.InodeTable[7].(*ComputedRegularInode).Source = "other:6969"
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/etc/hostname", DiffData},
+			}},
+		},
+		{
+			name: "device number",
+			modify: func(fs *FileSystem) {
+				fs.InodeTable[6].(*SpecialInode).Rdev = 1<<8 | 5
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/dev/null", DiffRdev},
+			}},
+		},
+		{
+			name: "inode type",
+			modify: func(fs *FileSystem) {
+				fs.InodeTable[4] = &RegularInode{Mode: syscall.S_IFREG | 0644}
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/etc/alias", DiffType},
+			}},
+		},
+		{
+			name: "special file type",
+			modify: func(fs *FileSystem) {
+				fs.InodeTable[6].(*SpecialInode).Mode = syscall.S_IFBLK | 0666
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/dev/null", DiffType},
+			}},
+		},
+		{
+			name: "hard link broken",
+			modify: func(fs *FileSystem) {
+				fs.InodeTable[8] = &RegularInode{Mode: syscall.S_IFREG | 0644,
+					Size: 1, Hash: hash.Hash{1}}
+				getDirectory(fs, 2).EntryList[3].InodeNumber = 8
+			},
+			want: FileSystemDiff{Changed: []ChangedPath{
+				{"/etc/passwd", DiffHardlinks},
+				{"/etc/passwd.link", DiffHardlinks},
+			}},
+		},
+		{
+			name: "added and removed",
+			modify: func(fs *FileSystem) {
+				fs.EntryList = fs.EntryList[1:]
+				fs.EntryList = append(fs.EntryList,
+					&DirectoryEntry{Name: "tmp", InodeNumber: 8})
+				fs.InodeTable[8] = &DirectoryInode{Mode: syscall.S_IFDIR | 0777}
+			},
+			want: FileSystemDiff{
+				Added:   []string{"/tmp"},
+				Removed: []string{"/dev", "/dev/null"},
+			},
+		},
+		{
+			name: "filtered",
+			modify: func(fs *FileSystem) {
+				fs.EntryList = fs.EntryList[1:]
+				fs.InodeTable[4].(*SymlinkInode).Symlink = "group"
+			},
+			filter: []string{"/dev", "/etc/alias"},
+		},
+	}
+	for _, test := range tests {
+		var pathFilter *filter.Filter
+		if test.filter != nil {
+			var err error
+			if pathFilter, err = filter.NewFilter(test.filter); err != nil {
+				t.Fatal(err)
+			}
+		}
+		right := makeDiffTestFileSystem()
+		test.modify(right)
+		got := DiffFileSystems(makeDiffTestFileSystem(), right, pathFilter)
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%s: got: %+v, want: %+v", test.name, *got, test.want)
+		}
+		if got.Empty() != reflect.DeepEqual(test.want, FileSystemDiff{}) {
+			t.Errorf("%s: Empty()=%v", test.name, got.Empty())
+		}
+	}
+}
+
+func TestDiffAttributesJSON(t *testing.T) {
+	var tests = []struct {
+		attributes DiffAttributes
+		json       string
+	}{
+		{0, `[]`},
+		{DiffType, `["type"]`},
+		{DiffMode | DiffData | DiffHardlinks, `["mode","data","hardlinks"]`},
+		{DiffSymlink, `["symlink"]`},
+		{DiffOwner | DiffRdev, `["owner","rdev"]`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.attributes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.json {
+			t.Errorf("Marshal(%s)=%s, want: %s", test.attributes, data,
+				test.json)
+		}
+		var attributes DiffAttributes
+		if err := json.Unmarshal(data, &attributes); err != nil {
+			t.Fatal(err)
+		}
+		if attributes != test.attributes {
+			t.Errorf("Unmarshal(%s)=%s", data, attributes)
+		}
+	}
+	var attributes DiffAttributes
+	if err := json.Unmarshal([]byte(`["colour"]`), &attributes); err == nil {
+		t.Error("unknown attribute accepted")
+	}
+}
+
+func TestDiffWriteText(t *testing.T) {
+	diff := &FileSystemDiff{
+		Added:   []string{"/new"},
+		Removed: []string{"/old"},
+		Changed: []ChangedPath{
+			{"/dev/null", DiffRdev},
+			{"/etc", DiffMode | DiffOwner},
+			{"/etc/alias", DiffSymlink},
+		},
+	}
+	buffer := &bytes.Buffer{}
+	if err := diff.WriteText(buffer); err != nil {
+		t.Fatal(err)
+	}
+	want := "- /old\n+ /new\nM /dev/null (rdev)\nM /etc (mode,owner)\n" +
+		"M /etc/alias (symlink)\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
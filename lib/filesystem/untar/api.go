@@ -16,3 +16,28 @@ func Decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 	*filesystem.FileSystem, error) {
 	return decode(tarReader, hasher, filter)
 }
+
+// LayerDecoder builds a file-system from a sequence of layers (such as the
+// layers of an OCI or Docker image). Entries in later layers replace entries
+// in earlier layers, and whiteout files (.wh.name) and opaque directory
+// markers (.wh..wh..opq) remove entries from earlier layers.
+type LayerDecoder struct {
+	decoderData *decoderData
+	hasher      Hasher
+	filter      *filter.Filter
+}
+
+func NewLayerDecoder(hasher Hasher, filter *filter.Filter) *LayerDecoder {
+	return newLayerDecoder(hasher, filter)
+}
+
+// AddLayer applies the layer read from tarReader on top of earlier layers.
+func (decoder *LayerDecoder) AddLayer(tarReader *tar.Reader) error {
+	return decoder.addLayer(tarReader)
+}
+
+// FileSystem returns the file-system built from the layers. No more layers
+// may be added after this is called.
+func (decoder *LayerDecoder) FileSystem() *filesystem.FileSystem {
+	return decoder.decoderData.finish()
+}
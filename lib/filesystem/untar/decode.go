@@ -17,13 +17,27 @@ type decoderData struct {
 	fileSystem      filesystem.FileSystem
 	inodeTable      map[string]uint64
 	directoryTable  map[string]*filesystem.DirectoryInode
+	layered         bool            // If true, process whiteouts.
+	layerNumber     uint            // The layer currently being decoded.
+	layerTable      map[string]uint // The layer each entry was added in.
 }
 
 func decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 	*filesystem.FileSystem, error) {
-	var decoderData decoderData
-	decoderData.inodeTable = make(map[string]uint64)
-	decoderData.directoryTable = make(map[string]*filesystem.DirectoryInode)
+	decoderData := newDecoderData(false)
+	if err := decoderData.addTar(tarReader, hasher, filter); err != nil {
+		return nil, err
+	}
+	return decoderData.finish(), nil
+}
+
+func newDecoderData(layered bool) *decoderData {
+	decoderData := &decoderData{
+		inodeTable:     make(map[string]uint64),
+		directoryTable: make(map[string]*filesystem.DirectoryInode),
+		layered:        layered,
+		layerTable:     make(map[string]uint),
+	}
 	fileSystem := &decoderData.fileSystem
 	fileSystem.InodeTable = make(filesystem.InodeTable)
 	// Create a default top-level directory which may be updated.
@@ -31,13 +45,18 @@ func decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 	fileSystem.DirectoryInode.Mode = syscall.S_IFDIR | syscall.S_IRWXU |
 		syscall.S_IRGRP | syscall.S_IXGRP | syscall.S_IROTH | syscall.S_IXOTH
 	decoderData.directoryTable["/"] = &fileSystem.DirectoryInode
+	return decoderData
+}
+
+func (decoderData *decoderData) addTar(tarReader *tar.Reader, hasher Hasher,
+	filter *filter.Filter) error {
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		header.Name = normaliseFilename(header.Name)
 		if header.Name == "/.subd" ||
@@ -49,18 +68,24 @@ func decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 		}
 		err = decoderData.addHeader(tarReader, hasher, header)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
+
+func (decoderData *decoderData) finish() *filesystem.FileSystem {
+	fileSystem := &decoderData.fileSystem
 	delete(fileSystem.InodeTable, 0)
+	decoderData.pruneInodeTable()
 	fileSystem.DirectoryCount = uint64(len(decoderData.directoryTable))
 	fileSystem.ComputeTotalDataBytes()
 	sortDirectory(&fileSystem.DirectoryInode)
-	return fileSystem, nil
+	return fileSystem
 }
 
 func normaliseFilename(filename string) string {
-	if filename[:2] == "./" {
+	if strings.HasPrefix(filename, "./") {
 		filename = filename[1:]
 	} else if filename[0] != '/' {
 		filename = "/" + filename
@@ -80,6 +105,24 @@ func (decoderData *decoderData) addHeader(tarReader *tar.Reader, hasher Hasher,
 			"No parent directory found for: %s", header.Name))
 	}
 	leafName := path.Base(header.Name)
+	if decoderData.layered && strings.HasPrefix(leafName, whiteoutPrefix) {
+		return decoderData.addWhiteout(parentDir, path.Dir(header.Name),
+			leafName)
+	}
+	if _, ok := decoderData.inodeTable[header.Name]; ok && header.Name != "/" {
+		// Replace the existing entry, except for directories which are
+		// merged.
+		if directory, ok := decoderData.directoryTable[header.Name]; ok &&
+			header.Typeflag == tar.TypeDir {
+			directory.Mode = filesystem.FileMode(
+				(header.Mode & ^syscall.S_IFMT) | syscall.S_IFDIR)
+			directory.Uid = uint32(header.Uid)
+			directory.Gid = uint32(header.Gid)
+			decoderData.layerTable[header.Name] = decoderData.layerNumber
+			return nil
+		}
+		decoderData.removeEntry(parentDir, header.Name, leafName)
+	}
 	if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
 		return decoderData.addRegularFile(tarReader, hasher, header,
 			parentDir, leafName)
@@ -147,7 +190,10 @@ func (decoderData *decoderData) addHardlink(header *tar.Header,
 		var newEntry filesystem.DirectoryEntry
 		newEntry.Name = name
 		newEntry.InodeNumber = inum
+		newEntry.SetInode(decoderData.fileSystem.InodeTable[inum])
 		parent.EntryList = append(parent.EntryList, &newEntry)
+		decoderData.inodeTable[header.Name] = inum
+		decoderData.layerTable[header.Name] = decoderData.layerNumber
 	} else {
 		return errors.New(fmt.Sprintf("missing hardlink target: %s",
 			header.Linkname))
@@ -206,6 +252,7 @@ func (decoderData *decoderData) addEntry(parent *filesystem.DirectoryInode,
 func (decoderData *decoderData) addInode(fullName string,
 	inode filesystem.GenericInode) {
 	decoderData.inodeTable[fullName] = decoderData.nextInodeNumber
+	decoderData.layerTable[fullName] = decoderData.layerNumber
 	decoderData.fileSystem.InodeTable[decoderData.nextInodeNumber] = inode
 	decoderData.nextInodeNumber++
 }
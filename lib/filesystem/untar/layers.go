@@ -0,0 +1,108 @@
+package untar
+
+import (
+	"archive/tar"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filter"
+	"path"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+func newLayerDecoder(hasher Hasher, filter *filter.Filter) *LayerDecoder {
+	return &LayerDecoder{
+		decoderData: newDecoderData(true),
+		hasher:      hasher,
+		filter:      filter,
+	}
+}
+
+func (decoder *LayerDecoder) addLayer(tarReader *tar.Reader) error {
+	decoder.decoderData.layerNumber++
+	return decoder.decoderData.addTar(tarReader, decoder.hasher,
+		decoder.filter)
+}
+
+func (decoderData *decoderData) addWhiteout(parent *filesystem.DirectoryInode,
+	parentName, leafName string) error {
+	if leafName == opaqueWhiteout {
+		decoderData.hideLowerLayers(parent, parentName)
+		return nil
+	}
+	name := leafName[len(whiteoutPrefix):]
+	fullName := path.Join(parentName, name)
+	if _, ok := decoderData.inodeTable[fullName]; ok {
+		decoderData.removeEntry(parent, fullName, name)
+	}
+	return nil
+}
+
+// Remove entries in the directory which were added by earlier layers.
+func (decoderData *decoderData) hideLowerLayers(
+	directory *filesystem.DirectoryInode, directoryName string) {
+	entryList := make([]*filesystem.DirectoryEntry, 0,
+		len(directory.EntryList))
+	for _, dirent := range directory.EntryList {
+		fullName := path.Join(directoryName, dirent.Name)
+		if decoderData.layerTable[fullName] < decoderData.layerNumber {
+			decoderData.forgetName(fullName, dirent.Inode())
+			continue
+		}
+		entryList = append(entryList, dirent)
+		if inode, ok := dirent.Inode().(*filesystem.DirectoryInode); ok {
+			decoderData.hideLowerLayers(inode, fullName)
+		}
+	}
+	directory.EntryList = entryList
+}
+
+func (decoderData *decoderData) removeEntry(
+	parent *filesystem.DirectoryInode, fullName, name string) {
+	for index, dirent := range parent.EntryList {
+		if dirent.Name == name {
+			parent.EntryList = append(parent.EntryList[:index],
+				parent.EntryList[index+1:]...)
+			decoderData.forgetName(fullName, dirent.Inode())
+			return
+		}
+	}
+}
+
+// Forget the name (and all names below it, if it is a directory). Inodes are
+// removed later by pruneInodeTable, since they may have other links.
+func (decoderData *decoderData) forgetName(fullName string,
+	inode filesystem.GenericInode) {
+	delete(decoderData.inodeTable, fullName)
+	delete(decoderData.layerTable, fullName)
+	if directory, ok := inode.(*filesystem.DirectoryInode); ok {
+		delete(decoderData.directoryTable, fullName)
+		for _, dirent := range directory.EntryList {
+			decoderData.forgetName(path.Join(fullName, dirent.Name),
+				dirent.Inode())
+		}
+	}
+}
+
+func (decoderData *decoderData) pruneInodeTable() {
+	inodeTable := decoderData.fileSystem.InodeTable
+	referenced := make(map[uint64]struct{}, len(inodeTable))
+	markReferencedInodes(&decoderData.fileSystem.DirectoryInode, referenced)
+	for inum := range inodeTable {
+		if _, ok := referenced[inum]; !ok {
+			delete(inodeTable, inum)
+		}
+	}
+}
+
+func markReferencedInodes(directory *filesystem.DirectoryInode,
+	referenced map[uint64]struct{}) {
+	for _, dirent := range directory.EntryList {
+		referenced[dirent.InodeNumber] = struct{}{}
+		if inode, ok := dirent.Inode().(*filesystem.DirectoryInode); ok {
+			markReferencedInodes(inode, referenced)
+		}
+	}
+}
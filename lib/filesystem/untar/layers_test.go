@@ -0,0 +1,199 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha512"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// testHasher hashes data and remembers it, so that file contents may be
+// recovered from the file-system.
+type testHasher map[hash.Hash]string
+
+func (hasher testHasher) Hash(reader io.Reader, length uint64) (
+	hash.Hash, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(length)))
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	hashVal := hash.Hash(sha512.Sum512(data))
+	hasher[hashVal] = string(data)
+	return hashVal, nil
+}
+
+// entry describes a tar entry. A name ending in "/" is a directory, a data
+// starting with "->" is a symlink and a data starting with "=>" is a hard link.
+type entry struct {
+	name string
+	data string
+}
+
+func makeTar(t *testing.T, entries []entry) *tar.Reader {
+	buffer := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buffer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644}
+		switch {
+		case entry.name[len(entry.name)-1] == '/':
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		case len(entry.data) > 1 && entry.data[:2] == "->":
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.data[2:]
+		case len(entry.data) > 1 && entry.data[:2] == "=>":
+			header.Typeflag = tar.TypeLink
+			header.Linkname = entry.data[2:]
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.data))
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tarWriter.Write([]byte(entry.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tar.NewReader(buffer)
+}
+
+// listFileSystem returns a map of pathnames to contents, using the same
+// notation as entry.data ("/" for directories). Hard links are listed with
+// their contents.
+func listFileSystem(fs *filesystem.FileSystem,
+	hasher testHasher) map[string]string {
+	files := make(map[string]string)
+	listDirectory(&fs.DirectoryInode, "/", hasher, files)
+	return files
+}
+
+func listDirectory(directory *filesystem.DirectoryInode, name string,
+	hasher testHasher, files map[string]string) {
+	for _, dirent := range directory.EntryList {
+		pathname := path.Join(name, dirent.Name)
+		switch inode := dirent.Inode().(type) {
+		case *filesystem.DirectoryInode:
+			files[pathname] = "/"
+			listDirectory(inode, pathname, hasher, files)
+		case *filesystem.RegularInode:
+			files[pathname] = hasher[inode.Hash]
+		case *filesystem.SymlinkInode:
+			files[pathname] = "->" + inode.Symlink
+		}
+	}
+}
+
+func countInodes(directory *filesystem.DirectoryInode,
+	inodes map[uint64]struct{}) {
+	for _, dirent := range directory.EntryList {
+		inodes[dirent.InodeNumber] = struct{}{}
+		if inode, ok := dirent.Inode().(*filesystem.DirectoryInode); ok {
+			countInodes(inode, inodes)
+		}
+	}
+}
+
+func TestLayerDecoder(t *testing.T) {
+	var tests = []struct {
+		name   string
+		layers [][]entry
+		want   map[string]string
+	}{
+		{
+			name: "replace and whiteout files",
+			layers: [][]entry{
+				{{"etc/", ""}, {"etc/a", "a1"}, {"etc/b", "b1"},
+					{"bin/", ""}, {"bin/sh", "sh1"}},
+				{{"etc/.wh.a", ""}, {"bin/sh", "sh2"}, {"etc/c", "c2"}},
+			},
+			want: map[string]string{"/etc": "/", "/etc/b": "b1",
+				"/etc/c": "c2", "/bin": "/", "/bin/sh": "sh2"},
+		},
+		{
+			name: "whiteout directory",
+			layers: [][]entry{
+				{{"d/", ""}, {"d/x", "x1"}, {"d/e/", ""}, {"d/e/y", "y1"},
+					{"f", "f1"}},
+				{{".wh.d", ""}},
+			},
+			want: map[string]string{"/f": "f1"},
+		},
+		{
+			name: "opaque directory",
+			layers: [][]entry{
+				{{"d/", ""}, {"d/x", "x1"}, {"d/e/", ""}, {"d/e/y", "y1"}},
+				{{"d/", ""}, {"d/z", "z2"}, {"d/.wh..wh..opq", ""}},
+			},
+			want: map[string]string{"/d": "/", "/d/z": "z2"},
+		},
+		{
+			name: "whiteout one hard link",
+			layers: [][]entry{
+				{{"a", "data"}, {"b", "=>a"}},
+				{{".wh.a", ""}},
+			},
+			want: map[string]string{"/b": "data"},
+		},
+		{
+			name: "replace file with symlink and directory",
+			layers: [][]entry{
+				{{"a", "a1"}, {"b", "b1"}},
+				{{"a", "->b"}, {"b/", ""}, {"b/c", "c2"}},
+			},
+			want: map[string]string{"/a": "->b", "/b": "/", "/b/c": "c2"},
+		},
+		{
+			name: "whiteout missing entry",
+			layers: [][]entry{
+				{{"a", "a1"}},
+				{{".wh.b", ""}},
+			},
+			want: map[string]string{"/a": "a1"},
+		},
+	}
+	for _, test := range tests {
+		hasher := make(testHasher)
+		decoder := NewLayerDecoder(hasher, nil)
+		for _, layer := range test.layers {
+			if err := decoder.AddLayer(makeTar(t, layer)); err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+		}
+		fs := decoder.FileSystem()
+		if got := listFileSystem(fs, hasher); !reflect.DeepEqual(got,
+			test.want) {
+			t.Errorf("%s: got: %v, want: %v", test.name, got, test.want)
+		}
+		inodes := make(map[uint64]struct{})
+		countInodes(&fs.DirectoryInode, inodes)
+		if len(fs.InodeTable) != len(inodes) {
+			t.Errorf("%s: %d inodes, %d referenced", test.name,
+				len(fs.InodeTable), len(inodes))
+		}
+	}
+}
+
+func TestDecodeKeepsWhiteouts(t *testing.T) {
+	hasher := make(testHasher)
+	fs, err := Decode(makeTar(t, []entry{{"a", "a1"}, {".wh.a", "w"}}),
+		hasher, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"/a": "a1", "/.wh.a": "w"}
+	if got := listFileSystem(fs, hasher); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
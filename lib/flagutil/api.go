@@ -12,3 +12,7 @@ type StringList []string
 
 // A StringToRuneMap satisfies the standard library flag.Value interface.
 type StringToRuneMap map[string]rune
+
+// A StringToStringMap is a map of key=value strings that satisfies the
+// standard library flag.Value interface.
+type StringToStringMap map[string]string
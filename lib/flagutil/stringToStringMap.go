@@ -0,0 +1,40 @@
+package flagutil
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+func (m *StringToStringMap) String() string {
+	keys := make([]string, 0, len(*m))
+	for key := range *m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	retval := `"`
+	for index, key := range keys {
+		if index != 0 {
+			retval += ","
+		}
+		retval += key + "=" + (*m)[key]
+	}
+	return retval + `"`
+}
+
+func (m *StringToStringMap) Set(value string) error {
+	newMap := make(map[string]string)
+	if value == "" {
+		*m = newMap
+		return nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.SplitN(entry, "=", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return errors.New("invalid entry: " + entry)
+		}
+		newMap[fields[0]] = fields[1]
+	}
+	*m = newMap
+	return nil
+}
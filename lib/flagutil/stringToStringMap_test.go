@@ -0,0 +1,44 @@
+package flagutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringToStringMapSet(t *testing.T) {
+	var tests = []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"a=1", map[string]string{"a": "1"}, false},
+		{"a=1,b=", map[string]string{"a": "1", "b": ""}, false},
+		{"a=x=y", map[string]string{"a": "x=y"}, false},
+		{"a", nil, true},
+		{"=1", nil, true},
+		{"a=1,,b=2", nil, true},
+	}
+	for _, test := range tests {
+		var m StringToStringMap
+		err := m.Set(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q): no error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q): %s", test.value, err)
+		} else if !reflect.DeepEqual(map[string]string(m), test.want) {
+			t.Errorf("Set(%q) = %v, want: %v", test.value, m, test.want)
+		}
+	}
+}
+
+func TestStringToStringMapString(t *testing.T) {
+	m := StringToStringMap{"b": "2", "a": "1"}
+	if got := m.String(); got != `"a=1,b=2"` {
+		t.Errorf("String() = %s", got)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+	Package grouppolicy grants rights to groups of users.
+
+	Package grouppolicy loads a policy file which maps groups (or roles), given
+	in client certificates, to the RPC methods they may call and the image
+	directories they may change. The policy is reloaded when the file changes,
+	so rights may be changed without reissuing certificates. A Policy may be
+	registered with the srpc package.
+*/
+package grouppolicy
+
+import (
+	"log"
+	"sync"
+)
+
+// Policy holds the most recently loaded policy.
+//
+// Each line of the policy file contains a group name, a rule type and a
+// pattern. The "method" rule type permits the group to call methods matching
+// the pattern (Service.Method, with shell wildcards). The "directory" rule
+// type permits the group to change images and channels in the directory and
+// its subdirectories ("/" matches all directories). Empty lines and lines
+// starting with "#" are ignored. For example:
+//   admins      method     *.*
+//   release     method     ImageServer.AddImage
+//   release     directory  prod
+type Policy struct {
+	filename    string
+	logger      *log.Logger
+	rwLock      sync.RWMutex        // Protect everything below.
+	methods     map[string][]string // Key: group, value: method patterns.
+	directories map[string][]string // Key: group, value: directory names.
+	numReloads  uint64
+	numErrors   uint64
+}
+
+// New loads the policy file, then watches it and reloads it when it is
+// replaced. Reload errors are logged to logger and the previously loaded
+// policy is kept. Metrics are registered under /group-policy.
+func New(filename string, logger *log.Logger) (*Policy, error) {
+	return newPolicy(filename, logger)
+}
+
+// PermitsDirectory returns true if any of the groups is permitted to change
+// images and channels in the directory.
+func (p *Policy) PermitsDirectory(groups map[string]struct{},
+	dirname string) bool {
+	return p.permitsDirectory(groups, dirname)
+}
+
+// PermitsMethod returns true if any of the groups is permitted to call the
+// method. It satisfies the srpc.GroupPolicy interface.
+func (p *Policy) PermitsMethod(groups map[string]struct{},
+	serviceMethod string) bool {
+	return p.permitsMethod(groups, serviceMethod)
+}
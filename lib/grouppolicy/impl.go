@@ -0,0 +1,167 @@
+package grouppolicy
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/fsutil"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"github.com/Symantec/tricorder/go/tricorder/units"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func newPolicy(filename string, logger *log.Logger) (*Policy, error) {
+	p := &Policy{filename: filename, logger: logger}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	if err := p.registerMetrics(); err != nil {
+		return nil, err
+	}
+	go p.watch()
+	return p, nil
+}
+
+func (p *Policy) load() error {
+	file, err := os.Open(p.filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	methods := make(map[string][]string)
+	directories := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: bad line", p.filename, lineNumber)
+		}
+		group, pattern := fields[0], fields[2]
+		switch fields[1] {
+		case "method":
+			if strings.Count(pattern, ".") != 1 {
+				return fmt.Errorf("%s:%d: bad method pattern: %s",
+					p.filename, lineNumber, pattern)
+			}
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s:%d: %s", p.filename, lineNumber, err)
+			}
+			methods[group] = append(methods[group], pattern)
+		case "directory":
+			dirname := path.Clean("/" + pattern)[1:]
+			directories[group] = append(directories[group], dirname)
+		default:
+			return fmt.Errorf("%s:%d: unknown rule type: %s",
+				p.filename, lineNumber, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	p.rwLock.Lock()
+	defer p.rwLock.Unlock()
+	p.methods = methods
+	p.directories = directories
+	return nil
+}
+
+func (p *Policy) watch() {
+	channel := fsutil.WatchFile(p.filename, p.logger)
+	// The first file yielded is the one which was already loaded.
+	(<-channel).Close()
+	for file := range channel {
+		file.Close()
+		if err := p.load(); err != nil {
+			p.rwLock.Lock()
+			p.numErrors++
+			p.rwLock.Unlock()
+			p.logger.Printf("Error reloading group policy, keeping old one: %s\n",
+				err)
+			continue
+		}
+		p.rwLock.Lock()
+		p.numReloads++
+		p.rwLock.Unlock()
+		p.logger.Printf("Reloaded group policy: %s\n", p.filename)
+	}
+}
+
+func (p *Policy) permitsDirectory(groups map[string]struct{},
+	dirname string) bool {
+	dirname = path.Clean("/" + dirname)[1:]
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	for group := range groups {
+		for _, policyDirname := range p.directories[group] {
+			if policyDirname == "" || dirname == policyDirname ||
+				strings.HasPrefix(dirname, policyDirname+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Policy) permitsMethod(groups map[string]struct{},
+	serviceMethod string) bool {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	for group := range groups {
+		for _, pattern := range p.methods[group] {
+			if matched, _ := filepath.Match(pattern, serviceMethod); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Policy) getCount(count func() uint64) func() uint64 {
+	return func() uint64 {
+		p.rwLock.RLock()
+		defer p.rwLock.RUnlock()
+		return count()
+	}
+}
+
+func countRules(rules map[string][]string) uint64 {
+	var numRules uint64
+	for _, patterns := range rules {
+		numRules += uint64(len(patterns))
+	}
+	return numRules
+}
+
+func (p *Policy) registerMetrics() error {
+	dir, err := tricorder.RegisterDirectory("/group-policy")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-method-rules",
+		p.getCount(func() uint64 { return countRules(p.methods) }),
+		units.None, "number of method rules")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-directory-rules",
+		p.getCount(func() uint64 { return countRules(p.directories) }),
+		units.None, "number of directory rules")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-reloads",
+		p.getCount(func() uint64 { return p.numReloads }),
+		units.None, "number of times the policy was reloaded")
+	if err != nil {
+		return err
+	}
+	return dir.RegisterMetric("num-reload-errors",
+		p.getCount(func() uint64 { return p.numErrors }),
+		units.None, "number of failed reloads")
+}
@@ -0,0 +1,133 @@
+package grouppolicy
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+const testPolicy = `# Test policy.
+admins      method     *.*
+release     method     ImageServer.AddImage
+release     method     ImageServer.Set*
+release     directory  prod
+builders    directory  /dev/team/
+everyone    directory  /
+`
+
+func newTestPolicy(t *testing.T, contents string) (*Policy, error) {
+	filename := filepath.Join(t.TempDir(), "policy")
+	if err := ioutil.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := &Policy{filename: filename, logger: log.New(ioutil.Discard, "", 0)}
+	return p, p.load()
+}
+
+func makeGroups(groups ...string) map[string]struct{} {
+	groupsMap := make(map[string]struct{})
+	for _, group := range groups {
+		groupsMap[group] = struct{}{}
+	}
+	return groupsMap
+}
+
+func TestLoad(t *testing.T) {
+	var tests = []struct {
+		name      string
+		contents  string
+		wantError bool
+	}{
+		{"empty", "", false},
+		{"example", testPolicy, false},
+		{"missing pattern", "admins method\n", true},
+		{"extra field", "admins method *.* extra\n", true},
+		{"unknown rule type", "admins group *.*\n", true},
+		{"method without service", "admins method AddImage\n", true},
+		{"bad method pattern", "admins method Image[.Add\n", true},
+	}
+	for _, test := range tests {
+		_, err := newTestPolicy(t, test.contents)
+		if test.wantError && err == nil {
+			t.Errorf("%s: no error", test.name)
+		} else if !test.wantError && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+	}
+}
+
+func TestLoadFailureKeepsPolicy(t *testing.T) {
+	p, err := newTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p.filename, []byte("admins\n"),
+		0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.load(); err == nil {
+		t.Fatal("bad policy loaded")
+	}
+	if !p.PermitsMethod(makeGroups("admins"), "Subd.Poll") {
+		t.Error("policy lost after failed load")
+	}
+}
+
+func TestPermitsMethod(t *testing.T) {
+	p, err := newTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		groups        map[string]struct{}
+		serviceMethod string
+		want          bool
+	}{
+		{makeGroups("admins"), "Subd.Poll", true},
+		{makeGroups("release"), "ImageServer.AddImage", true},
+		{makeGroups("release"), "ImageServer.SetChannel", true},
+		{makeGroups("release"), "ImageServer.DeleteImage", false},
+		{makeGroups("release", "admins"), "ImageServer.DeleteImage", true},
+		{makeGroups("builders"), "ImageServer.AddImage", false},
+		{makeGroups("unknown"), "Subd.Poll", false},
+		{makeGroups(), "Subd.Poll", false},
+	}
+	for _, test := range tests {
+		if got := p.PermitsMethod(test.groups,
+			test.serviceMethod); got != test.want {
+			t.Errorf("%v: %s: got: %v, want: %v", test.groups,
+				test.serviceMethod, got, test.want)
+		}
+	}
+}
+
+func TestPermitsDirectory(t *testing.T) {
+	p, err := newTestPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		groups  map[string]struct{}
+		dirname string
+		want    bool
+	}{
+		{makeGroups("release"), "prod", true},
+		{makeGroups("release"), "prod/web", true},
+		{makeGroups("release"), "/prod/web/", true},
+		{makeGroups("release"), "production", false},
+		{makeGroups("release"), "", false},
+		{makeGroups("builders"), "dev/team/app", true},
+		{makeGroups("builders"), "dev", false},
+		{makeGroups("everyone"), "anything/at/all", true},
+		{makeGroups("admins"), "prod", false},
+		{makeGroups(), "prod", false},
+	}
+	for _, test := range tests {
+		if got := p.PermitsDirectory(test.groups,
+			test.dirname); got != test.want {
+			t.Errorf("%v: %q: got: %v, want: %v", test.groups, test.dirname,
+				got, test.want)
+		}
+	}
+}
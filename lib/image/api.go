@@ -1,10 +1,12 @@
 package image
 
 import (
+	"crypto"
 	"github.com/Symantec/Dominator/lib/filesystem"
 	"github.com/Symantec/Dominator/lib/filter"
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/triggers"
+	"time"
 )
 
 type Annotation struct {
@@ -12,6 +14,28 @@ type Annotation struct {
 	URL    string
 }
 
+// Signature is a signature over the digest of an image, computed from the
+// file-system, filter and triggers.
+type Signature struct {
+	PublicKey []byte // PKIX, ASN.1 DER form.
+	Value     []byte
+}
+
+// Channel is a mutable name which points to an image. History records every
+// change to the channel, oldest first.
+type Channel struct {
+	Name      string
+	ImageName string
+	History   []ChannelEvent
+}
+
+type ChannelEvent struct {
+	ImageName string
+	Time      time.Time
+	Username  string // Empty: unauthenticated or local change.
+	Rollback  bool
+}
+
 type DirectoryMetadata struct {
 	OwnerGroup string
 }
@@ -28,6 +52,50 @@ type Image struct {
 	Triggers     *triggers.Triggers
 	ReleaseNotes *Annotation
 	BuildLog     *Annotation
+	Manifest     *Annotation       // Build manifest: imagetool build.
+	Packages     *Annotation       // Package inventory: lib/image/packages.
+	Labels       map[string]string // Arbitrary key/value metadata.
+	Signatures   []Signature
+}
+
+// TrustedKeys records which public keys are trusted to sign images in which
+// image directories.
+type TrustedKeys struct {
+	keysByDirectory map[string][][]byte // Key: directory, value: PKIX keys.
+}
+
+// LoadTrustedKeys reads the list of trusted keys from the file specified by
+// filename. Each line contains an image directory and the name of a file
+// containing a PEM encoded public key or certificate. Relative key filenames
+// are relative to the directory containing filename. Keys for a directory
+// are trusted for all subdirectories which do not have their own keys.
+func LoadTrustedKeys(filename string) (*TrustedKeys, error) {
+	return loadTrustedKeys(filename)
+}
+
+// VerifyImage returns an error if the image specified by name is not signed
+// by a key trusted for the directory containing the image.
+func (trustedKeys *TrustedKeys) VerifyImage(name string, image *Image) error {
+	return trustedKeys.verifyImage(name, image)
+}
+
+// ListObjects returns the hashes of the objects referenced by the image: the
+// data for regular files (excluding empty files) and the annotations which are
+// stored as objects. Hashes may be repeated.
+func (image *Image) ListObjects() []hash.Hash {
+	return image.listObjects()
+}
+
+// MatchLabels returns true if the image has all the labels in selector. An
+// empty value in selector matches any value for that key.
+func (image *Image) MatchLabels(selector map[string]string) bool {
+	return image.matchLabels(selector)
+}
+
+// Sign will sign the image with signer, replacing any existing signature with
+// the same key. RSA, ECDSA and Ed25519 keys are supported.
+func (image *Image) Sign(signer crypto.Signer) error {
+	return image.sign(signer)
 }
 
 // Verify will perform some self-consistency checks on the image. If a problem
@@ -36,6 +104,12 @@ func (image *Image) Verify() error {
 	return image.verify()
 }
 
+// VerifySignatures verifies that all the signatures in the image are valid. It
+// does not check whether the signing keys are trusted.
+func (image *Image) VerifySignatures() error {
+	return image.verifySignatures()
+}
+
 // VerifyRequiredPaths will verify if required paths are present in the image.
 // The table of required paths is given by requiredPaths. If the image is a
 // sparse image (has no filter), then this check is skipped. If a problem is
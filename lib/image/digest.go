@@ -0,0 +1,89 @@
+package image
+
+import (
+	"bufio"
+	"crypto/sha512"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"io"
+	"path"
+)
+
+// The digest is computed over a canonical encoding of the file-system, filter
+// and triggers. A canonical encoding is used (rather than gob) because map
+// iteration order is random and the encoding must be stable across builds
+// and machines.
+func (image *Image) digest() (hash.Hash, error) {
+	var hashVal hash.Hash
+	hasher := sha512.New()
+	writer := bufio.NewWriter(hasher)
+	if image.FileSystem != nil {
+		err := writeDirectoryDigest(writer, image.FileSystem,
+			&image.FileSystem.DirectoryInode, "/")
+		if err != nil {
+			return hashVal, err
+		}
+	}
+	fmt.Fprintln(writer, "filter:")
+	if image.Filter != nil {
+		for _, line := range image.Filter.FilterLines {
+			fmt.Fprintf(writer, "%q\n", line)
+		}
+	} else {
+		fmt.Fprintln(writer, "sparse")
+	}
+	fmt.Fprintln(writer, "triggers:")
+	if image.Triggers != nil {
+		for _, trigger := range image.Triggers.Triggers {
+			fmt.Fprintf(writer, "%q %t %q\n",
+				trigger.Service, trigger.HighImpact, trigger.MatchLines)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return hashVal, err
+	}
+	copy(hashVal[:], hasher.Sum(nil))
+	return hashVal, nil
+}
+
+func writeDirectoryDigest(writer io.Writer, fs *filesystem.FileSystem,
+	inode *filesystem.DirectoryInode, name string) error {
+	fmt.Fprintf(writer, "d %q %o %d %d\n",
+		name, uint32(inode.Mode), inode.Uid, inode.Gid)
+	for _, dirent := range inode.EntryList {
+		pathname := path.Join(name, dirent.Name)
+		genericInode, ok := fs.InodeTable[dirent.InodeNumber]
+		if !ok {
+			return fmt.Errorf("no inode: %d for: %s", dirent.InodeNumber,
+				pathname)
+		}
+		fmt.Fprintf(writer, "%d ", dirent.InodeNumber)
+		switch inode := genericInode.(type) {
+		case *filesystem.DirectoryInode:
+			if err := writeDirectoryDigest(writer, fs, inode,
+				pathname); err != nil {
+				return err
+			}
+		case *filesystem.RegularInode:
+			fmt.Fprintf(writer, "f %q %o %d %d %d.%09d %d %x\n",
+				pathname, uint32(inode.Mode), inode.Uid, inode.Gid,
+				inode.MtimeSeconds, inode.MtimeNanoSeconds, inode.Size,
+				inode.Hash)
+		case *filesystem.ComputedRegularInode:
+			fmt.Fprintf(writer, "c %q %o %d %d %q\n",
+				pathname, uint32(inode.Mode), inode.Uid, inode.Gid,
+				inode.Source)
+		case *filesystem.SymlinkInode:
+			fmt.Fprintf(writer, "l %q %d %d %q\n",
+				pathname, inode.Uid, inode.Gid, inode.Symlink)
+		case *filesystem.SpecialInode:
+			fmt.Fprintf(writer, "s %q %o %d %d %d.%09d %d\n",
+				pathname, uint32(inode.Mode), inode.Uid, inode.Gid,
+				inode.MtimeSeconds, inode.MtimeNanoSeconds, inode.Rdev)
+		default:
+			return fmt.Errorf("unsupported inode type for: %s", pathname)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+/*
+	Package export writes images to tar archives and OCI image layouts.
+
+	The image data are streamed from an object server, so images may be
+	exported without root privileges and without unpacking them locally.
+	Computed files are not exported, since their contents are generated
+	for each machine.
+*/
+package export
+
+import (
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+)
+
+// WriteTar writes the file-system as a tar stream to writer. File data are
+// read from objectsGetter.
+func WriteTar(writer io.Writer, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter) error {
+	return writeTar(writer, fs, objectsGetter)
+}
+
+// WriteOCI writes the image as a single layer OCI image layout, in the form of
+// a tar stream, to writer. The image is tagged with refName and labels are
+// included in the image configuration. Images do not record the architecture
+// of their binaries, so it must be given in architecture (using the GOARCH
+// names, such as amd64 or arm64). File data are read from objectsGetter. A
+// temporary file is used to compute the layer digest.
+func WriteOCI(writer io.Writer, img *image.Image, refName, architecture string,
+	objectsGetter objectserver.ObjectsGetter) error {
+	return writeOCI(writer, img, refName, architecture, objectsGetter)
+}
@@ -0,0 +1,212 @@
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver/memory"
+	"io"
+	"io/ioutil"
+	"syscall"
+	"testing"
+)
+
+type tarEntry struct {
+	typeflag byte
+	linkname string
+	data     string
+}
+
+func addObject(t *testing.T, objSrv *memory.ObjectServer,
+	data string) hash.Hash {
+	hashVal, _, err := objSrv.AddObject(bytes.NewBufferString(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashVal
+}
+
+// makeTestFileSystem makes a file-system with a directory, a regular file
+// with a hard link, an empty file, a symlink, a computed file and a device.
+func makeTestFileSystem(t *testing.T,
+	objSrv *memory.ObjectServer) *filesystem.FileSystem {
+	fs := &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			2: &filesystem.DirectoryInode{
+				EntryList: []*filesystem.DirectoryEntry{
+					{Name: "sh", InodeNumber: 3},
+					{Name: "bash", InodeNumber: 3},
+				},
+				Mode: syscall.S_IFDIR | 0755,
+			},
+			3: &filesystem.RegularInode{Mode: syscall.S_IFREG | 0755, Size: 5,
+				Hash: addObject(t, objSrv, "shell")},
+			4: &filesystem.RegularInode{Mode: syscall.S_IFREG | 0644},
+			5: &filesystem.SymlinkInode{Symlink: "bin/sh"},
+			6: &filesystem.ComputedRegularInode{Mode: syscall.S_IFREG | 0644,
+				Source: "localhost:6969"},
+			7: &filesystem.SpecialInode{Mode: syscall.S_IFCHR | 0666,
+				Rdev: 1<<8 | 3},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{Name: "bin", InodeNumber: 2},
+				{Name: "empty", InodeNumber: 4},
+				{Name: "link", InodeNumber: 5},
+				{Name: "computed", InodeNumber: 6},
+				{Name: "null", InodeNumber: 7},
+			},
+			Mode: syscall.S_IFDIR | 0755,
+		},
+		NumRegularInodes: 2,
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func readTar(t *testing.T, reader io.Reader) map[string]tarEntry {
+	entries := make(map[string]tarEntry)
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[header.Name] = tarEntry{header.Typeflag, header.Linkname,
+			string(data)}
+	}
+}
+
+func TestWriteTar(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	buffer := &bytes.Buffer{}
+	err := WriteTar(buffer, makeTestFileSystem(t, objSrv), objSrv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := readTar(t, buffer)
+	var tests = []struct {
+		name  string
+		entry tarEntry
+	}{
+		{"./", tarEntry{typeflag: tar.TypeDir}},
+		{"./bin/", tarEntry{typeflag: tar.TypeDir}},
+		{"./bin/sh", tarEntry{typeflag: tar.TypeReg, data: "shell"}},
+		{"./bin/bash", tarEntry{typeflag: tar.TypeLink, linkname: "./bin/sh"}},
+		{"./empty", tarEntry{typeflag: tar.TypeReg}},
+		{"./link", tarEntry{typeflag: tar.TypeSymlink, linkname: "bin/sh"}},
+		{"./null", tarEntry{typeflag: tar.TypeChar}},
+	}
+	for _, test := range tests {
+		if entry, ok := entries[test.name]; !ok {
+			t.Errorf("%s: missing", test.name)
+		} else if entry != test.entry {
+			t.Errorf("%s: got: %+v, want: %+v", test.name, entry, test.entry)
+		}
+	}
+	if _, ok := entries["./computed"]; ok {
+		t.Error("computed file exported")
+	}
+	if len(entries) != len(tests) {
+		t.Errorf("%d entries, want: %d", len(entries), len(tests))
+	}
+}
+
+func TestWriteTarSizeMismatch(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	fs := makeTestFileSystem(t, objSrv)
+	fs.InodeTable[3].(*filesystem.RegularInode).Size = 4
+	if err := WriteTar(ioutil.Discard, fs, objSrv); err == nil {
+		t.Error("object length mismatch not detected")
+	}
+}
+
+func readJSON(t *testing.T, entries map[string]tarEntry, name string,
+	value interface{}) {
+	entry, ok := entries[name]
+	if !ok {
+		t.Fatalf("%s: missing", name)
+	}
+	if err := json.Unmarshal([]byte(entry.data), value); err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+}
+
+func TestWriteOCI(t *testing.T) {
+	var tests = []struct {
+		architecture string
+		wantError    bool
+	}{
+		{"amd64", false},
+		{"arm64", false},
+		{"", true},
+	}
+	for _, test := range tests {
+		objSrv := memory.NewObjectServer()
+		img := &image.Image{
+			FileSystem: makeTestFileSystem(t, objSrv),
+			Labels:     map[string]string{"team": "infra"},
+		}
+		buffer := &bytes.Buffer{}
+		err := WriteOCI(buffer, img, "web:1", test.architecture, objSrv)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("architecture: %q: error: %v", test.architecture, err)
+		}
+		if err != nil {
+			continue
+		}
+		entries := readTar(t, buffer)
+		var index ociIndex
+		readJSON(t, entries, "index.json", &index)
+		if len(index.Manifests) != 1 {
+			t.Fatalf("%d manifests", len(index.Manifests))
+		}
+		if name := index.Manifests[0].Annotations[refNameAnnotation]; name !=
+			"web:1" {
+			t.Errorf("ref name: %q", name)
+		}
+		var manifest ociManifest
+		readJSON(t, entries, blobName(index.Manifests[0].Digest), &manifest)
+		var config ociConfig
+		readJSON(t, entries, blobName(manifest.Config.Digest), &config)
+		if config.Architecture != test.architecture {
+			t.Errorf("architecture: %q, want: %q", config.Architecture,
+				test.architecture)
+		}
+		if config.Config.Labels["team"] != "infra" {
+			t.Errorf("labels: %v", config.Config.Labels)
+		}
+		if len(manifest.Layers) != 1 {
+			t.Fatalf("%d layers", len(manifest.Layers))
+		}
+		layer := entries[blobName(manifest.Layers[0].Digest)].data
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(layer)))
+		if digest != manifest.Layers[0].Digest {
+			t.Errorf("layer digest: %s, want: %s", digest,
+				manifest.Layers[0].Digest)
+		}
+		gzipReader, err := gzip.NewReader(bytes.NewBufferString(layer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry := readTar(t, gzipReader)["./bin/sh"]; entry.data != "shell" {
+			t.Errorf("layer: ./bin/sh: %+v", entry)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package export
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	mediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		Labels map[string]string `json:"Labels,omitempty"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+func writeOCI(writer io.Writer, img *image.Image, refName, architecture string,
+	objectsGetter objectserver.ObjectsGetter) error {
+	if architecture == "" {
+		return errors.New("no architecture specified")
+	}
+	layerFile, err := ioutil.TempFile("", "oci-layer")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(layerFile.Name())
+	defer layerFile.Close()
+	layerDigest, layerSize, diffID, err := writeLayer(layerFile, img,
+		objectsGetter)
+	if err != nil {
+		return err
+	}
+	var config ociConfig
+	config.Architecture = architecture
+	config.OS = "linux"
+	config.Config.Labels = img.Labels
+	config.RootFS.Type = "layers"
+	config.RootFS.DiffIDs = []string{diffID}
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		Config:        makeDescriptor(mediaTypeConfig, configData),
+		Layers: []ociDescriptor{{
+			MediaType: mediaTypeLayer,
+			Digest:    layerDigest,
+			Size:      layerSize,
+		}},
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	manifestDescriptor := makeDescriptor(mediaTypeManifest, manifestData)
+	if refName != "" {
+		manifestDescriptor.Annotations = map[string]string{
+			refNameAnnotation: refName}
+	}
+	indexData, err := json.Marshal(ociIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeIndex,
+		Manifests:     []ociDescriptor{manifestDescriptor},
+	})
+	if err != nil {
+		return err
+	}
+	tarWriter := tar.NewWriter(writer)
+	err = writeTarData(tarWriter, "oci-layout",
+		[]byte(`{"imageLayoutVersion":"1.0.0"}`))
+	if err != nil {
+		return err
+	}
+	if err := writeTarDirectory(tarWriter, "blobs/"); err != nil {
+		return err
+	}
+	if err := writeTarDirectory(tarWriter, "blobs/sha256/"); err != nil {
+		return err
+	}
+	if _, err := layerFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	err = writeTarFile(tarWriter, blobName(layerDigest), layerFile, layerSize)
+	if err != nil {
+		return err
+	}
+	err = writeTarData(tarWriter, blobName(manifest.Config.Digest),
+		configData)
+	if err != nil {
+		return err
+	}
+	err = writeTarData(tarWriter, blobName(manifestDescriptor.Digest),
+		manifestData)
+	if err != nil {
+		return err
+	}
+	err = writeTarData(tarWriter, "index.json", indexData)
+	if err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
+
+// Write the compressed layer, returning the digest and size of the compressed
+// data and the digest of the uncompressed data (the diff ID).
+func writeLayer(writer io.Writer, img *image.Image,
+	objectsGetter objectserver.ObjectsGetter) (string, int64, string, error) {
+	compressedHasher := sha256.New()
+	counter := &countingWriter{writer: io.MultiWriter(writer,
+		compressedHasher)}
+	gzipWriter := gzip.NewWriter(counter)
+	uncompressedHasher := sha256.New()
+	err := writeTar(io.MultiWriter(gzipWriter, uncompressedHasher),
+		img.FileSystem, objectsGetter)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", 0, "", err
+	}
+	return fmt.Sprintf("sha256:%x", compressedHasher.Sum(nil)), counter.count,
+		fmt.Sprintf("sha256:%x", uncompressedHasher.Sum(nil)), nil
+}
+
+func makeDescriptor(mediaType string, data []byte) ociDescriptor {
+	return ociDescriptor{
+		MediaType: mediaType,
+		Digest:    fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+		Size:      int64(len(data)),
+	}
+}
+
+func blobName(digest string) string {
+	return "blobs/sha256/" + digest[len("sha256:"):]
+}
+
+func writeTarDirectory(tarWriter *tar.Writer, name string) error {
+	return tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  time.Now(),
+	})
+}
+
+func writeTarData(tarWriter *tar.Writer, name string, data []byte) error {
+	return writeTarFile(tarWriter, name, bytes.NewReader(data),
+		int64(len(data)))
+}
+
+func writeTarFile(tarWriter *tar.Writer, name string, reader io.Reader,
+	size int64) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Now(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tarWriter, reader, size)
+	return err
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	nWritten, err := w.writer.Write(p)
+	w.count += int64(nWritten)
+	return nWritten, err
+}
@@ -0,0 +1,196 @@
+package export
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+	"syscall"
+	"time"
+)
+
+type tarEncoder struct {
+	fs            *filesystem.FileSystem
+	tarWriter     *tar.Writer
+	objectsReader objectserver.ObjectsReader
+	linkTable     map[uint64]string // Inode number -> first name written.
+}
+
+func writeTar(writer io.Writer, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter) error {
+	tarWriter := tar.NewWriter(writer)
+	if err := encodeFileSystem(tarWriter, fs, objectsGetter); err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
+
+func encodeFileSystem(tarWriter *tar.Writer, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter) error {
+	// Objects are requested in the order in which they will be written.
+	hashes := make([]hash.Hash, 0, fs.NumRegularInodes)
+	err := listObjects(fs, &fs.DirectoryInode, make(map[uint64]struct{}),
+		&hashes)
+	if err != nil {
+		return err
+	}
+	encoder := &tarEncoder{
+		fs:        fs,
+		tarWriter: tarWriter,
+		linkTable: make(map[uint64]string),
+	}
+	if len(hashes) > 0 {
+		objectsReader, err := objectsGetter.GetObjects(hashes)
+		if err != nil {
+			return err
+		}
+		defer objectsReader.Close()
+		encoder.objectsReader = objectsReader
+	}
+	return encoder.writeDirectory(&fs.DirectoryInode, ".")
+}
+
+func listObjects(fs *filesystem.FileSystem,
+	directory *filesystem.DirectoryInode, seen map[uint64]struct{},
+	hashes *[]hash.Hash) error {
+	for _, dirent := range directory.EntryList {
+		inode, ok := fs.InodeTable[dirent.InodeNumber]
+		if !ok {
+			return fmt.Errorf("no inode: %d for: %s", dirent.InodeNumber,
+				dirent.Name)
+		}
+		switch inode := inode.(type) {
+		case *filesystem.DirectoryInode:
+			if err := listObjects(fs, inode, seen, hashes); err != nil {
+				return err
+			}
+		case *filesystem.RegularInode:
+			if _, ok := seen[dirent.InodeNumber]; ok {
+				continue
+			}
+			seen[dirent.InodeNumber] = struct{}{}
+			if inode.Size > 0 {
+				*hashes = append(*hashes, inode.Hash)
+			}
+		}
+	}
+	return nil
+}
+
+func (encoder *tarEncoder) writeDirectory(
+	directory *filesystem.DirectoryInode, name string) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     int64(directory.Mode &^ syscall.S_IFMT),
+		Uid:      int(directory.Uid),
+		Gid:      int(directory.Gid),
+		ModTime:  time.Unix(0, 0),
+	}
+	if err := encoder.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	for _, dirent := range directory.EntryList {
+		pathname := name + "/" + dirent.Name
+		if err := encoder.writeEntry(dirent, pathname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (encoder *tarEncoder) writeEntry(dirent *filesystem.DirectoryEntry,
+	name string) error {
+	inode := encoder.fs.InodeTable[dirent.InodeNumber]
+	if directory, ok := inode.(*filesystem.DirectoryInode); ok {
+		return encoder.writeDirectory(directory, name)
+	}
+	if _, ok := inode.(*filesystem.ComputedRegularInode); ok {
+		return nil
+	}
+	if linkname, ok := encoder.linkTable[dirent.InodeNumber]; ok {
+		return encoder.tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeLink,
+			Name:     name,
+			Linkname: linkname,
+			ModTime:  time.Unix(0, 0),
+		})
+	}
+	encoder.linkTable[dirent.InodeNumber] = name
+	switch inode := inode.(type) {
+	case *filesystem.RegularInode:
+		return encoder.writeRegularFile(inode, name)
+	case *filesystem.SymlinkInode:
+		return encoder.tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: inode.Symlink,
+			Mode:     0777,
+			Uid:      int(inode.Uid),
+			Gid:      int(inode.Gid),
+			ModTime:  time.Unix(0, 0),
+		})
+	case *filesystem.SpecialInode:
+		return encoder.writeSpecialFile(inode, name)
+	}
+	return errors.New("unsupported inode type for: " + name)
+}
+
+func (encoder *tarEncoder) writeRegularFile(inode *filesystem.RegularInode,
+	name string) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(inode.Mode &^ syscall.S_IFMT),
+		Uid:      int(inode.Uid),
+		Gid:      int(inode.Gid),
+		Size:     int64(inode.Size),
+		ModTime: time.Unix(inode.MtimeSeconds,
+			int64(inode.MtimeNanoSeconds)),
+	}
+	if err := encoder.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	if inode.Size < 1 {
+		return nil
+	}
+	length, reader, err := encoder.objectsReader.NextObject()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if length != inode.Size {
+		return fmt.Errorf("object: %x length: %d != inode size: %d for: %s",
+			inode.Hash, length, inode.Size, name)
+	}
+	_, err = io.CopyN(encoder.tarWriter, reader, int64(length))
+	return err
+}
+
+func (encoder *tarEncoder) writeSpecialFile(inode *filesystem.SpecialInode,
+	name string) error {
+	header := &tar.Header{
+		Name: name,
+		Mode: int64(inode.Mode &^ syscall.S_IFMT),
+		Uid:  int(inode.Uid),
+		Gid:  int(inode.Gid),
+		ModTime: time.Unix(inode.MtimeSeconds,
+			int64(inode.MtimeNanoSeconds)),
+	}
+	switch inode.Mode & syscall.S_IFMT {
+	case syscall.S_IFCHR:
+		header.Typeflag = tar.TypeChar
+	case syscall.S_IFBLK:
+		header.Typeflag = tar.TypeBlock
+	case syscall.S_IFIFO:
+		header.Typeflag = tar.TypeFifo
+	default: // Sockets cannot be archived and are recreated at runtime.
+		return nil
+	}
+	header.Devmajor = int64(inode.Rdev >> 8)
+	header.Devminor = int64(inode.Rdev & 0xff)
+	return encoder.tarWriter.WriteHeader(header)
+}
@@ -0,0 +1,12 @@
+package image
+
+func (image *Image) matchLabels(selector map[string]string) bool {
+	for key, value := range selector {
+		if labelValue, ok := image.Labels[key]; !ok {
+			return false
+		} else if value != "" && value != labelValue {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package image
+
+import (
+	"testing"
+)
+
+func TestMatchLabels(t *testing.T) {
+	img := &Image{Labels: map[string]string{"os": "linux", "tier": "prod"}}
+	var tests = []struct {
+		selector map[string]string
+		want     bool
+	}{
+		{nil, true},
+		{map[string]string{"os": "linux"}, true},
+		{map[string]string{"os": "linux", "tier": "prod"}, true},
+		{map[string]string{"os": ""}, true},
+		{map[string]string{"os": "windows"}, false},
+		{map[string]string{"os": "linux", "tier": "dev"}, false},
+		{map[string]string{"arch": ""}, false},
+	}
+	for _, test := range tests {
+		if got := img.MatchLabels(test.selector); got != test.want {
+			t.Errorf("MatchLabels(%v) = %v", test.selector, got)
+		}
+	}
+	if !(&Image{}).MatchLabels(nil) {
+		t.Error("image without labels does not match empty selector")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+	Package lint checks images against a configurable policy.
+
+	A policy is a set of rules per image directory. Each rule names a check
+	and whether a violation should reject the image or only produce a warning.
+	Checks are pluggable: the built-in checks may be supplemented by
+	registering new checks with RegisterCheck.
+*/
+package lint
+
+import (
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver"
+)
+
+const (
+	ActionWarn   = "warn"
+	ActionReject = "reject"
+)
+
+// Context provides checks with information beyond the image being checked.
+type Context struct {
+	PreviousImage *image.Image               // May be nil.
+	ObjectsGetter objectserver.ObjectsGetter // May be nil: no content checks.
+}
+
+// Checker is the interface that wraps the Check method.
+//
+// Check returns the policy violations found in img. The Check and Reject
+// fields of the violations are filled in by the policy. An error should only
+// be returned if the check could not be performed.
+type Checker interface {
+	Check(img *image.Image, context *Context) ([]Violation, error)
+}
+
+// CheckerFactory creates a Checker from the arguments given in a policy rule.
+type CheckerFactory func(args []string) (Checker, error)
+
+type Violation struct {
+	Check    string
+	Pathname string `json:",omitempty"`
+	Message  string
+	Reject   bool
+}
+
+type rule struct {
+	checkName string
+	checker   Checker
+	reject    bool
+}
+
+// Policy records which checks are applied to images in which image
+// directories.
+type Policy struct {
+	rulesByDirectory map[string][]rule
+}
+
+// FindPreviousImage returns the name of the latest image in imageNames which
+// is in the same directory as name and sorts before it (as a version string),
+// or "" if there is none. This is the image used for comparisons.
+func FindPreviousImage(name string, imageNames []string) string {
+	return findPreviousImage(name, imageNames)
+}
+
+// ListChecks returns the names of the registered checks.
+func ListChecks() []string {
+	return listChecks()
+}
+
+// LoadPolicy reads a policy from the file specified by filename. Each line
+// contains an image directory, a check name, an action (warn or reject) and
+// optional arguments for the check. The rules for a directory apply to all
+// subdirectories which do not have their own rules.
+func LoadPolicy(filename string) (*Policy, error) {
+	return loadPolicy(filename)
+}
+
+// NewDefaultPolicy returns a policy which applies all the registered checks
+// (with no arguments) to all images, warning about violations.
+func NewDefaultPolicy() (*Policy, error) {
+	return newDefaultPolicy()
+}
+
+// RegisterCheck registers a check under name. It should be called before any
+// policies are loaded, typically from an init function.
+func RegisterCheck(name string, factory CheckerFactory) {
+	registerCheck(name, factory)
+}
+
+// Check applies the rules for the directory containing the image specified by
+// name and returns the violations found.
+func (policy *Policy) Check(name string, img *image.Image, context *Context) (
+	[]Violation, error) {
+	return policy.check(name, img, context)
+}
+
+// Rejected returns true if any of the violations should reject the image.
+func Rejected(violations []Violation) bool {
+	return rejected(violations)
+}
+
+func (violation Violation) String() string {
+	return violation.string()
+}
@@ -0,0 +1,255 @@
+package lint
+
+import (
+	"bytes"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver/memory"
+	"github.com/Symantec/Dominator/lib/triggers"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+type testInode struct {
+	pathname string
+	inode    filesystem.GenericInode
+}
+
+// makeTestImage makes an image containing the inodes. Parent directories must
+// be listed before their entries.
+func makeTestImage(t *testing.T, inodes []testInode) *image.Image {
+	fs := &filesystem.FileSystem{
+		InodeTable:     make(filesystem.InodeTable),
+		DirectoryInode: filesystem.DirectoryInode{Mode: syscall.S_IFDIR | 0755},
+	}
+	directories := map[string]*filesystem.DirectoryInode{
+		"/": &fs.DirectoryInode,
+	}
+	for index, entry := range inodes {
+		inodeNumber := uint64(index + 2)
+		fs.InodeTable[inodeNumber] = entry.inode
+		directory := directories[path.Dir(entry.pathname)]
+		if directory == nil {
+			t.Fatalf("%s: no parent directory", entry.pathname)
+		}
+		directory.EntryList = append(directory.EntryList,
+			&filesystem.DirectoryEntry{Name: path.Base(entry.pathname),
+				InodeNumber: inodeNumber})
+		if inode, ok := entry.inode.(*filesystem.DirectoryInode); ok {
+			directories[entry.pathname] = inode
+		}
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		t.Fatal(err)
+	}
+	return &image.Image{FileSystem: fs}
+}
+
+func directory(mode filesystem.FileMode) *filesystem.DirectoryInode {
+	return &filesystem.DirectoryInode{Mode: syscall.S_IFDIR | mode}
+}
+
+func regularFile(mode filesystem.FileMode) *filesystem.RegularInode {
+	return &filesystem.RegularInode{Mode: syscall.S_IFREG | mode}
+}
+
+func ownedFile(uid, gid uint32) *filesystem.RegularInode {
+	return &filesystem.RegularInode{Mode: syscall.S_IFREG | 0644, Uid: uid,
+		Gid: gid}
+}
+
+func computedFile(source string) *filesystem.ComputedRegularInode {
+	return &filesystem.ComputedRegularInode{Mode: syscall.S_IFREG | 0644,
+		Source: source}
+}
+
+// dataFile returns a regular file containing data, which is added to objSrv.
+func dataFile(t *testing.T, objSrv *memory.ObjectServer,
+	data string) *filesystem.RegularInode {
+	hashVal, _, err := objSrv.AddObject(bytes.NewBufferString(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &filesystem.RegularInode{Mode: syscall.S_IFREG | 0644,
+		Size: uint64(len(data)), Hash: hashVal}
+}
+
+// violationPaths returns the pathname (or message, if there is no pathname)
+// of each violation.
+func violationPaths(violations []Violation) []string {
+	paths := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		if violation.Pathname != "" {
+			paths = append(paths, violation.Pathname)
+		} else {
+			paths = append(paths, violation.Message)
+		}
+	}
+	return paths
+}
+
+func runCheck(t *testing.T, name string, args []string, img *image.Image,
+	context *Context) []string {
+	checker, err := checkFactories[name](args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	violations, err := checker.Check(img, context)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	return violationPaths(violations)
+}
+
+func TestSetuidChecker(t *testing.T) {
+	previous := makeTestImage(t, []testInode{
+		{"/bin", directory(0755)},
+		{"/bin/su", regularFile(syscall.S_ISUID | 0755)},
+		{"/bin/wall", regularFile(0755)},
+	})
+	var tests = []struct {
+		name     string
+		previous *image.Image
+		want     []string
+	}{
+		{"no previous image", nil, []string{}},
+		{"compared", previous, []string{"/bin/mount", "/bin/wall"}},
+	}
+	img := makeTestImage(t, []testInode{
+		{"/bin", directory(0755)},
+		{"/bin/mount", regularFile(syscall.S_ISUID | 0755)},
+		{"/bin/su", regularFile(syscall.S_ISUID | 0755)},
+		{"/bin/wall", regularFile(syscall.S_ISGID | 0755)},
+		{"/bin/setgid-dir", directory(syscall.S_ISGID | 0755)},
+	})
+	for _, test := range tests {
+		got := runCheck(t, "setuid", nil, img,
+			&Context{PreviousImage: test.previous})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got: %v, want: %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWorldWritableChecker(t *testing.T) {
+	img := makeTestImage(t, []testInode{
+		{"/tmp", directory(syscall.S_ISVTX | 0777)},
+		{"/open", directory(0777)},
+		{"/open/file", regularFile(0666)},
+		{"/open/private", regularFile(0600)},
+		{"/open/computed", &filesystem.ComputedRegularInode{
+			Mode: syscall.S_IFREG | 0646, Source: "localhost:6969"}},
+	})
+	got := runCheck(t, "world-writable", nil, img, &Context{})
+	want := []string{"/open", "/open/file", "/open/computed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestUnknownOwnerChecker(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	var tests = []struct {
+		name          string
+		inodes        []testInode
+		objectsGetter bool
+		want          []string
+	}{
+		{
+			name: "passwd and group",
+			inodes: []testInode{
+				{"/etc", directory(0755)},
+				{"/etc/passwd", dataFile(t, objSrv,
+					"root:x:0:0::/:\nbad line\nweb:x:100:100::/:\n")},
+				{"/etc/group", dataFile(t, objSrv, "root:x:0:\n")},
+				{"/etc/web", ownedFile(100, 0)},
+				{"/etc/db", ownedFile(200, 0)},
+				{"/etc/db.conf", ownedFile(200, 100)},
+			},
+			objectsGetter: true,
+			want:          []string{"/etc/db", "/etc/db.conf"},
+		},
+		{
+			name: "no group file",
+			inodes: []testInode{
+				{"/etc", directory(0755)},
+				{"/etc/passwd", dataFile(t, objSrv, "root:x:0:0::/:\n")},
+				{"/etc/db", ownedFile(0, 200)},
+			},
+			objectsGetter: true,
+			want:          []string{},
+		},
+		{
+			name: "no object server",
+			inodes: []testInode{
+				{"/etc", directory(0755)},
+				{"/etc/passwd", dataFile(t, objSrv, "root:x:0:0::/:\n")},
+				{"/etc/db", ownedFile(200, 0)},
+			},
+			want: []string{},
+		},
+	}
+	for _, test := range tests {
+		context := &Context{}
+		if test.objectsGetter {
+			context.ObjectsGetter = objSrv
+		}
+		got := runCheck(t, "unknown-owner", nil,
+			makeTestImage(t, test.inodes), context)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got: %v, want: %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTriggerTargetsChecker(t *testing.T) {
+	img := makeTestImage(t, []testInode{
+		{"/etc", directory(0755)},
+		{"/etc/init.d", directory(0755)},
+		{"/etc/init.d/sshd", regularFile(0755)},
+		{"/lib", directory(0755)},
+		{"/lib/systemd", directory(0755)},
+		{"/lib/systemd/system", directory(0755)},
+		{"/lib/systemd/system/nginx.service", regularFile(0644)},
+		{"/lib/systemd/system/backup.timer", regularFile(0644)},
+	})
+	img.Triggers = triggers.New()
+	for _, service := range []string{"sshd", "nginx", "backup.timer",
+		"missing", "missing", "../etc/init.d/sshd", "backup"} {
+		img.Triggers.Triggers = append(img.Triggers.Triggers,
+			&triggers.Trigger{Service: service})
+	}
+	got := runCheck(t, "trigger-targets", nil, img, &Context{})
+	want := []string{
+		"no init script or unit for service: missing",
+		"no init script or unit for service: ../etc/init.d/sshd",
+		"no init script or unit for service: backup",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestComputedFilesChecker(t *testing.T) {
+	img := makeTestImage(t, []testInode{
+		{"/good", computedFile("filegen:6969")},
+		{"/other", computedFile("other:6969")},
+		{"/bad", computedFile("filegen")},
+	})
+	var tests = []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"/bad"}},
+		{[]string{"filegen:6969"}, []string{"/other", "/bad"}},
+	}
+	for _, test := range tests {
+		got := runCheck(t, "computed-files", test.args, img, &Context{})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("args: %v: got: %v, want: %v", test.args, got, test.want)
+		}
+	}
+}
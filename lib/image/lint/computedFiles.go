@@ -0,0 +1,52 @@
+package lint
+
+import (
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/image"
+	"net"
+)
+
+// computedFilesChecker reports computed files with a bad source address. If
+// filegen servers are listed as arguments, computed files from any other
+// source are also reported.
+type computedFilesChecker struct {
+	servers map[string]struct{} // Empty: any server is allowed.
+}
+
+func newComputedFilesChecker(args []string) (Checker, error) {
+	checker := computedFilesChecker{make(map[string]struct{}, len(args))}
+	for _, server := range args {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return nil, err
+		}
+		checker.servers[server] = struct{}{}
+	}
+	return checker, nil
+}
+
+func (checker computedFilesChecker) Check(img *image.Image,
+	context *Context) ([]Violation, error) {
+	var violations []Violation
+	forEachInode(img.FileSystem,
+		func(pathname string, inode filesystem.GenericInode) {
+			computedInode, ok := inode.(*filesystem.ComputedRegularInode)
+			if !ok {
+				return
+			}
+			var message string
+			if _, _, err := net.SplitHostPort(
+				computedInode.Source); err != nil {
+				message = "bad source: " + computedInode.Source
+			} else if len(checker.servers) > 0 {
+				if _, ok := checker.servers[computedInode.Source]; !ok {
+					message = "source: " + computedInode.Source +
+						" is not a known filegen server"
+				}
+			}
+			if message != "" {
+				violations = append(violations,
+					Violation{Pathname: pathname, Message: message})
+			}
+		})
+	return violations, nil
+}
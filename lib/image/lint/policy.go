@@ -0,0 +1,185 @@
+package lint
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/verstr"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var checkFactories = map[string]CheckerFactory{
+	"computed-files":  newComputedFilesChecker,
+	"setuid":          newSetuidChecker,
+	"trigger-targets": newTriggerTargetsChecker,
+	"unknown-owner":   newUnknownOwnerChecker,
+	"world-writable":  newWorldWritableChecker,
+}
+
+func registerCheck(name string, factory CheckerFactory) {
+	checkFactories[name] = factory
+}
+
+func listChecks() []string {
+	names := make([]string, 0, len(checkFactories))
+	for name := range checkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func loadPolicy(filename string) (*Policy, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	policy := &Policy{make(map[string][]rule)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, errors.New("bad line: " + line)
+		}
+		var reject bool
+		switch fields[2] {
+		case ActionWarn:
+		case ActionReject:
+			reject = true
+		default:
+			return nil, errors.New("unknown action: " + fields[2])
+		}
+		if err := policy.addRule(fields[0], fields[1], reject,
+			fields[3:]); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func newDefaultPolicy() (*Policy, error) {
+	policy := &Policy{make(map[string][]rule)}
+	for _, checkName := range listChecks() {
+		if err := policy.addRule("/", checkName, false, nil); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+func (policy *Policy) addRule(directory, checkName string, reject bool,
+	args []string) error {
+	factory, ok := checkFactories[checkName]
+	if !ok {
+		return errors.New("unknown check: " + checkName)
+	}
+	checker, err := factory(args)
+	if err != nil {
+		return fmt.Errorf("error creating check: %s: %s", checkName, err)
+	}
+	directory = path.Clean("/" + directory)
+	policy.rulesByDirectory[directory] = append(
+		policy.rulesByDirectory[directory],
+		rule{checkName: checkName, checker: checker, reject: reject})
+	return nil
+}
+
+func (policy *Policy) check(name string, img *image.Image, context *Context) (
+	[]Violation, error) {
+	if context == nil {
+		context = &Context{}
+	}
+	var violations []Violation
+	for _, rule := range policy.findRules(name) {
+		ruleViolations, err := rule.checker.Check(img, context)
+		if err != nil {
+			return nil, fmt.Errorf("check: %s failed: %s", rule.checkName, err)
+		}
+		for _, violation := range ruleViolations {
+			violation.Check = rule.checkName
+			violation.Reject = rule.reject
+			violations = append(violations, violation)
+		}
+	}
+	return violations, nil
+}
+
+// Find the rules for the closest enclosing directory of the image name.
+func (policy *Policy) findRules(name string) []rule {
+	dirname := path.Dir(path.Clean("/" + name))
+	for {
+		if rules, ok := policy.rulesByDirectory[dirname]; ok {
+			return rules
+		}
+		if dirname == "/" {
+			return nil
+		}
+		dirname = path.Dir(dirname)
+	}
+}
+
+func findPreviousImage(name string, imageNames []string) string {
+	dirname := path.Dir(name)
+	var previousName string
+	for _, imageName := range imageNames {
+		if path.Dir(imageName) != dirname || !verstr.Less(imageName, name) {
+			continue
+		}
+		if previousName == "" || verstr.Less(previousName, imageName) {
+			previousName = imageName
+		}
+	}
+	return previousName
+}
+
+func rejected(violations []Violation) bool {
+	for _, violation := range violations {
+		if violation.Reject {
+			return true
+		}
+	}
+	return false
+}
+
+func (violation Violation) string() string {
+	action := ActionWarn
+	if violation.Reject {
+		action = ActionReject
+	}
+	if violation.Pathname == "" {
+		return fmt.Sprintf("%s: %s: %s", action, violation.Check,
+			violation.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", action, violation.Check,
+		violation.Pathname, violation.Message)
+}
+
+type violationList []Violation
+
+func (list violationList) Len() int {
+	return len(list)
+}
+
+func (list violationList) Less(left, right int) bool {
+	return list[left].Pathname < list[right].Pathname
+}
+
+func (list violationList) Swap(left, right int) {
+	list[left], list[right] = list[right], list[left]
+}
+
+func sortViolations(violations []Violation) {
+	sort.Sort(violationList(violations))
+}
@@ -0,0 +1,172 @@
+package lint
+
+import (
+	"github.com/Symantec/Dominator/lib/image"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countChecker reports one violation per call and counts the calls.
+type countChecker struct {
+	numCalls *int
+}
+
+func (checker countChecker) Check(img *image.Image, context *Context) (
+	[]Violation, error) {
+	*checker.numCalls++
+	return []Violation{{Message: "found"}}, nil
+}
+
+func writePolicy(t *testing.T, text string) string {
+	filename := path.Join(t.TempDir(), "policy")
+	if err := ioutil.WriteFile(filename, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadPolicy(t *testing.T) {
+	var tests = []struct {
+		name      string
+		policy    string
+		wantError string
+	}{
+		{
+			name: "good",
+			policy: `# Comment
+/         world-writable warn
+
+/prod     setuid         reject
+/prod     computed-files reject localhost:6969
+`,
+		},
+		{name: "short line", policy: "/ setuid\n", wantError: "bad line"},
+		{name: "bad action", policy: "/ setuid fail\n",
+			wantError: "unknown action"},
+		{name: "bad check", policy: "/ colour warn\n",
+			wantError: "unknown check"},
+		{name: "bad arguments", policy: "/ setuid warn extra\n",
+			wantError: "no arguments"},
+		{name: "bad server", policy: "/ computed-files warn localhost\n",
+			wantError: "missing port"},
+	}
+	for _, test := range tests {
+		_, err := LoadPolicy(writePolicy(t, test.policy))
+		if test.wantError == "" {
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantError) {
+			t.Errorf("%s: error: %v, want: %s", test.name, err,
+				test.wantError)
+		}
+	}
+	if _, err := LoadPolicy(path.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing policy file loaded")
+	}
+}
+
+func TestPolicyFindsClosestDirectory(t *testing.T) {
+	var numRootCalls, numProdCalls int
+	RegisterCheck("test-root", func(args []string) (Checker, error) {
+		return countChecker{&numRootCalls}, nil
+	})
+	RegisterCheck("test-prod", func(args []string) (Checker, error) {
+		return countChecker{&numProdCalls}, nil
+	})
+	defer delete(checkFactories, "test-root")
+	defer delete(checkFactories, "test-prod")
+	policy, err := LoadPolicy(writePolicy(t,
+		"/ test-root warn\n/prod test-prod reject\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		imageName             string
+		wantRoot, wantProd    int
+		wantRejected          bool
+		wantNumViolations     int
+		wantCheckOfViolations string
+	}{
+		{"dev/web/1", 1, 0, false, 1, "test-root"},
+		{"prod/1", 1, 1, true, 1, "test-prod"},
+		{"prod/web/1", 1, 2, true, 1, "test-prod"},
+		{"production/1", 2, 2, false, 1, "test-root"},
+	}
+	for _, test := range tests {
+		violations, err := policy.Check(test.imageName, &image.Image{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if numRootCalls != test.wantRoot || numProdCalls != test.wantProd {
+			t.Errorf("%s: calls: %d, %d, want: %d, %d", test.imageName,
+				numRootCalls, numProdCalls, test.wantRoot, test.wantProd)
+		}
+		if Rejected(violations) != test.wantRejected {
+			t.Errorf("%s: rejected: %v", test.imageName, !test.wantRejected)
+		}
+		if len(violations) != test.wantNumViolations {
+			t.Errorf("%s: violations: %v", test.imageName, violations)
+		} else if violations[0].Check != test.wantCheckOfViolations {
+			t.Errorf("%s: check: %s", test.imageName, violations[0].Check)
+		}
+	}
+}
+
+func TestNewDefaultPolicy(t *testing.T) {
+	policy, err := NewDefaultPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checkNames []string
+	for _, rule := range policy.findRules("any/image") {
+		if rule.reject {
+			t.Errorf("%s: rejects", rule.checkName)
+		}
+		checkNames = append(checkNames, rule.checkName)
+	}
+	if !reflect.DeepEqual(checkNames, ListChecks()) {
+		t.Errorf("checks: %v, want: %v", checkNames, ListChecks())
+	}
+}
+
+func TestFindPreviousImage(t *testing.T) {
+	imageNames := []string{"web/1.9", "web/1.10", "web/2.0", "db/1.5",
+		"web/canary/1.8"}
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{"web/1.11", "web/1.10"},
+		{"web/3.0", "web/2.0"},
+		{"web/1.0", ""},
+		{"db/1.6", "db/1.5"},
+		{"cache/1.0", ""},
+	}
+	for _, test := range tests {
+		if got := FindPreviousImage(test.name, imageNames); got != test.want {
+			t.Errorf("FindPreviousImage(%s)=%q, want: %q", test.name, got,
+				test.want)
+		}
+	}
+}
+
+func TestViolationString(t *testing.T) {
+	var tests = []struct {
+		violation Violation
+		want      string
+	}{
+		{Violation{Check: "setuid", Pathname: "/bin/su", Message: "new",
+			Reject: true}, "reject: setuid: /bin/su: new"},
+		{Violation{Check: "trigger-targets", Message: "missing"},
+			"warn: trigger-targets: missing"},
+	}
+	for _, test := range tests {
+		if got := test.violation.String(); got != test.want {
+			t.Errorf("got: %q, want: %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/image"
+	"syscall"
+)
+
+const setidBits = syscall.S_ISUID | syscall.S_ISGID
+
+// setuidChecker reports regular files which are setuid or setgid but were not
+// in the previous image. Without a previous image there is nothing to compare
+// with, so nothing is reported.
+type setuidChecker struct{}
+
+func newSetuidChecker(args []string) (Checker, error) {
+	if len(args) > 0 {
+		return nil, errors.New("no arguments supported")
+	}
+	return setuidChecker{}, nil
+}
+
+func (setuidChecker) Check(img *image.Image, context *Context) (
+	[]Violation, error) {
+	if context.PreviousImage == nil ||
+		context.PreviousImage.FileSystem == nil {
+		return nil, nil
+	}
+	oldModes := getSetidModes(context.PreviousImage.FileSystem)
+	var violations []Violation
+	for pathname, mode := range getSetidModes(img.FileSystem) {
+		if newBits := mode &^ oldModes[pathname]; newBits != 0 {
+			violations = append(violations, Violation{
+				Pathname: pathname,
+				Message:  fmt.Sprintf("new %s file", setidName(newBits)),
+			})
+		}
+	}
+	sortViolations(violations)
+	return violations, nil
+}
+
+func getSetidModes(fs *filesystem.FileSystem) map[string]filesystem.FileMode {
+	modes := make(map[string]filesystem.FileMode)
+	forEachInode(fs, func(pathname string, inode filesystem.GenericInode) {
+		var mode filesystem.FileMode
+		switch inode := inode.(type) {
+		case *filesystem.RegularInode:
+			mode = inode.Mode
+		case *filesystem.ComputedRegularInode:
+			mode = inode.Mode
+		default:
+			return
+		}
+		if mode&setidBits != 0 {
+			modes[pathname] = mode & setidBits
+		}
+	})
+	return modes
+}
+
+func setidName(bits filesystem.FileMode) string {
+	switch bits {
+	case syscall.S_ISUID:
+		return "setuid"
+	case syscall.S_ISGID:
+		return "setgid"
+	}
+	return "setuid+setgid"
+}
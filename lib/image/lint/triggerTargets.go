@@ -0,0 +1,66 @@
+package lint
+
+import (
+	"errors"
+	"github.com/Symantec/Dominator/lib/image"
+	"strings"
+)
+
+// Places where a service may be defined.
+var serviceDirectories = []string{
+	"/etc/init.d",
+	"/etc/systemd/system",
+	"/lib/systemd/system",
+	"/usr/lib/systemd/system",
+}
+
+// triggerTargetsChecker reports triggers for services which are not defined
+// by an init script or systemd unit in the image.
+type triggerTargetsChecker struct{}
+
+func newTriggerTargetsChecker(args []string) (Checker, error) {
+	if len(args) > 0 {
+		return nil, errors.New("no arguments supported")
+	}
+	return triggerTargetsChecker{}, nil
+}
+
+func (triggerTargetsChecker) Check(img *image.Image, context *Context) (
+	[]Violation, error) {
+	if img.Triggers == nil {
+		return nil, nil
+	}
+	var violations []Violation
+	reported := make(map[string]struct{})
+	for _, trigger := range img.Triggers.Triggers {
+		service := trigger.Service
+		if _, ok := reported[service]; ok {
+			continue
+		}
+		if !serviceExists(img, service) {
+			reported[service] = struct{}{}
+			violations = append(violations, Violation{
+				Message: "no init script or unit for service: " + service,
+			})
+		}
+	}
+	return violations, nil
+}
+
+func serviceExists(img *image.Image, service string) bool {
+	if service == "" || strings.Contains(service, "/") {
+		return false
+	}
+	names := []string{service}
+	if !strings.Contains(service, ".") {
+		names = append(names, service+".service")
+	}
+	for _, directory := range serviceDirectories {
+		for _, name := range names {
+			if lookupInode(img.FileSystem, directory+"/"+name) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
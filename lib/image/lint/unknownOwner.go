@@ -0,0 +1,136 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unknownOwnerChecker reports UIDs and GIDs which own files but are missing
+// from /etc/passwd and /etc/group in the image. One violation is reported per
+// ID, naming the first path found. If the image has no /etc/passwd (or
+// /etc/group), that part of the check is skipped.
+type unknownOwnerChecker struct{}
+
+type ownedInode interface {
+	GetUid() uint32
+	GetGid() uint32
+}
+
+type ownerUsage struct {
+	firstPathname string
+	numPaths      uint
+}
+
+func newUnknownOwnerChecker(args []string) (Checker, error) {
+	if len(args) > 0 {
+		return nil, errors.New("no arguments supported")
+	}
+	return unknownOwnerChecker{}, nil
+}
+
+func (unknownOwnerChecker) Check(img *image.Image, context *Context) (
+	[]Violation, error) {
+	if context.ObjectsGetter == nil {
+		return nil, nil
+	}
+	knownUids, err := readIds(img.FileSystem, "/etc/passwd",
+		context.ObjectsGetter)
+	if err != nil {
+		return nil, err
+	}
+	knownGids, err := readIds(img.FileSystem, "/etc/group",
+		context.ObjectsGetter)
+	if err != nil {
+		return nil, err
+	}
+	uids := make(map[uint32]*ownerUsage)
+	gids := make(map[uint32]*ownerUsage)
+	forEachInode(img.FileSystem,
+		func(pathname string, inode filesystem.GenericInode) {
+			var uid, gid uint32
+			switch inode := inode.(type) {
+			case ownedInode:
+				uid = inode.GetUid()
+				gid = inode.GetGid()
+			case *filesystem.ComputedRegularInode:
+				uid = inode.Uid
+				gid = inode.Gid
+			default:
+				return
+			}
+			recordOwner(uids, uid, pathname)
+			recordOwner(gids, gid, pathname)
+		})
+	var violations []Violation
+	if knownUids != nil {
+		violations = append(violations,
+			findUnknownIds(uids, knownUids, "UID", "/etc/passwd")...)
+	}
+	if knownGids != nil {
+		violations = append(violations,
+			findUnknownIds(gids, knownGids, "GID", "/etc/group")...)
+	}
+	return violations, nil
+}
+
+func recordOwner(usage map[uint32]*ownerUsage, id uint32, pathname string) {
+	if owner := usage[id]; owner != nil {
+		owner.numPaths++
+	} else {
+		usage[id] = &ownerUsage{firstPathname: pathname, numPaths: 1}
+	}
+}
+
+func findUnknownIds(usage map[uint32]*ownerUsage, knownIds map[uint32]struct{},
+	idName, filename string) []Violation {
+	ids := make([]int, 0)
+	for id := range usage {
+		if _, ok := knownIds[id]; !ok {
+			ids = append(ids, int(id))
+		}
+	}
+	sort.Ints(ids)
+	violations := make([]Violation, 0, len(ids))
+	for _, id := range ids {
+		owner := usage[uint32(id)]
+		violations = append(violations, Violation{
+			Pathname: owner.firstPathname,
+			Message: fmt.Sprintf("%s: %d not in %s (%d paths)",
+				idName, id, filename, owner.numPaths),
+		})
+	}
+	return violations
+}
+
+// readIds returns the IDs in the third field of a passwd or group file, or nil
+// if the file does not exist.
+func readIds(fs *filesystem.FileSystem, pathname string,
+	objectsGetter objectserver.ObjectsGetter) (map[uint32]struct{}, error) {
+	data, err := readFile(fs, pathname, objectsGetter)
+	if err != nil {
+		return nil, fmt.Errorf("error reading: %s: %s", pathname, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	ids := make(map[uint32]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 {
+			continue
+		}
+		if id, err := strconv.ParseUint(fields[2], 10, 32); err == nil {
+			ids[uint32(id)] = struct{}{}
+		}
+	}
+	return ids, scanner.Err()
+}
@@ -0,0 +1,84 @@
+package lint
+
+import (
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+	"strings"
+)
+
+// forEachInode calls fn for each path in the file-system (including the root
+// directory), in directory order.
+func forEachInode(fs *filesystem.FileSystem,
+	fn func(pathname string, inode filesystem.GenericInode)) {
+	fn("/", &fs.DirectoryInode)
+	forEachInodeInDirectory(&fs.DirectoryInode, "", fn)
+}
+
+func forEachInodeInDirectory(directory *filesystem.DirectoryInode,
+	dirname string,
+	fn func(pathname string, inode filesystem.GenericInode)) {
+	for _, dirent := range directory.EntryList {
+		pathname := dirname + "/" + dirent.Name
+		fn(pathname, dirent.Inode())
+		if inode, ok := dirent.Inode().(*filesystem.DirectoryInode); ok {
+			forEachInodeInDirectory(inode, pathname, fn)
+		}
+	}
+}
+
+// lookupInode returns the inode for pathname, or nil if it does not exist.
+// Symbolic links are not followed.
+func lookupInode(fs *filesystem.FileSystem,
+	pathname string) filesystem.GenericInode {
+	var inode filesystem.GenericInode = &fs.DirectoryInode
+	for _, name := range strings.Split(pathname, "/") {
+		if name == "" {
+			continue
+		}
+		directory, ok := inode.(*filesystem.DirectoryInode)
+		if !ok {
+			return nil
+		}
+		inode = nil
+		for _, dirent := range directory.EntryList {
+			if dirent.Name == name {
+				inode = dirent.Inode()
+				break
+			}
+		}
+		if inode == nil {
+			return nil
+		}
+	}
+	return inode
+}
+
+// readFile returns the contents of the regular file pathname, or nil if it
+// does not exist.
+func readFile(fs *filesystem.FileSystem, pathname string,
+	objectsGetter objectserver.ObjectsGetter) ([]byte, error) {
+	inode, ok := lookupInode(fs, pathname).(*filesystem.RegularInode)
+	if !ok {
+		return nil, nil
+	}
+	if inode.Size < 1 {
+		return []byte{}, nil
+	}
+	objectsReader, err := objectsGetter.GetObjects([]hash.Hash{inode.Hash})
+	if err != nil {
+		return nil, err
+	}
+	defer objectsReader.Close()
+	size, reader, err := objectsReader.NextObject()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,48 @@
+package lint
+
+import (
+	"errors"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/image"
+	"syscall"
+)
+
+// worldWritableChecker reports world-writable regular files and directories.
+// Directories with the sticky bit set (such as /tmp) are allowed.
+type worldWritableChecker struct{}
+
+func newWorldWritableChecker(args []string) (Checker, error) {
+	if len(args) > 0 {
+		return nil, errors.New("no arguments supported")
+	}
+	return worldWritableChecker{}, nil
+}
+
+func (worldWritableChecker) Check(img *image.Image, context *Context) (
+	[]Violation, error) {
+	var violations []Violation
+	forEachInode(img.FileSystem,
+		func(pathname string, inode filesystem.GenericInode) {
+			var message string
+			switch inode := inode.(type) {
+			case *filesystem.DirectoryInode:
+				if inode.Mode&syscall.S_IWOTH != 0 &&
+					inode.Mode&syscall.S_ISVTX == 0 {
+					message = "world-writable directory without sticky bit"
+				}
+			case *filesystem.RegularInode:
+				if inode.Mode&syscall.S_IWOTH != 0 {
+					message = "world-writable file"
+				}
+			case *filesystem.ComputedRegularInode:
+				if inode.Mode&syscall.S_IWOTH != 0 {
+					message = "world-writable computed file"
+				}
+			}
+			if message != "" {
+				violations = append(violations,
+					Violation{Pathname: pathname, Message: message})
+			}
+		})
+	return violations, nil
+}
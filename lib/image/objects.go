@@ -0,0 +1,24 @@
+package image
+
+import (
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+)
+
+func (image *Image) listObjects() []hash.Hash {
+	hashes := make([]hash.Hash, 0, image.FileSystem.NumRegularInodes+4)
+	for _, inode := range image.FileSystem.InodeTable {
+		if inode, ok := inode.(*filesystem.RegularInode); ok {
+			if inode.Size > 0 {
+				hashes = append(hashes, inode.Hash)
+			}
+		}
+	}
+	for _, annotation := range []*Annotation{image.ReleaseNotes,
+		image.BuildLog, image.Manifest, image.Packages} {
+		if annotation != nil && annotation.Object != nil {
+			hashes = append(hashes, *annotation.Object)
+		}
+	}
+	return hashes
+}
@@ -0,0 +1,111 @@
+/*
+	Package packages extracts an inventory of the installed packages from an
+	image, by parsing the package databases in the image file-system.
+
+	The dpkg status file and the RPM database (in SQLite or Berkeley DB
+	format) are supported. No external tools or libraries are required.
+*/
+package packages
+
+import (
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+)
+
+const (
+	ManagerDpkg = "dpkg"
+	ManagerRpm  = "rpm"
+)
+
+type Package struct {
+	Name         string
+	Version      string // Includes the epoch and release, if any.
+	Architecture string `json:",omitempty"`
+	Manager      string // ManagerDpkg or ManagerRpm.
+}
+
+// Inventory is the list of packages installed in an image. It is stored as a
+// JSON object referenced by the Packages annotation of the image.
+type Inventory struct {
+	Packages []Package // Sorted by name, architecture, manager and version.
+}
+
+type VersionChange struct {
+	Name         string
+	Architecture string `json:",omitempty"`
+	Manager      string
+	OldVersion   string
+	NewVersion   string
+}
+
+type InventoryDiff struct {
+	Added   []Package
+	Removed []Package
+	Changed []VersionChange
+}
+
+// Decode reads a JSON encoded inventory.
+func Decode(reader io.Reader) (*Inventory, error) {
+	return decode(reader)
+}
+
+// DiffInventories returns the packages which were added, removed or changed
+// going from the left inventory to the right inventory.
+func DiffInventories(left, right *Inventory) *InventoryDiff {
+	return diffInventories(left, right)
+}
+
+// Extract will find and parse the package databases in the file-system.
+// The database files are read from objectsGetter. If no package database is
+// found, an empty inventory is returned.
+func Extract(fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter) (*Inventory, error) {
+	return extract(fs, objectsGetter)
+}
+
+// ParseDpkgStatus parses a dpkg status file (normally /var/lib/dpkg/status)
+// and returns the installed packages.
+func ParseDpkgStatus(reader io.Reader) ([]Package, error) {
+	return parseDpkgStatus(reader)
+}
+
+// ParseRpmBerkeleyDB parses the contents of an RPM database in Berkeley DB
+// hash format (normally /var/lib/rpm/Packages).
+func ParseRpmBerkeleyDB(data []byte) ([]Package, error) {
+	return parseRpmBerkeleyDB(data)
+}
+
+// ParseRpmSqlite parses the contents of an RPM database in SQLite format
+// (normally /var/lib/rpm/rpmdb.sqlite). Changes still in a write-ahead log are
+// not seen.
+func ParseRpmSqlite(data []byte) ([]Package, error) {
+	return parseRpmSqlite(data)
+}
+
+// Encode writes the inventory to writer in JSON format.
+func (inventory *Inventory) Encode(writer io.Writer) error {
+	return inventory.encode(writer)
+}
+
+// Sort sorts the packages in the inventory.
+func (inventory *Inventory) Sort() {
+	inventory.sort()
+}
+
+// WriteText writes the inventory to writer, one package per line.
+func (inventory *Inventory) WriteText(writer io.Writer) error {
+	return inventory.writeText(writer)
+}
+
+func (diff *InventoryDiff) Empty() bool {
+	return len(diff.Added) < 1 && len(diff.Removed) < 1 &&
+		len(diff.Changed) < 1
+}
+
+// WriteText writes the difference to writer, one line per package. Lines
+// start with "+" for added packages, "-" for removed packages and "M" for
+// packages where the version changed.
+func (diff *InventoryDiff) WriteText(writer io.Writer) error {
+	return diff.writeText(writer)
+}
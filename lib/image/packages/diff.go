@@ -0,0 +1,134 @@
+package packages
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type packageKey struct {
+	name         string
+	architecture string
+	manager      string
+}
+
+func makeVersionsTable(
+	inventory *Inventory) map[packageKey]map[string]struct{} {
+	table := make(map[packageKey]map[string]struct{})
+	if inventory == nil {
+		return table
+	}
+	for _, pkg := range inventory.Packages {
+		key := packageKey{pkg.Name, pkg.Architecture, pkg.Manager}
+		versions := table[key]
+		if versions == nil {
+			versions = make(map[string]struct{})
+			table[key] = versions
+		}
+		versions[pkg.Version] = struct{}{}
+	}
+	return table
+}
+
+func diffInventories(left, right *Inventory) *InventoryDiff {
+	leftTable := makeVersionsTable(left)
+	rightTable := makeVersionsTable(right)
+	diff := &InventoryDiff{}
+	for key, leftVersions := range leftTable {
+		rightVersions := rightTable[key]
+		if len(leftVersions) == 1 && len(rightVersions) == 1 {
+			oldVersion := getOnlyVersion(leftVersions)
+			newVersion := getOnlyVersion(rightVersions)
+			if oldVersion != newVersion {
+				diff.Changed = append(diff.Changed, VersionChange{
+					Name:         key.name,
+					Architecture: key.architecture,
+					Manager:      key.manager,
+					OldVersion:   oldVersion,
+					NewVersion:   newVersion,
+				})
+			}
+			continue
+		}
+		// Packages which may be installed more than once (such as kernels)
+		// are compared version by version.
+		for version := range leftVersions {
+			if _, ok := rightVersions[version]; !ok {
+				diff.Removed = append(diff.Removed, key.makePackage(version))
+			}
+		}
+	}
+	for key, rightVersions := range rightTable {
+		leftVersions := leftTable[key]
+		if len(leftVersions) == 1 && len(rightVersions) == 1 {
+			continue
+		}
+		for version := range rightVersions {
+			if _, ok := leftVersions[version]; !ok {
+				diff.Added = append(diff.Added, key.makePackage(version))
+			}
+		}
+	}
+	sort.Sort(packageList(diff.Added))
+	sort.Sort(packageList(diff.Removed))
+	sort.Sort(changeList(diff.Changed))
+	return diff
+}
+
+type changeList []VersionChange
+
+func (list changeList) Len() int {
+	return len(list)
+}
+
+func (list changeList) Less(left, right int) bool {
+	return list[left].key().less(list[right].key())
+}
+
+func (list changeList) Swap(left, right int) {
+	list[left], list[right] = list[right], list[left]
+}
+
+func (change VersionChange) key() Package {
+	return Package{
+		Name:         change.Name,
+		Architecture: change.Architecture,
+		Manager:      change.Manager,
+	}
+}
+
+func getOnlyVersion(versions map[string]struct{}) string {
+	for version := range versions {
+		return version
+	}
+	return ""
+}
+
+func (key packageKey) makePackage(version string) Package {
+	return Package{
+		Name:         key.name,
+		Version:      version,
+		Architecture: key.architecture,
+		Manager:      key.manager,
+	}
+}
+
+func (diff *InventoryDiff) writeText(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for _, pkg := range diff.Removed {
+		fmt.Fprintf(w, "- %s\n", pkg)
+	}
+	for _, pkg := range diff.Added {
+		fmt.Fprintf(w, "+ %s\n", pkg)
+	}
+	for _, change := range diff.Changed {
+		architecture := change.Architecture
+		if architecture == "" {
+			architecture = "-"
+		}
+		fmt.Fprintf(w, "M %s %s %s -> %s %s\n", change.Manager, change.Name,
+			change.OldVersion, change.NewVersion, architecture)
+	}
+	return w.Flush()
+}
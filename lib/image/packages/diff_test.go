@@ -0,0 +1,90 @@
+package packages
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func makeRpm(name, version string) Package {
+	return Package{name, version, "x86_64", ManagerRpm}
+}
+
+func TestDiffInventories(t *testing.T) {
+	var tests = []struct {
+		name        string
+		left, right []Package
+		want        InventoryDiff
+	}{
+		{
+			name:  "identical",
+			left:  []Package{makeRpm("bash", "5.1")},
+			right: []Package{makeRpm("bash", "5.1")},
+		},
+		{
+			name: "added, removed and changed",
+			left: []Package{makeRpm("bash", "5.1"), makeRpm("old", "1"),
+				makeRpm("zlib", "1.2")},
+			right: []Package{makeRpm("bash", "5.2"), makeRpm("new", "1"),
+				makeRpm("zlib", "1.2")},
+			want: InventoryDiff{
+				Added:   []Package{makeRpm("new", "1")},
+				Removed: []Package{makeRpm("old", "1")},
+				Changed: []VersionChange{
+					{"bash", "x86_64", ManagerRpm, "5.1", "5.2"},
+				},
+			},
+		},
+		{
+			name: "multiple versions",
+			left: []Package{makeRpm("kernel", "5.14-1"),
+				makeRpm("kernel", "5.14-2")},
+			right: []Package{makeRpm("kernel", "5.14-2"),
+				makeRpm("kernel", "5.14-3")},
+			want: InventoryDiff{
+				Added:   []Package{makeRpm("kernel", "5.14-3")},
+				Removed: []Package{makeRpm("kernel", "5.14-1")},
+			},
+		},
+		{
+			name: "architecture and manager are part of the key",
+			left: []Package{makeRpm("glibc", "2.34")},
+			right: []Package{makeRpm("glibc", "2.34"),
+				{"glibc", "2.34", "i686", ManagerRpm},
+				{"glibc", "2.34", "x86_64", ManagerDpkg}},
+			want: InventoryDiff{
+				Added: []Package{{"glibc", "2.34", "i686", ManagerRpm},
+					{"glibc", "2.34", "x86_64", ManagerDpkg}},
+			},
+		},
+	}
+	for _, test := range tests {
+		got := DiffInventories(&Inventory{test.left},
+			&Inventory{test.right})
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%s: got: %+v, want: %+v", test.name, *got, test.want)
+		}
+		if got.Empty() != reflect.DeepEqual(test.want, InventoryDiff{}) {
+			t.Errorf("%s: Empty()=%v", test.name, got.Empty())
+		}
+	}
+	if diff := DiffInventories(nil, &Inventory{}); !diff.Empty() {
+		t.Errorf("nil inventory: %+v", diff)
+	}
+}
+
+func TestInventoryDiffWriteText(t *testing.T) {
+	diff := &InventoryDiff{
+		Added:   []Package{makeRpm("new", "1")},
+		Removed: []Package{{"old", "2", "", ManagerDpkg}},
+		Changed: []VersionChange{{"bash", "x86_64", ManagerRpm, "5.1", "5.2"}},
+	}
+	buffer := &bytes.Buffer{}
+	if err := diff.WriteText(buffer); err != nil {
+		t.Fatal(err)
+	}
+	want := "- dpkg old 2 -\n+ rpm new 1 x86_64\nM rpm bash 5.1 -> 5.2 x86_64\n"
+	if got := buffer.String(); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package packages
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+func parseDpkgStatus(reader io.Reader) ([]Package, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var packages []Package
+	fields := make(map[string]string)
+	finishParagraph := func() {
+		if fields["Package"] != "" && isDpkgInstalled(fields["Status"]) {
+			packages = append(packages, Package{
+				Name:         fields["Package"],
+				Version:      fields["Version"],
+				Architecture: fields["Architecture"],
+				Manager:      ManagerDpkg,
+			})
+		}
+		fields = make(map[string]string)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			finishParagraph()
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue // Continuation of a multi-line field.
+		}
+		splitLine := strings.SplitN(line, ":", 2)
+		if len(splitLine) != 2 {
+			continue
+		}
+		fields[splitLine[0]] = strings.TrimSpace(splitLine[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finishParagraph()
+	return packages, nil
+}
+
+// The Status field has the form: "want flag status", such as
+// "install ok installed".
+func isDpkgInstalled(status string) bool {
+	statusFields := strings.Fields(status)
+	if len(statusFields) != 3 {
+		return false
+	}
+	return statusFields[2] == "installed"
+}
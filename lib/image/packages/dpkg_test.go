@@ -0,0 +1,70 @@
+package packages
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDpkgStatus(t *testing.T) {
+	var tests = []struct {
+		name   string
+		status string
+		want   []Package
+	}{
+		{
+			name: "installed and removed",
+			status: `Package: bash
+Status: install ok installed
+Architecture: amd64
+Version: 5.1-6
+Description: GNU Bourne Again SHell
+ Bash is an sh-compatible command language interpreter.
+ .
+ Package: continuation lines are ignored
+
+Package: old
+Status: deinstall ok config-files
+Version: 1.0
+
+Package: zlib1g
+Status: install ok installed
+Architecture: amd64
+Version: 1:1.2.11-4`,
+			want: []Package{
+				{"bash", "5.1-6", "amd64", ManagerDpkg},
+				{"zlib1g", "1:1.2.11-4", "amd64", ManagerDpkg},
+			},
+		},
+		{
+			name: "half installed and blank lines",
+			status: `
+
+Package: half
+Status: install reinstreq half-installed
+Version: 2.0
+
+
+Package: all
+Status: install ok installed
+Architecture: all
+Version: 3.0
+`,
+			want: []Package{{"all", "3.0", "all", ManagerDpkg}},
+		},
+		{
+			name:   "empty",
+			status: "",
+		},
+	}
+	for _, test := range tests {
+		got, err := ParseDpkgStatus(strings.NewReader(test.status))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got: %v, want: %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package packages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+	"path"
+	"strings"
+)
+
+const maxSymlinks = 16
+
+type database struct {
+	pathname string
+	parser   func(data []byte) ([]Package, error)
+}
+
+// Only the first RPM database found is used, since newer systems may keep a
+// stale database in the old location.
+var rpmDatabases = []database{
+	{"/usr/lib/sysimage/rpm/rpmdb.sqlite", parseRpmSqlite},
+	{"/var/lib/rpm/rpmdb.sqlite", parseRpmSqlite},
+	{"/usr/lib/sysimage/rpm/Packages", parseRpmBerkeleyDB},
+	{"/var/lib/rpm/Packages", parseRpmBerkeleyDB},
+}
+
+var dpkgDatabase = database{"/var/lib/dpkg/status", parseDpkgData}
+
+func extract(fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter) (*Inventory, error) {
+	inventory := &Inventory{}
+	databases := []database{dpkgDatabase}
+	for _, rpmDatabase := range rpmDatabases {
+		if inode, _ := lookupPath(fs, rpmDatabase.pathname); inode != nil {
+			databases = append(databases, rpmDatabase)
+			break
+		}
+	}
+	for _, database := range databases {
+		inode, err := lookupPath(fs, database.pathname)
+		if err != nil {
+			return nil, err
+		}
+		if inode == nil {
+			continue
+		}
+		data, err := readInode(inode, objectsGetter)
+		if err != nil {
+			return nil, fmt.Errorf("error reading: %s: %s", database.pathname,
+				err)
+		}
+		packages, err := database.parser(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing: %s: %s", database.pathname,
+				err)
+		}
+		inventory.Packages = append(inventory.Packages, packages...)
+	}
+	inventory.sort()
+	return inventory, nil
+}
+
+func parseDpkgData(data []byte) ([]Package, error) {
+	return parseDpkgStatus(bytes.NewReader(data))
+}
+
+// lookupPath returns the regular inode for pathname, following symbolic links.
+// If pathname does not exist or is not a regular file, nil is returned.
+func lookupPath(fs *filesystem.FileSystem, pathname string) (
+	*filesystem.RegularInode, error) {
+	numSymlinks := 0
+	components := splitPath(pathname)
+	var directories []*filesystem.DirectoryInode
+	directory := &fs.DirectoryInode
+	for len(components) > 0 {
+		name := components[0]
+		components = components[1:]
+		switch name {
+		case ".":
+			continue
+		case "..":
+			if len(directories) > 0 {
+				directory = directories[len(directories)-1]
+				directories = directories[:len(directories)-1]
+			}
+			continue
+		}
+		var inode filesystem.GenericInode
+		for _, dirent := range directory.EntryList {
+			if dirent.Name == name {
+				inode = dirent.Inode()
+				break
+			}
+		}
+		switch inode := inode.(type) {
+		case *filesystem.DirectoryInode:
+			directories = append(directories, directory)
+			directory = inode
+		case *filesystem.RegularInode:
+			if len(components) > 0 {
+				return nil, nil
+			}
+			return inode, nil
+		case *filesystem.SymlinkInode:
+			numSymlinks++
+			if numSymlinks > maxSymlinks {
+				return nil, errors.New("too many symbolic links: " + pathname)
+			}
+			if path.IsAbs(inode.Symlink) {
+				directories = nil
+				directory = &fs.DirectoryInode
+			}
+			components = append(splitPath(inode.Symlink), components...)
+		default:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+func splitPath(pathname string) []string {
+	var components []string
+	for _, component := range strings.Split(pathname, "/") {
+		if component != "" {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+func readInode(inode *filesystem.RegularInode,
+	objectsGetter objectserver.ObjectsGetter) ([]byte, error) {
+	if inode.Size < 1 {
+		return nil, nil
+	}
+	objectsReader, err := objectsGetter.GetObjects([]hash.Hash{inode.Hash})
+	if err != nil {
+		return nil, err
+	}
+	defer objectsReader.Close()
+	size, reader, err := objectsReader.NextObject()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
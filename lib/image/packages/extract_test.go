@@ -0,0 +1,186 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/objectserver/memory"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type testFile struct {
+	pathname string
+	data     []byte
+	symlink  string
+}
+
+// makeExtractFileSystem makes a file-system containing the specified files,
+// creating parent directories as needed.
+func makeExtractFileSystem(t *testing.T, objSrv *memory.ObjectServer,
+	files []testFile) *filesystem.FileSystem {
+	fs := &filesystem.FileSystem{
+		InodeTable:     make(filesystem.InodeTable),
+		DirectoryInode: filesystem.DirectoryInode{Mode: syscall.S_IFDIR | 0755},
+	}
+	nextInode := uint64(1)
+	addInode := func(inode filesystem.GenericInode) uint64 {
+		nextInode++
+		fs.InodeTable[nextInode] = inode
+		return nextInode
+	}
+	for _, file := range files {
+		components := splitPath(file.pathname)
+		directory := &fs.DirectoryInode
+		for _, name := range components[:len(components)-1] {
+			var found *filesystem.DirectoryInode
+			for _, dirent := range directory.EntryList {
+				if dirent.Name == name {
+					inode := fs.InodeTable[dirent.InodeNumber]
+					found = inode.(*filesystem.DirectoryInode)
+				}
+			}
+			if found == nil {
+				found = &filesystem.DirectoryInode{Mode: syscall.S_IFDIR | 0755}
+				directory.EntryList = append(directory.EntryList,
+					&filesystem.DirectoryEntry{Name: name,
+						InodeNumber: addInode(found)})
+			}
+			directory = found
+		}
+		var inode filesystem.GenericInode
+		if file.symlink != "" {
+			inode = &filesystem.SymlinkInode{Symlink: file.symlink}
+		} else {
+			regularInode := &filesystem.RegularInode{
+				Mode: syscall.S_IFREG | 0644,
+				Size: uint64(len(file.data)),
+			}
+			if len(file.data) > 0 {
+				hashVal, _, err := objSrv.AddObject(bytes.NewReader(file.data),
+					uint64(len(file.data)), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				regularInode.Hash = hashVal
+			}
+			inode = regularInode
+		}
+		directory.EntryList = append(directory.EntryList,
+			&filesystem.DirectoryEntry{Name: components[len(components)-1],
+				InodeNumber: addInode(inode)})
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func makeTestRpmSqlite(names ...string) []byte {
+	builder := newRpmSqliteBuilder("Packages")
+	var cells [][]byte
+	for index, name := range names {
+		cells = append(cells, builder.makePackageCell(uint64(index+1), name))
+	}
+	builder.writePage(2, sqlitePageLeafTable, cells, 0)
+	return builder.bytes()
+}
+
+func TestExtract(t *testing.T) {
+	dpkgStatus := []byte("Package: bash\nStatus: install ok installed\n" +
+		"Version: 5.1\nArchitecture: amd64\n")
+	var tests = []struct {
+		name      string
+		files     []testFile
+		want      string // Package names.
+		wantError bool
+	}{
+		{
+			name: "no databases",
+			files: []testFile{
+				{pathname: "/etc/passwd", data: []byte("root")},
+			},
+		},
+		{
+			name: "dpkg and rpm",
+			files: []testFile{
+				{pathname: "/var/lib/dpkg/status", data: dpkgStatus},
+				{pathname: "/var/lib/rpm/rpmdb.sqlite",
+					data: makeTestRpmSqlite("zlib", "glibc")},
+			},
+			want: "bash,glibc,zlib",
+		},
+		{
+			name: "new location preferred over stale database",
+			files: []testFile{
+				{pathname: "/usr/lib/sysimage/rpm/rpmdb.sqlite",
+					data: makeTestRpmSqlite("new")},
+				{pathname: "/var/lib/rpm/Packages",
+					data: makeBerkeleyDB(binary.LittleEndian,
+						strings.Repeat("stale", 200))},
+			},
+			want: "new",
+		},
+		{
+			name: "relative symlink",
+			files: []testFile{
+				{pathname: "/usr/lib/sysimage/data/rpmdb.sqlite",
+					data: makeTestRpmSqlite("linked")},
+				{pathname: "/var/lib/rpm",
+					symlink: "../../usr/lib/sysimage/data"},
+			},
+			want: "linked",
+		},
+		{
+			name: "symlink loop",
+			files: []testFile{
+				{pathname: "/var/lib/dpkg", symlink: "/var/lib/dpkg"},
+			},
+			wantError: true,
+		},
+		{
+			name: "corrupt database",
+			files: []testFile{
+				{pathname: "/var/lib/rpm/rpmdb.sqlite",
+					data: make([]byte, 1024)},
+			},
+			wantError: true,
+		},
+	}
+	for _, test := range tests {
+		objSrv := memory.NewObjectServer()
+		fs := makeExtractFileSystem(t, objSrv, test.files)
+		inventory, err := Extract(fs, objSrv)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("%s: error: %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := makePackageNames(inventory.Packages); got != test.want {
+			t.Errorf("%s: got: %s, want: %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestInventoryEncoding(t *testing.T) {
+	inventory := &Inventory{Packages: []Package{
+		makeRpm("zlib", "1.2"),
+		{"bash", "5.1", "", ManagerDpkg},
+	}}
+	inventory.Sort()
+	buffer := &bytes.Buffer{}
+	if err := inventory.Encode(buffer); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, inventory) {
+		t.Errorf("got: %+v, want: %+v", decoded, inventory)
+	}
+}
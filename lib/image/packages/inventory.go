@@ -0,0 +1,69 @@
+package packages
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+func decode(reader io.Reader) (*Inventory, error) {
+	var inventory Inventory
+	if err := json.NewDecoder(reader).Decode(&inventory); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+func (inventory *Inventory) encode(writer io.Writer) error {
+	return json.NewEncoder(writer).Encode(inventory)
+}
+
+func (inventory *Inventory) sort() {
+	sort.Sort(packageList(inventory.Packages))
+}
+
+func (inventory *Inventory) writeText(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for _, pkg := range inventory.Packages {
+		fmt.Fprintln(w, pkg.String())
+	}
+	return w.Flush()
+}
+
+func (pkg Package) String() string {
+	architecture := pkg.Architecture
+	if architecture == "" {
+		architecture = "-"
+	}
+	return fmt.Sprintf("%s %s %s %s", pkg.Manager, pkg.Name, pkg.Version,
+		architecture)
+}
+
+type packageList []Package
+
+func (list packageList) Len() int {
+	return len(list)
+}
+
+func (list packageList) Less(left, right int) bool {
+	return list[left].less(list[right])
+}
+
+func (list packageList) Swap(left, right int) {
+	list[left], list[right] = list[right], list[left]
+}
+
+func (left Package) less(right Package) bool {
+	if left.Name != right.Name {
+		return left.Name < right.Name
+	}
+	if left.Architecture != right.Architecture {
+		return left.Architecture < right.Architecture
+	}
+	if left.Manager != right.Manager {
+		return left.Manager < right.Manager
+	}
+	return left.Version < right.Version
+}
@@ -0,0 +1,175 @@
+package packages
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Berkeley DB hash database layout, as used by the RPM Packages database.
+// Pages are in the byte order of the machine which wrote the database, which
+// is detected from the magic number in the metadata page.
+const (
+	bdbHashMagic = 0x061561
+
+	bdbMetaMagicOffset    = 12
+	bdbMetaPageSizeOffset = 20
+	bdbMetaLastPageOffset = 32
+
+	bdbPageHeaderSize    = 26
+	bdbPageNextOffset    = 16
+	bdbPageEntriesOffset = 20
+	bdbPageHfOffset      = 22
+	bdbPageTypeOffset    = 25
+
+	bdbPageTypeHashUnsorted = 2
+	bdbPageTypeOverflow     = 7
+	bdbPageTypeHash         = 13
+
+	bdbItemKeyData = 1
+	bdbItemOffPage = 3
+)
+
+type bdbReader struct {
+	data      []byte
+	byteOrder binary.ByteOrder
+	pageSize  uint64
+}
+
+func parseRpmBerkeleyDB(data []byte) ([]Package, error) {
+	reader, err := newBdbReader(data)
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := reader.readValues()
+	if err != nil {
+		return nil, err
+	}
+	return parseRpmHeaders(blobs), nil
+}
+
+func newBdbReader(data []byte) (*bdbReader, error) {
+	if len(data) < 512 {
+		return nil, errors.New("short Berkeley DB file")
+	}
+	reader := &bdbReader{data: data}
+	magic := data[bdbMetaMagicOffset : bdbMetaMagicOffset+4]
+	if binary.LittleEndian.Uint32(magic) == bdbHashMagic {
+		reader.byteOrder = binary.LittleEndian
+	} else if binary.BigEndian.Uint32(magic) == bdbHashMagic {
+		reader.byteOrder = binary.BigEndian
+	} else {
+		return nil, errors.New("not a Berkeley DB hash database")
+	}
+	reader.pageSize = uint64(reader.byteOrder.Uint32(
+		data[bdbMetaPageSizeOffset:]))
+	if reader.pageSize < 512 || reader.pageSize > 65536 {
+		return nil, fmt.Errorf("bad page size: %d", reader.pageSize)
+	}
+	return reader, nil
+}
+
+func (reader *bdbReader) getPage(pageNumber uint64) ([]byte, error) {
+	start := pageNumber * reader.pageSize
+	if start+reader.pageSize > uint64(len(reader.data)) {
+		return nil, fmt.Errorf("page: %d beyond end of file", pageNumber)
+	}
+	return reader.data[start : start+reader.pageSize], nil
+}
+
+// readValues returns the data values of all key/data pairs in the hash pages.
+func (reader *bdbReader) readValues() ([][]byte, error) {
+	lastPage := uint64(reader.byteOrder.Uint32(
+		reader.data[bdbMetaLastPageOffset:]))
+	numPages := uint64(len(reader.data)) / reader.pageSize
+	if lastPage >= numPages {
+		lastPage = numPages - 1
+	}
+	var values [][]byte
+	for pageNumber := uint64(1); pageNumber <= lastPage; pageNumber++ {
+		page, err := reader.getPage(pageNumber)
+		if err != nil {
+			return nil, err
+		}
+		pageType := page[bdbPageTypeOffset]
+		if pageType != bdbPageTypeHash && pageType != bdbPageTypeHashUnsorted {
+			continue
+		}
+		numEntries := uint64(reader.byteOrder.Uint16(
+			page[bdbPageEntriesOffset:]))
+		if bdbPageHeaderSize+numEntries*2 > reader.pageSize {
+			return nil, fmt.Errorf("bad entry count in page: %d", pageNumber)
+		}
+		// Entries are key/data pairs: only the data are wanted.
+		for index := uint64(1); index < numEntries; index += 2 {
+			value, err := reader.readItem(page, index)
+			if err != nil {
+				return nil, fmt.Errorf("page: %d: %s", pageNumber, err)
+			}
+			if value != nil {
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (reader *bdbReader) readItem(page []byte, index uint64) ([]byte, error) {
+	offset := uint64(reader.byteOrder.Uint16(
+		page[bdbPageHeaderSize+index*2:]))
+	// Items are packed from the end of the page, so an item ends where the
+	// previous item starts.
+	end := reader.pageSize
+	if index > 0 {
+		end = uint64(reader.byteOrder.Uint16(
+			page[bdbPageHeaderSize+(index-1)*2:]))
+	}
+	if offset >= end || end > reader.pageSize {
+		return nil, errors.New("bad item offset")
+	}
+	item := page[offset:end]
+	switch item[0] {
+	case bdbItemKeyData:
+		return item[1:], nil
+	case bdbItemOffPage:
+		if len(item) < 12 {
+			return nil, errors.New("short off-page item")
+		}
+		pageNumber := uint64(reader.byteOrder.Uint32(item[4:]))
+		length := uint64(reader.byteOrder.Uint32(item[8:]))
+		return reader.readOverflow(pageNumber, length)
+	}
+	return nil, nil // Duplicates are not used by RPM.
+}
+
+func (reader *bdbReader) readOverflow(pageNumber, length uint64) (
+	[]byte, error) {
+	if length > uint64(len(reader.data)) {
+		return nil, errors.New("bad overflow length")
+	}
+	value := make([]byte, 0, length)
+	for pageNumber != 0 && uint64(len(value)) < length {
+		page, err := reader.getPage(pageNumber)
+		if err != nil {
+			return nil, err
+		}
+		if page[bdbPageTypeOffset] != bdbPageTypeOverflow {
+			return nil, fmt.Errorf("page: %d is not an overflow page",
+				pageNumber)
+		}
+		// For overflow pages, the free area offset is the number of bytes
+		// used on the page.
+		numBytes := uint64(reader.byteOrder.Uint16(page[bdbPageHfOffset:]))
+		if numBytes < 1 || bdbPageHeaderSize+numBytes > reader.pageSize {
+			return nil, fmt.Errorf("bad overflow page: %d", pageNumber)
+		}
+		value = append(value,
+			page[bdbPageHeaderSize:bdbPageHeaderSize+numBytes]...)
+		pageNumber = uint64(reader.byteOrder.Uint32(
+			page[bdbPageNextOffset:]))
+	}
+	if uint64(len(value)) != length {
+		return nil, errors.New("truncated overflow chain")
+	}
+	return value, nil
+}
@@ -0,0 +1,123 @@
+package packages
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const testBdbPageSize = 512
+
+// makeBdbHashPage makes a hash page with the specified items, which already
+// include their item type byte.
+func makeBdbHashPage(byteOrder binary.ByteOrder, items [][]byte) []byte {
+	page := make([]byte, testBdbPageSize)
+	page[bdbPageTypeOffset] = bdbPageTypeHash
+	byteOrder.PutUint16(page[bdbPageEntriesOffset:], uint16(len(items)))
+	end := len(page)
+	for index, item := range items {
+		end -= len(item)
+		copy(page[end:], item)
+		byteOrder.PutUint16(page[bdbPageHeaderSize+index*2:], uint16(end))
+	}
+	return page
+}
+
+func makeBdbOverflowPage(byteOrder binary.ByteOrder, data []byte,
+	nextPage uint32) []byte {
+	page := make([]byte, testBdbPageSize)
+	page[bdbPageTypeOffset] = bdbPageTypeOverflow
+	byteOrder.PutUint32(page[bdbPageNextOffset:], nextPage)
+	byteOrder.PutUint16(page[bdbPageHfOffset:], uint16(len(data)))
+	copy(page[bdbPageHeaderSize:], data)
+	return page
+}
+
+func makeBdbKeyData(data []byte) []byte {
+	return append([]byte{bdbItemKeyData}, data...)
+}
+
+func makeBdbOffPage(byteOrder binary.ByteOrder, pageNumber uint32,
+	length int) []byte {
+	item := make([]byte, 12)
+	item[0] = bdbItemOffPage
+	byteOrder.PutUint32(item[4:], pageNumber)
+	byteOrder.PutUint32(item[8:], uint32(length))
+	return item
+}
+
+// makeBerkeleyDB makes a database with two packages on a hash page and one
+// package in a chain of three overflow pages. The header for largeName must
+// need three overflow pages.
+func makeBerkeleyDB(byteOrder binary.ByteOrder, largeName string) []byte {
+	large := makeRpmHeader(largeName, "1.0", "1", "x86_64", -1)
+	chunkSize := testBdbPageSize - bdbPageHeaderSize
+	meta := make([]byte, testBdbPageSize)
+	byteOrder.PutUint32(meta[bdbMetaMagicOffset:], bdbHashMagic)
+	byteOrder.PutUint32(meta[bdbMetaPageSizeOffset:], testBdbPageSize)
+	byteOrder.PutUint32(meta[bdbMetaLastPageOffset:], 4)
+	hashPage := makeBdbHashPage(byteOrder, [][]byte{
+		makeBdbKeyData([]byte{1, 0, 0, 0}),
+		makeBdbKeyData(makeRpmHeader("bash", "5.1", "2", "x86_64", -1)),
+		makeBdbKeyData([]byte{2, 0, 0, 0}),
+		makeBdbOffPage(byteOrder, 2, len(large)),
+		makeBdbKeyData([]byte{3, 0, 0, 0}),
+		makeBdbKeyData(makeRpmHeader("zlib", "1.2", "1", "x86_64", -1)),
+	})
+	data := append(meta, hashPage...)
+	data = append(data,
+		makeBdbOverflowPage(byteOrder, large[:chunkSize], 3)...)
+	data = append(data,
+		makeBdbOverflowPage(byteOrder, large[chunkSize:2*chunkSize], 4)...)
+	return append(data,
+		makeBdbOverflowPage(byteOrder, large[2*chunkSize:], 0)...)
+}
+
+func TestParseRpmBerkeleyDB(t *testing.T) {
+	largeName := "kernel-" + strings.Repeat("x", 1000)
+	var tests = []struct {
+		name      string
+		data      []byte
+		want      string // Package names.
+		wantError bool
+	}{
+		{
+			name: "little endian",
+			data: makeBerkeleyDB(binary.LittleEndian, largeName),
+			want: "bash," + largeName + ",zlib",
+		},
+		{
+			name: "big endian",
+			data: makeBerkeleyDB(binary.BigEndian, largeName),
+			want: "bash," + largeName + ",zlib",
+		},
+		{
+			name:      "truncated overflow",
+			data:      makeBerkeleyDB(binary.LittleEndian, largeName)[:1536],
+			wantError: true,
+		},
+		{
+			name:      "not Berkeley DB",
+			data:      make([]byte, 1024),
+			wantError: true,
+		},
+		{
+			name:      "short",
+			data:      make([]byte, 100),
+			wantError: true,
+		},
+	}
+	for _, test := range tests {
+		packages, err := ParseRpmBerkeleyDB(test.data)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("%s: error: %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := makePackageNames(packages); got != test.want {
+			t.Errorf("%s: got: %s, want: %s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package packages
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+const (
+	rpmTagName    = 1000
+	rpmTagVersion = 1001
+	rpmTagRelease = 1002
+	rpmTagEpoch   = 1003
+	rpmTagArch    = 1022
+
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+
+	rpmIndexEntrySize = 16
+)
+
+// parseRpmHeader decodes a header blob as stored in the RPM database: the
+// header without the leading magic. All values are big-endian.
+func parseRpmHeader(blob []byte) (Package, error) {
+	pkg := Package{Manager: ManagerRpm}
+	if len(blob) < 8 {
+		return pkg, errors.New("short RPM header")
+	}
+	numIndexEntries := binary.BigEndian.Uint32(blob[0:4])
+	dataLength := binary.BigEndian.Uint32(blob[4:8])
+	dataStart := 8 + uint64(numIndexEntries)*rpmIndexEntrySize
+	if dataStart+uint64(dataLength) > uint64(len(blob)) {
+		return pkg, errors.New("truncated RPM header")
+	}
+	data := blob[dataStart : dataStart+uint64(dataLength)]
+	var version, release, epoch string
+	for index := uint64(0); index < uint64(numIndexEntries); index++ {
+		entry := blob[8+index*rpmIndexEntrySize:]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		dataType := binary.BigEndian.Uint32(entry[4:8])
+		offset := binary.BigEndian.Uint32(entry[8:12])
+		if uint64(offset) >= uint64(len(data)) {
+			continue
+		}
+		switch tag {
+		case rpmTagName, rpmTagVersion, rpmTagRelease, rpmTagArch:
+			if dataType != rpmTypeString {
+				continue
+			}
+			value := getCString(data[offset:])
+			switch tag {
+			case rpmTagName:
+				pkg.Name = value
+			case rpmTagVersion:
+				version = value
+			case rpmTagRelease:
+				release = value
+			case rpmTagArch:
+				pkg.Architecture = value
+			}
+		case rpmTagEpoch:
+			if dataType != rpmTypeInt32 || len(data[offset:]) < 4 {
+				continue
+			}
+			epoch = strconv.FormatUint(
+				uint64(binary.BigEndian.Uint32(data[offset:])), 10)
+		}
+	}
+	if pkg.Name == "" {
+		return pkg, errors.New("no name in RPM header")
+	}
+	pkg.Version = version
+	if release != "" {
+		pkg.Version += "-" + release
+	}
+	if epoch != "" {
+		pkg.Version = epoch + ":" + pkg.Version
+	}
+	return pkg, nil
+}
+
+func getCString(data []byte) string {
+	for index, char := range data {
+		if char == 0 {
+			return string(data[:index])
+		}
+	}
+	return string(data)
+}
+
+// parseRpmHeaders parses each of the header blobs. Blobs which cannot be
+// parsed are skipped.
+func parseRpmHeaders(blobs [][]byte) []Package {
+	packages := make([]Package, 0, len(blobs))
+	for _, blob := range blobs {
+		if pkg, err := parseRpmHeader(blob); err == nil {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
@@ -0,0 +1,81 @@
+package packages
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type rpmHeaderEntry struct {
+	tag      uint32
+	dataType uint32
+	value    []byte
+}
+
+// makeRpmHeader makes a header blob, as stored in the RPM database. If epoch is
+// negative, no epoch is recorded.
+func makeRpmHeader(name, version, release, arch string, epoch int) []byte {
+	entries := []rpmHeaderEntry{
+		{rpmTagName, rpmTypeString, []byte(name + "\x00")},
+		{rpmTagVersion, rpmTypeString, []byte(version + "\x00")},
+		{rpmTagRelease, rpmTypeString, []byte(release + "\x00")},
+		{rpmTagArch, rpmTypeString, []byte(arch + "\x00")},
+	}
+	if epoch >= 0 {
+		value := make([]byte, 4)
+		binary.BigEndian.PutUint32(value, uint32(epoch))
+		entries = append(entries, rpmHeaderEntry{rpmTagEpoch, rpmTypeInt32,
+			value})
+	}
+	var index, data []byte
+	for _, entry := range entries {
+		indexEntry := make([]byte, rpmIndexEntrySize)
+		binary.BigEndian.PutUint32(indexEntry[0:], entry.tag)
+		binary.BigEndian.PutUint32(indexEntry[4:], entry.dataType)
+		binary.BigEndian.PutUint32(indexEntry[8:], uint32(len(data)))
+		binary.BigEndian.PutUint32(indexEntry[12:], 1)
+		index = append(index, indexEntry...)
+		data = append(data, entry.value...)
+	}
+	blob := make([]byte, 8)
+	binary.BigEndian.PutUint32(blob[0:], uint32(len(entries)))
+	binary.BigEndian.PutUint32(blob[4:], uint32(len(data)))
+	return append(append(blob, index...), data...)
+}
+
+func TestParseRpmHeader(t *testing.T) {
+	var tests = []struct {
+		blob      []byte
+		want      Package
+		wantError bool
+	}{
+		{
+			blob: makeRpmHeader("bash", "5.1", "2.el9", "x86_64", -1),
+			want: Package{Name: "bash", Version: "5.1-2.el9",
+				Architecture: "x86_64", Manager: ManagerRpm},
+		},
+		{
+			blob: makeRpmHeader("shadow-utils", "4.9", "6", "x86_64", 2),
+			want: Package{Name: "shadow-utils", Version: "2:4.9-6",
+				Architecture: "x86_64", Manager: ManagerRpm},
+		},
+		{
+			blob: makeRpmHeader("gpg-pubkey", "1", "", "", -1),
+			want: Package{Name: "gpg-pubkey", Version: "1",
+				Manager: ManagerRpm},
+		},
+		{blob: makeRpmHeader("", "1", "1", "noarch", -1), wantError: true},
+		{blob: makeRpmHeader("bash", "5.1", "1", "x86_64", -1)[:20],
+			wantError: true},
+		{blob: []byte{0, 0, 0}, wantError: true},
+	}
+	for index, test := range tests {
+		pkg, err := parseRpmHeader(test.blob)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("test %d: error: %v", index, err)
+			continue
+		}
+		if err == nil && pkg != test.want {
+			t.Errorf("test %d: got: %+v, want: %+v", index, pkg, test.want)
+		}
+	}
+}
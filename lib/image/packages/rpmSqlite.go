@@ -0,0 +1,316 @@
+package packages
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// SQLite database file layout. Only what is needed to read all the rows of a
+// table is implemented.
+const (
+	sqliteMagic             = "SQLite format 3\x00"
+	sqliteHeaderSize        = 100
+	sqlitePageSizeOffset    = 16
+	sqliteReservedOffset    = 20
+	sqlitePageInteriorTable = 0x05
+	sqlitePageLeafTable     = 0x0d
+	sqliteMaxDepth          = 64
+)
+
+type sqliteReader struct {
+	data       []byte
+	pageSize   uint64
+	usableSize uint64
+}
+
+type sqliteValue struct {
+	isNull bool
+	data   []byte // Raw data for strings and blobs.
+	number int64
+}
+
+func parseRpmSqlite(data []byte) ([]Package, error) {
+	reader, err := newSqliteReader(data)
+	if err != nil {
+		return nil, err
+	}
+	rootPage, err := reader.findTable("Packages")
+	if err != nil {
+		return nil, err
+	}
+	var blobs [][]byte
+	err = reader.walkTable(rootPage, func(row []sqliteValue) error {
+		// Columns: hnum (INTEGER PRIMARY KEY, stored as NULL), blob.
+		if len(row) >= 2 && !row[1].isNull {
+			blobs = append(blobs, row[1].data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseRpmHeaders(blobs), nil
+}
+
+func newSqliteReader(data []byte) (*sqliteReader, error) {
+	if len(data) < sqliteHeaderSize ||
+		string(data[:len(sqliteMagic)]) != sqliteMagic {
+		return nil, errors.New("not an SQLite database")
+	}
+	reader := &sqliteReader{data: data}
+	reader.pageSize = uint64(binary.BigEndian.Uint16(
+		data[sqlitePageSizeOffset:]))
+	if reader.pageSize == 1 {
+		reader.pageSize = 65536
+	}
+	if reader.pageSize < 512 {
+		return nil, fmt.Errorf("bad page size: %d", reader.pageSize)
+	}
+	reserved := uint64(data[sqliteReservedOffset])
+	if reserved >= reader.pageSize-480 {
+		return nil, fmt.Errorf("bad reserved space: %d", reserved)
+	}
+	reader.usableSize = reader.pageSize - reserved
+	return reader, nil
+}
+
+// getPage returns the page and the offset of the b-tree page header (page 1
+// starts with the database header).
+func (reader *sqliteReader) getPage(pageNumber uint64) ([]byte, uint64, error) {
+	if pageNumber < 1 {
+		return nil, 0, errors.New("bad page number: 0")
+	}
+	start := (pageNumber - 1) * reader.pageSize
+	if start+reader.pageSize > uint64(len(reader.data)) {
+		return nil, 0, fmt.Errorf("page: %d beyond end of file", pageNumber)
+	}
+	page := reader.data[start : start+reader.pageSize]
+	if pageNumber == 1 {
+		return page, sqliteHeaderSize, nil
+	}
+	return page, 0, nil
+}
+
+// findTable returns the root page of the table, from the schema table.
+func (reader *sqliteReader) findTable(name string) (uint64, error) {
+	var rootPage uint64
+	err := reader.walkTable(1, func(row []sqliteValue) error {
+		// Columns: type, name, tbl_name, rootpage, sql.
+		if len(row) >= 4 && string(row[0].data) == "table" &&
+			string(row[1].data) == name {
+			rootPage = uint64(row[3].number)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rootPage < 1 {
+		return 0, errors.New("no table: " + name)
+	}
+	return rootPage, nil
+}
+
+// walkTable calls rowFunc for each row of the table with the specified root
+// page. A corrupt database may contain loops, so each page is visited at most
+// once and the depth of the b-tree is limited.
+func (reader *sqliteReader) walkTable(rootPage uint64,
+	rowFunc func([]sqliteValue) error) error {
+	return reader.walkPage(rootPage, 0, make(map[uint64]struct{}), rowFunc)
+}
+
+func (reader *sqliteReader) walkPage(pageNumber uint64, depth int,
+	visitedPages map[uint64]struct{},
+	rowFunc func([]sqliteValue) error) error {
+	if depth > sqliteMaxDepth {
+		return errors.New("b-tree too deep")
+	}
+	if _, ok := visitedPages[pageNumber]; ok {
+		return fmt.Errorf("page: %d visited twice", pageNumber)
+	}
+	visitedPages[pageNumber] = struct{}{}
+	page, headerOffset, err := reader.getPage(pageNumber)
+	if err != nil {
+		return err
+	}
+	header := page[headerOffset:]
+	pageType := header[0]
+	numCells := uint64(binary.BigEndian.Uint16(header[3:]))
+	cellPointers := headerOffset + 8
+	if pageType == sqlitePageInteriorTable {
+		cellPointers += 4
+	} else if pageType != sqlitePageLeafTable {
+		return fmt.Errorf("page: %d is not a table b-tree page", pageNumber)
+	}
+	if cellPointers+numCells*2 > reader.usableSize {
+		return fmt.Errorf("bad cell count in page: %d", pageNumber)
+	}
+	for index := uint64(0); index < numCells; index++ {
+		cellOffset := uint64(binary.BigEndian.Uint16(
+			page[cellPointers+index*2:]))
+		if cellOffset >= reader.usableSize {
+			return fmt.Errorf("bad cell offset in page: %d", pageNumber)
+		}
+		cell := page[cellOffset:reader.usableSize]
+		if pageType == sqlitePageInteriorTable {
+			if len(cell) < 4 {
+				return fmt.Errorf("short cell in page: %d", pageNumber)
+			}
+			childPage := uint64(binary.BigEndian.Uint32(cell))
+			err := reader.walkPage(childPage, depth+1, visitedPages, rowFunc)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		payload, err := reader.readLeafPayload(cell)
+		if err != nil {
+			return fmt.Errorf("page: %d: %s", pageNumber, err)
+		}
+		row, err := decodeSqliteRecord(payload)
+		if err != nil {
+			return fmt.Errorf("page: %d: %s", pageNumber, err)
+		}
+		if err := rowFunc(row); err != nil {
+			return err
+		}
+	}
+	if pageType == sqlitePageInteriorTable {
+		rightmostPage := uint64(binary.BigEndian.Uint32(header[8:]))
+		return reader.walkPage(rightmostPage, depth+1, visitedPages,
+			rowFunc)
+	}
+	return nil
+}
+
+// readLeafPayload returns the complete payload of a table leaf cell,
+// following overflow pages if needed.
+func (reader *sqliteReader) readLeafPayload(cell []byte) ([]byte, error) {
+	payloadSize, length := getSqliteVarint(cell)
+	if length < 1 {
+		return nil, errors.New("bad payload size")
+	}
+	cell = cell[length:]
+	if _, length = getSqliteVarint(cell); length < 1 { // Skip the rowid.
+		return nil, errors.New("bad rowid")
+	}
+	cell = cell[length:]
+	if payloadSize > uint64(len(reader.data)) {
+		return nil, errors.New("bad payload size")
+	}
+	maxLocal := reader.usableSize - 35
+	localSize := payloadSize
+	if payloadSize > maxLocal {
+		minLocal := (reader.usableSize-12)*32/255 - 23
+		localSize = minLocal + (payloadSize-minLocal)%(reader.usableSize-4)
+		if localSize > maxLocal {
+			localSize = minLocal
+		}
+	}
+	if localSize > uint64(len(cell)) {
+		return nil, errors.New("cell overflows page")
+	}
+	payload := make([]byte, 0, payloadSize)
+	payload = append(payload, cell[:localSize]...)
+	if localSize == payloadSize {
+		return payload, nil
+	}
+	if uint64(len(cell)) < localSize+4 {
+		return nil, errors.New("missing overflow page number")
+	}
+	overflowPage := uint64(binary.BigEndian.Uint32(cell[localSize:]))
+	for overflowPage != 0 && uint64(len(payload)) < payloadSize {
+		page, _, err := reader.getPage(overflowPage)
+		if err != nil {
+			return nil, err
+		}
+		numBytes := payloadSize - uint64(len(payload))
+		if numBytes > reader.usableSize-4 {
+			numBytes = reader.usableSize - 4
+		}
+		payload = append(payload, page[4:4+numBytes]...)
+		overflowPage = uint64(binary.BigEndian.Uint32(page))
+	}
+	if uint64(len(payload)) != payloadSize {
+		return nil, errors.New("truncated overflow chain")
+	}
+	return payload, nil
+}
+
+func decodeSqliteRecord(payload []byte) ([]sqliteValue, error) {
+	headerSize, length := getSqliteVarint(payload)
+	if length < 1 || headerSize < uint64(length) ||
+		headerSize > uint64(len(payload)) {
+		return nil, errors.New("bad record header")
+	}
+	header := payload[length:headerSize]
+	body := payload[headerSize:]
+	var values []sqliteValue
+	for len(header) > 0 {
+		serialType, length := getSqliteVarint(header)
+		if length < 1 {
+			return nil, errors.New("bad serial type")
+		}
+		header = header[length:]
+		var value sqliteValue
+		var size uint64
+		switch {
+		case serialType == 0:
+			value.isNull = true
+		case serialType >= 1 && serialType <= 6:
+			size = []uint64{0, 1, 2, 3, 4, 6, 8}[serialType]
+		case serialType == 7:
+			size = 8
+		case serialType == 8:
+			value.number = 0
+		case serialType == 9:
+			value.number = 1
+		case serialType >= 12:
+			size = (serialType - 12) / 2
+		default:
+			return nil, fmt.Errorf("bad serial type: %d", serialType)
+		}
+		if size > uint64(len(body)) {
+			return nil, errors.New("truncated record")
+		}
+		value.data = body[:size]
+		if serialType >= 1 && serialType <= 6 {
+			value.number = decodeSqliteInteger(value.data)
+		}
+		body = body[size:]
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func decodeSqliteInteger(data []byte) int64 {
+	var number int64
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		number = -1 // Sign extend.
+	}
+	for _, char := range data {
+		number = number<<8 | int64(char)
+	}
+	return number
+}
+
+// getSqliteVarint decodes a big-endian variable length integer. The number of
+// bytes used is returned, or 0 if the data are truncated.
+func getSqliteVarint(data []byte) (uint64, int) {
+	var value uint64
+	for index := 0; index < 9; index++ {
+		if index >= len(data) {
+			return 0, 0
+		}
+		char := data[index]
+		if index == 8 {
+			return value<<8 | uint64(char), 9
+		}
+		value = value<<7 | uint64(char&0x7f)
+		if char&0x80 == 0 {
+			return value, index + 1
+		}
+	}
+	return value, 9
+}
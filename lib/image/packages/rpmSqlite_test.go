@@ -0,0 +1,264 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const testSqlitePageSize = 512
+
+// sqliteBuilder builds an SQLite database file with table b-tree pages.
+type sqliteBuilder struct {
+	pages [][]byte // Page numbers start at 1.
+}
+
+func putSqliteVarint(value uint64) []byte {
+	if value < 0x80 {
+		return []byte{byte(value)}
+	}
+	var data []byte
+	for ; value > 0; value >>= 7 {
+		data = append([]byte{byte(value & 0x7f)}, data...)
+	}
+	for index := 0; index < len(data)-1; index++ {
+		data[index] |= 0x80
+	}
+	return data
+}
+
+// makeSqliteRecord encodes the values, which may be nil, small integers,
+// strings or blobs.
+func makeSqliteRecord(values ...interface{}) []byte {
+	var header, body []byte
+	for _, value := range values {
+		switch value := value.(type) {
+		case nil:
+			header = append(header, 0)
+		case int:
+			header = append(header, 1)
+			body = append(body, byte(value))
+		case string:
+			header = append(header, putSqliteVarint(13+2*uint64(len(value)))...)
+			body = append(body, value...)
+		case []byte:
+			header = append(header, putSqliteVarint(12+2*uint64(len(value)))...)
+			body = append(body, value...)
+		}
+	}
+	record := putSqliteVarint(uint64(len(header) + 1))
+	return append(append(record, header...), body...)
+}
+
+func (builder *sqliteBuilder) newPage() uint64 {
+	builder.pages = append(builder.pages, make([]byte, testSqlitePageSize))
+	return uint64(len(builder.pages))
+}
+
+// makeLeafCell makes a table leaf cell, writing overflow pages as needed.
+func (builder *sqliteBuilder) makeLeafCell(rowid uint64,
+	payload []byte) []byte {
+	cell := append(putSqliteVarint(uint64(len(payload))),
+		putSqliteVarint(rowid)...)
+	usableSize := uint64(testSqlitePageSize)
+	payloadSize := uint64(len(payload))
+	maxLocal := usableSize - 35
+	if payloadSize <= maxLocal {
+		return append(cell, payload...)
+	}
+	minLocal := (usableSize-12)*32/255 - 23
+	localSize := minLocal + (payloadSize-minLocal)%(usableSize-4)
+	if localSize > maxLocal {
+		localSize = minLocal
+	}
+	cell = append(cell, payload[:localSize]...)
+	payload = payload[localSize:]
+	nextPage := builder.newPage()
+	cell = binary.BigEndian.AppendUint32(cell, uint32(nextPage))
+	for len(payload) > 0 {
+		page := builder.pages[nextPage-1]
+		numBytes := copy(page[4:], payload)
+		payload = payload[numBytes:]
+		if len(payload) > 0 {
+			nextPage = builder.newPage()
+			binary.BigEndian.PutUint32(page, uint32(nextPage))
+		}
+	}
+	return cell
+}
+
+func makeInteriorCell(childPage uint64, key uint64) []byte {
+	cell := binary.BigEndian.AppendUint32(nil, uint32(childPage))
+	return append(cell, putSqliteVarint(key)...)
+}
+
+func (builder *sqliteBuilder) writePage(pageNumber uint64, pageType byte,
+	cells [][]byte, rightmostPage uint64) {
+	page := builder.pages[pageNumber-1]
+	headerOffset := 0
+	if pageNumber == 1 {
+		headerOffset = sqliteHeaderSize
+	}
+	page[headerOffset] = pageType
+	binary.BigEndian.PutUint16(page[headerOffset+3:], uint16(len(cells)))
+	cellPointers := headerOffset + 8
+	if pageType == sqlitePageInteriorTable {
+		binary.BigEndian.PutUint32(page[headerOffset+8:],
+			uint32(rightmostPage))
+		cellPointers += 4
+	}
+	end := len(page)
+	for index, cell := range cells {
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(page[cellPointers+index*2:], uint16(end))
+	}
+}
+
+func (builder *sqliteBuilder) bytes() []byte {
+	data := bytes.Join(builder.pages, nil)
+	copy(data, sqliteMagic)
+	binary.BigEndian.PutUint16(data[sqlitePageSizeOffset:],
+		testSqlitePageSize)
+	return data
+}
+
+// newRpmSqliteBuilder returns a builder with a schema (page 1) listing the
+// Packages table with root page 2.
+func newRpmSqliteBuilder(tableName string) *sqliteBuilder {
+	builder := &sqliteBuilder{}
+	builder.newPage()
+	builder.newPage()
+	builder.writePage(1, sqlitePageLeafTable, [][]byte{
+		builder.makeLeafCell(1, makeSqliteRecord("index", "Index", "Packages",
+			3, "CREATE INDEX")),
+		builder.makeLeafCell(2, makeSqliteRecord("table", tableName,
+			tableName, 2, "CREATE TABLE")),
+	}, 0)
+	return builder
+}
+
+func (builder *sqliteBuilder) makePackageCell(rowid uint64,
+	name string) []byte {
+	return builder.makeLeafCell(rowid, makeSqliteRecord(nil,
+		makeRpmHeader(name, "1.0", "1", "x86_64", -1)))
+}
+
+func makePackageNames(packages []Package) string {
+	names := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		names = append(names, pkg.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestParseRpmSqlite(t *testing.T) {
+	var tests = []struct {
+		name      string
+		build     func() []byte
+		want      string // Package names.
+		wantError string
+	}{
+		{
+			name: "single leaf",
+			build: func() []byte {
+				builder := newRpmSqliteBuilder("Packages")
+				builder.writePage(2, sqlitePageLeafTable, [][]byte{
+					builder.makePackageCell(1, "bash"),
+					builder.makePackageCell(2, "glibc"),
+				}, 0)
+				return builder.bytes()
+			},
+			want: "bash,glibc",
+		},
+		{
+			name: "interior pages and overflow",
+			build: func() []byte {
+				builder := newRpmSqliteBuilder("Packages")
+				left := builder.newPage()
+				right := builder.newPage()
+				builder.writePage(2, sqlitePageInteriorTable,
+					[][]byte{makeInteriorCell(left, 2)}, right)
+				large := "kernel-" + strings.Repeat("x", 1500)
+				builder.writePage(left, sqlitePageLeafTable, [][]byte{
+					builder.makePackageCell(1, "bash"),
+					builder.makePackageCell(2, large),
+				}, 0)
+				builder.writePage(right, sqlitePageLeafTable, [][]byte{
+					builder.makePackageCell(3, "zlib"),
+				}, 0)
+				return builder.bytes()
+			},
+			want: "bash,kernel-" + strings.Repeat("x", 1500) + ",zlib",
+		},
+		{
+			name: "loop",
+			build: func() []byte {
+				builder := newRpmSqliteBuilder("Packages")
+				builder.writePage(2, sqlitePageInteriorTable,
+					[][]byte{makeInteriorCell(2, 1)}, 2)
+				return builder.bytes()
+			},
+			wantError: "visited twice",
+		},
+		{
+			// Without tracking visited pages, this would take 32^64 steps.
+			name: "shared children",
+			build: func() []byte {
+				builder := newRpmSqliteBuilder("Packages")
+				child := builder.newPage()
+				var cells [][]byte
+				for index := uint64(0); index < 32; index++ {
+					cells = append(cells, makeInteriorCell(child, index))
+				}
+				builder.writePage(2, sqlitePageInteriorTable, cells, child)
+				builder.writePage(child, sqlitePageInteriorTable, cells,
+					child)
+				return builder.bytes()
+			},
+			wantError: "visited twice",
+		},
+		{
+			name: "missing page",
+			build: func() []byte {
+				builder := newRpmSqliteBuilder("Packages")
+				builder.writePage(2, sqlitePageInteriorTable,
+					[][]byte{makeInteriorCell(9, 1)}, 9)
+				return builder.bytes()
+			},
+			wantError: "beyond end of file",
+		},
+		{
+			name: "no table",
+			build: func() []byte {
+				builder := newRpmSqliteBuilder("Other")
+				builder.writePage(2, sqlitePageLeafTable, nil, 0)
+				return builder.bytes()
+			},
+			wantError: "no table",
+		},
+		{
+			name:      "not SQLite",
+			build:     func() []byte { return make([]byte, 1024) },
+			wantError: "not an SQLite database",
+		},
+	}
+	for _, test := range tests {
+		packages, err := ParseRpmSqlite(test.build())
+		if test.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("%s: error: %v, want: %s", test.name, err,
+					test.wantError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := makePackageNames(packages); got != test.want {
+			t.Errorf("%s: got: %s, want: %s", test.name, got, test.want)
+		}
+	}
+}
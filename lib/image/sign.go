@@ -0,0 +1,184 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/x509util"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+)
+
+func (image *Image) sign(signer crypto.Signer) error {
+	// The options must match what verify() expects for the key type. Ed25519
+	// signs the digest as the message: passing crypto.SHA512 would instead
+	// select Ed25519ph.
+	var opts crypto.SignerOpts
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		opts = crypto.SHA512
+	case ed25519.PublicKey:
+		opts = crypto.Hash(0)
+	default:
+		return fmt.Errorf("unsupported public key type: %T", signer.Public())
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	digest, err := image.digest()
+	if err != nil {
+		return err
+	}
+	value, err := signer.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return err
+	}
+	signatures := make([]Signature, 0, len(image.Signatures)+1)
+	for _, signature := range image.Signatures {
+		if !bytes.Equal(signature.PublicKey, publicKey) {
+			signatures = append(signatures, signature)
+		}
+	}
+	image.Signatures = append(signatures,
+		Signature{PublicKey: publicKey, Value: value})
+	return nil
+}
+
+func (image *Image) verifySignatures() error {
+	if len(image.Signatures) < 1 {
+		return nil
+	}
+	digest, err := image.digest()
+	if err != nil {
+		return err
+	}
+	for _, signature := range image.Signatures {
+		if err := signature.verify(digest[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (signature Signature) verify(digest []byte) error {
+	publicKey, err := x509.ParsePKIXPublicKey(signature.PublicKey)
+	if err != nil {
+		return err
+	}
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA512, digest,
+			signature.Value)
+		if err != nil {
+			return errors.New("bad RSA signature: " + err.Error())
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct{ R, S *big.Int }
+		rest, err := asn1.Unmarshal(signature.Value, &ecdsaSignature)
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 {
+			return errors.New("trailing data in ECDSA signature")
+		}
+		if !ecdsa.Verify(publicKey, digest, ecdsaSignature.R,
+			ecdsaSignature.S) {
+			return errors.New("bad ECDSA signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(publicKey, digest, signature.Value) {
+			return errors.New("bad Ed25519 signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type: %T", publicKey)
+}
+
+func loadTrustedKeys(filename string) (*TrustedKeys, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	trustedKeys := &TrustedKeys{make(map[string][][]byte)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.New("bad line: " + line)
+		}
+		keyFilename := fields[1]
+		if !path.IsAbs(keyFilename) {
+			keyFilename = path.Join(path.Dir(filename), keyFilename)
+		}
+		publicKey, err := x509util.LoadPublicKey(keyFilename)
+		if err != nil {
+			return nil, err
+		}
+		encodedKey, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		directory := path.Clean("/" + fields[0])
+		trustedKeys.keysByDirectory[directory] = append(
+			trustedKeys.keysByDirectory[directory], encodedKey)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return trustedKeys, nil
+}
+
+func (trustedKeys *TrustedKeys) verifyImage(name string, image *Image) error {
+	keys := trustedKeys.findKeys(name)
+	if len(keys) < 1 {
+		return errors.New("no trusted keys for image: " + name)
+	}
+	digest, err := image.digest()
+	if err != nil {
+		return err
+	}
+	for _, signature := range image.Signatures {
+		for _, key := range keys {
+			if !bytes.Equal(signature.PublicKey, key) {
+				continue
+			}
+			if err := signature.verify(digest[:]); err != nil {
+				return fmt.Errorf("image: %s: %s", name, err)
+			}
+			return nil
+		}
+	}
+	return errors.New("image: " + name + " not signed by a trusted key")
+}
+
+// Find the keys for the closest enclosing directory of the image name.
+func (trustedKeys *TrustedKeys) findKeys(name string) [][]byte {
+	dirname := path.Dir(path.Clean("/" + name))
+	for {
+		if keys, ok := trustedKeys.keysByDirectory[dirname]; ok {
+			return keys
+		}
+		if dirname == "/" {
+			return nil
+		}
+		dirname = path.Dir(dirname)
+	}
+}
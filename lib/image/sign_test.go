@@ -0,0 +1,157 @@
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/Symantec/Dominator/lib/filesystem"
+	"github.com/Symantec/Dominator/lib/filter"
+	"github.com/Symantec/Dominator/lib/hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+type unsupportedSigner struct{}
+
+func (unsupportedSigner) Public() crypto.PublicKey { return struct{}{} }
+
+func (unsupportedSigner) Sign(io.Reader, []byte, crypto.SignerOpts) (
+	[]byte, error) {
+	return []byte("signature"), nil
+}
+
+func makeSignerTestImage() *Image {
+	fs := &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			2: &filesystem.RegularInode{Mode: 0644, Size: 1,
+				Hash: hash.Hash{1}},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{Name: "file", InodeNumber: 2},
+			},
+			Mode: 0755,
+		},
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		panic(err)
+	}
+	return &Image{FileSystem: fs}
+}
+
+func makeSigners(t *testing.T) map[string]crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{
+		"RSA":     rsaKey,
+		"ECDSA":   ecdsaKey,
+		"Ed25519": ed25519Key,
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for name, signer := range makeSigners(t) {
+		img := makeSignerTestImage()
+		if err := img.Sign(signer); err != nil {
+			t.Errorf("%s: Sign: %s", name, err)
+			continue
+		}
+		// Signing again with the same key replaces the signature.
+		if err := img.Sign(signer); err != nil {
+			t.Errorf("%s: Sign: %s", name, err)
+			continue
+		}
+		if len(img.Signatures) != 1 {
+			t.Errorf("%s: %d signatures", name, len(img.Signatures))
+		}
+		if err := img.VerifySignatures(); err != nil {
+			t.Errorf("%s: VerifySignatures: %s", name, err)
+		}
+		img.Filter, _ = filter.NewFilter([]string{"/tmp"})
+		if err := img.VerifySignatures(); err == nil {
+			t.Errorf("%s: modified image verified", name)
+		}
+	}
+}
+
+func TestSignUnsupportedKey(t *testing.T) {
+	img := makeSignerTestImage()
+	if err := img.Sign(unsupportedSigner{}); err == nil {
+		t.Error("signed with unsupported key type")
+	}
+	if len(img.Signatures) > 0 {
+		t.Error("signature added for unsupported key type")
+	}
+}
+
+func writePublicKey(t *testing.T, filename string, key crypto.PublicKey) {
+	data, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filename,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	signers := makeSigners(t)
+	dir := t.TempDir()
+	writePublicKey(t, path.Join(dir, "prod.pem"), signers["Ed25519"].Public())
+	writePublicKey(t, path.Join(dir, "root.pem"), signers["ECDSA"].Public())
+	trustFile := path.Join(dir, "trusted-keys")
+	err := ioutil.WriteFile(trustFile,
+		[]byte("# Comment\n/ root.pem\nprod prod.pem\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedKeys, err := LoadTrustedKeys(trustFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		imageName string
+		signer    string
+		wantError bool
+	}{
+		{"prod/web/1", "Ed25519", false},
+		{"prod/web/1", "ECDSA", true},
+		{"prod/web/1", "", true},
+		{"dev/web/1", "ECDSA", false},
+		{"dev/web/1", "Ed25519", true},
+		{"top-level", "ECDSA", false},
+		{"production/1", "ECDSA", false},
+	}
+	for _, test := range tests {
+		img := makeSignerTestImage()
+		if test.signer != "" {
+			if err := img.Sign(signers[test.signer]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := trustedKeys.VerifyImage(test.imageName, img)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("VerifyImage(%s) signed with: %q: error: %v",
+				test.imageName, test.signer, err)
+		}
+	}
+}
@@ -2,14 +2,72 @@ package objectserver
 
 import (
 	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/rateio"
 	"io"
 )
 
+// Compression codecs. The values are recorded on disk and sent over the wire,
+// so they must never change.
+const (
+	CompressionNone = 0
+	CompressionGzip = 1
+)
+
+// ObjectsGetter is the subset of ObjectServer needed to read objects.
+type ObjectsGetter interface {
+	GetObjects(hashes []hash.Hash) (ObjectsReader, error)
+}
+
+// ObjectDeleter is implemented by object servers which can delete objects.
+// DeleteObject returns the number of bytes freed, or 0 if the object did not
+// exist.
+type ObjectDeleter interface {
+	DeleteObject(hashVal hash.Hash) (uint64, error)
+}
+
+// ObjectLister is implemented by object servers which can list their objects.
+// The uncompressed size of each object is returned.
+type ObjectLister interface {
+	ListObjectSizes() map[hash.Hash]uint64
+}
+
+// ObjectVerifier is implemented by object servers which can check that a
+// stored object matches its hash. VerifyObject returns the number of bytes
+// read. If readerContext is not nil it is used to limit the read rate.
+type ObjectVerifier interface {
+	VerifyObject(hashVal hash.Hash, readerContext *rateio.ReaderContext) (
+		uint64, error)
+}
+
 type ObjectsReader interface {
 	Close() error
 	NextObject() (uint64, io.ReadCloser, error)
 }
 
+// CompressedObjectsReader is implemented by objects readers which can return
+// the stored form of objects, which may be compressed.
+type CompressedObjectsReader interface {
+	ObjectsReader
+	// NextCompressedObject returns the length of the stored data, the
+	// compression codec and a reader for the stored data.
+	NextCompressedObject() (uint64, uint, io.ReadCloser, error)
+}
+
+// StorageUsageReporter is implemented by object servers which can report how
+// much storage they use.
+type StorageUsageReporter interface {
+	GetStorageUsage() (StorageUsage, error)
+}
+
+type StorageUsage struct {
+	NumObjects          uint64
+	NumCompressed       uint64 // Number of objects stored compressed.
+	ObjectBytes         uint64 // Total uncompressed size of objects.
+	StoredBytes         uint64 // Total size of stored objects.
+	FileSystemBytes     uint64 // Size of the underlying file-system.
+	FileSystemFreeBytes uint64 // Space available in the file-system.
+}
+
 type ObjectServer interface {
 	AddObject(reader io.Reader, length uint64, expectedHash *hash.Hash) (
 		hash.Hash, bool, error)
@@ -22,3 +80,23 @@ func GetObject(objSrv ObjectServer, hashVal hash.Hash) (
 	uint64, io.ReadCloser, error) {
 	return getObject(objSrv, hashVal)
 }
+
+func CompressionName(compression uint) string {
+	return compressionName(compression)
+}
+
+func NewCompressor(compression uint, writer io.Writer) (io.WriteCloser, error) {
+	return newCompressor(compression, writer)
+}
+
+// NewDecompressor returns a reader which decompresses the data read from
+// reader. Closing it does not close reader.
+func NewDecompressor(compression uint, reader io.Reader) (
+	io.ReadCloser, error) {
+	return newDecompressor(compression, reader)
+}
+
+// ParseCompression returns the compression codec with the specified name.
+func ParseCompression(name string) (uint, error) {
+	return parseCompression(name)
+}
@@ -0,0 +1,93 @@
+/*
+	Package cache implements a pull-through caching object server.
+
+	Objects are fetched on demand from an upstream object server and stored in a
+	local filesystem object server, which is limited in size by evicting the
+	least recently used objects.
+*/
+package cache
+
+import (
+	"container/list"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"io"
+	"log"
+	"sync"
+)
+
+type ObjectServer struct {
+	local      *filesystem.ObjectServer
+	upstream   objectserver.ObjectServer
+	maxSize    uint64 // Zero: unlimited.
+	logger     *log.Logger
+	sync.Mutex // Protect everything below.
+	size       uint64
+	lru        *list.List // Front is most recently used.
+	entries    map[hash.Hash]*list.Element
+	pending    map[hash.Hash]*pendingObject // Being fetched or evicted.
+	stats      Stats
+}
+
+type Stats struct {
+	NumHits      uint64
+	NumMisses    uint64
+	BytesFetched uint64
+	NumEvicted   uint64
+	BytesEvicted uint64
+	FetchErrors  uint64
+}
+
+// NewObjectServer creates a caching object server which stores objects in
+// local and fetches missing objects from upstream. The objects already in local
+// are retained, subject to maxSize (0: unlimited).
+func NewObjectServer(local *filesystem.ObjectServer,
+	upstream objectserver.ObjectServer, maxSize uint64,
+	logger *log.Logger) *ObjectServer {
+	return newObjectServer(local, upstream, maxSize, logger)
+}
+
+// AddObject always fails: the cache is read-only.
+func (objSrv *ObjectServer) AddObject(reader io.Reader, length uint64,
+	expectedHash *hash.Hash) (hash.Hash, bool, error) {
+	return objSrv.addObject(reader, length, expectedHash)
+}
+
+// CheckObjects returns the sizes of the objects, checking with the upstream
+// server for objects which are not cached.
+func (objSrv *ObjectServer) CheckObjects(hashes []hash.Hash) ([]uint64, error) {
+	return objSrv.checkObjects(hashes)
+}
+
+func (objSrv *ObjectServer) GetObject(hashVal hash.Hash) (
+	uint64, io.ReadCloser, error) {
+	return objectserver.GetObject(objSrv, hashVal)
+}
+
+// GetObjects fetches any objects which are not cached and returns a reader for
+// the cached objects. The objects will not be evicted until the reader is
+// closed.
+func (objSrv *ObjectServer) GetObjects(hashes []hash.Hash) (
+	objectserver.ObjectsReader, error) {
+	return objSrv.getObjects(hashes)
+}
+
+// Prefetch fetches any objects which are not cached, without marking cached
+// objects as recently used.
+func (objSrv *ObjectServer) Prefetch(hashes []hash.Hash) error {
+	return objSrv.prefetch(hashes)
+}
+
+func (objSrv *ObjectServer) RegisterMetrics(dir *tricorder.DirectorySpec) error {
+	return objSrv.registerMetrics(dir)
+}
+
+func (objSrv *ObjectServer) Stats() Stats {
+	return objSrv.getStats()
+}
+
+func (objSrv *ObjectServer) WriteHtml(writer io.Writer) {
+	objSrv.writeHtml(writer)
+}
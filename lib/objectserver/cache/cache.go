@@ -0,0 +1,335 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"io"
+	"log"
+)
+
+type cacheEntry struct {
+	hash    hash.Hash
+	size    uint64
+	numPins uint // Pinned objects are not evicted.
+	unused  bool // Fetched but not yet read, so not a cache hit.
+}
+
+// pendingObject tracks an object which is being fetched or evicted. done is
+// closed once the fetch or eviction has completed.
+type pendingObject struct {
+	done chan struct{}
+	err  error // Set if the fetch failed.
+}
+
+type objectsReader struct {
+	objectserver.CompressedObjectsReader
+	objSrv *ObjectServer
+	hashes []hash.Hash
+}
+
+func newObjectServer(local *filesystem.ObjectServer,
+	upstream objectserver.ObjectServer, maxSize uint64,
+	logger *log.Logger) *ObjectServer {
+	objSrv := &ObjectServer{
+		local:    local,
+		upstream: upstream,
+		maxSize:  maxSize,
+		logger:   logger,
+		lru:      list.New(),
+		entries:  make(map[hash.Hash]*list.Element),
+		pending:  make(map[hash.Hash]*pendingObject),
+	}
+	for hashVal, size := range local.ListObjectSizes() {
+		objSrv.entries[hashVal] = objSrv.lru.PushBack(
+			&cacheEntry{hash: hashVal, size: size})
+		objSrv.size += size
+	}
+	objSrv.Lock()
+	evicted := objSrv.evict()
+	objSrv.Unlock()
+	objSrv.deleteEvicted(evicted)
+	return objSrv
+}
+
+func (objSrv *ObjectServer) addObject(reader io.Reader, length uint64,
+	expectedHash *hash.Hash) (hash.Hash, bool, error) {
+	var hashVal hash.Hash
+	return hashVal, false, errors.New("caching object server is read-only")
+}
+
+func (objSrv *ObjectServer) checkObjects(hashes []hash.Hash) ([]uint64, error) {
+	sizes := make([]uint64, len(hashes))
+	var missingHashes []hash.Hash
+	var missingIndices []int
+	objSrv.Lock()
+	for index, hashVal := range hashes {
+		if element, ok := objSrv.entries[hashVal]; ok {
+			sizes[index] = element.Value.(*cacheEntry).size
+		} else {
+			missingHashes = append(missingHashes, hashVal)
+			missingIndices = append(missingIndices, index)
+		}
+	}
+	objSrv.Unlock()
+	if len(missingHashes) < 1 {
+		return sizes, nil
+	}
+	upstreamSizes, err := objSrv.upstream.CheckObjects(missingHashes)
+	if err != nil {
+		return nil, err
+	}
+	for index, size := range upstreamSizes {
+		sizes[missingIndices[index]] = size
+	}
+	return sizes, nil
+}
+
+func (objSrv *ObjectServer) getObjects(hashes []hash.Hash) (
+	objectserver.ObjectsReader, error) {
+	for attempt := 0; ; attempt++ {
+		if err := objSrv.fetchMissing(hashes, false); err != nil {
+			return nil, err
+		}
+		if objSrv.pin(hashes) {
+			break
+		}
+		if attempt >= 2 {
+			return nil, errors.New(
+				"objects evicted before they could be read: cache too small")
+		}
+	}
+	localReader, err := objSrv.local.GetObjects(hashes)
+	if err != nil {
+		objSrv.unpin(hashes)
+		return nil, err
+	}
+	return &objectsReader{
+		CompressedObjectsReader: localReader.(objectserver.CompressedObjectsReader),
+		objSrv:                  objSrv,
+		hashes:                  hashes,
+	}, nil
+}
+
+func (or *objectsReader) Close() error {
+	err := or.CompressedObjectsReader.Close()
+	or.objSrv.unpin(or.hashes)
+	return err
+}
+
+func (objSrv *ObjectServer) prefetch(hashes []hash.Hash) error {
+	return objSrv.fetchMissing(hashes, true)
+}
+
+// pin marks the objects as recently used and prevents them from being
+// evicted. If any object is not cached, nothing is pinned and false is
+// returned.
+func (objSrv *ObjectServer) pin(hashes []hash.Hash) bool {
+	objSrv.Lock()
+	defer objSrv.Unlock()
+	for _, hashVal := range hashes {
+		if _, ok := objSrv.entries[hashVal]; !ok {
+			return false
+		}
+	}
+	for _, hashVal := range hashes {
+		element := objSrv.entries[hashVal]
+		entry := element.Value.(*cacheEntry)
+		entry.numPins++
+		if entry.unused {
+			entry.unused = false
+		} else {
+			objSrv.stats.NumHits++
+		}
+		objSrv.lru.MoveToFront(element)
+	}
+	return true
+}
+
+func (objSrv *ObjectServer) unpin(hashes []hash.Hash) {
+	objSrv.Lock()
+	for _, hashVal := range hashes {
+		if element, ok := objSrv.entries[hashVal]; ok {
+			entry := element.Value.(*cacheEntry)
+			if entry.numPins > 0 {
+				entry.numPins--
+			}
+		}
+	}
+	evicted := objSrv.evict()
+	objSrv.Unlock()
+	objSrv.deleteEvicted(evicted)
+}
+
+// fetchMissing fetches objects which are not cached from the upstream server.
+// Objects which are already being fetched by another caller are waited for
+// rather than fetched again, while unrelated fetches proceed concurrently.
+// An object which was being evicted will still be missing on return, so
+// callers must check.
+func (objSrv *ObjectServer) fetchMissing(hashes []hash.Hash,
+	prefetch bool) error {
+	fetchHashes, waitObjects := objSrv.claimMissing(hashes)
+	if len(fetchHashes) > 0 {
+		err := objSrv.fetch(fetchHashes, prefetch)
+		objSrv.finishFetch(fetchHashes, err)
+		if err != nil {
+			return err
+		}
+	}
+	for _, pending := range waitObjects {
+		<-pending.done
+		if pending.err != nil {
+			return pending.err
+		}
+	}
+	return nil
+}
+
+// claimMissing returns the objects which are not cached and which the caller
+// must fetch, and the pending objects the caller must wait for.
+func (objSrv *ObjectServer) claimMissing(hashes []hash.Hash) (
+	[]hash.Hash, []*pendingObject) {
+	objSrv.Lock()
+	defer objSrv.Unlock()
+	var fetchHashes []hash.Hash
+	var waitObjects []*pendingObject
+	seen := make(map[hash.Hash]struct{}, len(hashes))
+	for _, hashVal := range hashes {
+		if _, ok := seen[hashVal]; ok {
+			continue
+		}
+		seen[hashVal] = struct{}{}
+		if pending, ok := objSrv.pending[hashVal]; ok {
+			waitObjects = append(waitObjects, pending)
+			continue
+		}
+		if _, ok := objSrv.entries[hashVal]; ok {
+			continue
+		}
+		objSrv.pending[hashVal] = &pendingObject{done: make(chan struct{})}
+		fetchHashes = append(fetchHashes, hashVal)
+	}
+	return fetchHashes, waitObjects
+}
+
+// finishFetch wakes the callers waiting for the fetched objects. Those which
+// were not added are failed with err.
+func (objSrv *ObjectServer) finishFetch(hashes []hash.Hash, err error) {
+	objSrv.Lock()
+	defer objSrv.Unlock()
+	if err != nil {
+		objSrv.stats.FetchErrors++
+	}
+	for _, hashVal := range hashes {
+		pending := objSrv.pending[hashVal]
+		delete(objSrv.pending, hashVal)
+		if _, ok := objSrv.entries[hashVal]; !ok {
+			pending.err = err
+		}
+		close(pending.done)
+	}
+}
+
+func (objSrv *ObjectServer) fetch(hashes []hash.Hash, prefetch bool) error {
+	objectsReader, err := objSrv.upstream.GetObjects(hashes)
+	if err != nil {
+		return err
+	}
+	defer objectsReader.Close()
+	for _, hashVal := range hashes {
+		length, reader, err := objectsReader.NextObject()
+		if err != nil {
+			return err
+		}
+		_, _, err = objSrv.local.AddObject(reader, length, &hashVal)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("error adding object: %x: %s", hashVal, err)
+		}
+		objSrv.add(hashVal, length, prefetch)
+	}
+	return nil
+}
+
+func (objSrv *ObjectServer) add(hashVal hash.Hash, size uint64,
+	prefetch bool) {
+	objSrv.Lock()
+	if _, ok := objSrv.entries[hashVal]; ok {
+		objSrv.Unlock()
+		return
+	}
+	entry := &cacheEntry{hash: hashVal, size: size, unused: true}
+	if !prefetch {
+		objSrv.stats.NumMisses++
+	}
+	objSrv.entries[hashVal] = objSrv.lru.PushFront(entry)
+	objSrv.size += size
+	objSrv.stats.BytesFetched += size
+	evicted := objSrv.evict()
+	objSrv.Unlock()
+	objSrv.deleteEvicted(evicted)
+}
+
+// evict removes the least recently used objects which are not pinned until
+// the cache fits within maxSize, and returns them. They remain pending until
+// they are deleted by deleteEvicted, which must be called after the lock is
+// released. This must be called with the lock held.
+func (objSrv *ObjectServer) evict() []*cacheEntry {
+	if objSrv.maxSize < 1 {
+		return nil
+	}
+	var evicted []*cacheEntry
+	element := objSrv.lru.Back()
+	for objSrv.size > objSrv.maxSize && element != nil {
+		entry := element.Value.(*cacheEntry)
+		previous := element.Prev()
+		// Objects still being fetched have only just been added.
+		if _, ok := objSrv.pending[entry.hash]; !ok && entry.numPins < 1 {
+			objSrv.lru.Remove(element)
+			delete(objSrv.entries, entry.hash)
+			objSrv.size -= entry.size
+			objSrv.pending[entry.hash] = &pendingObject{
+				done: make(chan struct{})}
+			evicted = append(evicted, entry)
+		}
+		element = previous
+	}
+	return evicted
+}
+
+// deleteEvicted deletes the evicted objects from the local object server.
+// Objects which could not be deleted are put back as least recently used.
+func (objSrv *ObjectServer) deleteEvicted(evicted []*cacheEntry) {
+	if len(evicted) < 1 {
+		return
+	}
+	deleteErrors := make([]error, len(evicted))
+	for index, entry := range evicted {
+		_, deleteErrors[index] = objSrv.local.DeleteStaleObject(entry.hash, 0)
+	}
+	objSrv.Lock()
+	defer objSrv.Unlock()
+	for index, entry := range evicted {
+		pending := objSrv.pending[entry.hash]
+		delete(objSrv.pending, entry.hash)
+		close(pending.done)
+		if err := deleteErrors[index]; err != nil {
+			objSrv.logger.Printf("Error evicting object: %x: %s\n",
+				entry.hash, err)
+			objSrv.entries[entry.hash] = objSrv.lru.PushBack(entry)
+			objSrv.size += entry.size
+			continue
+		}
+		objSrv.stats.NumEvicted++
+		objSrv.stats.BytesEvicted += entry.size
+	}
+}
+
+func (objSrv *ObjectServer) getStats() Stats {
+	objSrv.Lock()
+	defer objSrv.Unlock()
+	return objSrv.stats
+}
@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/objectserver/filesystem"
+	"github.com/Symantec/Dominator/lib/objectserver/memory"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testUpstream counts the fetches of each object. Fetches which include a
+// blocked object wait until it is unblocked.
+type testUpstream struct {
+	*memory.ObjectServer
+	mutex   sync.Mutex
+	fetches map[hash.Hash]int
+	blocked map[hash.Hash]chan struct{}
+	started chan struct{} // Signalled when a blocked fetch starts.
+}
+
+func newTestUpstream() *testUpstream {
+	return &testUpstream{
+		ObjectServer: memory.NewObjectServer(),
+		fetches:      make(map[hash.Hash]int),
+		blocked:      make(map[hash.Hash]chan struct{}),
+		started:      make(chan struct{}, 10),
+	}
+}
+
+func (upstream *testUpstream) addObject(t *testing.T, data string) hash.Hash {
+	hashVal, _, err := upstream.AddObject(bytes.NewBufferString(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashVal
+}
+
+func (upstream *testUpstream) block(hashVal hash.Hash) chan<- struct{} {
+	upstream.mutex.Lock()
+	defer upstream.mutex.Unlock()
+	unblock := make(chan struct{})
+	upstream.blocked[hashVal] = unblock
+	return unblock
+}
+
+func (upstream *testUpstream) numFetches(hashVal hash.Hash) int {
+	upstream.mutex.Lock()
+	defer upstream.mutex.Unlock()
+	return upstream.fetches[hashVal]
+}
+
+func (upstream *testUpstream) GetObjects(hashes []hash.Hash) (
+	objectserver.ObjectsReader, error) {
+	var waitFor []chan struct{}
+	upstream.mutex.Lock()
+	for _, hashVal := range hashes {
+		upstream.fetches[hashVal]++
+		if unblock, ok := upstream.blocked[hashVal]; ok {
+			waitFor = append(waitFor, unblock)
+		}
+	}
+	upstream.mutex.Unlock()
+	if len(waitFor) > 0 {
+		upstream.started <- struct{}{}
+	}
+	for _, unblock := range waitFor {
+		<-unblock
+	}
+	return upstream.ObjectServer.GetObjects(hashes)
+}
+
+func newTestObjectServer(t *testing.T, upstream *testUpstream,
+	maxSize uint64) *ObjectServer {
+	logger := log.New(ioutil.Discard, "", 0)
+	local, err := filesystem.NewObjectServer(t.TempDir(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newObjectServer(local, upstream, maxSize, logger)
+}
+
+func readObjects(objSrv *ObjectServer, hashes []hash.Hash) error {
+	objectsReader, err := objSrv.GetObjects(hashes)
+	if err != nil {
+		return err
+	}
+	defer objectsReader.Close()
+	for range hashes {
+		_, reader, err := objectsReader.NextObject()
+		if err != nil {
+			return err
+		}
+		_, err = ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func waitStarted(t *testing.T, upstream *testUpstream) {
+	select {
+	case <-upstream.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("blocked fetch did not start")
+	}
+}
+
+func TestConcurrentFetchesOfSameObject(t *testing.T) {
+	upstream := newTestUpstream()
+	hashVal := upstream.addObject(t, "shared object")
+	unblock := upstream.block(hashVal)
+	objSrv := newTestObjectServer(t, upstream, 0)
+	const numReaders = 4
+	errors := make(chan error, numReaders)
+	for i := 0; i < numReaders; i++ {
+		go func() { errors <- readObjects(objSrv, []hash.Hash{hashVal}) }()
+	}
+	waitStarted(t, upstream)
+	close(unblock)
+	for i := 0; i < numReaders; i++ {
+		if err := <-errors; err != nil {
+			t.Error(err)
+		}
+	}
+	if n := upstream.numFetches(hashVal); n != 1 {
+		t.Errorf("object fetched %d times", n)
+	}
+	if stats := objSrv.Stats(); stats.NumMisses != 1 ||
+		stats.NumHits != numReaders-1 {
+		t.Errorf("stats: %+v", stats)
+	}
+}
+
+func TestUnrelatedFetchesRunConcurrently(t *testing.T) {
+	upstream := newTestUpstream()
+	slowHash := upstream.addObject(t, "slow object")
+	fastHash := upstream.addObject(t, "fast object")
+	unblock := upstream.block(slowHash)
+	objSrv := newTestObjectServer(t, upstream, 0)
+	slowError := make(chan error, 1)
+	go func() { slowError <- readObjects(objSrv, []hash.Hash{slowHash}) }()
+	waitStarted(t, upstream)
+	fastError := make(chan error, 1)
+	go func() { fastError <- readObjects(objSrv, []hash.Hash{fastHash}) }()
+	select {
+	case err := <-fastError:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("fetch blocked by an unrelated fetch")
+	}
+	close(unblock)
+	if err := <-slowError; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetchErrorWakesWaiters(t *testing.T) {
+	upstream := newTestUpstream()
+	missingHash := hash.Hash{1}
+	unblock := upstream.block(missingHash)
+	objSrv := newTestObjectServer(t, upstream, 0)
+	const numReaders = 2
+	errors := make(chan error, numReaders)
+	for i := 0; i < numReaders; i++ {
+		go func() { errors <- readObjects(objSrv, []hash.Hash{missingHash}) }()
+	}
+	waitStarted(t, upstream)
+	close(unblock)
+	for i := 0; i < numReaders; i++ {
+		if err := <-errors; err == nil {
+			t.Error("missing object read")
+		}
+	}
+	if len(objSrv.pending) != 0 {
+		t.Errorf("%d objects left pending", len(objSrv.pending))
+	}
+	// Waiters may see the error from the first fetch instead of fetching.
+	if n := upstream.numFetches(missingHash); n < 1 || n > numReaders {
+		t.Errorf("object fetched %d times", n)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	var tests = []struct {
+		name       string
+		maxSize    uint64
+		pinned     bool
+		wantCached []bool
+	}{
+		{"unlimited", 0, false, []bool{true, true, true}},
+		{"room for two", 20, false, []bool{false, true, true}},
+		{"room for one", 10, false, []bool{false, false, true}},
+		{"first pinned", 10, true, []bool{true, false, false}},
+	}
+	for _, test := range tests {
+		upstream := newTestUpstream()
+		hashes := []hash.Hash{
+			upstream.addObject(t, "object 01"),
+			upstream.addObject(t, "object 02"),
+			upstream.addObject(t, "object 03"),
+		}
+		objSrv := newTestObjectServer(t, upstream, test.maxSize)
+		var pinReader objectserver.ObjectsReader
+		for index, hashVal := range hashes {
+			if index == 0 && test.pinned {
+				var err error
+				pinReader, err = objSrv.GetObjects([]hash.Hash{hashVal})
+				if err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			if err := readObjects(objSrv, []hash.Hash{hashVal}); err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+		}
+		numEvicted := uint64(0)
+		local := objSrv.local.ListObjectSizes()
+		for index, hashVal := range hashes {
+			_, cached := local[hashVal]
+			if cached != test.wantCached[index] {
+				t.Errorf("%s: object %d cached: %v", test.name, index, cached)
+			}
+			if _, ok := objSrv.entries[hashVal]; ok != cached {
+				t.Errorf("%s: object %d tracked: %v", test.name, index, ok)
+			}
+			if !cached {
+				numEvicted++
+			}
+		}
+		if stats := objSrv.Stats(); stats.NumEvicted != numEvicted {
+			t.Errorf("%s: evicted: %d, want: %d", test.name,
+				stats.NumEvicted, numEvicted)
+		}
+		if len(objSrv.pending) != 0 {
+			t.Errorf("%s: %d objects left pending", test.name,
+				len(objSrv.pending))
+		}
+		if pinReader != nil {
+			pinReader.Close()
+		}
+	}
+}
+
+func TestNewObjectServerEvicts(t *testing.T) {
+	upstream := newTestUpstream()
+	hashVal := upstream.addObject(t, "object 01")
+	objSrv := newTestObjectServer(t, upstream, 0)
+	if err := objSrv.Prefetch([]hash.Hash{hashVal}); err != nil {
+		t.Fatal(err)
+	}
+	objSrv = newObjectServer(objSrv.local, upstream, 5, objSrv.logger)
+	if size := objSrv.local.ListObjectSizes()[hashVal]; size != 0 {
+		t.Error("object beyond the size limit not evicted")
+	}
+	if objSrv.size != 0 {
+		t.Errorf("size: %d", objSrv.size)
+	}
+}
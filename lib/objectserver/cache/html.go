@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/format"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"github.com/Symantec/tricorder/go/tricorder/units"
+	"io"
+)
+
+func (objSrv *ObjectServer) writeHtml(writer io.Writer) {
+	objSrv.Lock()
+	numObjects := objSrv.lru.Len()
+	size := objSrv.size
+	stats := objSrv.stats
+	objSrv.Unlock()
+	fmt.Fprintf(writer, "Cached objects: %d, consuming %s", numObjects,
+		format.FormatBytes(size))
+	if objSrv.maxSize > 0 {
+		fmt.Fprintf(writer, " of %s", format.FormatBytes(objSrv.maxSize))
+	}
+	fmt.Fprintln(writer, "<br>")
+	hitPercent := 0.0
+	if stats.NumHits+stats.NumMisses > 0 {
+		hitPercent = 100.0 * float64(stats.NumHits) /
+			float64(stats.NumHits+stats.NumMisses)
+	}
+	fmt.Fprintf(writer,
+		"Hits: %d, misses: %d (%.1f%% hit rate), fetched %s<br>\n",
+		stats.NumHits, stats.NumMisses, hitPercent,
+		format.FormatBytes(stats.BytesFetched))
+	fmt.Fprintf(writer, "Evicted: %d objects (%s)", stats.NumEvicted,
+		format.FormatBytes(stats.BytesEvicted))
+	if stats.FetchErrors > 0 {
+		fmt.Fprintf(writer, ", <font color=\"red\">%d fetch errors</font>",
+			stats.FetchErrors)
+	}
+	fmt.Fprintln(writer, "<br>")
+}
+
+func (objSrv *ObjectServer) registerMetrics(
+	dir *tricorder.DirectorySpec) error {
+	err := dir.RegisterMetric("hits",
+		func() uint64 { return objSrv.getStats().NumHits },
+		units.None, "number of object reads satisfied from the cache")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("misses",
+		func() uint64 { return objSrv.getStats().NumMisses },
+		units.None, "number of object reads fetched from upstream")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("bytes-fetched",
+		func() uint64 { return objSrv.getStats().BytesFetched },
+		units.Byte, "number of bytes fetched from upstream")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("evicted-objects",
+		func() uint64 { return objSrv.getStats().NumEvicted },
+		units.None, "number of objects evicted")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("fetch-errors",
+		func() uint64 { return objSrv.getStats().FetchErrors },
+		units.None, "number of failed fetches from upstream")
+	if err != nil {
+		return err
+	}
+	return dir.RegisterMetric("size",
+		func() uint64 {
+			objSrv.Lock()
+			defer objSrv.Unlock()
+			return objSrv.size
+		},
+		units.Byte, "size of cached objects")
+}
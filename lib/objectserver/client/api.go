@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/gob"
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectserver"
@@ -27,6 +28,13 @@ func (objClient *ObjectClient) CheckObjects(hashes []hash.Hash) (
 	return objClient.checkObjects(hashes)
 }
 
+// DeleteObjects deletes objects. The number of bytes freed for each object is
+// returned (0 if the object did not exist).
+func (objClient *ObjectClient) DeleteObjects(hashes []hash.Hash) (
+	[]uint64, error) {
+	return objClient.deleteObjects(hashes)
+}
+
 func (objClient *ObjectClient) GetObject(hashVal hash.Hash) (
 	uint64, io.ReadCloser, error) {
 	return objectserver.GetObject(objClient, hashVal)
@@ -37,14 +45,39 @@ func (objClient *ObjectClient) GetObjects(hashes []hash.Hash) (
 	return objClient.getObjects(hashes)
 }
 
+func (objClient *ObjectClient) GetStorageUsage() (
+	objectserver.StorageUsage, error) {
+	return objClient.getStorageUsage()
+}
+
+// ListObjects calls objectFunc for each object on the server, as the list is
+// received. If objectFunc returns an error, listing stops and the error is
+// returned.
+func (objClient *ObjectClient) ListObjects(
+	objectFunc func(hashVal hash.Hash, size uint64) error) error {
+	return objClient.listObjects(objectFunc)
+}
+
 func (objClient *ObjectClient) SetExclusiveGetObjects(exclusive bool) {
 	objClient.exclusiveGet = exclusive
 }
 
+// VerifyObjects asks the server to check that objects match their hashes. If
+// hashes is empty, all objects are verified. The server limits its read rate
+// to maxBytesPerSecond (0: the server maximum). failFunc is called for each
+// object which fails verification. The number of objects verified is
+// returned.
+func (objClient *ObjectClient) VerifyObjects(hashes []hash.Hash,
+	maxBytesPerSecond uint64,
+	failFunc func(hashVal hash.Hash, err error)) (uint64, error) {
+	return objClient.verifyObjects(hashes, maxBytesPerSecond, failFunc)
+}
+
 type ObjectsReader struct {
 	sizes     []uint64
 	client    *srpc.Client
 	reader    io.Reader
+	decoder   *gob.Decoder // Only set if objects are sent compressed.
 	nextIndex int64
 }
 
@@ -65,7 +98,14 @@ type ObjectAdderQueue struct {
 }
 
 func NewObjectAdderQueue(client *srpc.Client) (*ObjectAdderQueue, error) {
-	return newObjectAdderQueue(client)
+	return newObjectAdderQueue(context.Background(), client)
+}
+
+// NewObjectAdderQueueContext is like NewObjectAdderQueue, except that the queue
+// is abandoned if ctx is cancelled or its deadline passes.
+func NewObjectAdderQueueContext(ctx context.Context, client *srpc.Client) (
+	*ObjectAdderQueue, error) {
+	return newObjectAdderQueue(ctx, client)
 }
 
 func (objQ *ObjectAdderQueue) Add(reader io.Reader, length uint64) (
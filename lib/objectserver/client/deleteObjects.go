@@ -0,0 +1,24 @@
+package client
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/objectserver"
+)
+
+func (objClient *ObjectClient) deleteObjects(hashes []hash.Hash) (
+	[]uint64, error) {
+	request := objectserver.DeleteObjectsRequest{Hashes: hashes}
+	var reply objectserver.DeleteObjectsResponse
+	client, err := srpc.DialHTTP("tcp", objClient.address, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error dialing: %s\n", err)
+	}
+	defer client.Close()
+	err = client.RequestReply("ObjectServer.DeleteObjects", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.SizesFreed, nil
+}
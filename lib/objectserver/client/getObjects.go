@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Symantec/Dominator/lib/hash"
+	objectserverlib "github.com/Symantec/Dominator/lib/objectserver"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/objectserver"
 	"io"
@@ -23,6 +24,7 @@ func (objClient *ObjectClient) getObjects(hashes []hash.Hash) (
 	}
 	var request objectserver.GetObjectsRequest
 	var reply objectserver.GetObjectsResponse
+	request.AcceptCompressed = true
 	request.Exclusive = objClient.exclusiveGet
 	request.Hashes = hashes
 	encoder := gob.NewEncoder(conn)
@@ -41,6 +43,9 @@ func (objClient *ObjectClient) getObjects(hashes []hash.Hash) (
 	}
 	objectsReader.nextIndex = -1
 	objectsReader.sizes = reply.ObjectSizes
+	if reply.Compressed {
+		objectsReader.decoder = decoder
+	}
 	return &objectsReader, nil
 }
 
@@ -50,6 +55,34 @@ func (or *ObjectsReader) nextObject() (uint64, io.ReadCloser, error) {
 		return 0, nil, errors.New("all objects have been consumed")
 	}
 	size := or.sizes[or.nextIndex]
-	return size,
-		ioutil.NopCloser(&io.LimitedReader{or.reader, int64(size)}), nil
+	if or.decoder == nil {
+		return size,
+			ioutil.NopCloser(&io.LimitedReader{or.reader, int64(size)}), nil
+	}
+	var header objectserver.GetObjectHeader
+	if err := or.decoder.Decode(&header); err != nil {
+		return 0, nil, err
+	}
+	stored := &io.LimitedReader{R: or.reader, N: int64(header.Length)}
+	decompressor, err := objectserverlib.NewDecompressor(header.Compression,
+		stored)
+	if err != nil {
+		return 0, nil, err
+	}
+	return size, &compressedObjectReader{decompressor, stored}, nil
+}
+
+// compressedObjectReader discards any unread stored data on Close, so that the
+// stream is positioned at the next object.
+type compressedObjectReader struct {
+	io.ReadCloser
+	stored *io.LimitedReader
+}
+
+func (reader *compressedObjectReader) Close() error {
+	err := reader.ReadCloser.Close()
+	if _, e := io.Copy(ioutil.Discard, reader.stored); e != nil && err == nil {
+		err = e
+	}
+	return err
 }
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	objectserverlib "github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/proto/objectserver"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// makeCompressedStream returns a reader for the objects as a server sends
+// them when compression is accepted: each one preceded by a GetObjectHeader.
+func makeCompressedStream(t *testing.T, objects []string,
+	compression []uint) *ObjectsReader {
+	buffer := &bytes.Buffer{}
+	encoder := gob.NewEncoder(buffer)
+	sizes := make([]uint64, 0, len(objects))
+	for index, data := range objects {
+		stored := &bytes.Buffer{}
+		compressor, err := objectserverlib.NewCompressor(compression[index],
+			stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressor.Write([]byte(data))
+		if err := compressor.Close(); err != nil {
+			t.Fatal(err)
+		}
+		err = encoder.Encode(objectserver.GetObjectHeader{
+			Compression: compression[index],
+			Length:      uint64(stored.Len()),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer.Write(stored.Bytes())
+		sizes = append(sizes, uint64(len(data)))
+	}
+	return &ObjectsReader{
+		sizes:     sizes,
+		reader:    buffer,
+		decoder:   gob.NewDecoder(buffer),
+		nextIndex: -1,
+	}
+}
+
+func TestNextCompressedObject(t *testing.T) {
+	objects := []string{
+		strings.Repeat("compressible ", 1000),
+		"plain object",
+		strings.Repeat("partly read ", 1000),
+		"last object",
+	}
+	objectsReader := makeCompressedStream(t, objects, []uint{
+		objectserverlib.CompressionGzip,
+		objectserverlib.CompressionNone,
+		objectserverlib.CompressionGzip,
+		objectserverlib.CompressionNone,
+	})
+	for index, want := range objects {
+		length, reader, err := objectsReader.nextObject()
+		if err != nil {
+			t.Fatalf("object %d: %s", index, err)
+		}
+		if length != uint64(len(want)) {
+			t.Errorf("object %d: length: %d, want: %d", index, length,
+				len(want))
+		}
+		if index == 2 {
+			// Closing early must skip the rest of the stored data.
+			buffer := make([]byte, 10)
+			if _, err := reader.Read(buffer); err != nil {
+				t.Fatal(err)
+			}
+			reader.Close()
+			continue
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("object %d: %s", index, err)
+		}
+		if string(data) != want {
+			t.Errorf("object %d: got: %q", index, data)
+		}
+	}
+	if _, _, err := objectsReader.nextObject(); err == nil {
+		t.Error("read beyond the last object")
+	}
+}
+
+func TestNextObjectUnknownCompression(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	err := gob.NewEncoder(buffer).Encode(objectserver.GetObjectHeader{
+		Compression: 100, Length: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer.WriteString("data")
+	objectsReader := &ObjectsReader{
+		sizes:     []uint64{4},
+		reader:    buffer,
+		decoder:   gob.NewDecoder(buffer),
+		nextIndex: -1,
+	}
+	if _, _, err := objectsReader.nextObject(); err == nil {
+		t.Error("unknown compression accepted")
+	}
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"fmt"
+	objectserverlib "github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/objectserver"
+)
+
+func (objClient *ObjectClient) getStorageUsage() (
+	objectserverlib.StorageUsage, error) {
+	var usage objectserverlib.StorageUsage
+	var reply objectserver.GetStorageUsageResponse
+	client, err := srpc.DialHTTP("tcp", objClient.address, 0)
+	if err != nil {
+		return usage, fmt.Errorf("error dialing: %s\n", err)
+	}
+	defer client.Close()
+	err = client.RequestReply("ObjectServer.GetStorageUsage",
+		objectserver.GetStorageUsageRequest{}, &reply)
+	if err != nil {
+		return usage, err
+	}
+	return objectserverlib.StorageUsage{
+		NumObjects:          reply.NumObjects,
+		NumCompressed:       reply.NumCompressed,
+		ObjectBytes:         reply.ObjectBytes,
+		StoredBytes:         reply.StoredBytes,
+		FileSystemBytes:     reply.FileSystemBytes,
+		FileSystemFreeBytes: reply.FileSystemFreeBytes,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/objectserver"
+)
+
+func (objClient *ObjectClient) listObjects(
+	objectFunc func(hashVal hash.Hash, size uint64) error) error {
+	client, err := srpc.DialHTTP("tcp", objClient.address, 0)
+	if err != nil {
+		return fmt.Errorf("error dialing: %s\n", err)
+	}
+	defer client.Close()
+	conn, err := client.Call("ObjectServer.ListObjects")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	decoder := gob.NewDecoder(conn)
+	for {
+		var response objectserver.ListObjectsResponse
+		if err := decoder.Decode(&response); err != nil {
+			return errors.New("error decoding: " + err.Error())
+		}
+		if response.Error != "" {
+			return errors.New(response.Error)
+		}
+		if len(response.Objects) < 1 {
+			return nil
+		}
+		for _, object := range response.Objects {
+			if err := objectFunc(object.Hash, object.Size); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"crypto/sha512"
 	"encoding/gob"
 	"errors"
@@ -11,10 +12,11 @@ import (
 	"io"
 )
 
-func newObjectAdderQueue(client *srpc.Client) (*ObjectAdderQueue, error) {
+func newObjectAdderQueue(ctx context.Context, client *srpc.Client) (
+	*ObjectAdderQueue, error) {
 	var objQ ObjectAdderQueue
 	var err error
-	objQ.conn, err = client.Call("ObjectServer.AddObjects")
+	objQ.conn, err = client.CallContext(ctx, "ObjectServer.AddObjects")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/proto/objectserver"
+)
+
+func (objClient *ObjectClient) verifyObjects(hashes []hash.Hash,
+	maxBytesPerSecond uint64,
+	failFunc func(hashVal hash.Hash, err error)) (uint64, error) {
+	client, err := srpc.DialHTTP("tcp", objClient.address, 0)
+	if err != nil {
+		return 0, fmt.Errorf("error dialing: %s\n", err)
+	}
+	defer client.Close()
+	conn, err := client.Call("ObjectServer.VerifyObjects")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	request := objectserver.VerifyObjectsRequest{
+		Hashes:            hashes,
+		MaxBytesPerSecond: maxBytesPerSecond,
+	}
+	if err := gob.NewEncoder(conn).Encode(request); err != nil {
+		return 0, err
+	}
+	if err := conn.Flush(); err != nil {
+		return 0, err
+	}
+	decoder := gob.NewDecoder(conn)
+	for {
+		var response objectserver.VerifyObjectsResponse
+		if err := decoder.Decode(&response); err != nil {
+			return 0, errors.New("error decoding: " + err.Error())
+		}
+		if response.Done {
+			if response.Error != "" {
+				return 0, errors.New(response.Error)
+			}
+			return response.NumVerified, nil
+		}
+		failFunc(response.Hash, errors.New(response.Error))
+	}
+}
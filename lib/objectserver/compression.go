@@ -0,0 +1,74 @@
+package objectserver
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+type codec struct {
+	name      string
+	newReader func(io.Reader) (io.ReadCloser, error)
+	newWriter func(io.Writer) io.WriteCloser
+}
+
+var codecs = map[uint]codec{
+	CompressionNone: {
+		name: "none",
+		newReader: func(reader io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(reader), nil
+		},
+		newWriter: func(writer io.Writer) io.WriteCloser {
+			return nopWriteCloser{writer}
+		},
+	},
+	CompressionGzip: {
+		name: "gzip",
+		newReader: func(reader io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(reader)
+		},
+		newWriter: func(writer io.Writer) io.WriteCloser {
+			return gzip.NewWriter(writer)
+		},
+	},
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressionName(compression uint) string {
+	if codec, ok := codecs[compression]; ok {
+		return codec.name
+	}
+	return "unknown"
+}
+
+func newCompressor(compression uint, writer io.Writer) (
+	io.WriteCloser, error) {
+	if codec, ok := codecs[compression]; ok {
+		return codec.newWriter(writer), nil
+	}
+	return nil, fmt.Errorf("unknown compression: %d", compression)
+}
+
+func newDecompressor(compression uint, reader io.Reader) (
+	io.ReadCloser, error) {
+	if codec, ok := codecs[compression]; ok {
+		return codec.newReader(reader)
+	}
+	return nil, fmt.Errorf("unknown compression: %d", compression)
+}
+
+func parseCompression(name string) (uint, error) {
+	for compression, codec := range codecs {
+		if codec.name == name {
+			return compression, nil
+		}
+	}
+	return 0, errors.New("unknown compression: " + name)
+}
@@ -0,0 +1,82 @@
+package objectserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseCompression(t *testing.T) {
+	var tests = []struct {
+		name        string
+		compression uint
+		wantError   bool
+	}{
+		{"none", CompressionNone, false},
+		{"gzip", CompressionGzip, false},
+		{"zip", 0, true},
+	}
+	for _, test := range tests {
+		compression, err := ParseCompression(test.name)
+		if gotError := err != nil; gotError != test.wantError {
+			t.Errorf("%s: error: %v", test.name, err)
+		}
+		if err != nil {
+			continue
+		}
+		if compression != test.compression {
+			t.Errorf("%s: got: %d, want: %d", test.name, compression,
+				test.compression)
+		}
+		if name := CompressionName(compression); name != test.name {
+			t.Errorf("CompressionName(%d)=%s, want: %s", compression, name,
+				test.name)
+		}
+	}
+	if name := CompressionName(100); name != "unknown" {
+		t.Errorf("CompressionName(100)=%s", name)
+	}
+}
+
+func TestCompressorRoundTrip(t *testing.T) {
+	data := strings.Repeat("compressible data ", 1000)
+	for _, compression := range []uint{CompressionNone, CompressionGzip} {
+		buffer := &bytes.Buffer{}
+		compressor, err := NewCompressor(compression, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := compressor.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := compressor.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if compression != CompressionNone && buffer.Len() >= len(data) {
+			t.Errorf("%s: %d bytes compressed to %d",
+				CompressionName(compression), len(data), buffer.Len())
+		}
+		decompressor, err := NewDecompressor(compression, buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(decompressor)
+		decompressor.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("%s: data not preserved", CompressionName(compression))
+		}
+	}
+}
+
+func TestUnknownCompression(t *testing.T) {
+	if _, err := NewCompressor(100, &bytes.Buffer{}); err == nil {
+		t.Error("NewCompressor accepted unknown compression")
+	}
+	if _, err := NewDecompressor(100, &bytes.Buffer{}); err == nil {
+		t.Error("NewDecompressor accepted unknown compression")
+	}
+}
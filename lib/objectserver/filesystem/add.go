@@ -3,83 +3,184 @@ package filesystem
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha512"
 	"errors"
 	"fmt"
-	"github.com/Symantec/Dominator/lib/fsutil"
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectcache"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"syscall"
+	"time"
 )
 
 const (
 	filePerms = syscall.S_IRUSR | syscall.S_IWUSR | syscall.S_IRGRP
 	buflen    = 65536
+	// Objects are streamed into this subdirectory while they are being added.
+	temporaryDirectory = ".tmp"
 )
 
 func (objSrv *ObjectServer) addObject(reader io.Reader, length uint64,
 	expectedHash *hash.Hash) (hash.Hash, bool, error) {
-	hashVal, data, err := objectcache.ReadObject(reader, length, expectedHash)
+	var hashVal hash.Hash
+	tmpDir := path.Join(objSrv.baseDir, temporaryDirectory)
+	if err := os.MkdirAll(tmpDir, syscall.S_IRWXU); err != nil {
+		return hashVal, false, err
+	}
+	tmpFile, err := ioutil.TempFile(tmpDir, "object")
 	if err != nil {
 		return hashVal, false, err
 	}
-	length = uint64(len(data))
-	filename := path.Join(objSrv.baseDir, objectcache.HashToFilename(hashVal))
+	tmpFilename := tmpFile.Name()
+	// Clean up partial uploads. This fails harmlessly after the rename.
+	defer os.Remove(tmpFilename)
+	hashVal, length, err = writeObject(tmpFile, reader, length, expectedHash)
+	if err != nil {
+		tmpFile.Close()
+		return hashVal, false, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return hashVal, false, err
+	}
 	// Check for existing object and collision.
-	fi, err := os.Lstat(filename)
+	existingFilename, fi, _, err := objSrv.findObject(hashVal)
 	if err == nil {
 		if !fi.Mode().IsRegular() {
-			return hashVal, false, errors.New("Existing non-file: " + filename)
+			return hashVal, false,
+				errors.New("Existing non-file: " + existingFilename)
 		}
-		if err := collisionCheck(data, filename, fi.Size()); err != nil {
+		if err := objSrv.collisionCheck(tmpFilename, length,
+			hashVal); err != nil {
 			return hashVal, false, errors.New(
 				"Collision detected: " + err.Error())
 		}
-		// No collision and no error: it's the same object. Go home early.
-		return hashVal, false, nil
+		// No collision and no error: it's the same object. Refresh the
+		// modification time so that the garbage collector grace period
+		// protects it. If it was deleted in the meantime, write it again.
+		if err := objSrv.touchObject(existingFilename); err == nil {
+			return hashVal, false, nil
+		} else if !os.IsNotExist(err) {
+			return hashVal, false, err
+		}
+	} else if !os.IsNotExist(err) {
+		return hashVal, false, err
+	}
+	filename := path.Join(objSrv.baseDir, objectcache.HashToFilename(hashVal))
+	compressedFilename, err := objSrv.compressObject(tmpDir, tmpFilename,
+		length)
+	if err != nil {
+		return hashVal, false, err
+	}
+	if compressedFilename != "" {
+		defer os.Remove(compressedFilename)
+		tmpFilename = compressedFilename
+		filename += compressedSuffix
 	}
 	if err = os.MkdirAll(path.Dir(filename), syscall.S_IRWXU); err != nil {
 		return hashVal, false, err
 	}
-	if err := fsutil.CopyToFile(filename, filePerms, bytes.NewReader(data),
-		length); err != nil {
+	if err := os.Rename(tmpFilename, filename); err != nil {
 		return hashVal, false, err
 	}
 	objSrv.rwLock.Lock()
-	objSrv.sizesMap[hashVal] = uint64(len(data))
+	objSrv.sizesMap[hashVal] = length
 	objSrv.rwLock.Unlock()
 	return hashVal, true, nil
 }
 
-func collisionCheck(data []byte, filename string, size int64) error {
-	file, err := os.Open(filename)
+// writeObject copies the object data to file while computing the hash, so that
+// memory use does not depend on the object size. If length is 0 the data are
+// read until EOF. The hash and length of the object are returned.
+func writeObject(file *os.File, reader io.Reader, length uint64,
+	expectedHash *hash.Hash) (hash.Hash, uint64, error) {
+	var hashVal hash.Hash
+	if err := file.Chmod(filePerms); err != nil {
+		return hashVal, 0, err
+	}
+	hasher := sha512.New()
+	if hasher.Size() != len(hashVal) {
+		return hashVal, 0, errors.New("incompatible hash size")
+	}
+	writer := bufio.NewWriterSize(file, buflen)
+	var nCopied int64
+	var err error
+	if length < 1 {
+		nCopied, err = io.Copy(io.MultiWriter(writer, hasher), reader)
+		if err != nil {
+			return hashVal, 0, err
+		}
+		if nCopied < 1 {
+			return hashVal, 0, errors.New("zero length object cannot be added")
+		}
+	} else {
+		nCopied, err = io.CopyN(io.MultiWriter(writer, hasher), reader,
+			int64(length))
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return hashVal, 0, fmt.Errorf(
+				"failed to read data, wanted: %d, got: %d bytes: %s",
+				length, nCopied, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return hashVal, 0, err
+	}
+	copy(hashVal[:], hasher.Sum(nil))
+	if expectedHash != nil {
+		if hashVal != *expectedHash {
+			return hashVal, 0, fmt.Errorf(
+				"hash mismatch. Computed=%x, expected=%x",
+				hashVal, *expectedHash)
+		}
+	}
+	return hashVal, uint64(nCopied), nil
+}
+
+func (objSrv *ObjectServer) collisionCheck(newFilename string, newSize uint64,
+	hashVal hash.Hash) error {
+	size, file, err := objSrv.openObject(hashVal)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	if int64(len(data)) != size {
+	if newSize != size {
 		return errors.New(fmt.Sprintf(
-			"length mismatch. Data=%d, existing object=%d",
-			len(data), size))
-	}
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, 0, buflen)
-	for len(data) > 0 {
-		numToRead := len(data)
-		if numToRead > cap(buffer) {
-			numToRead = cap(buffer)
+			"length mismatch. Data=%d, existing object=%d", newSize, size))
+	}
+	newFile, err := os.Open(newFilename)
+	if err != nil {
+		return err
+	}
+	defer newFile.Close()
+	newBuffer := make([]byte, buflen)
+	buffer := make([]byte, buflen)
+	for size > 0 {
+		numToRead := uint64(buflen)
+		if numToRead > size {
+			numToRead = size
 		}
-		buf := buffer[:numToRead]
-		nread, err := reader.Read(buf)
-		if err != nil {
+		if _, err := io.ReadFull(newFile, newBuffer[:numToRead]); err != nil {
 			return err
 		}
-		if bytes.Compare(data[:nread], buf[:nread]) != 0 {
+		if _, err := io.ReadFull(file, buffer[:numToRead]); err != nil {
+			return err
+		}
+		if !bytes.Equal(newBuffer[:numToRead], buffer[:numToRead]) {
 			return errors.New("content mismatch")
 		}
-		data = data[nread:]
+		size -= numToRead
 	}
 	return nil
 }
+
+func (objSrv *ObjectServer) touchObject(filename string) error {
+	objSrv.rwLock.Lock()
+	defer objSrv.rwLock.Unlock()
+	now := time.Now()
+	return os.Chtimes(filename, now, now)
+}
@@ -0,0 +1,149 @@
+package filesystem
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectcache"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func (objSrv *ObjectServer) readTestObject(t *testing.T,
+	hashVal hash.Hash) string {
+	objectsReader, err := objSrv.GetObjects([]hash.Hash{hashVal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer objectsReader.Close()
+	length, reader, err := objectsReader.NextObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(data)) != length {
+		t.Errorf("read: %d bytes, length: %d", len(data), length)
+	}
+	return string(data)
+}
+
+// countTemporaryFiles returns the number of partial uploads left behind.
+func (objSrv *ObjectServer) countTemporaryFiles() int {
+	names, _ := ioutil.ReadDir(path.Join(objSrv.baseDir, temporaryDirectory))
+	return len(names)
+}
+
+func TestAddObject(t *testing.T) {
+	const data = "object data"
+	goodHash := hash.Hash(sha512.Sum512([]byte(data)))
+	badHash := hash.Hash{1}
+	var tests = []struct {
+		name         string
+		data         string
+		length       uint64
+		expectedHash *hash.Hash
+		wantError    string
+	}{
+		{name: "known length", data: data, length: uint64(len(data))},
+		{name: "read until EOF", data: data},
+		{name: "expected hash", data: data, length: uint64(len(data)),
+			expectedHash: &goodHash},
+		{name: "length beyond data", data: data, length: 100,
+			wantError: "wanted: 100, got: 11 bytes"},
+		{name: "zero length", wantError: "zero length object"},
+		{name: "hash mismatch", data: data, length: uint64(len(data)),
+			expectedHash: &badHash, wantError: "hash mismatch"},
+	}
+	for _, test := range tests {
+		objSrv := newTestObjectServer(t)
+		hashVal, isNew, err := objSrv.AddObject(
+			bytes.NewBufferString(test.data), test.length, test.expectedHash)
+		if objSrv.countTemporaryFiles() != 0 {
+			t.Errorf("%s: temporary files left behind", test.name)
+		}
+		if test.wantError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("%s: error: %v, want: %s", test.name, err,
+					test.wantError)
+			}
+			if len(objSrv.ListObjects()) != 0 {
+				t.Errorf("%s: object stored", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if hashVal != goodHash || !isNew {
+			t.Errorf("%s: hash: %x, new: %v", test.name, hashVal, isNew)
+		}
+		if got := objSrv.readTestObject(t, hashVal); got != data {
+			t.Errorf("%s: read: %q", test.name, got)
+		}
+	}
+}
+
+func TestAddExistingObject(t *testing.T) {
+	objSrv := newTestObjectServer(t)
+	hashVal := objSrv.addTestObject(t, "object data")
+	filename := path.Join(objSrv.baseDir, objectcache.HashToFilename(hashVal))
+	oldTime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filename, oldTime, oldTime); err != nil {
+		t.Fatal(err)
+	}
+	_, isNew, err := objSrv.AddObject(bytes.NewBufferString("object data"),
+		0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNew {
+		t.Error("existing object added again")
+	}
+	// The garbage collection grace period must restart.
+	if fi, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if !fi.ModTime().After(oldTime) {
+		t.Errorf("modification time not refreshed: %s", fi.ModTime())
+	}
+	objSrv.corruptTestObject(t, hashVal, "OBJECT DATA")
+	_, _, err = objSrv.AddObject(bytes.NewBufferString("object data"), 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "Collision detected") {
+		t.Errorf("error: %v", err)
+	}
+}
+
+func TestNewObjectServerRemovesPartialUploads(t *testing.T) {
+	objSrv := newTestObjectServer(t)
+	hashVal := objSrv.addTestObject(t, "object data")
+	tmpDir := path.Join(objSrv.baseDir, temporaryDirectory)
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	err := ioutil.WriteFile(path.Join(tmpDir, "object123"), []byte("part"),
+		0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objSrv, err = NewObjectServer(objSrv.baseDir,
+		log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objSrv.countTemporaryFiles() != 0 {
+		t.Error("partial upload not removed")
+	}
+	sizes := objSrv.ListObjectSizes()
+	if len(sizes) != 1 || sizes[hashVal] != uint64(len("object data")) {
+		t.Errorf("objects: %v", sizes)
+	}
+}
@@ -3,16 +3,34 @@ package filesystem
 import (
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/rateio"
+	"github.com/Symantec/tricorder/go/tricorder"
 	"io"
 	"log"
 	"sync"
+	"time"
 )
 
+// QuarantineDirectory is the subdirectory of the object directory which holds
+// objects which failed verification.
+const QuarantineDirectory = ".quarantine"
+
 type ObjectServer struct {
-	baseDir  string
-	rwLock   sync.RWMutex         // Protect map mutations.
-	sizesMap map[hash.Hash]uint64 // Only set if object is known.
-	logger   *log.Logger
+	baseDir     string
+	compression CompressionParams
+	rwLock      sync.RWMutex         // Protect map mutations.
+	sizesMap    map[hash.Hash]uint64 // Only set if object is known.
+	logger      *log.Logger
+}
+
+// CompressionParams controls which new objects are stored compressed.
+// Objects are always addressed by the hash of their uncompressed data.
+type CompressionParams struct {
+	Compression uint   // objectserver.Compression* codec.
+	MinSize     uint64 // Smaller objects are not compressed.
+	// Objects which do not compress to at most MaxRatio of their size are
+	// stored uncompressed. Default: 0.9.
+	MaxRatio float64
 }
 
 func NewObjectServer(baseDir string, logger *log.Logger) (
@@ -29,6 +47,27 @@ func (objSrv *ObjectServer) CheckObjects(hashes []hash.Hash) ([]uint64, error) {
 	return objSrv.checkObjects(hashes)
 }
 
+// CheckStaleObject returns the size of the object if it exists and has not
+// been added (or re-added) within gracePeriod, else it returns 0.
+func (objSrv *ObjectServer) CheckStaleObject(hashVal hash.Hash,
+	gracePeriod time.Duration) (uint64, error) {
+	return objSrv.checkStaleObject(hashVal, gracePeriod)
+}
+
+// DeleteStaleObject will delete the object if it has not been added (or
+// re-added) within gracePeriod. The size of the deleted object is returned,
+// or 0 if the object was not deleted.
+func (objSrv *ObjectServer) DeleteStaleObject(hashVal hash.Hash,
+	gracePeriod time.Duration) (uint64, error) {
+	return objSrv.deleteStaleObject(hashVal, gracePeriod)
+}
+
+// DeleteObject deletes the object, ignoring the grace period. The size of the
+// deleted object is returned, or 0 if the object did not exist.
+func (objSrv *ObjectServer) DeleteObject(hashVal hash.Hash) (uint64, error) {
+	return objSrv.deleteObject(hashVal)
+}
+
 func (objSrv *ObjectServer) GetObject(hashVal hash.Hash) (
 	uint64, io.ReadCloser, error) {
 	return objectserver.GetObject(objSrv, hashVal)
@@ -39,6 +78,22 @@ func (objSrv *ObjectServer) GetObjects(hashes []hash.Hash) (
 	return objSrv.getObjects(hashes)
 }
 
+// GetStorageUsage returns the number and size of stored objects and the size
+// of the underlying file-system.
+func (objSrv *ObjectServer) GetStorageUsage() (
+	objectserver.StorageUsage, error) {
+	return objSrv.getStorageUsage()
+}
+
+// SetCompression sets the compression parameters for new objects. It must be
+// called before objects are added.
+func (objSrv *ObjectServer) SetCompression(params CompressionParams) {
+	if params.MaxRatio <= 0 {
+		params.MaxRatio = 0.9
+	}
+	objSrv.compression = params
+}
+
 func (objSrv *ObjectServer) ListObjectSizes() map[hash.Hash]uint64 {
 	return objSrv.listObjectSizes()
 }
@@ -53,6 +108,80 @@ func (objSrv *ObjectServer) NumObjects() uint64 {
 	return uint64(len(objSrv.sizesMap))
 }
 
+// VerifyObject reads the object and checks that its data match its hash. The
+// number of bytes read is returned. If readerContext is not nil it is used to
+// limit the read rate.
+func (objSrv *ObjectServer) VerifyObject(hashVal hash.Hash,
+	readerContext *rateio.ReaderContext) (uint64, error) {
+	return objSrv.verifyObject(hashVal, readerContext)
+}
+
+// ScrubberParams configures the scrubber, which periodically re-reads every
+// object and checks its hash.
+type ScrubberParams struct {
+	Interval          time.Duration // Minimum time between starting passes.
+	MaxBytesPerSecond uint64        // 0: no limit.
+	// Replica, if not nil, is used to fetch a good copy of corrupt objects.
+	Replica objectserver.ObjectsGetter
+}
+
+type Scrubber struct {
+	objSrv        *ObjectServer
+	params        ScrubberParams
+	readerContext *rateio.ReaderContext
+	rwLock        sync.RWMutex // Protect everything below.
+	stats         ScrubberStats
+	findings      []ScrubFinding
+}
+
+type ScrubberStats struct {
+	NumPasses        uint64
+	PassStartTime    time.Time // Zero if no pass is in progress.
+	PassObjects      uint64    // Number of objects in the current pass.
+	PassObjectsDone  uint64
+	LastPassDuration time.Duration
+	LastPassFinished time.Time
+	ObjectsScrubbed  uint64 // Totals since startup.
+	BytesScrubbed    uint64
+	NumCorrupt       uint64
+	NumRepaired      uint64
+	NumErrors        uint64
+}
+
+// ScrubFinding records a problem found with an object.
+type ScrubFinding struct {
+	Time     time.Time
+	Hash     hash.Hash
+	Error    error // Why the object was rejected, or the read error.
+	Repaired bool
+}
+
+// StartScrubber starts a goroutine which verifies objects in the background.
+// If a replica is specified, corrupt objects are moved into the
+// QuarantineDirectory and a good copy is fetched. Otherwise corrupt objects are
+// left in place and only reported.
+func (objSrv *ObjectServer) StartScrubber(params ScrubberParams) *Scrubber {
+	return objSrv.startScrubber(params)
+}
+
+// Findings returns the most recent problems found by the scrubber.
+func (s *Scrubber) Findings() []ScrubFinding {
+	return s.getFindings()
+}
+
+// RegisterMetrics registers the scrubber metrics in dir.
+func (s *Scrubber) RegisterMetrics(dir *tricorder.DirectorySpec) error {
+	return s.registerMetrics(dir)
+}
+
+func (s *Scrubber) Stats() ScrubberStats {
+	return s.getStats()
+}
+
+func (s *Scrubber) WriteHtml(writer io.Writer) {
+	s.writeHtml(writer)
+}
+
 type ObjectsReader struct {
 	objectServer *ObjectServer
 	hashes       []hash.Hash
@@ -66,3 +195,10 @@ func (or *ObjectsReader) Close() error {
 func (or *ObjectsReader) NextObject() (uint64, io.ReadCloser, error) {
 	return or.nextObject()
 }
+
+// NextCompressedObject returns the length of the stored data for the next
+// object, its compression codec and a reader for the stored data.
+func (or *ObjectsReader) NextCompressedObject() (
+	uint64, uint, io.ReadCloser, error) {
+	return or.nextCompressedObject()
+}
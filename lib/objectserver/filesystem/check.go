@@ -4,9 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Symantec/Dominator/lib/hash"
-	"github.com/Symantec/Dominator/lib/objectcache"
-	"os"
-	"path"
 )
 
 func (objSrv *ObjectServer) checkObjects(hashes []hash.Hash) ([]uint64, error) {
@@ -28,8 +25,7 @@ func (objSrv *ObjectServer) checkObject(hash hash.Hash) (uint64, error) {
 	if ok {
 		return size, nil
 	}
-	filename := path.Join(objSrv.baseDir, objectcache.HashToFilename(hash))
-	fi, err := os.Lstat(filename)
+	filename, fi, compressed, err := objSrv.findObject(hash)
 	if err != nil {
 		return 0, nil
 	}
@@ -37,7 +33,10 @@ func (objSrv *ObjectServer) checkObject(hash hash.Hash) (uint64, error) {
 		if fi.Size() < 1 {
 			return 0, errors.New(fmt.Sprintf("zero length file: %s", filename))
 		}
-		size := uint64(fi.Size())
+		size, err := objectLength(filename, fi, compressed)
+		if err != nil {
+			return 0, err
+		}
 		objSrv.rwLock.Lock()
 		objSrv.sizesMap[hash] = size
 		objSrv.rwLock.Unlock()
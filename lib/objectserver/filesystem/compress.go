@@ -0,0 +1,265 @@
+package filesystem
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectcache"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// Compressed objects are stored in a file with compressedSuffix appended to the
+// name used for uncompressed objects. The file starts with a compressedHeader,
+// followed by the compressed data.
+const (
+	compressedSuffix      = ".z"
+	compressedHeaderSize  = 16
+	compressionSampleSize = 64 << 10
+)
+
+var compressedMagic = [4]byte{'D', 'O', 'M', 'Z'}
+
+type compressedHeader struct {
+	Magic       [4]byte
+	Compression uint32
+	Length      uint64 // Uncompressed length.
+}
+
+type countingWriter struct {
+	count uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += uint64(len(p))
+	return len(p), nil
+}
+
+type objectReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (rc *objectReadCloser) Close() error {
+	var firstError error
+	for _, closer := range rc.closers {
+		if err := closer.Close(); err != nil && firstError == nil {
+			firstError = err
+		}
+	}
+	return firstError
+}
+
+func readCompressedHeader(reader io.Reader) (compressedHeader, error) {
+	var header compressedHeader
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		return header, err
+	}
+	if header.Magic != compressedMagic {
+		return header, errors.New("bad compressed object header")
+	}
+	return header, nil
+}
+
+func readCompressedLength(filename string) (uint64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	header, err := readCompressedHeader(file)
+	if err != nil {
+		return 0, errors.New(filename + ": " + err.Error())
+	}
+	return header.Length, nil
+}
+
+// findObject returns the name of the file containing the object, its
+// FileInfo and whether it is compressed. If the object does not exist the
+// error satisfies os.IsNotExist.
+func (objSrv *ObjectServer) findObject(hashVal hash.Hash) (
+	string, os.FileInfo, bool, error) {
+	filename := path.Join(objSrv.baseDir, objectcache.HashToFilename(hashVal))
+	fi, err := os.Lstat(filename)
+	if err == nil {
+		return filename, fi, false, nil
+	} else if !os.IsNotExist(err) {
+		return "", nil, false, err
+	}
+	filename += compressedSuffix
+	fi, err = os.Lstat(filename)
+	if err != nil {
+		return "", nil, false, err
+	}
+	return filename, fi, true, nil
+}
+
+// objectLength returns the uncompressed length of a stored object.
+func objectLength(filename string, fi os.FileInfo, compressed bool) (
+	uint64, error) {
+	if compressed {
+		return readCompressedLength(filename)
+	}
+	return uint64(fi.Size()), nil
+}
+
+type storedObject struct {
+	file         *os.File
+	reader       io.Reader // Positioned at the start of the stored data.
+	storedLength uint64
+	length       uint64 // Uncompressed length.
+	compression  uint
+}
+
+// openStoredObject opens the stored (possibly compressed) form of an object.
+func (objSrv *ObjectServer) openStoredObject(hashVal hash.Hash) (
+	*storedObject, error) {
+	filename, _, compressed, err := objSrv.findObject(hashVal)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	object := &storedObject{
+		file:         file,
+		reader:       file,
+		storedLength: uint64(fi.Size()),
+		length:       uint64(fi.Size()),
+		compression:  objectserver.CompressionNone,
+	}
+	if !compressed {
+		return object, nil
+	}
+	object.reader = bufio.NewReader(file)
+	header, err := readCompressedHeader(object.reader)
+	if err != nil {
+		file.Close()
+		return nil, errors.New(filename + ": " + err.Error())
+	}
+	object.storedLength -= compressedHeaderSize
+	object.length = header.Length
+	object.compression = uint(header.Compression)
+	return object, nil
+}
+
+// openObject returns the uncompressed length of the object and a reader for
+// the uncompressed data.
+func (objSrv *ObjectServer) openObject(hashVal hash.Hash) (
+	uint64, io.ReadCloser, error) {
+	object, err := objSrv.openStoredObject(hashVal)
+	if err != nil {
+		return 0, nil, err
+	}
+	if object.compression == objectserver.CompressionNone {
+		return object.length, object.file, nil
+	}
+	decompressor, err := objectserver.NewDecompressor(object.compression,
+		object.reader)
+	if err != nil {
+		object.file.Close()
+		return 0, nil, err
+	}
+	return object.length, &objectReadCloser{
+		Reader:  decompressor,
+		closers: []io.Closer{decompressor, object.file},
+	}, nil
+}
+
+// compressObject compresses the object data in filename into a new temporary
+// file in tmpDir if the compression parameters allow and the data compress
+// well enough. It returns the name of the compressed file, or "" if the
+// object should be stored uncompressed.
+func (objSrv *ObjectServer) compressObject(tmpDir, filename string,
+	length uint64) (string, error) {
+	params := objSrv.compression
+	if params.Compression == objectserver.CompressionNone ||
+		length < params.MinSize {
+		return "", nil
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	// Try a sample first, so that large incompressible objects (such as
+	// already compressed files) are only read once more.
+	if length > compressionSampleSize {
+		counter := &countingWriter{}
+		compressor, err := objectserver.NewCompressor(params.Compression,
+			counter)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(compressor, file,
+			compressionSampleSize); err != nil {
+			return "", err
+		}
+		if err := compressor.Close(); err != nil {
+			return "", err
+		}
+		if float64(counter.count) > params.MaxRatio*compressionSampleSize {
+			return "", nil
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	tmpFile, err := ioutil.TempFile(tmpDir, "compressed")
+	if err != nil {
+		return "", err
+	}
+	keep := false
+	defer func() {
+		tmpFile.Close()
+		if !keep {
+			os.Remove(tmpFile.Name())
+		}
+	}()
+	if err := tmpFile.Chmod(filePerms); err != nil {
+		return "", err
+	}
+	writer := bufio.NewWriterSize(tmpFile, buflen)
+	header := compressedHeader{
+		Magic:       compressedMagic,
+		Compression: uint32(params.Compression),
+		Length:      length,
+	}
+	if err := binary.Write(writer, binary.BigEndian, header); err != nil {
+		return "", err
+	}
+	counter := &countingWriter{}
+	compressor, err := objectserver.NewCompressor(params.Compression,
+		io.MultiWriter(writer, counter))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(compressor, bufio.NewReader(file)); err != nil {
+		return "", err
+	}
+	if err := compressor.Close(); err != nil {
+		return "", err
+	}
+	if float64(counter.count+compressedHeaderSize) >
+		params.MaxRatio*float64(length) {
+		return "", nil
+	}
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+	keep = true
+	return tmpFile.Name(), nil
+}
@@ -0,0 +1,157 @@
+package filesystem
+
+import (
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func newCompressingObjectServer(t *testing.T) *ObjectServer {
+	objSrv := newTestObjectServer(t)
+	objSrv.SetCompression(CompressionParams{
+		Compression: objectserver.CompressionGzip,
+		MinSize:     1024,
+		MaxRatio:    0.9,
+	})
+	return objSrv
+}
+
+func randomData(length int) string {
+	data := make([]byte, length)
+	rand.New(rand.NewSource(1)).Read(data)
+	return string(data)
+}
+
+func TestCompressedObjects(t *testing.T) {
+	var tests = []struct {
+		name           string
+		data           string
+		wantCompressed bool
+	}{
+		{"large compressible", strings.Repeat("compressible ", 10000), true},
+		{"small compressible", strings.Repeat("compressible ", 10), false},
+		{"sample compressible", strings.Repeat("x", 10000), true},
+		{"random", randomData(100000), false},
+	}
+	for _, test := range tests {
+		objSrv := newCompressingObjectServer(t)
+		hashVal := objSrv.addTestObject(t, test.data)
+		_, _, compressed, err := objSrv.findObject(hashVal)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if compressed != test.wantCompressed {
+			t.Errorf("%s: compressed: %v", test.name, compressed)
+		}
+		if got := objSrv.readTestObject(t, hashVal); got != test.data {
+			t.Errorf("%s: data not preserved", test.name)
+		}
+		length := uint64(len(test.data))
+		if size := objSrv.ListObjectSizes()[hashVal]; size != length {
+			t.Errorf("%s: size: %d, want: %d", test.name, size, length)
+		}
+		if sizes, err := objSrv.CheckObjects(
+			[]hash.Hash{hashVal}); err != nil {
+			t.Fatal(err)
+		} else if sizes[0] != length {
+			t.Errorf("%s: CheckObjects: %d, want: %d", test.name, sizes[0],
+				length)
+		}
+		if _, err := objSrv.VerifyObject(hashVal, nil); err != nil {
+			t.Errorf("%s: VerifyObject: %s", test.name, err)
+		}
+		// Sizes must survive a restart, which scans the stored objects.
+		objSrv, err = NewObjectServer(objSrv.baseDir,
+			log.New(ioutil.Discard, "", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := objSrv.ListObjectSizes()[hashVal]; size != length {
+			t.Errorf("%s: size after restart: %d, want: %d", test.name, size,
+				length)
+		}
+	}
+}
+
+func TestNextCompressedObject(t *testing.T) {
+	objSrv := newCompressingObjectServer(t)
+	compressible := strings.Repeat("compressible ", 10000)
+	small := "small object"
+	hashes := []hash.Hash{
+		objSrv.addTestObject(t, compressible),
+		objSrv.addTestObject(t, small),
+	}
+	objectsReader, err := objSrv.getObjects(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer objectsReader.Close()
+	var tests = []struct {
+		data        string
+		compression uint
+	}{
+		{compressible, objectserver.CompressionGzip},
+		{small, objectserver.CompressionNone},
+	}
+	for index, test := range tests {
+		length, compression, reader, err :=
+			objectsReader.NextCompressedObject()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(stored)) != length {
+			t.Errorf("object %d: read: %d bytes, length: %d", index,
+				len(stored), length)
+		}
+		if compression != test.compression {
+			t.Errorf("object %d: compression: %d, want: %d", index,
+				compression, test.compression)
+		}
+		decompressor, err := objectserver.NewDecompressor(compression,
+			strings.NewReader(string(stored)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(decompressor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.data {
+			t.Errorf("object %d: data not preserved", index)
+		}
+	}
+	if _, _, _, err := objectsReader.NextCompressedObject(); err == nil {
+		t.Error("read beyond the last object")
+	}
+}
+
+func TestScrubCompressedObject(t *testing.T) {
+	objSrv := newCompressingObjectServer(t)
+	data := strings.Repeat("compressible ", 10000)
+	hashVal := objSrv.addTestObject(t, data)
+	filename, _, _, err := objSrv.findObject(hashVal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a byte in the compressed data, beyond the header.
+	stored[compressedHeaderSize+20] ^= 0xff
+	if err := ioutil.WriteFile(filename, stored, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := objSrv.VerifyObject(hashVal, nil); err == nil {
+		t.Error("corrupt compressed object verified")
+	}
+}
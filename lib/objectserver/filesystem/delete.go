@@ -0,0 +1,57 @@
+package filesystem
+
+import (
+	"errors"
+	"github.com/Symantec/Dominator/lib/hash"
+	"os"
+	"time"
+)
+
+func (objSrv *ObjectServer) checkStaleObject(hashVal hash.Hash,
+	gracePeriod time.Duration) (uint64, error) {
+	objSrv.rwLock.RLock()
+	defer objSrv.rwLock.RUnlock()
+	return objSrv.checkStaleObjectWithLock(hashVal, gracePeriod)
+}
+
+// This must be called with the lock held.
+func (objSrv *ObjectServer) checkStaleObjectWithLock(hashVal hash.Hash,
+	gracePeriod time.Duration) (uint64, error) {
+	filename, fi, _, err := objSrv.findObject(hashVal)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		return 0, errors.New("existing non-file: " + filename)
+	}
+	if time.Since(fi.ModTime()) < gracePeriod {
+		return 0, nil
+	}
+	return uint64(fi.Size()), nil
+}
+
+func (objSrv *ObjectServer) deleteObject(hashVal hash.Hash) (uint64, error) {
+	return objSrv.deleteStaleObject(hashVal, 0)
+}
+
+func (objSrv *ObjectServer) deleteStaleObject(hashVal hash.Hash,
+	gracePeriod time.Duration) (uint64, error) {
+	objSrv.rwLock.Lock()
+	defer objSrv.rwLock.Unlock()
+	size, err := objSrv.checkStaleObjectWithLock(hashVal, gracePeriod)
+	if err != nil || size < 1 {
+		return 0, err
+	}
+	filename, _, _, err := objSrv.findObject(hashVal)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Remove(filename); err != nil {
+		return 0, err
+	}
+	delete(objSrv.sizesMap, hashVal)
+	return size, nil
+}
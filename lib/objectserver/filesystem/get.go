@@ -3,10 +3,7 @@ package filesystem
 import (
 	"errors"
 	"github.com/Symantec/Dominator/lib/hash"
-	"github.com/Symantec/Dominator/lib/objectcache"
 	"io"
-	"os"
-	"path"
 )
 
 func (objSrv *ObjectServer) getObjects(hashes []hash.Hash) (
@@ -23,16 +20,22 @@ func (or *ObjectsReader) nextObject() (uint64, io.ReadCloser, error) {
 	if or.nextIndex >= int64(len(or.hashes)) {
 		return 0, nil, errors.New("all objects have been consumed")
 	}
-	filename := path.Join(or.objectServer.baseDir,
-		objectcache.HashToFilename(or.hashes[or.nextIndex]))
-	file, err := os.Open(filename)
-	if err != nil {
-		return 0, nil, err
+	return or.objectServer.openObject(or.hashes[or.nextIndex])
+}
+
+func (or *ObjectsReader) nextCompressedObject() (
+	uint64, uint, io.ReadCloser, error) {
+	or.nextIndex++
+	if or.nextIndex >= int64(len(or.hashes)) {
+		return 0, 0, nil, errors.New("all objects have been consumed")
 	}
-	fi, err := file.Stat()
+	object, err := or.objectServer.openStoredObject(or.hashes[or.nextIndex])
 	if err != nil {
-		file.Close()
-		return 0, nil, err
+		return 0, 0, nil, err
 	}
-	return uint64(fi.Size()), file, nil
+	return object.storedLength, object.compression,
+		&objectReadCloser{
+			Reader:  object.reader,
+			closers: []io.Closer{object.file},
+		}, nil
 }
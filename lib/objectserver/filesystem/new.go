@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"path"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -30,6 +31,10 @@ func newObjectServer(baseDir string, logger *log.Logger) (
 		logger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 	objSrv.logger = logger
+	// Remove partial uploads left behind by a previous crash.
+	if err := os.RemoveAll(path.Join(baseDir, temporaryDirectory)); err != nil {
+		return nil, err
+	}
 	state := concurrent.NewState(0)
 	startTime := time.Now()
 	var rusageStart, rusageStop syscall.Rusage
@@ -67,6 +72,10 @@ func scanDirectory(objSrv *ObjectServer, baseDir string, subpath string,
 		return err
 	}
 	for _, name := range names {
+		if subpath == "" &&
+			(name == QuarantineDirectory || name == temporaryDirectory) {
+			continue
+		}
 		fullPathName := path.Join(myPathName, name)
 		fi, err := os.Lstat(fullPathName)
 		if err != nil {
@@ -93,12 +102,20 @@ func scanDirectory(objSrv *ObjectServer, baseDir string, subpath string,
 				return errors.New(
 					fmt.Sprintf("zero-length file: %s", fullPathName))
 			}
+			size := uint64(fi.Size())
+			if strings.HasSuffix(filename, compressedSuffix) {
+				filename = filename[:len(filename)-len(compressedSuffix)]
+				size, err = readCompressedLength(fullPathName)
+				if err != nil {
+					return err
+				}
+			}
 			hash, err := objectcache.FilenameToHash(filename)
 			if err != nil {
 				return err
 			}
 			objSrv.rwLock.Lock()
-			objSrv.sizesMap[hash] = uint64(fi.Size())
+			objSrv.sizesMap[hash] = size
 			objSrv.rwLock.Unlock()
 		}
 	}
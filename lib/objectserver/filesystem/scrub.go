@@ -0,0 +1,307 @@
+package filesystem
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/format"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/rateio"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"github.com/Symantec/tricorder/go/tricorder/units"
+	"io"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+const maxScrubFindings = 100
+
+var errorHashMismatch = errors.New("hash mismatch")
+
+func (objSrv *ObjectServer) startScrubber(params ScrubberParams) *Scrubber {
+	s := &Scrubber{objSrv: objSrv, params: params}
+	if params.MaxBytesPerSecond > 0 {
+		// The reader context gets out of the way at 100% of the maximum speed,
+		// so limit to half of twice the desired speed.
+		s.readerContext = rateio.NewReaderContext(params.MaxBytesPerSecond*2,
+			50, &rateio.ReadMeasurer{})
+	}
+	go s.loop()
+	return s
+}
+
+func (s *Scrubber) loop() {
+	for {
+		startTime := time.Now()
+		s.scrubPass()
+		time.Sleep(s.params.Interval - time.Since(startTime))
+	}
+}
+
+func (s *Scrubber) scrubPass() {
+	hashes := s.objSrv.ListObjects()
+	s.rwLock.Lock()
+	s.stats.PassStartTime = time.Now()
+	s.stats.PassObjects = uint64(len(hashes))
+	s.stats.PassObjectsDone = 0
+	s.rwLock.Unlock()
+	var numCorrupt, numErrors uint64
+	for _, hashVal := range hashes {
+		nRead, err := s.scrubObject(hashVal)
+		var finding *ScrubFinding
+		if err != nil {
+			finding = &ScrubFinding{Time: time.Now(), Hash: hashVal, Error: err}
+			if err == errorHashMismatch {
+				numCorrupt++
+				s.objSrv.logger.Printf("Scrubber: object: %x is corrupt\n",
+					hashVal)
+				if err := s.replaceObject(hashVal); err != nil {
+					s.objSrv.logger.Printf(
+						"Scrubber: error repairing object: %x: %s\n",
+						hashVal, err)
+				} else {
+					s.objSrv.logger.Printf("Scrubber: repaired object: %x\n",
+						hashVal)
+					finding.Repaired = true
+				}
+			} else {
+				numErrors++
+				s.objSrv.logger.Printf("Scrubber: error reading object: %x: %s\n",
+					hashVal, err)
+			}
+		}
+		s.rwLock.Lock()
+		s.stats.PassObjectsDone++
+		s.stats.ObjectsScrubbed++
+		s.stats.BytesScrubbed += nRead
+		if finding != nil {
+			if finding.Error == errorHashMismatch {
+				s.stats.NumCorrupt++
+			} else {
+				s.stats.NumErrors++
+			}
+			if finding.Repaired {
+				s.stats.NumRepaired++
+			}
+			s.findings = append(s.findings, *finding)
+			if len(s.findings) > maxScrubFindings {
+				s.findings = s.findings[len(s.findings)-maxScrubFindings:]
+			}
+		}
+		s.rwLock.Unlock()
+	}
+	s.rwLock.Lock()
+	s.stats.NumPasses++
+	s.stats.LastPassFinished = time.Now()
+	s.stats.LastPassDuration = time.Since(s.stats.PassStartTime)
+	s.stats.PassStartTime = time.Time{}
+	duration := s.stats.LastPassDuration
+	s.rwLock.Unlock()
+	s.objSrv.logger.Printf(
+		"Scrubbed %d objects in %s, %d corrupt, %d read errors\n",
+		len(hashes), format.Duration(duration), numCorrupt, numErrors)
+}
+
+// scrubObject returns the number of bytes read and errorHashMismatch if the
+// object is corrupt. Objects which were deleted since being listed are
+// ignored.
+func (s *Scrubber) scrubObject(hashVal hash.Hash) (uint64, error) {
+	nRead, err := s.objSrv.verifyObject(hashVal, s.readerContext)
+	if err != nil && os.IsNotExist(err) {
+		return 0, nil
+	}
+	return nRead, err
+}
+
+// verifyObject reads the object and checks that it matches its hash. If
+// readerContext is not nil it is used to limit the read rate.
+func (objSrv *ObjectServer) verifyObject(hashVal hash.Hash,
+	readerContext *rateio.ReaderContext) (uint64, error) {
+	_, file, err := objSrv.openObject(hashVal)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if readerContext != nil {
+		reader = readerContext.NewReader(file)
+	}
+	hasher := sha512.New()
+	nRead, err := io.Copy(hasher, reader)
+	if err != nil {
+		return uint64(nRead), err
+	}
+	if !bytes.Equal(hasher.Sum(nil), hashVal[:]) {
+		return uint64(nRead), errorHashMismatch
+	}
+	return uint64(nRead), nil
+}
+
+// quarantineObject moves the object out of the way, so that it is no longer
+// served and may be added again.
+func (objSrv *ObjectServer) quarantineObject(hashVal hash.Hash) error {
+	quarantineDir := path.Join(objSrv.baseDir, QuarantineDirectory)
+	quarantineName := path.Join(quarantineDir,
+		fmt.Sprintf("%x.%d", hashVal, time.Now().Unix()))
+	objSrv.rwLock.Lock()
+	defer objSrv.rwLock.Unlock()
+	filename, _, compressed, err := objSrv.findObject(hashVal)
+	if err != nil {
+		return err
+	}
+	if compressed {
+		quarantineName += compressedSuffix
+	}
+	if err := os.MkdirAll(quarantineDir, syscall.S_IRWXU); err != nil {
+		return err
+	}
+	if err := os.Rename(filename, quarantineName); err != nil {
+		return err
+	}
+	delete(objSrv.sizesMap, hashVal)
+	return nil
+}
+
+// replaceObject quarantines a corrupt object and fetches a good copy from the
+// replica. Without a replica the object is kept, since a corrupt object is no
+// worse than a missing one and the operator may still want to inspect it.
+func (s *Scrubber) replaceObject(hashVal hash.Hash) error {
+	if s.params.Replica == nil {
+		return errors.New("no replica to repair from")
+	}
+	if err := s.objSrv.quarantineObject(hashVal); err != nil {
+		return fmt.Errorf("error quarantining: %s", err)
+	}
+	return s.repairObject(hashVal)
+}
+
+func (s *Scrubber) repairObject(hashVal hash.Hash) error {
+	// Keep the objects reader open while reading: closing it may close the
+	// connection to the replica.
+	objectsReader, err := s.params.Replica.GetObjects([]hash.Hash{hashVal})
+	if err != nil {
+		return err
+	}
+	defer objectsReader.Close()
+	length, reader, err := objectsReader.NextObject()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, _, err = s.objSrv.AddObject(reader, length, &hashVal)
+	return err
+}
+
+func (s *Scrubber) getFindings() []ScrubFinding {
+	s.rwLock.RLock()
+	defer s.rwLock.RUnlock()
+	findings := make([]ScrubFinding, len(s.findings))
+	copy(findings, s.findings)
+	return findings
+}
+
+func (s *Scrubber) getStats() ScrubberStats {
+	s.rwLock.RLock()
+	defer s.rwLock.RUnlock()
+	return s.stats
+}
+
+func (s *Scrubber) registerMetrics(dir *tricorder.DirectorySpec) error {
+	err := dir.RegisterMetric("passes",
+		func() uint64 { return s.getStats().NumPasses },
+		units.None, "number of completed scrub passes")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("pass-objects-done",
+		func() uint64 { return s.getStats().PassObjectsDone },
+		units.None, "number of objects scrubbed in the current pass")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("pass-objects",
+		func() uint64 { return s.getStats().PassObjects },
+		units.None, "number of objects in the current pass")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("last-pass-duration",
+		func() time.Duration { return s.getStats().LastPassDuration },
+		units.Second, "duration of the last completed scrub pass")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("objects-scrubbed",
+		func() uint64 { return s.getStats().ObjectsScrubbed },
+		units.None, "number of objects scrubbed")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("bytes-scrubbed",
+		func() uint64 { return s.getStats().BytesScrubbed },
+		units.Byte, "number of bytes scrubbed")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("corrupt-objects",
+		func() uint64 { return s.getStats().NumCorrupt },
+		units.None, "number of corrupt objects found")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("repaired-objects",
+		func() uint64 { return s.getStats().NumRepaired },
+		units.None, "number of corrupt objects replaced from a replica")
+	if err != nil {
+		return err
+	}
+	return dir.RegisterMetric("read-errors",
+		func() uint64 { return s.getStats().NumErrors },
+		units.None, "number of objects which could not be read")
+}
+
+func (s *Scrubber) writeHtml(writer io.Writer) {
+	stats := s.getStats()
+	findings := s.getFindings()
+	if stats.PassStartTime.IsZero() {
+		fmt.Fprintf(writer, "Scrubber: completed %d passes", stats.NumPasses)
+	} else {
+		fmt.Fprintf(writer, "Scrubber: pass %d scrubbed %d of %d objects",
+			stats.NumPasses+1, stats.PassObjectsDone, stats.PassObjects)
+	}
+	if !stats.LastPassFinished.IsZero() {
+		fmt.Fprintf(writer, ", last pass took %s",
+			format.Duration(stats.LastPassDuration))
+	}
+	fmt.Fprintf(writer, ", %s scrubbed", format.FormatBytes(stats.BytesScrubbed))
+	if stats.NumCorrupt > 0 || stats.NumErrors > 0 {
+		fmt.Fprintf(writer,
+			", <font color=\"red\">%d corrupt (%d repaired), %d read errors</font>",
+			stats.NumCorrupt, stats.NumRepaired, stats.NumErrors)
+	}
+	fmt.Fprintln(writer, "<br>")
+	if len(findings) < 1 {
+		return
+	}
+	fmt.Fprintln(writer, "<table border=\"1\">")
+	fmt.Fprintln(writer, "  <tr>")
+	fmt.Fprintln(writer, "    <th>Time</th>")
+	fmt.Fprintln(writer, "    <th>Object</th>")
+	fmt.Fprintln(writer, "    <th>Problem</th>")
+	fmt.Fprintln(writer, "    <th>Repaired</th>")
+	fmt.Fprintln(writer, "  </tr>")
+	for index := len(findings) - 1; index >= 0; index-- {
+		finding := findings[index]
+		fmt.Fprintln(writer, "  <tr>")
+		fmt.Fprintf(writer, "    <td>%s</td>\n",
+			finding.Time.Format(time.RFC3339))
+		fmt.Fprintf(writer, "    <td>%x</td>\n", finding.Hash)
+		fmt.Fprintf(writer, "    <td>%s</td>\n", finding.Error)
+		fmt.Fprintf(writer, "    <td>%t</td>\n", finding.Repaired)
+		fmt.Fprintln(writer, "  </tr>")
+	}
+	fmt.Fprintln(writer, "</table>")
+}
@@ -0,0 +1,128 @@
+package filesystem
+
+import (
+	"bytes"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectcache"
+	"github.com/Symantec/Dominator/lib/objectserver/memory"
+	"io/ioutil"
+	"log"
+	"path"
+	"testing"
+)
+
+func newTestObjectServer(t *testing.T) *ObjectServer {
+	objSrv, err := NewObjectServer(t.TempDir(), log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objSrv
+}
+
+func (objSrv *ObjectServer) addTestObject(t *testing.T,
+	data string) hash.Hash {
+	hashVal, _, err := objSrv.AddObject(bytes.NewBufferString(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashVal
+}
+
+// corruptTestObject overwrites an object with data of the same length.
+func (objSrv *ObjectServer) corruptTestObject(t *testing.T, hashVal hash.Hash,
+	data string) {
+	filename := path.Join(objSrv.baseDir, objectcache.HashToFilename(hashVal))
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (objSrv *ObjectServer) countQuarantined() int {
+	quarantineDir := path.Join(objSrv.baseDir, QuarantineDirectory)
+	names, err := ioutil.ReadDir(quarantineDir)
+	if err != nil {
+		return 0
+	}
+	return len(names)
+}
+
+func TestScrubPass(t *testing.T) {
+	const good, bad = "good object", "corrupt object"
+	var tests = []struct {
+		name            string
+		replica         []string // nil: no replica.
+		wantRepaired    bool
+		wantPresent     bool
+		wantQuarantined int
+	}{
+		{"no replica", nil, false, true, 0},
+		{"good copy on replica", []string{bad}, true, true, 1},
+		{"missing from replica", []string{}, false, false, 1},
+	}
+	for _, test := range tests {
+		objSrv := newTestObjectServer(t)
+		objSrv.addTestObject(t, good)
+		corruptHash := objSrv.addTestObject(t, bad)
+		objSrv.corruptTestObject(t, corruptHash, "CORRUPT object")
+		s := &Scrubber{objSrv: objSrv}
+		if test.replica != nil {
+			replica := memory.NewObjectServer()
+			for _, data := range test.replica {
+				_, _, err := replica.AddObject(bytes.NewBufferString(data),
+					uint64(len(data)), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.params.Replica = replica
+		}
+		s.scrubPass()
+		stats := s.Stats()
+		if stats.NumPasses != 1 || stats.ObjectsScrubbed != 2 ||
+			stats.NumCorrupt != 1 || stats.NumErrors != 0 {
+			t.Errorf("%s: stats: %+v", test.name, stats)
+		}
+		findings := s.Findings()
+		if len(findings) != 1 {
+			t.Errorf("%s: findings: %v", test.name, findings)
+			continue
+		}
+		if findings[0].Hash != corruptHash ||
+			findings[0].Error != errorHashMismatch ||
+			findings[0].Repaired != test.wantRepaired {
+			t.Errorf("%s: finding: %+v", test.name, findings[0])
+		}
+		if test.wantRepaired != (stats.NumRepaired == 1) {
+			t.Errorf("%s: repaired: %d", test.name, stats.NumRepaired)
+		}
+		sizes, err := objSrv.CheckObjects([]hash.Hash{corruptHash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if present := sizes[0] > 0; present != test.wantPresent {
+			t.Errorf("%s: present: %v", test.name, present)
+		}
+		if test.wantRepaired {
+			if _, err := objSrv.VerifyObject(corruptHash, nil); err != nil {
+				t.Errorf("%s: repaired object: %s", test.name, err)
+			}
+		}
+		if got := objSrv.countQuarantined(); got != test.wantQuarantined {
+			t.Errorf("%s: %d quarantined, want: %d", test.name, got,
+				test.wantQuarantined)
+		}
+	}
+}
+
+func TestScrubPassIgnoresDeletedObjects(t *testing.T) {
+	objSrv := newTestObjectServer(t)
+	hashVal := objSrv.addTestObject(t, "deleted")
+	if _, err := objSrv.DeleteStaleObject(hashVal, 0); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scrubber{objSrv: objSrv}
+	if nRead, err := s.scrubObject(hashVal); nRead != 0 || err != nil {
+		t.Errorf("read: %d, error: %v", nRead, err)
+	}
+}
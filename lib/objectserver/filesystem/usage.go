@@ -0,0 +1,34 @@
+package filesystem
+
+import (
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"os"
+	"syscall"
+)
+
+func (objSrv *ObjectServer) getStorageUsage() (
+	objectserver.StorageUsage, error) {
+	var usage objectserver.StorageUsage
+	for hashVal, size := range objSrv.listObjectSizes() {
+		_, fi, compressed, err := objSrv.findObject(hashVal)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // Deleted since being listed.
+			}
+			return usage, err
+		}
+		usage.NumObjects++
+		usage.ObjectBytes += size
+		usage.StoredBytes += uint64(fi.Size())
+		if compressed {
+			usage.NumCompressed++
+		}
+	}
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(objSrv.baseDir, &statfs); err != nil {
+		return usage, err
+	}
+	usage.FileSystemBytes = statfs.Blocks * uint64(statfs.Bsize)
+	usage.FileSystemFreeBytes = statfs.Bavail * uint64(statfs.Bsize)
+	return usage, nil
+}
@@ -0,0 +1,51 @@
+/*
+	Package revocation checks certificates against revocation lists.
+
+	Package revocation loads a certificate revocation list (CRL) file and a
+	local deny list of certificate serial numbers and usernames, and reloads
+	them when they change. A List may be registered with the srpc package so
+	that connections from clients with revoked certificates are rejected.
+*/
+package revocation
+
+import (
+	"crypto/x509"
+	"log"
+	"sync"
+)
+
+// List holds the most recently loaded revocation data.
+//
+// The CRL file contains one or more PEM or DER encoded CRLs. The file is
+// trusted, so the signatures of the CRLs are not checked.
+//
+// Each line of the deny list file contains "serial" followed by a hexadecimal
+// certificate serial number (colons are permitted), or "user" followed by a
+// username. Empty lines and lines starting with "#" are ignored. Serial
+// numbers in the deny list are revoked regardless of the certificate issuer.
+type List struct {
+	crlFile      string
+	denyListFile string
+	logger       *log.Logger
+	rwLock       sync.RWMutex        // Protect everything below.
+	crlEntries   map[string]struct{} // Key: issuer and serial number.
+	serials      map[string]struct{} // Key: serial number.
+	usernames    map[string]struct{}
+	numReloads   uint64
+	numErrors    uint64
+}
+
+// New loads the CRL file and the deny list file (either may be empty), then
+// watches them and reloads them when they are replaced. After a reload,
+// established srpc connections with certificates which are now revoked are
+// closed. Reload errors are logged to logger and the previously loaded data
+// are kept. Metrics are registered under /revocation.
+func New(crlFile, denyListFile string, logger *log.Logger) (*List, error) {
+	return newList(crlFile, denyListFile, logger)
+}
+
+// CheckCertificate returns an error if the certificate has been revoked. It
+// satisfies the srpc.RevocationChecker interface.
+func (l *List) CheckCertificate(cert *x509.Certificate) error {
+	return l.checkCertificate(cert)
+}
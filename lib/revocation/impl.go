@@ -0,0 +1,226 @@
+package revocation
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/fsutil"
+	"github.com/Symantec/Dominator/lib/srpc"
+	"github.com/Symantec/Dominator/lib/x509util"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"github.com/Symantec/tricorder/go/tricorder/units"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+func newList(crlFile, denyListFile string, logger *log.Logger) (*List, error) {
+	l := &List{crlFile: crlFile, denyListFile: denyListFile, logger: logger}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.registerMetrics(); err != nil {
+		return nil, err
+	}
+	for _, filename := range []string{crlFile, denyListFile} {
+		if filename != "" {
+			go l.watchFile(filename)
+		}
+	}
+	return l, nil
+}
+
+func (l *List) load() error {
+	crlEntries := make(map[string]struct{})
+	if l.crlFile != "" {
+		if err := loadCrls(l.crlFile, crlEntries, l.logger); err != nil {
+			return err
+		}
+	}
+	serials := make(map[string]struct{})
+	usernames := make(map[string]struct{})
+	if l.denyListFile != "" {
+		err := loadDenyList(l.denyListFile, serials, usernames)
+		if err != nil {
+			return err
+		}
+	}
+	l.rwLock.Lock()
+	defer l.rwLock.Unlock()
+	l.crlEntries = crlEntries
+	l.serials = serials
+	l.usernames = usernames
+	return nil
+}
+
+func crlKey(rawIssuer []byte, serial *big.Int) string {
+	return string(rawIssuer) + "/" + serial.String()
+}
+
+func loadCrls(filename string, entries map[string]struct{},
+	logger *log.Logger) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var ders [][]byte
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		for block, rest := pem.Decode(data); block != nil; block, rest =
+			pem.Decode(rest) {
+			if block.Type == "X509 CRL" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+		if len(ders) < 1 {
+			return errors.New(filename + ": no CRLs found")
+		}
+	} else {
+		ders = append(ders, data)
+	}
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return errors.New(filename + ": " + err.Error())
+		}
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			logger.Printf("CRL from: %s in: %s is stale, next update was: %s\n",
+				crl.Issuer, filename, crl.NextUpdate.Format(time.RFC3339))
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			entries[crlKey(crl.RawIssuer, entry.SerialNumber)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func loadDenyList(filename string, serials map[string]struct{},
+	usernames map[string]struct{}) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: bad line", filename, lineNumber)
+		}
+		switch fields[0] {
+		case "serial":
+			serial, ok := new(big.Int).SetString(
+				strings.Replace(fields[1], ":", "", -1), 16)
+			if !ok {
+				return fmt.Errorf("%s:%d: bad serial number: %s",
+					filename, lineNumber, fields[1])
+			}
+			serials[serial.String()] = struct{}{}
+		case "user":
+			usernames[fields[1]] = struct{}{}
+		default:
+			return fmt.Errorf("%s:%d: unknown entry type: %s",
+				filename, lineNumber, fields[0])
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *List) watchFile(filename string) {
+	channel := fsutil.WatchFile(filename, l.logger)
+	// The first file yielded is the one which was already loaded.
+	(<-channel).Close()
+	for file := range channel {
+		file.Close()
+		if err := l.load(); err != nil {
+			l.rwLock.Lock()
+			l.numErrors++
+			l.rwLock.Unlock()
+			l.logger.Printf(
+				"Error reloading revocation lists, keeping old ones: %s\n",
+				err)
+			continue
+		}
+		l.rwLock.Lock()
+		l.numReloads++
+		l.rwLock.Unlock()
+		l.logger.Printf("Reloaded revocation lists after change to: %s\n",
+			filename)
+		if numClosed := srpc.CloseRevokedConnections(); numClosed > 0 {
+			l.logger.Printf("Closed %d connections with revoked certificates\n",
+				numClosed)
+		}
+	}
+}
+
+func (l *List) checkCertificate(cert *x509.Certificate) error {
+	username, err := x509util.GetUsername(cert)
+	if err != nil {
+		return err
+	}
+	l.rwLock.RLock()
+	defer l.rwLock.RUnlock()
+	if _, ok := l.crlEntries[crlKey(cert.RawIssuer,
+		cert.SerialNumber)]; ok {
+		return fmt.Errorf("certificate serial: %x for: %s is revoked by CRL",
+			cert.SerialNumber, username)
+	}
+	if _, ok := l.serials[cert.SerialNumber.String()]; ok {
+		return fmt.Errorf("certificate serial: %x for: %s is denied",
+			cert.SerialNumber, username)
+	}
+	if _, ok := l.usernames[username]; ok && username != "" {
+		return fmt.Errorf("certificate for user: %s is denied", username)
+	}
+	return nil
+}
+
+func (l *List) getCount(count func() int) func() uint {
+	return func() uint {
+		l.rwLock.RLock()
+		defer l.rwLock.RUnlock()
+		return uint(count())
+	}
+}
+
+func (l *List) registerMetrics() error {
+	dir, err := tricorder.RegisterDirectory("/revocation")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-crl-entries",
+		l.getCount(func() int { return len(l.crlEntries) }),
+		units.None, "number of certificates revoked by CRLs")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-denied-serials",
+		l.getCount(func() int { return len(l.serials) }),
+		units.None, "number of certificate serial numbers in the deny list")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-denied-users",
+		l.getCount(func() int { return len(l.usernames) }),
+		units.None, "number of usernames in the deny list")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("num-reloads",
+		l.getCount(func() int { return int(l.numReloads) }),
+		units.None, "number of times the lists were reloaded")
+	if err != nil {
+		return err
+	}
+	return dir.RegisterMetric("num-reload-errors",
+		l.getCount(func() int { return int(l.numErrors) }),
+		units.None, "number of failed reloads")
+}
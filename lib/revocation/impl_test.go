@@ -0,0 +1,192 @@
+package revocation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDenyList(t *testing.T) {
+	var tests = []struct {
+		name          string
+		contents      string
+		wantSerials   []int64
+		wantUsernames []string
+		wantError     bool
+	}{
+		{"empty", "", nil, nil, false},
+		{"comments", "# serial 1\n\n  # user bob\n", nil, nil, false},
+		{"entries", "serial 1f\nserial 01:00\nuser alice\n",
+			[]int64{0x1f, 0x100}, []string{"alice"}, false},
+		{"bad serial", "serial xyz\n", nil, nil, true},
+		{"unknown type", "group admins\n", nil, nil, true},
+		{"missing value", "user\n", nil, nil, true},
+		{"extra field", "user alice bob\n", nil, nil, true},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		filename := filepath.Join(dir, "denylist")
+		err := ioutil.WriteFile(filename, []byte(test.contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serials := make(map[string]struct{})
+		usernames := make(map[string]struct{})
+		err = loadDenyList(filename, serials, usernames)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if len(serials) != len(test.wantSerials) {
+			t.Errorf("%s: serials: %v", test.name, serials)
+		}
+		for _, serial := range test.wantSerials {
+			if _, ok := serials[big.NewInt(serial).String()]; !ok {
+				t.Errorf("%s: serial: %x missing", test.name, serial)
+			}
+		}
+		if len(usernames) != len(test.wantUsernames) {
+			t.Errorf("%s: usernames: %v", test.name, usernames)
+		}
+		for _, username := range test.wantUsernames {
+			if _, ok := usernames[username]; !ok {
+				t.Errorf("%s: username: %s missing", test.name, username)
+			}
+		}
+	}
+}
+
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T, name string) testIssuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testIssuer{cert, key}
+}
+
+func (issuer testIssuer) makeCrl(t *testing.T, serials ...int64) []byte {
+	entries := make([]x509.RevocationListEntry, 0, len(serials))
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now(),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, issuer.cert, issuer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func (issuer testIssuer) makeCert(serial int64,
+	username string) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: username},
+		RawIssuer:    issuer.cert.RawSubject,
+	}
+}
+
+func TestCheckCertificate(t *testing.T) {
+	first := newTestIssuer(t, "first CA")
+	second := newTestIssuer(t, "second CA")
+	dir := t.TempDir()
+	pemCrlFile := filepath.Join(dir, "crl.pem")
+	crls := pem.EncodeToMemory(
+		&pem.Block{Type: "X509 CRL", Bytes: first.makeCrl(t, 10, 11)})
+	crls = append(crls, pem.EncodeToMemory(
+		&pem.Block{Type: "X509 CRL", Bytes: second.makeCrl(t, 20)})...)
+	if err := ioutil.WriteFile(pemCrlFile, crls, 0600); err != nil {
+		t.Fatal(err)
+	}
+	derCrlFile := filepath.Join(dir, "crl.der")
+	err := ioutil.WriteFile(derCrlFile, first.makeCrl(t, 10, 11), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	denyListFile := filepath.Join(dir, "denylist")
+	err = ioutil.WriteFile(denyListFile, []byte("serial 1e\nuser mallory\n"),
+		0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name        string
+		crlFile     string
+		cert        *x509.Certificate
+		wantRevoked string // Empty: not revoked.
+	}{
+		{"first issuer revoked", pemCrlFile, first.makeCert(10, "alice"),
+			"revoked by CRL"},
+		{"second issuer revoked", pemCrlFile, second.makeCert(20, "bob"),
+			"revoked by CRL"},
+		{"other issuer", pemCrlFile, second.makeCert(10, "alice"), ""},
+		{"not revoked", pemCrlFile, first.makeCert(12, "alice"), ""},
+		{"DER CRL", derCrlFile, first.makeCert(11, "alice"),
+			"revoked by CRL"},
+		{"denied serial", derCrlFile, second.makeCert(30, "alice"),
+			"denied"},
+		{"denied user", derCrlFile, first.makeCert(12, "mallory"),
+			"denied"},
+	}
+	for _, test := range tests {
+		l := &List{crlFile: test.crlFile, denyListFile: denyListFile,
+			logger: log.New(ioutil.Discard, "", 0)}
+		if err := l.load(); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		err := l.checkCertificate(test.cert)
+		if test.wantRevoked == "" && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if test.wantRevoked != "" && (err == nil ||
+			!strings.Contains(err.Error(), test.wantRevoked)) {
+			t.Errorf("%s: error: %v, want: %s", test.name, err,
+				test.wantRevoked)
+		}
+	}
+}
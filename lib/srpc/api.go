@@ -13,7 +13,9 @@ package srpc
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
 	"sync"
@@ -26,11 +28,15 @@ var (
 	ErrorMissingCertificate   = errors.New("missing certificate")
 	ErrorBadCertificate       = errors.New("bad certificate")
 	ErrorAccessToMethodDenied = errors.New("access to method denied")
+	ErrorTooManyCalls         = errors.New("too many concurrent calls to method")
+	ErrorRateLimitExceeded    = errors.New("call rate limit exceeded")
 )
 
 var serverTlsConfig *tls.Config
 var clientTlsConfig *tls.Config
 var tlsRequired bool
+var revocationChecker RevocationChecker
+var groupPolicy GroupPolicy
 
 // RegisterName publishes in the server the set of methods of the receiver
 // value that satisfy one of the following interfaces:
@@ -40,7 +46,32 @@ var tlsRequired bool
 // passed only to provide access to connection metadata.
 // The name of the receiver (service) is given by name.
 func RegisterName(name string, rcvr interface{}) error {
-	return registerName(name, rcvr)
+	return registerName(name, rcvr, ReceiverOptions{})
+}
+
+// MethodPolicy limits the calls which may be made to a method. The zero value
+// imposes no limits.
+type MethodPolicy struct {
+	MaxConcurrentCalls       uint    // Calls in progress for all users.
+	MaxCallsPerUserPerSecond float64 // Sustained call rate for each user.
+	MaxBurstPerUser          uint    // Calls a user may make at once (min 1).
+	// If QueueWhenLimited is true, calls which reach a limit wait until they
+	// may proceed, otherwise they are rejected with ErrorTooManyCalls or
+	// ErrorRateLimitExceeded.
+	QueueWhenLimited bool
+}
+
+// ReceiverOptions holds optional parameters for RegisterNameWithOptions.
+type ReceiverOptions struct {
+	MethodPolicies map[string]MethodPolicy // Key: method name.
+}
+
+// RegisterNameWithOptions is similar to RegisterName, except that options may
+// be given. Calls to methods with a policy are limited by that policy and
+// limit hits are counted in the method metrics.
+func RegisterNameWithOptions(name string, rcvr interface{},
+	options ReceiverOptions) error {
+	return registerName(name, rcvr, options)
 }
 
 // RegisterServerTlsConfig registers the configuration for TLS server
@@ -51,6 +82,41 @@ func RegisterServerTlsConfig(config *tls.Config, requireTls bool) {
 	tlsRequired = requireTls
 }
 
+// RevocationChecker checks whether client certificates have been revoked.
+type RevocationChecker interface {
+	// CheckCertificate returns an error if the certificate has been revoked.
+	CheckCertificate(cert *x509.Certificate) error
+}
+
+// RegisterRevocationChecker registers a checker for the certificates presented
+// by TLS clients, including those in the chain to the root certificate.
+// Connections with a revoked certificate are rejected.
+func RegisterRevocationChecker(checker RevocationChecker) {
+	revocationChecker = checker
+}
+
+// CloseRevokedConnections checks the certificates of the established TLS
+// client connections with the registered RevocationChecker and closes the
+// connections with a revoked certificate. It should be called when the
+// revocation data change. The number of connections closed is returned.
+func CloseRevokedConnections() uint {
+	return closeRevokedConnections()
+}
+
+// GroupPolicy grants access to methods to the groups which clients belong
+// to. The groups are given in the client certificates.
+type GroupPolicy interface {
+	// PermitsMethod returns true if any of the groups is permitted to call
+	// the method.
+	PermitsMethod(groups map[string]struct{}, serviceMethod string) bool
+}
+
+// RegisterGroupPolicy registers a policy which permits clients to call
+// methods in addition to the methods permitted in their certificates.
+func RegisterGroupPolicy(policy GroupPolicy) {
+	groupPolicy = policy
+}
+
 // RegisterClientTlsConfig registers the configuration for TLS client
 // connections.
 func RegisterClientTlsConfig(config *tls.Config) {
@@ -64,6 +130,14 @@ func DialHTTP(network, address string, timeout time.Duration) (*Client, error) {
 	return dialHTTP(network, address, clientTlsConfig, timeout)
 }
 
+// DialHTTPContext is like DialHTTP, except that the connection attempt
+// (including the TLS handshake) is abandoned if ctx is cancelled or its
+// deadline passes.
+func DialHTTPContext(ctx context.Context, network, address string) (
+	*Client, error) {
+	return dialHTTPContext(ctx, network, address, clientTlsConfig, 0)
+}
+
 // DialHTTP connects to an HTTP SRPC TLS server at the specified network address
 // listening on the HTTP SRPC TLS path. If timeout is zero or less, the
 // underlying OS timeout is used (typically 3 minutes for TCP).
@@ -81,22 +155,36 @@ type Client struct {
 	isEncrypted bool
 	bufrw       *bufio.ReadWriter
 	callLock    sync.Mutex
+	mux         *muxConn // nil: server does not support multiplexing.
 }
 
 func (client *Client) Close() error {
-	client.bufrw.Flush()
-	return client.conn.Close()
+	return client.close()
 }
 
 // Call opens a buffered connection to the named Service.Method function, and
 // returns a connection handle and an error status. The connection handle wraps
-// a *bufio.ReadWriter. Only one connection can be made per Client. The Call
-// method will block if another Call is in progress. The Close method must be
-// called prior to attempting another Call.
+// a *bufio.ReadWriter. If the server supports multiplexing, many calls may be
+// in progress at once over the same Client, each with its own flow control.
+// Otherwise only one connection can be made per Client: the Call method will
+// block if another Call is in progress and the Close method must be called
+// prior to attempting another Call.
 func (client *Client) Call(serviceMethod string) (*Conn, error) {
 	return client.call(serviceMethod)
 }
 
+// CallContext is like Call, except that the call is abandoned if ctx is
+// cancelled or its deadline passes. Reads and writes on the connection then
+// fail, although data which have already been received may still be read. If
+// the server supports multiplexing, the deadline is sent to the server and
+// the server is told if the call is abandoned. Otherwise the
+// underlying connection is closed and the Client cannot be used for further
+// calls.
+func (client *Client) CallContext(ctx context.Context, serviceMethod string) (
+	*Conn, error) {
+	return client.callContext(ctx, serviceMethod)
+}
+
 // IsEncrypted will return true if the underlying connection is TLS-encrypted.
 func (client *Client) IsEncrypted() bool {
 	return client.isEncrypted
@@ -105,7 +193,7 @@ func (client *Client) IsEncrypted() bool {
 // Ping sends a short "are you alive?" request and waits for a response. No
 // method permissions are required for this operation. The Ping method is a
 // wrapper around the Call method and hence will block if a Call is already in
-// progress.
+// progress and the server does not support multiplexing.
 func (client *Client) Ping() error {
 	return client.ping()
 }
@@ -119,20 +207,44 @@ func (client *Client) RequestReply(serviceMethod string, request interface{},
 	return client.requestReply(serviceMethod, request, reply)
 }
 
+// RequestReplyContext is like RequestReply, except that the call is abandoned
+// if ctx is cancelled or its deadline passes. In that case ctx.Err() is
+// returned. See CallContext for details.
+func (client *Client) RequestReplyContext(ctx context.Context,
+	serviceMethod string, request interface{}, reply interface{}) error {
+	return client.requestReplyContext(ctx, serviceMethod, request, reply)
+}
+
 type Conn struct {
 	parent      *Client // nil: server-side connection.
 	isEncrypted bool
 	*bufio.ReadWriter
 	username         string              // Empty string for unauthenticated.
 	permittedMethods map[string]struct{} // nil: all, empty: none permitted.
+	groups           map[string]struct{}
+	remoteAddress    string  // Server only.
+	stream           *stream // nil: not multiplexed.
+	ctx              context.Context
+	finished         chan struct{} // Closed when a plain client call ends.
 }
 
 // Close will close the connection to the Sevice.Method function, releasing the
-// Client for a subsequent Call.
+// Client for a subsequent Call. Unread data are discarded if the connection is
+// multiplexed.
 func (conn *Conn) Close() error {
 	return conn.close()
 }
 
+// Context returns the context of the call. For a client connection this is
+// the context given to CallContext. For a server connection the context is
+// done when the client cancels or closes the call, when the deadline given by
+// the client passes, or when the connection fails. Server connections which
+// are not multiplexed cannot carry deadlines or cancellation, so their context
+// is never done.
+func (conn *Conn) Context() context.Context {
+	return conn.getContext()
+}
+
 // Username will return the username of the client who holds the certificate
 // used to authenticate the connection to the server. If the connection was not
 // authenticated the emtpy string is returned. If the connection is a client
@@ -141,6 +253,13 @@ func (conn *Conn) Username() string {
 	return conn.getUsername()
 }
 
+// Groups will return the groups (or roles) given in the certificate used to
+// authenticate the connection to the server. The map must not be modified. If
+// the connection is a client connection, then Groups will panic.
+func (conn *Conn) Groups() map[string]struct{} {
+	return conn.getGroups()
+}
+
 // IsEncrypted will return true if the underlying connection is TLS-encrypted.
 func (conn *Conn) IsEncrypted() bool {
 	return conn.isEncrypted
@@ -2,6 +2,7 @@ package srpc
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/gob"
 	"errors"
@@ -12,9 +13,18 @@ import (
 	"time"
 )
 
+var errorFallBackToInsecure = errors.New("fall back to insecure connection")
+
 func dialHTTP(network, address string, tlsConfig *tls.Config,
 	timeout time.Duration) (*Client, error) {
-	unsecuredConn, err := net.DialTimeout(network, address, timeout)
+	return dialHTTPContext(context.Background(), network, address, tlsConfig,
+		timeout)
+}
+
+func dialHTTPContext(ctx context.Context, network, address string,
+	tlsConfig *tls.Config, timeout time.Duration) (*Client, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	unsecuredConn, err := dialer.DialContext(ctx, network, address)
 	if err != nil {
 		if strings.Contains(err.Error(), ErrorConnectionRefused.Error()) {
 			return nil, ErrorConnectionRefused
@@ -24,6 +34,44 @@ func dialHTTP(network, address string, tlsConfig *tls.Config,
 		}
 		return nil, err
 	}
+	client, err := setupClient(ctx, unsecuredConn, tlsConfig)
+	if err != nil {
+		unsecuredConn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == errorFallBackToInsecure {
+			return dialHTTPContext(ctx, network, address, nil, timeout)
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+// setupClient performs the HTTP CONNECT and TLS handshakes. If ctx is
+// cancelled or its deadline passes, the handshakes are interrupted.
+func setupClient(ctx context.Context, unsecuredConn net.Conn,
+	tlsConfig *tls.Config) (*Client, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		unsecuredConn.SetDeadline(deadline)
+		defer unsecuredConn.SetDeadline(time.Time{})
+	}
+	if ctx.Done() != nil {
+		finished := make(chan struct{})
+		watcherDone := make(chan struct{})
+		go func() {
+			defer close(watcherDone)
+			select {
+			case <-ctx.Done():
+				unsecuredConn.SetDeadline(time.Now())
+			case <-finished:
+			}
+		}()
+		defer func() {
+			close(finished)
+			<-watcherDone
+		}()
+	}
 	if tcpConn, ok := unsecuredConn.(*net.TCPConn); ok {
 		if err := tcpConn.SetKeepAlive(true); err != nil {
 			return nil, err
@@ -36,7 +84,9 @@ func dialHTTP(network, address string, tlsConfig *tls.Config,
 	if tlsConfig != nil {
 		path = tlsRpcPath
 	}
-	io.WriteString(unsecuredConn, "CONNECT "+path+" HTTP/1.0\n\n")
+	// Servers which do not support multiplexing ignore the header.
+	io.WriteString(unsecuredConn,
+		"CONNECT "+path+" HTTP/1.0\n"+muxHeaderName+": 1\n\n")
 	// Require successful HTTP response before switching to SRPC protocol.
 	resp, err := http.ReadResponse(bufio.NewReader(unsecuredConn),
 		&http.Request{Method: "CONNECT"})
@@ -47,16 +97,17 @@ func dialHTTP(network, address string, tlsConfig *tls.Config,
 		tlsConfig != nil &&
 		tlsConfig.InsecureSkipVerify {
 		// Fall back to insecure connection.
-		return dialHTTP(network, address, nil, timeout)
+		return nil, errorFallBackToInsecure
 	}
 	if resp.StatusCode == http.StatusMethodNotAllowed {
 		return nil, ErrorMissingCertificate
 	}
-	if resp.Status != connectString {
+	multiplexed := resp.Status == muxConnectString
+	if resp.Status != connectString && !multiplexed {
 		return nil, errors.New("unexpected HTTP response: " + resp.Status)
 	}
 	if tlsConfig == nil {
-		return newClient(unsecuredConn, false), nil
+		return newClient(unsecuredConn, false, multiplexed), nil
 	}
 	tlsConn := tls.Client(unsecuredConn, tlsConfig)
 	if err := tlsConn.Handshake(); err != nil {
@@ -65,54 +116,122 @@ func dialHTTP(network, address string, tlsConfig *tls.Config,
 		}
 		return nil, err
 	}
-	return newClient(tlsConn, true), nil
+	return newClient(tlsConn, true, multiplexed), nil
 }
 
-func newClient(conn net.Conn, isEncrypted bool) *Client {
+func newClient(conn net.Conn, isEncrypted, multiplexed bool) *Client {
+	bufrw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if multiplexed {
+		return newMuxClient(conn, isEncrypted, bufrw)
+	}
 	return &Client{
 		conn:        conn,
 		isEncrypted: isEncrypted,
-		bufrw: bufio.NewReadWriter(bufio.NewReader(conn),
-			bufio.NewWriter(conn))}
+		bufrw:       bufrw,
+	}
 }
 
 func (client *Client) call(serviceMethod string) (*Conn, error) {
+	return client.callContext(context.Background(), serviceMethod)
+}
+
+func (client *Client) callContext(ctx context.Context, serviceMethod string) (
+	*Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if client.mux != nil {
+		return client.callMultiplexed(ctx, serviceMethod)
+	}
 	client.callLock.Lock()
-	conn, err := client.callWithLock(serviceMethod)
+	conn, err := client.callWithLock(ctx, serviceMethod)
 	if err != nil {
 		client.callLock.Unlock()
 	}
 	return conn, err
 }
 
-func (client *Client) callWithLock(serviceMethod string) (*Conn, error) {
-	_, err := client.bufrw.WriteString(serviceMethod + "\n")
-	if err != nil {
-		return nil, err
+func (client *Client) callWithLock(ctx context.Context, serviceMethod string) (
+	*Conn, error) {
+	conn := &Conn{
+		parent:      client,
+		ctx:         ctx,
+		isEncrypted: client.isEncrypted,
+		ReadWriter:  client.bufrw,
+	}
+	if ctx.Done() != nil {
+		// The server cannot be told about the cancellation, so the connection
+		// is torn down.
+		finished := make(chan struct{})
+		conn.finished = finished
+		go func() {
+			select {
+			case <-ctx.Done():
+				client.conn.Close()
+			case <-finished:
+			}
+		}()
 	}
-	if err = client.bufrw.Flush(); err != nil {
+	if err := conn.sendMethod(serviceMethod); err != nil {
+		conn.stopWatching()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
-	resp, err := client.bufrw.ReadString('\n')
+	return conn, nil
+}
+
+func (client *Client) callMultiplexed(ctx context.Context,
+	serviceMethod string) (*Conn, error) {
+	s, err := client.mux.openStream(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if resp != "\n" {
-		resp := resp[:len(resp)-1]
-		if resp == ErrorAccessToMethodDenied.Error() {
-			return nil, ErrorAccessToMethodDenied
-		}
-		return nil, errors.New(resp)
-	}
 	conn := &Conn{
 		parent:      client,
+		ctx:         ctx,
 		isEncrypted: client.isEncrypted,
-		ReadWriter:  client.bufrw,
+		ReadWriter:  newStreamReadWriter(s),
+		stream:      s,
+	}
+	if err := conn.sendMethod(serviceMethod); err != nil {
+		s.close()
+		return nil, err
 	}
 	return conn, nil
 }
 
+func (conn *Conn) sendMethod(serviceMethod string) error {
+	if _, err := conn.WriteString(serviceMethod + "\n"); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	resp, err := conn.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if resp != "\n" {
+		resp := resp[:len(resp)-1]
+		switch resp {
+		case ErrorAccessToMethodDenied.Error():
+			return ErrorAccessToMethodDenied
+		case ErrorTooManyCalls.Error():
+			return ErrorTooManyCalls
+		case ErrorRateLimitExceeded.Error():
+			return ErrorRateLimitExceeded
+		}
+		return errors.New(resp)
+	}
+	return nil
+}
+
 func (client *Client) close() error {
+	if client.mux != nil {
+		return client.mux.close()
+	}
 	client.bufrw.Flush()
 	return client.conn.Close()
 }
@@ -128,7 +247,22 @@ func (client *Client) ping() error {
 
 func (client *Client) requestReply(serviceMethod string, request interface{},
 	reply interface{}) error {
-	conn, err := client.Call(serviceMethod)
+	return client.requestReplyContext(context.Background(), serviceMethod,
+		request, reply)
+}
+
+func (client *Client) requestReplyContext(ctx context.Context,
+	serviceMethod string, request interface{}, reply interface{}) error {
+	err := client.requestReplyWithContext(ctx, serviceMethod, request, reply)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (client *Client) requestReplyWithContext(ctx context.Context,
+	serviceMethod string, request interface{}, reply interface{}) error {
+	conn, err := client.callContext(ctx, serviceMethod)
 	if err != nil {
 		return err
 	}
@@ -1,13 +1,45 @@
 package srpc
 
+import (
+	"context"
+)
+
 func (conn *Conn) close() error {
 	err := conn.Flush()
+	if conn.stream != nil {
+		conn.stream.close()
+		return err
+	}
 	if conn.parent != nil {
+		conn.stopWatching()
 		conn.parent.callLock.Unlock()
 	}
 	return err
 }
 
+func (conn *Conn) getContext() context.Context {
+	if conn.ctx == nil {
+		return context.Background()
+	}
+	return conn.ctx
+}
+
+// stopWatching stops the goroutine which tears down a plain client connection
+// if the call context is done.
+func (conn *Conn) stopWatching() {
+	if conn.finished != nil {
+		close(conn.finished)
+		conn.finished = nil
+	}
+}
+
+func (conn *Conn) getGroups() map[string]struct{} {
+	if conn.parent != nil {
+		panic("cannot call Groups() for client connection")
+	}
+	return conn.groups
+}
+
 func (conn *Conn) getUsername() string {
 	if conn.parent != nil {
 		panic("cannot call GetUsername() for client connection")
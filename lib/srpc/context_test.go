@@ -0,0 +1,186 @@
+package srpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type cancelResult struct {
+	hasDeadline bool
+	err         error
+}
+
+var cancelResults = make(chan cancelResult, 1)
+
+// WaitForCancel sends an empty line and then waits for the call to be
+// cancelled, recording what it saw.
+func (muxTestType) WaitForCancel(conn *Conn) error {
+	ctx := conn.Context()
+	_, hasDeadline := ctx.Deadline()
+	conn.WriteString("\n")
+	conn.Flush()
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+	}
+	cancelResults <- cancelResult{hasDeadline, ctx.Err()}
+	return nil
+}
+
+func waitForCancelResult(t *testing.T) cancelResult {
+	select {
+	case result := <-cancelResults:
+		return result
+	case <-time.After(15 * time.Second):
+		t.Fatal("server method did not finish")
+	}
+	return cancelResult{}
+}
+
+func TestMuxCallContext(t *testing.T) {
+	var tests = []struct {
+		name            string
+		timeout         time.Duration
+		cancel          bool
+		closeCall       bool
+		wantReadError   error
+		wantServerError error // nil: any error.
+		wantDeadline    bool
+	}{
+		{"cancelled", 0, true, false, context.Canceled, context.Canceled,
+			false},
+		{"cancelled with deadline", 10 * time.Second, true, false,
+			context.Canceled, context.Canceled, true},
+		// The server sees either its own deadline pass or the client close
+		// the stream when the client deadline passes.
+		{"deadline passes", 100 * time.Millisecond, false, false,
+			context.DeadlineExceeded, nil, true},
+		{"closed", 0, false, true, errorStreamClosed, context.Canceled,
+			false},
+	}
+	client, _ := newTestMuxPair(t)
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(),
+				test.timeout)
+		}
+		conn, err := client.CallContext(ctx, "MuxTest.WaitForCancel")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if _, err := conn.ReadString('\n'); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if test.closeCall {
+			conn.Close()
+		} else if test.cancel {
+			cancel()
+		}
+		result := waitForCancelResult(t)
+		if result.err == nil || (test.wantServerError != nil &&
+			result.err != test.wantServerError) {
+			t.Errorf("%s: server error: %v, want: %v", test.name, result.err,
+				test.wantServerError)
+		}
+		if result.hasDeadline != test.wantDeadline {
+			t.Errorf("%s: server deadline: %v", test.name, result.hasDeadline)
+		}
+		if _, err := conn.ReadString('\n'); err != test.wantReadError {
+			t.Errorf("%s: read error: %v, want: %v", test.name, err,
+				test.wantReadError)
+		}
+		conn.Close()
+		cancel()
+		// Abandoning a call does not affect the others.
+		if err := add(client, 1, 2); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+	}
+}
+
+func TestRequestReplyContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	var tests = []struct {
+		name          string
+		ctx           func() (context.Context, context.CancelFunc)
+		method        string
+		wantError     error
+		wantServerRun bool
+	}{
+		{"already cancelled",
+			func() (context.Context, context.CancelFunc) {
+				return cancelled, func() {}
+			},
+			"MuxTest.WaitForCancel", context.Canceled, false},
+		{"deadline passes",
+			func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(),
+					100*time.Millisecond)
+			},
+			"MuxTest.WaitForCancel", context.DeadlineExceeded, true},
+		{"no deadline",
+			func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			"MuxTest.Add", nil, false},
+	}
+	client, _ := newTestMuxPair(t)
+	for _, test := range tests {
+		ctx, cancel := test.ctx()
+		var sum int
+		err := client.RequestReplyContext(ctx, test.method, [2]int{1, 2},
+			&sum)
+		cancel()
+		if err != test.wantError {
+			t.Errorf("%s: error: %v, want: %v", test.name, err,
+				test.wantError)
+		}
+		if test.wantServerRun {
+			if result := waitForCancelResult(t); result.err == nil {
+				t.Errorf("%s: server error: %v", test.name, result.err)
+			}
+		} else if err == nil && sum != 3 {
+			t.Errorf("%s: sum: %d", test.name, sum)
+		}
+	}
+}
+
+func TestPlainCallContext(t *testing.T) {
+	server := httptest.NewServer(http.DefaultServeMux)
+	defer server.Close()
+	client, err := dialOldClient(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := client.CallContext(ctx, "MuxTest.Wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readError := make(chan error, 1)
+	go func() {
+		_, err := conn.ReadString('\n')
+		readError <- err
+	}()
+	cancel()
+	select {
+	case err := <-readError:
+		if err == nil {
+			t.Error("read succeeded after cancellation")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("read not interrupted by cancellation")
+	}
+	conn.Close()
+	// The server cannot be told, so the connection is gone.
+	if err := client.Ping(); err == nil {
+		t.Error("client usable after cancelling a plain call")
+	}
+}
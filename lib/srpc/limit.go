@@ -0,0 +1,243 @@
+package srpc
+
+import (
+	"context"
+	"errors"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"github.com/Symantec/tricorder/go/tricorder/units"
+	"net"
+	"sync"
+	"time"
+)
+
+const userBucketPruneInterval = time.Minute
+
+// callerKey identifies a caller for the per-user rate limits. Callers which are
+// not authenticated are identified by their host address.
+type callerKey struct {
+	username string
+	host     string // Empty if username is not.
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type methodLimiter struct {
+	policy            MethodPolicy
+	semaphore         chan struct{} // nil: no concurrency limit.
+	queueDistribution *tricorder.CumulativeDistribution
+	lock              sync.Mutex // Protect everything below.
+	users             map[callerKey]*tokenBucket
+	lastPrune         time.Time
+	numConcurrencyHit uint64
+	numRateHit        uint64
+	numRejected       uint64
+}
+
+func newMethodLimiter(policy MethodPolicy) *methodLimiter {
+	limiter := &methodLimiter{
+		policy:    policy,
+		users:     make(map[callerKey]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+	if policy.MaxConcurrentCalls > 0 {
+		limiter.semaphore = make(chan struct{}, policy.MaxConcurrentCalls)
+	}
+	return limiter
+}
+
+func getCallerKey(conn *Conn) callerKey {
+	if conn.username != "" {
+		return callerKey{username: conn.username}
+	}
+	host, _, err := net.SplitHostPort(conn.remoteAddress)
+	if err != nil {
+		host = conn.remoteAddress
+	}
+	return callerKey{host: host}
+}
+
+// acquire waits for or rejects the call according to the policy. If it
+// returns nil, release must be called when the call completes. If the call
+// does not proceed, the token taken from the bucket for the caller is
+// returned.
+func (l *methodLimiter) acquire(ctx context.Context, caller callerKey) error {
+	startTime := time.Now()
+	var queued bool
+	if l.policy.MaxCallsPerUserPerSecond > 0 {
+		wait, err := l.reserve(caller, startTime)
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			queued = true
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				l.refund(caller)
+				return ctx.Err()
+			}
+		}
+	}
+	if err := l.acquireSemaphore(ctx, &queued); err != nil {
+		if l.policy.MaxCallsPerUserPerSecond > 0 {
+			l.refund(caller)
+		}
+		return err
+	}
+	if queued {
+		l.queueDistribution.Add(time.Since(startTime))
+	}
+	return nil
+}
+
+func (l *methodLimiter) acquireSemaphore(ctx context.Context,
+	queued *bool) error {
+	if l.semaphore == nil {
+		return nil
+	}
+	select {
+	case l.semaphore <- struct{}{}:
+		return nil
+	default:
+	}
+	l.lock.Lock()
+	l.numConcurrencyHit++
+	if !l.policy.QueueWhenLimited {
+		l.numRejected++
+		l.lock.Unlock()
+		return ErrorTooManyCalls
+	}
+	l.lock.Unlock()
+	*queued = true
+	select {
+	case l.semaphore <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *methodLimiter) release() {
+	if l.semaphore != nil {
+		<-l.semaphore
+	}
+}
+
+func (l *methodLimiter) getBurst() float64 {
+	if l.policy.MaxBurstPerUser < 1 {
+		return 1
+	}
+	return float64(l.policy.MaxBurstPerUser)
+}
+
+// refund returns a token taken by reserve for a call which did not proceed.
+func (l *methodLimiter) refund(caller callerKey) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if bucket := l.users[caller]; bucket != nil {
+		bucket.tokens++
+		if burst := l.getBurst(); bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+	}
+}
+
+// reserve takes a token from the bucket for the caller and returns how long to
+// wait before the token is available.
+func (l *methodLimiter) reserve(caller callerKey, now time.Time) (
+	time.Duration, error) {
+	rate := l.policy.MaxCallsPerUserPerSecond
+	burst := l.getBurst()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if now.Sub(l.lastPrune) >= userBucketPruneInterval {
+		// Forget users whose buckets have refilled.
+		for key, bucket := range l.users {
+			if bucket.tokens+now.Sub(bucket.updated).Seconds()*rate >= burst {
+				delete(l.users, key)
+			}
+		}
+		l.lastPrune = now
+	}
+	bucket := l.users[caller]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		l.users[caller] = bucket
+	} else {
+		bucket.tokens += now.Sub(bucket.updated).Seconds() * rate
+		if bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+		bucket.updated = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, nil
+	}
+	l.numRateHit++
+	if !l.policy.QueueWhenLimited {
+		l.numRejected++
+		return 0, ErrorRateLimitExceeded
+	}
+	bucket.tokens--
+	return time.Duration(-bucket.tokens / rate * float64(time.Second)), nil
+}
+
+func (l *methodLimiter) getCounter(counter *uint64) func() uint64 {
+	return func() uint64 {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		return *counter
+	}
+}
+
+func (l *methodLimiter) registerMetrics(dir *tricorder.DirectorySpec) error {
+	if l.semaphore != nil {
+		err := dir.RegisterMetric("num-active-calls",
+			func() uint { return uint(len(l.semaphore)) },
+			units.None, "number of calls in progress")
+		if err != nil {
+			return err
+		}
+		err = dir.RegisterMetric("num-concurrency-limited-calls",
+			l.getCounter(&l.numConcurrencyHit), units.None,
+			"number of calls which reached the concurrency limit")
+		if err != nil {
+			return err
+		}
+	}
+	if l.policy.MaxCallsPerUserPerSecond > 0 {
+		err := dir.RegisterMetric("num-rate-limited-calls",
+			l.getCounter(&l.numRateHit), units.None,
+			"number of calls which reached the per-user rate limit")
+		if err != nil {
+			return err
+		}
+	}
+	err := dir.RegisterMetric("num-rejected-calls",
+		l.getCounter(&l.numRejected), units.None,
+		"number of calls rejected because of limits")
+	if err != nil {
+		return err
+	}
+	l.queueDistribution = bucketer.NewCumulativeDistribution()
+	return dir.RegisterMetric("queued-call-wait-durations",
+		l.queueDistribution, units.Millisecond,
+		"time calls waited because of limits")
+}
+
+func checkMethodPolicies(name string, receiver receiverType,
+	policies map[string]MethodPolicy) error {
+	for methodName := range policies {
+		if _, ok := receiver.methods[methodName]; !ok {
+			return errors.New(name + ": policy for unknown method: " +
+				methodName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package srpc
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(policy MethodPolicy) *methodLimiter {
+	limiter := newMethodLimiter(policy)
+	limiter.queueDistribution = bucketer.NewCumulativeDistribution()
+	return limiter
+}
+
+func TestGetCallerKey(t *testing.T) {
+	var tests = []struct {
+		username      string
+		remoteAddress string
+		want          callerKey
+	}{
+		{"alice", "10.0.0.1:1234", callerKey{username: "alice"}},
+		{"", "10.0.0.1:1234", callerKey{host: "10.0.0.1"}},
+		{"", "10.0.0.1:5678", callerKey{host: "10.0.0.1"}},
+		{"", "[::1]:80", callerKey{host: "::1"}},
+		{"", "pipe", callerKey{host: "pipe"}},
+	}
+	for _, test := range tests {
+		conn := &Conn{username: test.username,
+			remoteAddress: test.remoteAddress}
+		if got := getCallerKey(conn); got != test.want {
+			t.Errorf("%q, %q: got: %+v, want: %+v", test.username,
+				test.remoteAddress, got, test.want)
+		}
+	}
+}
+
+func TestCallersLimitedSeparately(t *testing.T) {
+	limiter := newTestLimiter(MethodPolicy{MaxCallsPerUserPerSecond: 0.1})
+	var tests = []struct {
+		caller    callerKey
+		wantError error
+	}{
+		{callerKey{host: "10.0.0.1"}, nil},
+		{callerKey{host: "10.0.0.1"}, ErrorRateLimitExceeded},
+		{callerKey{host: "10.0.0.2"}, nil},
+		{callerKey{username: "10.0.0.1"}, nil},
+		{callerKey{username: "10.0.0.1"}, ErrorRateLimitExceeded},
+	}
+	for index, test := range tests {
+		err := limiter.acquire(context.Background(), test.caller)
+		if err != test.wantError {
+			t.Errorf("call %d: %+v: error: %v, want: %v", index, test.caller,
+				err, test.wantError)
+		}
+		if err == nil {
+			limiter.release()
+		}
+	}
+}
+
+func TestLimiterRefunds(t *testing.T) {
+	var tests = []struct {
+		name          string
+		policy        MethodPolicy
+		callsBefore   int
+		fillSemaphore bool
+		timeout       time.Duration
+		wantError     error
+		wantTokens    float64
+	}{
+		{"proceeds", MethodPolicy{MaxCallsPerUserPerSecond: 1,
+			MaxBurstPerUser: 2}, 0, false, 0, nil, 1},
+		{"rate limited", MethodPolicy{MaxCallsPerUserPerSecond: 1}, 1,
+			false, 0, ErrorRateLimitExceeded, 0},
+		{"concurrency limited", MethodPolicy{MaxConcurrentCalls: 1,
+			MaxCallsPerUserPerSecond: 1, MaxBurstPerUser: 2}, 0, true, 0,
+			ErrorTooManyCalls, 2},
+		{"cancelled waiting for rate", MethodPolicy{
+			MaxCallsPerUserPerSecond: 1, QueueWhenLimited: true}, 1, false,
+			50 * time.Millisecond, context.DeadlineExceeded, 0},
+		{"cancelled waiting for slot", MethodPolicy{MaxConcurrentCalls: 1,
+			MaxCallsPerUserPerSecond: 1, MaxBurstPerUser: 2,
+			QueueWhenLimited: true}, 0, true, 50 * time.Millisecond,
+			context.DeadlineExceeded, 2},
+	}
+	caller := callerKey{username: "user"}
+	for _, test := range tests {
+		limiter := newTestLimiter(test.policy)
+		for i := 0; i < test.callsBefore; i++ {
+			if err := limiter.acquire(context.Background(),
+				caller); err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+			limiter.release()
+		}
+		if test.fillSemaphore {
+			limiter.semaphore <- struct{}{}
+		}
+		ctx := context.Background()
+		if test.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.timeout)
+			defer cancel()
+		}
+		if err := limiter.acquire(ctx, caller); err != test.wantError {
+			t.Errorf("%s: error: %v, want: %v", test.name, err,
+				test.wantError)
+		}
+		// Tokens are added at the rate limit, so allow for the time taken.
+		tokens := limiter.users[caller].tokens
+		if math.Abs(tokens-test.wantTokens) > 0.2 {
+			t.Errorf("%s: tokens: %.2f, want: %.2f", test.name, tokens,
+				test.wantTokens)
+		}
+	}
+}
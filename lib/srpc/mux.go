@@ -0,0 +1,438 @@
+package srpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// The multiplexed protocol carries many concurrent calls (streams) over one
+// connection. Each frame starts with a header containing the stream ID, the
+// frame type and the length of the payload which follows. Only the client
+// opens streams. Each stream is then used exactly like a connection in the
+// plain protocol: the client sends the Service.Method line and the server
+// replies with an empty line or an error.
+//
+// Each side may have up to muxWindowSize bytes of unread data outstanding per
+// stream. The reader grants more as data are consumed, so a slow stream does
+// not hold up the others. Closing a stream means that the sender will neither
+// read nor write it any more: data in flight to a closed stream are discarded
+// and further writes by the peer fail.
+//
+// The open frame may carry the time remaining before the call deadline (in
+// nanoseconds). A client which abandons a call closes the stream. When the
+// client closes a stream the server side of the call is cancelled.
+const (
+	muxConnectString = "200 Connected to Go SRPC (multiplexed)"
+	muxHeaderName    = "X-Srpc-Multiplex"
+	muxHeaderSize    = 9
+	muxMaxDataSize   = 32 << 10
+	muxMaxStreams    = 256 // Per connection.
+	muxWindowSize    = 256 << 10
+)
+
+const (
+	muxFrameData = iota
+	muxFrameOpen
+	muxFrameClose
+	muxFrameWindow
+)
+
+var (
+	errorConnectionClosed   = errors.New("connection closed")
+	errorStreamClosed       = errors.New("stream closed")
+	errorStreamClosedByPeer = errors.New("stream closed by peer")
+)
+
+type muxConn struct {
+	conn         io.Closer
+	bufrw        *bufio.ReadWriter
+	connTemplate *Conn // Server only: authentication for new streams.
+	writeLock    sync.Mutex
+	lock         sync.Mutex // Protects everything below and all streams.
+	err          error      // Set when the connection fails or is closed.
+	nextStreamId uint32
+	streams      map[uint32]*stream
+}
+
+type stream struct {
+	mux            *muxConn
+	id             uint32
+	ctx            context.Context
+	cancel         context.CancelFunc
+	cond           *sync.Cond // Uses mux.lock.
+	err            error      // Set if the call was cancelled.
+	readBuffer     bytes.Buffer
+	unacknowledged int // Bytes read since the last window update.
+	sendWindow     int
+	localClosed    bool
+	remoteClosed   bool
+}
+
+func newMuxConn(conn io.Closer, bufrw *bufio.ReadWriter,
+	connTemplate *Conn) *muxConn {
+	return &muxConn{
+		conn:         conn,
+		bufrw:        bufrw,
+		connTemplate: connTemplate,
+		nextStreamId: 1,
+		streams:      make(map[uint32]*stream),
+	}
+}
+
+func newMuxClient(conn net.Conn, isEncrypted bool,
+	bufrw *bufio.ReadWriter) *Client {
+	mux := newMuxConn(conn, bufrw, nil)
+	go func() {
+		mux.fail(mux.readFrames())
+		conn.Close()
+	}()
+	return &Client{
+		conn:        conn,
+		isEncrypted: isEncrypted,
+		bufrw:       bufrw,
+		mux:         mux,
+	}
+}
+
+// serveMux handles streams on a server connection until the connection is
+// closed.
+func serveMux(connTemplate *Conn, conn io.Closer, bufrw *bufio.ReadWriter) {
+	mux := newMuxConn(conn, bufrw, connTemplate)
+	err := mux.readFrames()
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		log.Println(err)
+	}
+	mux.fail(err)
+}
+
+// addStream must be called with the lock held. The stream is cancelled when
+// ctx is done or after timeout (if greater than zero).
+func (mux *muxConn) addStream(ctx context.Context, timeout time.Duration,
+	id uint32) *stream {
+	s := &stream{mux: mux, id: id, sendWindow: muxWindowSize}
+	if timeout > 0 {
+		s.ctx, s.cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		s.ctx, s.cancel = context.WithCancel(ctx)
+	}
+	s.cond = sync.NewCond(&mux.lock)
+	mux.streams[id] = s
+	go s.watchContext()
+	return s
+}
+
+func (mux *muxConn) close() error {
+	mux.writeLock.Lock()
+	mux.bufrw.Flush()
+	mux.writeLock.Unlock()
+	mux.fail(errorConnectionClosed)
+	return mux.conn.Close()
+}
+
+// fail wakes up all streams, which will then return err.
+func (mux *muxConn) fail(err error) {
+	if err == io.EOF {
+		err = errorConnectionClosed
+	}
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+	if mux.err == nil {
+		mux.err = err
+	}
+	for _, s := range mux.streams {
+		s.cancel()
+		s.cond.Broadcast()
+	}
+}
+
+func (mux *muxConn) openStream(ctx context.Context) (*stream, error) {
+	mux.lock.Lock()
+	if mux.err != nil {
+		err := mux.err
+		mux.lock.Unlock()
+		return nil, err
+	}
+	id := mux.nextStreamId
+	mux.nextStreamId++
+	s := mux.addStream(ctx, 0, id)
+	mux.lock.Unlock()
+	var payload []byte
+	if deadline, ok := ctx.Deadline(); ok {
+		payload = make([]byte, 8)
+		binary.BigEndian.PutUint64(payload, uint64(time.Until(deadline)))
+	}
+	if err := mux.writeFrame(id, muxFrameOpen, payload); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (mux *muxConn) readFrames() error {
+	var header [muxHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(mux.bufrw, header[:]); err != nil {
+			return err
+		}
+		id := binary.BigEndian.Uint32(header[0:4])
+		frameType := header[4]
+		length := binary.BigEndian.Uint32(header[5:9])
+		if length > muxMaxDataSize {
+			return errors.New("oversized frame")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(mux.bufrw, payload); err != nil {
+			return err
+		}
+		if err := mux.processFrame(id, frameType, payload); err != nil {
+			return err
+		}
+	}
+}
+
+func (mux *muxConn) processFrame(id uint32, frameType byte,
+	payload []byte) error {
+	mux.lock.Lock()
+	defer mux.lock.Unlock()
+	s := mux.streams[id]
+	switch frameType {
+	case muxFrameOpen:
+		if mux.connTemplate == nil || s != nil {
+			return errors.New("unexpected stream open")
+		}
+		var timeout time.Duration
+		if len(payload) == 8 {
+			timeout = time.Duration(binary.BigEndian.Uint64(payload))
+			if timeout < 1 {
+				timeout = 1 // Already expired.
+			}
+		}
+		s := mux.addStream(context.Background(), timeout, id)
+		go mux.serveStream(s, len(mux.streams))
+	case muxFrameData:
+		if s == nil || s.localClosed {
+			return nil // Discard data for closed streams.
+		}
+		if s.readBuffer.Len()+len(payload) > muxWindowSize {
+			return errors.New("stream window exceeded")
+		}
+		s.readBuffer.Write(payload)
+		s.cond.Broadcast()
+	case muxFrameClose:
+		if s == nil {
+			return nil
+		}
+		s.remoteClosed = true
+		if s.localClosed {
+			delete(mux.streams, id)
+		}
+		if mux.connTemplate != nil {
+			s.cancel() // The client has abandoned the call.
+		}
+		s.cond.Broadcast()
+	case muxFrameWindow:
+		if len(payload) != 4 {
+			return errors.New("bad window frame")
+		}
+		if s == nil {
+			return nil
+		}
+		s.sendWindow += int(binary.BigEndian.Uint32(payload))
+		s.cond.Broadcast()
+	default:
+		return errors.New("unknown frame type")
+	}
+	return nil
+}
+
+func (mux *muxConn) serveStream(s *stream, numStreams int) {
+	defer s.close()
+	conn := &Conn{
+		ctx:              s.ctx,
+		isEncrypted:      mux.connTemplate.isEncrypted,
+		ReadWriter:       newStreamReadWriter(s),
+		username:         mux.connTemplate.username,
+		permittedMethods: mux.connTemplate.permittedMethods,
+		groups:           mux.connTemplate.groups,
+		remoteAddress:    mux.connTemplate.remoteAddress,
+		stream:           s,
+	}
+	if numStreams > muxMaxStreams {
+		// Read the method line first, so that the client is still writing
+		// to an open stream and will read the reply.
+		if _, err := conn.ReadString('\n'); err != nil {
+			return
+		}
+		conn.WriteString("too many concurrent calls\n")
+		conn.Flush()
+		return
+	}
+	handleConnection(conn)
+}
+
+func (mux *muxConn) writeFrame(id uint32, frameType byte,
+	payload []byte) error {
+	var header [muxHeaderSize]byte
+	binary.BigEndian.PutUint32(header[0:4], id)
+	header[4] = frameType
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(payload)))
+	mux.writeLock.Lock()
+	defer mux.writeLock.Unlock()
+	if _, err := mux.bufrw.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := mux.bufrw.Write(payload); err != nil {
+		return err
+	}
+	return mux.bufrw.Flush()
+}
+
+func newStreamReadWriter(s *stream) *bufio.ReadWriter {
+	return bufio.NewReadWriter(bufio.NewReaderSize(s, muxMaxDataSize),
+		bufio.NewWriterSize(s, muxMaxDataSize))
+}
+
+// watchContext wakes up readers and writers when the stream context is done.
+// On the client this means the call was cancelled or its deadline passed, so
+// the server is told to stop by closing the stream.
+func (s *stream) watchContext() {
+	<-s.ctx.Done()
+	mux := s.mux
+	mux.lock.Lock()
+	sendClose := false
+	if !s.localClosed && s.err == nil {
+		if mux.err != nil {
+			s.err = mux.err
+		} else {
+			s.err = s.ctx.Err()
+			sendClose = mux.connTemplate == nil
+		}
+	}
+	s.cond.Broadcast()
+	mux.lock.Unlock()
+	if sendClose {
+		mux.writeFrame(s.id, muxFrameClose, nil)
+	}
+}
+
+func (s *stream) close() {
+	mux := s.mux
+	mux.lock.Lock()
+	if s.localClosed {
+		mux.lock.Unlock()
+		return
+	}
+	defer s.cancel()
+	s.localClosed = true
+	s.readBuffer.Reset()
+	if s.remoteClosed {
+		delete(mux.streams, s.id)
+	}
+	s.cond.Broadcast()
+	failed := mux.err != nil
+	mux.lock.Unlock()
+	if !failed {
+		mux.writeFrame(s.id, muxFrameClose, nil)
+	}
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	mux := s.mux
+	mux.lock.Lock()
+	for s.readBuffer.Len() < 1 && !s.localClosed && !s.remoteClosed &&
+		s.err == nil && mux.err == nil {
+		s.cond.Wait()
+	}
+	if s.err != nil && !s.localClosed && !s.remoteClosed {
+		err := s.err
+		mux.lock.Unlock()
+		return 0, err
+	}
+	if s.readBuffer.Len() < 1 {
+		var err error
+		if s.localClosed {
+			err = errorStreamClosed
+		} else if mux.connTemplate == nil && mux.err == nil &&
+			s.ctx.Err() != nil {
+			err = s.ctx.Err() // The call was abandoned by this client.
+		} else if s.remoteClosed {
+			err = io.EOF
+		} else if s.err != nil {
+			err = s.err
+		} else {
+			err = mux.err
+		}
+		mux.lock.Unlock()
+		return 0, err
+	}
+	nRead, _ := s.readBuffer.Read(p)
+	s.unacknowledged += nRead
+	var window [4]byte
+	sendWindow := false
+	if s.unacknowledged >= muxWindowSize/2 && !s.remoteClosed {
+		binary.BigEndian.PutUint32(window[:], uint32(s.unacknowledged))
+		s.unacknowledged = 0
+		sendWindow = true
+	}
+	mux.lock.Unlock()
+	if sendWindow {
+		if err := mux.writeFrame(s.id, muxFrameWindow, window[:]); err != nil {
+			return nRead, err
+		}
+	}
+	return nRead, nil
+}
+
+// Write blocks until the peer has room for the data.
+func (s *stream) Write(p []byte) (int, error) {
+	mux := s.mux
+	nWritten := 0
+	for len(p) > 0 {
+		mux.lock.Lock()
+		for s.sendWindow < 1 && !s.localClosed && !s.remoteClosed &&
+			s.err == nil && mux.err == nil {
+			s.cond.Wait()
+		}
+		if s.localClosed {
+			mux.lock.Unlock()
+			return nWritten, errorStreamClosed
+		}
+		if s.err != nil {
+			err := s.err
+			mux.lock.Unlock()
+			return nWritten, err
+		}
+		if mux.err != nil {
+			err := mux.err
+			mux.lock.Unlock()
+			return nWritten, err
+		}
+		if s.remoteClosed {
+			mux.lock.Unlock()
+			return nWritten, errorStreamClosedByPeer
+		}
+		size := len(p)
+		if size > s.sendWindow {
+			size = s.sendWindow
+		}
+		if size > muxMaxDataSize {
+			size = muxMaxDataSize
+		}
+		s.sendWindow -= size
+		mux.lock.Unlock()
+		if err := mux.writeFrame(s.id, muxFrameData, p[:size]); err != nil {
+			return nWritten, err
+		}
+		nWritten += size
+		p = p[size:]
+	}
+	return nWritten, nil
+}
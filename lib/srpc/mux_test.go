@@ -0,0 +1,366 @@
+package srpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type muxTestType struct{}
+
+func init() {
+	if err := RegisterName("MuxTest", muxTestType{}); err != nil {
+		panic(err)
+	}
+}
+
+// Add replies with the sum of the request.
+func (muxTestType) Add(conn *Conn, request [2]int, reply *int) error {
+	*reply = request[0] + request[1]
+	return nil
+}
+
+// Generate reads a decimal length and sends that many bytes.
+func (muxTestType) Generate(conn *Conn) error {
+	line, err := conn.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	length, err := strconv.Atoi(line[:len(line)-1])
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(bytes.Repeat([]byte{'x'}, length)); err != nil {
+		return err
+	}
+	return conn.Flush()
+}
+
+// Wait returns once the client sends a line or closes the call, or the call
+// is cancelled.
+func (muxTestType) Wait(conn *Conn) error {
+	if _, err := conn.ReadString('\n'); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// newTestMuxPair returns a multiplexed client connected over a pipe to a
+// server, and the server side of the connection.
+func newTestMuxPair(t *testing.T) (*Client, *muxConn) {
+	clientConn, serverConn := net.Pipe()
+	serverMux := newMuxConn(serverConn,
+		bufio.NewReadWriter(bufio.NewReader(serverConn),
+			bufio.NewWriter(serverConn)),
+		&Conn{})
+	go func() {
+		serverMux.fail(serverMux.readFrames())
+		serverConn.Close()
+	}()
+	client := newClient(clientConn, false, true)
+	t.Cleanup(func() { client.Close() })
+	return client, serverMux
+}
+
+func add(client *Client, a, b int) error {
+	var sum int
+	if err := client.RequestReply("MuxTest.Add", [2]int{a, b},
+		&sum); err != nil {
+		return err
+	}
+	if sum != a+b {
+		return fmt.Errorf("%d+%d=%d", a, b, sum)
+	}
+	return nil
+}
+
+// waitFor polls condition (with the connection lock held) until it is true.
+func waitFor(t *testing.T, mux *muxConn, condition func() bool) {
+	timeout := time.Now().Add(10 * time.Second)
+	for {
+		mux.lock.Lock()
+		done := condition()
+		mux.lock.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(timeout) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func appendFrame(frames []byte, id uint32, frameType byte,
+	payload []byte) []byte {
+	frames = binary.BigEndian.AppendUint32(frames, id)
+	frames = append(frames, frameType)
+	frames = binary.BigEndian.AppendUint32(frames, uint32(len(payload)))
+	return append(frames, payload...)
+}
+
+func TestMuxFrames(t *testing.T) {
+	data := make([]byte, muxMaxDataSize)
+	var fullWindow []byte
+	for i := 0; i < muxWindowSize/muxMaxDataSize; i++ {
+		fullWindow = appendFrame(fullWindow, 1, muxFrameData, data)
+	}
+	var tests = []struct {
+		name      string
+		server    bool
+		frames    []byte
+		wantError string // Empty: frames are accepted.
+	}{
+		{"open on client", false, appendFrame(nil, 2, muxFrameOpen, nil),
+			"unexpected stream open"},
+		{"reopen on server", true, appendFrame(nil, 1, muxFrameOpen, nil),
+			"unexpected stream open"},
+		{"data for unknown stream", false,
+			appendFrame(nil, 5, muxFrameData, []byte("data")), ""},
+		{"close for unknown stream", false,
+			appendFrame(nil, 5, muxFrameClose, nil), ""},
+		{"full window", false, fullWindow, ""},
+		{"window exceeded", false,
+			appendFrame(fullWindow, 1, muxFrameData, []byte{0}),
+			"stream window exceeded"},
+		{"window update", false,
+			appendFrame(nil, 1, muxFrameWindow, []byte{0, 0, 1, 0}), ""},
+		{"bad window update", false,
+			appendFrame(nil, 1, muxFrameWindow, []byte{0, 0, 1}),
+			"bad window frame"},
+		{"oversized", false,
+			appendFrame(nil, 1, muxFrameData, append(data, 0)),
+			"oversized frame"},
+		{"unknown type", false, appendFrame(nil, 1, 9, nil),
+			"unknown frame type"},
+		{"truncated", false,
+			appendFrame(nil, 1, muxFrameData, data)[:muxHeaderSize+10],
+			io.ErrUnexpectedEOF.Error()},
+	}
+	for _, test := range tests {
+		var connTemplate *Conn
+		if test.server {
+			connTemplate = &Conn{}
+		}
+		mux := newMuxConn(ioutil.NopCloser(nil),
+			bufio.NewReadWriter(
+				bufio.NewReader(bytes.NewReader(test.frames)),
+				bufio.NewWriter(ioutil.Discard)),
+			connTemplate)
+		mux.lock.Lock()
+		s := mux.addStream(context.Background(), 0, 1)
+		mux.lock.Unlock()
+		err := mux.readFrames()
+		if err == io.EOF {
+			err = nil
+		}
+		if test.wantError == "" && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if test.wantError != "" &&
+			(err == nil || err.Error() != test.wantError) {
+			t.Errorf("%s: error: %v, want: %s", test.name, err,
+				test.wantError)
+		}
+		if test.name == "window update" && s.sendWindow != muxWindowSize+256 {
+			t.Errorf("%s: send window: %d", test.name, s.sendWindow)
+		}
+		mux.fail(io.EOF)
+	}
+}
+
+func TestMuxConcurrentCalls(t *testing.T) {
+	client, _ := newTestMuxPair(t)
+	// Streams stay open while other calls are made on the same Client.
+	waitConn, err := client.Call("MuxTest.Wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const numCalls = 20
+	results := make(chan error, numCalls)
+	for i := 0; i < numCalls; i++ {
+		go func(i int) { results <- add(client, i, i) }(i)
+	}
+	for i := 0; i < numCalls; i++ {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+	}
+	waitConn.WriteString("\n")
+	waitConn.Flush()
+	waitConn.Close()
+	if err := client.Ping(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMuxFlowControl(t *testing.T) {
+	client, serverMux := newTestMuxPair(t)
+	const length = 2*muxWindowSize + 1000
+	conn, err := client.Call("MuxTest.Generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteString(strconv.Itoa(length) + "\n")
+	conn.Flush()
+	id := conn.stream.id
+	// The server stops sending when the client's window is full.
+	waitFor(t, serverMux, func() bool {
+		s := serverMux.streams[id]
+		return s != nil && s.sendWindow < 1
+	})
+	// The reply to the method line used one byte of the window. The last
+	// frames sent may still be in flight.
+	var buffered int
+	waitFor(t, client.mux, func() bool {
+		buffered = conn.stream.readBuffer.Len()
+		return buffered >= muxWindowSize-1
+	})
+	if buffered != muxWindowSize-1 {
+		t.Errorf("buffered: %d, want: %d", buffered, muxWindowSize-1)
+	}
+	// A stalled stream does not hold up other calls.
+	if err := add(client, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	nRead, err := io.Copy(ioutil.Discard, io.LimitReader(conn, length))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nRead != length {
+		t.Errorf("read: %d bytes, want: %d", nRead, length)
+	}
+}
+
+func TestMuxStreamLimit(t *testing.T) {
+	client, serverMux := newTestMuxPair(t)
+	conns := make([]*Conn, 0, muxMaxStreams)
+	for i := 0; i < muxMaxStreams; i++ {
+		conn, err := client.Call("MuxTest.Wait")
+		if err != nil {
+			t.Fatalf("call %d: %s", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	_, err := client.Call("MuxTest.Wait")
+	if err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Fatalf("call beyond limit: %v", err)
+	}
+	// Finishing a call makes room for another.
+	conns[0].Close()
+	waitFor(t, serverMux, func() bool {
+		return len(serverMux.streams) < muxMaxStreams
+	})
+	conn, err := client.Call("MuxTest.Wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns[0] = conn
+	for _, conn := range conns {
+		conn.Close()
+	}
+	waitFor(t, serverMux, func() bool { return len(serverMux.streams) == 0 })
+}
+
+// oldServerHandler serves the plain protocol and ignores the multiplexing
+// header, like servers which predate multiplexing.
+func oldServerHandler(w http.ResponseWriter, req *http.Request) {
+	conn, bufrw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	io.WriteString(conn, "HTTP/1.0 "+connectString+"\n\n")
+	handleConnection(&Conn{ReadWriter: bufrw})
+}
+
+// dialOldClient connects without asking for multiplexing, like clients which
+// predate it.
+func dialOldClient(address string) (*Client, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(conn, "CONNECT "+rpcPath+" HTTP/1.0\n\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: "CONNECT"})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.Status != connectString {
+		conn.Close()
+		return nil, errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	return &Client{
+		conn:  conn,
+		bufrw: bufio.NewReadWriter(reader, bufio.NewWriter(conn)),
+	}, nil
+}
+
+func TestMuxInterop(t *testing.T) {
+	newServer := httptest.NewServer(http.DefaultServeMux)
+	defer newServer.Close()
+	oldServer := httptest.NewServer(http.HandlerFunc(oldServerHandler))
+	defer oldServer.Close()
+	newDial := func(address string) (*Client, error) {
+		return DialHTTP("tcp", address, 0)
+	}
+	var tests = []struct {
+		name            string
+		server          *httptest.Server
+		dial            func(address string) (*Client, error)
+		wantMultiplexed bool
+	}{
+		{"new client, new server", newServer, newDial, true},
+		{"new client, old server", oldServer, newDial, false},
+		{"old client, new server", newServer, dialOldClient, false},
+	}
+	for _, test := range tests {
+		client, err := test.dial(strings.TrimPrefix(test.server.URL,
+			"http://"))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if multiplexed := client.mux != nil; multiplexed !=
+			test.wantMultiplexed {
+			t.Errorf("%s: multiplexed: %v", test.name, multiplexed)
+		}
+		for i := 0; i < 3; i++ {
+			if err := add(client, i, 1); err != nil {
+				t.Errorf("%s: call %d: %s", test.name, i, err)
+			}
+		}
+		if err := client.Ping(); err != nil {
+			t.Errorf("%s: ping: %s", test.name, err)
+		}
+		if test.wantMultiplexed {
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if err := add(client, i, i); err != nil {
+						t.Errorf("%s: concurrent call: %s", test.name, err)
+					}
+				}(i)
+			}
+			wg.Wait()
+		}
+		client.Close()
+	}
+}
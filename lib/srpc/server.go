@@ -3,6 +3,7 @@ package srpc
 import (
 	"bufio"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/gob"
 	"errors"
 	"github.com/Symantec/Dominator/lib/x509util"
@@ -17,6 +18,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +32,7 @@ const (
 type methodWrapper struct {
 	plain                         bool
 	fn                            reflect.Value
+	limiter                       *methodLimiter // nil: no limits.
 	requestType                   reflect.Type
 	responseType                  reflect.Type
 	failedCallsDistribution       *tricorder.CumulativeDistribution
@@ -51,8 +54,18 @@ var (
 	mutex                  sync.Mutex
 	numConnections         uint64
 	numRejectedConnections uint64
+	numRevokedConnections  uint64
+	trackedConnectionsLock sync.Mutex
+	trackedConnections     = make(map[*trackedConnection]struct{})
 )
 
+// trackedConnection is an authenticated connection, which is closed if a
+// certificate in its chains is revoked.
+type trackedConnection struct {
+	chains [][]*x509.Certificate
+	conn   io.Closer // The underlying connection, so that Close does not block.
+}
+
 // Precompute some reflect types. Can't use the types directly because Typeof
 // takes an empty interface value. This is annoying.
 var typeOfConn = reflect.TypeOf((**Conn)(nil)).Elem()
@@ -77,10 +90,17 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	err = serverMetricsDir.RegisterMetric("num-revoked-connections",
+		&numRevokedConnections, units.None,
+		"number of connections rejected or closed because of revocation")
+	if err != nil {
+		panic(err)
+	}
 	bucketer = tricorder.NewGeometricBucketer(0.1, 1e5)
 }
 
-func registerName(name string, rcvr interface{}) error {
+func registerName(name string, rcvr interface{},
+	options ReceiverOptions) error {
 	var receiver receiverType
 	receiver.methods = make(map[string]*methodWrapper)
 	typeOfReceiver := reflect.TypeOf(rcvr)
@@ -99,6 +119,9 @@ func registerName(name string, rcvr interface{}) error {
 		if mVal == nil {
 			continue
 		}
+		if policy, ok := options.MethodPolicies[method.Name]; ok {
+			mVal.limiter = newMethodLimiter(policy)
+		}
 		receiver.methods[method.Name] = mVal
 		dir, err := receiverMetricsDir.RegisterDirectory(method.Name)
 		if err != nil {
@@ -108,6 +131,10 @@ func registerName(name string, rcvr interface{}) error {
 			return err
 		}
 	}
+	if err := checkMethodPolicies(name, receiver,
+		options.MethodPolicies); err != nil {
+		return err
+	}
 	receivers[name] = receiver
 	return nil
 }
@@ -168,6 +195,11 @@ func (m *methodWrapper) registerMetrics(dir *tricorder.DirectorySpec) error {
 	if err != nil {
 		return err
 	}
+	if m.limiter != nil {
+		if err := m.limiter.registerMetrics(dir); err != nil {
+			return err
+		}
+	}
 	if m.plain {
 		return nil
 	}
@@ -228,12 +260,19 @@ func httpHandler(w http.ResponseWriter, req *http.Request, doTls bool) {
 			return
 		}
 	}
-	_, err = io.WriteString(unsecuredConn, "HTTP/1.0 "+connectString+"\n\n")
+	multiplexed := req.Header.Get(muxHeaderName) != ""
+	if multiplexed {
+		_, err = io.WriteString(unsecuredConn,
+			"HTTP/1.0 "+muxConnectString+"\n\n")
+	} else {
+		_, err = io.WriteString(unsecuredConn,
+			"HTTP/1.0 "+connectString+"\n\n")
+	}
 	if err != nil {
 		log.Println("error writing connect message: ", err.Error())
 		return
 	}
-	myConn := new(Conn)
+	myConn := &Conn{remoteAddress: req.RemoteAddr}
 	if doTls {
 		tlsConn := tls.Server(unsecuredConn, serverTlsConfig)
 		defer tlsConn.Close()
@@ -245,43 +284,130 @@ func httpHandler(w http.ResponseWriter, req *http.Request, doTls bool) {
 			return
 		}
 		myConn.isEncrypted = true
-		myConn.username, myConn.permittedMethods, err = getAuth(
-			tlsConn.ConnectionState())
+		// Track before checking, so that a revocation which arrives during
+		// the check closes the connection.
+		tracked := trackConnection(tlsConn.ConnectionState().VerifiedChains,
+			unsecuredConn)
+		defer untrackConnection(tracked)
+		myConn.username, myConn.permittedMethods, myConn.groups, err =
+			getAuth(tlsConn.ConnectionState())
 		if err != nil {
 			log.Println(err)
 			return
 		}
 		myConn.ReadWriter = bufio.NewReadWriter(bufio.NewReader(tlsConn),
 			bufio.NewWriter(tlsConn))
+		if multiplexed {
+			serveMux(myConn, tlsConn, myConn.ReadWriter)
+			return
+		}
 	} else {
 		defer unsecuredConn.Close()
 		myConn.ReadWriter = bufrw
+		if multiplexed {
+			serveMux(myConn, unsecuredConn, myConn.ReadWriter)
+			return
+		}
 	}
 	handleConnection(myConn)
 }
 
-func getAuth(state tls.ConnectionState) (string, map[string]struct{}, error) {
+func getAuth(state tls.ConnectionState) (string, map[string]struct{},
+	map[string]struct{}, error) {
 	var username string
 	permittedMethods := make(map[string]struct{})
+	groups := make(map[string]struct{})
 	for _, certChain := range state.VerifiedChains {
 		for _, cert := range certChain {
+			if err := checkRevoked(cert); err != nil {
+				return "", nil, nil, err
+			}
 			var err error
 			if username == "" {
 				username, err = x509util.GetUsername(cert)
 				if err != nil {
-					return "", nil, err
+					return "", nil, nil, err
 				}
 			}
 			pms, err := x509util.GetPermittedMethods(cert)
 			if err != nil {
-				return "", nil, err
+				return "", nil, nil, err
 			}
 			for method := range pms {
 				permittedMethods[method] = struct{}{}
 			}
+			certGroups, err := x509util.GetGroups(cert)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			for group := range certGroups {
+				groups[group] = struct{}{}
+			}
 		}
 	}
-	return username, permittedMethods, nil
+	return username, permittedMethods, groups, nil
+}
+
+func checkRevoked(cert *x509.Certificate) error {
+	if revocationChecker == nil {
+		return nil
+	}
+	if err := revocationChecker.CheckCertificate(cert); err != nil {
+		mutex.Lock()
+		numRejectedConnections++
+		numRevokedConnections++
+		mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+func trackConnection(chains [][]*x509.Certificate,
+	conn io.Closer) *trackedConnection {
+	tracked := &trackedConnection{chains: chains, conn: conn}
+	trackedConnectionsLock.Lock()
+	trackedConnections[tracked] = struct{}{}
+	trackedConnectionsLock.Unlock()
+	return tracked
+}
+
+func untrackConnection(tracked *trackedConnection) {
+	trackedConnectionsLock.Lock()
+	delete(trackedConnections, tracked)
+	trackedConnectionsLock.Unlock()
+}
+
+func (tracked *trackedConnection) isRevoked() bool {
+	for _, certChain := range tracked.chains {
+		for _, cert := range certChain {
+			if revocationChecker.CheckCertificate(cert) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func closeRevokedConnections() uint {
+	if revocationChecker == nil {
+		return 0
+	}
+	var revoked []*trackedConnection
+	trackedConnectionsLock.Lock()
+	for tracked := range trackedConnections {
+		if tracked.isRevoked() {
+			revoked = append(revoked, tracked)
+			delete(trackedConnections, tracked)
+		}
+	}
+	trackedConnectionsLock.Unlock()
+	for _, tracked := range revoked {
+		tracked.conn.Close()
+	}
+	mutex.Lock()
+	numRevokedConnections += uint64(len(revoked))
+	mutex.Unlock()
+	return uint(len(revoked))
 }
 
 func handleConnection(conn *Conn) {
@@ -291,6 +417,9 @@ func handleConnection(conn *Conn) {
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			return
 		}
+		if err != nil && conn.getContext().Err() != nil {
+			return // The call was cancelled.
+		}
 		if err != nil {
 			log.Println(err)
 			if _, err := conn.WriteString(err.Error() + "\n"); err != nil {
@@ -317,24 +446,34 @@ func handleConnection(conn *Conn) {
 			continue
 		}
 		if !conn.checkPermitted(serviceMethod) {
-			method.numDeniedCalls++
+			atomic.AddUint64(&method.numDeniedCalls, 1)
 			if _, e := conn.WriteString(
 				ErrorAccessToMethodDenied.Error() + "\n"); e != nil {
 				log.Println(e)
 				return
 			}
 			continue
-		} else {
-			if _, err := conn.WriteString("\n"); err != nil {
-				log.Println(err)
+		}
+		if err := method.acquire(conn); err != nil {
+			if _, e := conn.WriteString(err.Error() + "\n"); e != nil {
+				log.Println(e)
 				return
 			}
+			continue
+		}
+		if _, err := conn.WriteString("\n"); err != nil {
+			method.release()
+			log.Println(err)
+			return
 		}
 		if err := conn.Flush(); err != nil {
+			method.release()
 			log.Println(err)
 			return
 		}
-		if err := method.call(conn); err != nil {
+		err = method.call(conn)
+		method.release()
+		if err != nil {
 			log.Println(err)
 			return
 		}
@@ -351,6 +490,9 @@ func (conn *Conn) checkPermitted(serviceMethod string) bool {
 			return true
 		}
 	}
+	if groupPolicy != nil && len(conn.groups) > 0 {
+		return groupPolicy.PermitsMethod(conn.groups, serviceMethod)
+	}
 	return false
 }
 
@@ -387,8 +529,23 @@ func listMethodsHttpHandler(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// acquire applies the limits for the method, if any. If it returns nil,
+// release must be called when the call completes.
+func (m *methodWrapper) acquire(conn *Conn) error {
+	if m.limiter == nil {
+		return nil
+	}
+	return m.limiter.acquire(conn.getContext(), getCallerKey(conn))
+}
+
+func (m *methodWrapper) release() {
+	if m.limiter != nil {
+		m.limiter.release()
+	}
+}
+
 func (m *methodWrapper) call(conn *Conn) error {
-	m.numPermittedCalls++
+	atomic.AddUint64(&m.numPermittedCalls, 1)
 	startTime := time.Now()
 	err := m._call(conn)
 	timeTaken := time.Since(startTime)
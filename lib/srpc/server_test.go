@@ -0,0 +1,138 @@
+package srpc
+
+import (
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// serialChecker revokes certificates with the serial numbers it holds.
+type serialChecker map[int64]struct{}
+
+func (checker serialChecker) CheckCertificate(cert *x509.Certificate) error {
+	if _, ok := checker[cert.SerialNumber.Int64()]; ok {
+		return errors.New("revoked")
+	}
+	return nil
+}
+
+type testCloser struct {
+	closed bool
+}
+
+func (closer *testCloser) Close() error {
+	closer.closed = true
+	return nil
+}
+
+func makeChains(serials ...int64) [][]*x509.Certificate {
+	chain := make([]*x509.Certificate, 0, len(serials))
+	for _, serial := range serials {
+		chain = append(chain,
+			&x509.Certificate{SerialNumber: big.NewInt(serial)})
+	}
+	return [][]*x509.Certificate{chain}
+}
+
+func TestCloseRevokedConnections(t *testing.T) {
+	defer func() { revocationChecker = nil }()
+	var tests = []struct {
+		name       string
+		chains     [][]*x509.Certificate
+		wantClosed bool
+	}{
+		{"not revoked", makeChains(1, 100), false},
+		{"leaf revoked", makeChains(2, 100), true},
+		{"intermediate revoked", makeChains(3, 101, 100), true},
+		{"no chains", nil, false},
+	}
+	closers := make([]*testCloser, len(tests))
+	tracked := make([]*trackedConnection, len(tests))
+	for index, test := range tests {
+		closers[index] = &testCloser{}
+		tracked[index] = trackConnection(test.chains, closers[index])
+	}
+	defer func() {
+		for _, trackedConn := range tracked {
+			untrackConnection(trackedConn)
+		}
+	}()
+	if numClosed := closeRevokedConnections(); numClosed != 0 {
+		t.Errorf("closed: %d without a checker", numClosed)
+	}
+	RegisterRevocationChecker(serialChecker{2: {}, 101: {}})
+	if numClosed := closeRevokedConnections(); numClosed != 2 {
+		t.Errorf("closed: %d, want: 2", numClosed)
+	}
+	for index, test := range tests {
+		if closers[index].closed != test.wantClosed {
+			t.Errorf("%s: closed: %v", test.name, closers[index].closed)
+		}
+	}
+	// Closed connections are no longer tracked.
+	if numClosed := closeRevokedConnections(); numClosed != 0 {
+		t.Errorf("closed again: %d", numClosed)
+	}
+}
+
+// testGroupPolicy permits each group to call the methods it holds.
+type testGroupPolicy map[string][]string
+
+func (policy testGroupPolicy) PermitsMethod(groups map[string]struct{},
+	serviceMethod string) bool {
+	for group := range groups {
+		for _, method := range policy[group] {
+			if method == serviceMethod {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestCheckPermitted(t *testing.T) {
+	defer func() { groupPolicy = nil }()
+	policy := testGroupPolicy{"release": {"ImageServer.AddImage"}}
+	var tests = []struct {
+		name             string
+		permittedMethods []string // nil: all permitted.
+		groups           []string
+		policy           GroupPolicy
+		serviceMethod    string
+		want             bool
+	}{
+		{"unauthenticated", nil, nil, nil, "Subd.Poll", true},
+		{"no methods", []string{}, nil, policy, "Subd.Poll", false},
+		{"pattern", []string{"Subd.*"}, nil, nil, "Subd.Poll", true},
+		{"other pattern", []string{"Subd.*"}, nil, nil,
+			"ImageServer.AddImage", false},
+		{"group", []string{}, []string{"release"}, policy,
+			"ImageServer.AddImage", true},
+		{"group not permitted", []string{}, []string{"release"}, policy,
+			"ImageServer.DeleteImage", false},
+		{"group without policy", []string{}, []string{"release"}, nil,
+			"ImageServer.AddImage", false},
+		{"certificate or group", []string{"Subd.*"}, []string{"release"},
+			policy, "ImageServer.AddImage", true},
+	}
+	for _, test := range tests {
+		conn := &Conn{}
+		if test.permittedMethods != nil {
+			conn.permittedMethods = make(map[string]struct{})
+			for _, method := range test.permittedMethods {
+				conn.permittedMethods[method] = struct{}{}
+			}
+		}
+		if test.groups != nil {
+			conn.groups = make(map[string]struct{})
+			for _, group := range test.groups {
+				conn.groups[group] = struct{}{}
+			}
+		}
+		groupPolicy = test.policy
+		if got := conn.checkPermitted(test.serviceMethod); got != test.want {
+			t.Errorf("%s: got: %v, want: %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+	Package tlsloader loads TLS certificates, keys and CA bundles and reloads
+	them when they change.
+
+	Package tlsloader watches the certificate, key and CA files and reloads
+	them when they are replaced, so that certificates may be rotated without
+	restarting. The TLS configurations it makes use the most recently loaded
+	data for each new connection; existing connections are not affected.
+	Expiry times are published as metrics and shown on status pages.
+*/
+package tlsloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Loader holds the most recently loaded certificate, key and CA bundle.
+type Loader struct {
+	caFile          string
+	certFile        string
+	keyFile         string
+	rwLock          sync.RWMutex // Protect everything below.
+	contents        [][]byte     // Of the files which were loaded.
+	certificate     *tls.Certificate
+	certificateTime time.Time // Expiry time of the certificate.
+	caPool          *x509.CertPool
+	caTime          time.Time // Earliest expiry time in the CA bundle.
+	loadTime        time.Time
+	loadError       error // Error from the last failed reload.
+	numReloads      uint64
+	numErrors       uint64
+}
+
+// New loads the certificate and key and, if caFile is not empty, the CA
+// bundle. Metrics are registered under /tls. If a file does not exist, the
+// error satisfies os.IsNotExist.
+func New(caFile, certFile, keyFile string) (*Loader, error) {
+	return newLoader(caFile, certFile, keyFile)
+}
+
+// ClientConfig returns a copy of config which presents the most recently
+// loaded certificate to servers.
+func (l *Loader) ClientConfig(config *tls.Config) *tls.Config {
+	return l.clientConfig(config)
+}
+
+// ServerConfig returns a copy of config which presents the most recently
+// loaded certificate to clients and, if a CA file was given, verifies client
+// certificates using the most recently loaded CA bundle.
+func (l *Loader) ServerConfig(config *tls.Config) *tls.Config {
+	return l.serverConfig(config)
+}
+
+// Watch starts watching the files and reloads them when they are written,
+// replaced or reached through a symbolic link which is changed. Changes are
+// reloaded once the files have been quiet for a second, so that a certificate
+// and key which are replaced one after the other are loaded together. Errors
+// are logged to logger and the previously loaded data are kept.
+func (l *Loader) Watch(logger *log.Logger) {
+	l.watch(logger)
+}
+
+// WriteHtml writes the expiry times and reload state, with warnings for
+// certificates which have expired or will soon expire.
+func (l *Loader) WriteHtml(writer io.Writer) {
+	l.writeHtml(writer)
+}
@@ -0,0 +1,48 @@
+package tlsloader
+
+import (
+	"fmt"
+	"github.com/Symantec/Dominator/lib/format"
+	"io"
+	"time"
+)
+
+const expiryWarningPeriod = 14 * 24 * time.Hour
+
+func (l *Loader) writeHtml(writer io.Writer) {
+	l.rwLock.RLock()
+	certificateTime := l.certificateTime
+	caTime := l.caTime
+	loadTime := l.loadTime
+	loadError := l.loadError
+	numReloads := l.numReloads
+	l.rwLock.RUnlock()
+	fmt.Fprint(writer, "TLS certificate ")
+	writeExpiry(writer, certificateTime)
+	if !caTime.IsZero() {
+		fmt.Fprint(writer, ", CA bundle ")
+		writeExpiry(writer, caTime)
+	}
+	if numReloads > 0 {
+		fmt.Fprintf(writer, ", reloaded %d times (last: %s)",
+			numReloads, loadTime.Format(time.RFC3339))
+	}
+	if loadError != nil {
+		fmt.Fprintf(writer, ", <font color=\"red\">reload error: %s</font>",
+			loadError)
+	}
+	fmt.Fprintln(writer, "<br>")
+}
+
+func writeExpiry(writer io.Writer, expires time.Time) {
+	timeLeft := time.Until(expires)
+	if timeLeft <= 0 {
+		fmt.Fprintf(writer, "<font color=\"red\">expired %s ago</font>",
+			format.Duration(-timeLeft))
+	} else if timeLeft < expiryWarningPeriod {
+		fmt.Fprintf(writer, "<font color=\"red\">expires in %s</font>",
+			format.Duration(timeLeft))
+	} else {
+		fmt.Fprintf(writer, "expires in %s", format.Duration(timeLeft))
+	}
+}
@@ -0,0 +1,249 @@
+package tlsloader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/Symantec/tricorder/go/tricorder"
+	"github.com/Symantec/tricorder/go/tricorder/units"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+func newLoader(caFile, certFile, keyFile string) (*Loader, error) {
+	l := &Loader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	if _, err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.registerMetrics(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Loader) filenames() []string {
+	filenames := []string{l.certFile, l.keyFile}
+	if l.caFile != "" {
+		filenames = append(filenames, l.caFile)
+	}
+	return filenames
+}
+
+// readFiles reads the certificate, key and CA files (in the order given by
+// filenames).
+func (l *Loader) readFiles() ([][]byte, error) {
+	filenames := l.filenames()
+	contents := make([][]byte, 0, len(filenames))
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, data)
+	}
+	return contents, nil
+}
+
+// load reads all the files and, if they have changed and can all be parsed,
+// replaces the loaded data with them. Otherwise the loaded data are kept. It
+// returns true if the data were replaced.
+func (l *Loader) load() (bool, error) {
+	contents, err := l.readFiles()
+	if err != nil {
+		return false, err
+	}
+	l.rwLock.Lock()
+	unchanged := sameContents(contents, l.contents)
+	if unchanged {
+		l.loadError = nil // The files are back to the loaded data.
+	}
+	l.rwLock.Unlock()
+	if unchanged {
+		return false, nil
+	}
+	certificate, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return false, errors.New(l.certFile + ", " + l.keyFile + ": " +
+			err.Error())
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return false, errors.New(l.certFile + ": " + err.Error())
+	}
+	var caPool *x509.CertPool
+	var caTime time.Time
+	if l.caFile != "" {
+		caPool, caTime, err = parseCertPool(l.caFile, contents[2])
+		if err != nil {
+			return false, err
+		}
+	}
+	l.rwLock.Lock()
+	defer l.rwLock.Unlock()
+	l.contents = contents
+	l.certificate = &certificate
+	l.certificateTime = leaf.NotAfter
+	l.caPool = caPool
+	l.caTime = caTime
+	l.loadTime = time.Now()
+	l.loadError = nil
+	return true, nil
+}
+
+func sameContents(left, right [][]byte) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for index := range left {
+		if !bytes.Equal(left[index], right[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCertPool returns the certificates in the data read from filename and
+// the earliest time at which one of them expires.
+func parseCertPool(filename string, data []byte) (*x509.CertPool, time.Time,
+	error) {
+	caPool := x509.NewCertPool()
+	var expires time.Time
+	for block, rest := pem.Decode(data); block != nil; block, rest =
+		pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, time.Time{}, errors.New(filename + ": " + err.Error())
+		}
+		caPool.AddCert(cert)
+		if expires.IsZero() || cert.NotAfter.Before(expires) {
+			expires = cert.NotAfter
+		}
+	}
+	if expires.IsZero() {
+		return nil, time.Time{}, errors.New("unable to parse CA file: " +
+			filename)
+	}
+	return caPool, expires, nil
+}
+
+func (l *Loader) reload(logger *log.Logger) {
+	changed, err := l.load()
+	if err != nil {
+		l.rwLock.Lock()
+		l.loadError = err
+		l.numErrors++
+		l.rwLock.Unlock()
+		logger.Printf(
+			"Error reloading TLS certificates, keeping old ones: %s\n", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	l.rwLock.Lock()
+	l.numReloads++
+	expires := l.certificateTime
+	l.rwLock.Unlock()
+	logger.Printf("Reloaded TLS certificates, certificate expires: %s\n",
+		expires.Format(time.RFC3339))
+}
+
+func (l *Loader) getCertificate() *tls.Certificate {
+	l.rwLock.RLock()
+	defer l.rwLock.RUnlock()
+	return l.certificate
+}
+
+func (l *Loader) getCertPool() *x509.CertPool {
+	l.rwLock.RLock()
+	defer l.rwLock.RUnlock()
+	return l.caPool
+}
+
+func (l *Loader) clientConfig(template *tls.Config) *tls.Config {
+	config := template.Clone()
+	config.Certificates = nil
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (
+		*tls.Certificate, error) {
+		return l.getCertificate(), nil
+	}
+	return config
+}
+
+func (l *Loader) serverConfig(template *tls.Config) *tls.Config {
+	config := template.Clone()
+	config.Certificates = nil
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (
+		*tls.Config, error) {
+		config := template.Clone()
+		config.Certificates = []tls.Certificate{*l.getCertificate()}
+		if caPool := l.getCertPool(); caPool != nil {
+			config.ClientCAs = caPool
+		}
+		return config, nil
+	}
+	return config
+}
+
+func (l *Loader) getTimes() (time.Time, time.Time) {
+	l.rwLock.RLock()
+	defer l.rwLock.RUnlock()
+	return l.certificateTime, l.caTime
+}
+
+func (l *Loader) getCounter(counter *uint64) func() uint64 {
+	return func() uint64 {
+		l.rwLock.RLock()
+		defer l.rwLock.RUnlock()
+		return *counter
+	}
+}
+
+func (l *Loader) registerMetrics() error {
+	dir, err := tricorder.RegisterDirectory("/tls")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("certificate-expiration-time",
+		func() time.Time {
+			certificateTime, _ := l.getTimes()
+			return certificateTime
+		},
+		units.None, "time at which the certificate expires")
+	if err != nil {
+		return err
+	}
+	err = dir.RegisterMetric("certificate-time-to-expiration",
+		func() time.Duration {
+			certificateTime, _ := l.getTimes()
+			return time.Until(certificateTime)
+		},
+		units.Second, "time until the certificate expires")
+	if err != nil {
+		return err
+	}
+	if l.caFile != "" {
+		err = dir.RegisterMetric("ca-expiration-time",
+			func() time.Time {
+				_, caTime := l.getTimes()
+				return caTime
+			},
+			units.None, "time at which the first CA certificate expires")
+		if err != nil {
+			return err
+		}
+	}
+	err = dir.RegisterMetric("num-reloads", l.getCounter(&l.numReloads),
+		units.None, "number of times the certificates were reloaded")
+	if err != nil {
+		return err
+	}
+	return dir.RegisterMetric("num-reload-errors", l.getCounter(&l.numErrors),
+		units.None, "number of failed reloads")
+}
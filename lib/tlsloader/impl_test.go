@@ -0,0 +1,144 @@
+package tlsloader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testPair struct {
+	cert    []byte
+	key     []byte
+	expires time.Time
+}
+
+// makeTestPair returns a PEM encoded self-signed certificate and key which
+// expire after lifetime.
+func makeTestPair(t *testing.T, lifetime time.Duration) testPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(lifetime).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              expires,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testPair{
+		cert: pem.EncodeToMemory(
+			&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key: pem.EncodeToMemory(
+			&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		expires: expires.UTC(),
+	}
+}
+
+func writeTestFile(t *testing.T, filename string, data []byte) {
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestLoader returns a Loader without metrics, which may only be
+// registered once.
+func newTestLoader(t *testing.T, caFile, certFile, keyFile string) *Loader {
+	l := &Loader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	if _, err := l.load(); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+var testLogger = log.New(ioutil.Discard, "", 0)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	first := makeTestPair(t, 24*time.Hour)
+	second := makeTestPair(t, 48*time.Hour)
+	third := makeTestPair(t, 72*time.Hour)
+	writeTestFile(t, certFile, first.cert)
+	writeTestFile(t, keyFile, first.key)
+	writeTestFile(t, caFile, first.cert)
+	l := newTestLoader(t, caFile, certFile, keyFile)
+	var tests = []struct {
+		name        string
+		cert        []byte
+		key         []byte
+		ca          []byte
+		wantExpires time.Time
+		wantCA      time.Time
+		wantReloads uint64
+		wantError   bool
+	}{
+		{"unchanged", first.cert, first.key, first.cert, first.expires,
+			first.expires, 0, false},
+		{"new pair", second.cert, second.key, first.cert, second.expires,
+			first.expires, 1, false},
+		{"new CA", second.cert, second.key, third.cert, second.expires,
+			third.expires, 2, false},
+		{"mismatched pair", third.cert, second.key, third.cert,
+			second.expires, third.expires, 2, true},
+		{"bad CA", third.cert, third.key, []byte("junk"), second.expires,
+			third.expires, 2, true},
+		{"bad certificate", []byte("junk"), third.key, third.cert,
+			second.expires, third.expires, 2, true},
+		{"back to loaded", second.cert, second.key, third.cert,
+			second.expires, third.expires, 2, false},
+	}
+	for _, test := range tests {
+		writeTestFile(t, certFile, test.cert)
+		writeTestFile(t, keyFile, test.key)
+		writeTestFile(t, caFile, test.ca)
+		l.reload(testLogger)
+		certificateTime, caTime := l.getTimes()
+		if !certificateTime.Equal(test.wantExpires) {
+			t.Errorf("%s: certificate expires: %s, want: %s", test.name,
+				certificateTime, test.wantExpires)
+		}
+		if !caTime.Equal(test.wantCA) {
+			t.Errorf("%s: CA expires: %s, want: %s", test.name, caTime,
+				test.wantCA)
+		}
+		if l.numReloads != test.wantReloads {
+			t.Errorf("%s: reloads: %d, want: %d", test.name, l.numReloads,
+				test.wantReloads)
+		}
+		if (l.loadError != nil) != test.wantError {
+			t.Errorf("%s: error: %v", test.name, l.loadError)
+		}
+		// The certificate in use always matches its key.
+		leaf, err := x509.ParseCertificate(l.getCertificate().Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		} else if !leaf.NotAfter.Equal(certificateTime) {
+			t.Errorf("%s: serving certificate expiring: %s", test.name,
+				leaf.NotAfter)
+		}
+	}
+}
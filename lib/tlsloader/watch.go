@@ -0,0 +1,69 @@
+package tlsloader
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// pollInterval is how often the files are checked if they cannot be watched.
+const pollInterval = time.Minute
+
+// reloadDelay is how long the files must be quiet before they are reloaded.
+var reloadDelay = time.Second
+
+func (l *Loader) watch(logger *log.Logger) {
+	trigger := make(chan struct{}, 1)
+	if !l.watchWithInotify(trigger, logger) {
+		go pollForChanges(trigger)
+	}
+	go l.reloadOnTrigger(trigger, logger)
+}
+
+// getWatchDirectories returns the directories which hold the files and, if
+// the files are symbolic links, the directories which hold their targets. A
+// change anywhere in these directories may change the files.
+func (l *Loader) getWatchDirectories() []string {
+	directories := make(map[string]struct{})
+	for _, filename := range l.filenames() {
+		directories[filepath.Dir(filename)] = struct{}{}
+		if target, err := filepath.EvalSymlinks(filename); err == nil {
+			directories[filepath.Dir(target)] = struct{}{}
+		}
+	}
+	directoryList := make([]string, 0, len(directories))
+	for directory := range directories {
+		directoryList = append(directoryList, directory)
+	}
+	sort.Strings(directoryList)
+	return directoryList
+}
+
+func notify(trigger chan<- struct{}) {
+	select {
+	case trigger <- struct{}{}:
+	default:
+	}
+}
+
+func pollForChanges(trigger chan<- struct{}) {
+	for range time.Tick(pollInterval) {
+		notify(trigger)
+	}
+}
+
+// reloadOnTrigger reloads the files once they have been quiet for reloadDelay
+// after a trigger.
+func (l *Loader) reloadOnTrigger(trigger <-chan struct{}, logger *log.Logger) {
+	for range trigger {
+		for waiting := true; waiting; {
+			select {
+			case <-trigger:
+			case <-time.After(reloadDelay):
+				waiting = false
+			}
+		}
+		l.reload(logger)
+	}
+}
@@ -0,0 +1,12 @@
+// +build !linux
+
+package tlsloader
+
+import (
+	"log"
+)
+
+func (l *Loader) watchWithInotify(trigger chan<- struct{},
+	logger *log.Logger) bool {
+	return false
+}
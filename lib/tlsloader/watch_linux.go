@@ -0,0 +1,52 @@
+package tlsloader
+
+import (
+	"golang.org/x/exp/inotify"
+	"log"
+)
+
+func (l *Loader) watchWithInotify(trigger chan<- struct{},
+	logger *log.Logger) bool {
+	watcher, err := inotify.NewWatcher()
+	if err != nil {
+		logger.Println("Error creating watcher:", err)
+		return false
+	}
+	if err := l.addWatches(watcher); err != nil {
+		logger.Println("Error adding watch:", err)
+		watcher.Close()
+		return false
+	}
+	go l.waitForInotifyEvents(watcher, trigger, logger)
+	return true
+}
+
+// addWatches watches for files being written, created or renamed in the
+// directories which may hold the files. Renaming covers both replacing a file
+// and swapping a symbolic link to a directory of files (such as ..data).
+func (l *Loader) addWatches(watcher *inotify.Watcher) error {
+	for _, directory := range l.getWatchDirectories() {
+		err := watcher.AddWatch(directory,
+			inotify.IN_CLOSE_WRITE|inotify.IN_CREATE|inotify.IN_MOVED_TO)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Loader) waitForInotifyEvents(watcher *inotify.Watcher,
+	trigger chan<- struct{}, logger *log.Logger) {
+	for {
+		select {
+		case <-watcher.Event:
+			notify(trigger)
+			// The targets of symbolic links may have moved.
+			if err := l.addWatches(watcher); err != nil {
+				logger.Println("Error adding watch:", err)
+			}
+		case err := <-watcher.Error:
+			logger.Println("Error with watcher:", err)
+		}
+	}
+}
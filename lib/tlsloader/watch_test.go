@@ -0,0 +1,111 @@
+package tlsloader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// makeDataDirectory writes the pair into a new directory under dir and points
+// dir/..data at it, the way mounted secrets are updated.
+func makeDataDirectory(t *testing.T, dir, name string, pair testPair) {
+	dataDir := filepath.Join(dir, name)
+	if err := os.Mkdir(dataDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dataDir, "cert.pem"), pair.cert)
+	writeTestFile(t, filepath.Join(dataDir, "key.pem"), pair.key)
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(name, tmpLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	first := makeTestPair(t, 24*time.Hour)
+	second := makeTestPair(t, 48*time.Hour)
+	makeDataDirectory(t, dir, "..first", first)
+	for _, name := range []string{"cert.pem", "key.pem"} {
+		err := os.Symlink(filepath.Join("..data", name),
+			filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := newTestLoader(t, "", filepath.Join(dir, "cert.pem"),
+		filepath.Join(dir, "key.pem"))
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name        string
+		pair        testPair
+		wantExpires time.Time
+	}{
+		{"..first", first, first.expires},
+		{"..second", second, second.expires},
+	}
+	for _, test := range tests {
+		if _, err := os.Stat(filepath.Join(dir, test.name)); err != nil {
+			makeDataDirectory(t, dir, test.name, test.pair)
+		}
+		l.reload(testLogger)
+		if certificateTime, _ := l.getTimes(); !certificateTime.Equal(
+			test.wantExpires) {
+			t.Errorf("%s: certificate expires: %s, want: %s", test.name,
+				certificateTime, test.wantExpires)
+		}
+		// The directory of the old target is replaced by the new one.
+		wantDirs := []string{dir, filepath.Join(resolvedDir, test.name)}
+		if dirs := l.getWatchDirectories(); !reflect.DeepEqual(dirs,
+			wantDirs) {
+			t.Errorf("%s: watching: %v, want: %v", test.name, dirs, wantDirs)
+		}
+	}
+}
+
+func TestReloadWaitsForQuiet(t *testing.T) {
+	savedDelay := reloadDelay
+	reloadDelay = 200 * time.Millisecond
+	defer func() { reloadDelay = savedDelay }()
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	first := makeTestPair(t, 24*time.Hour)
+	second := makeTestPair(t, 48*time.Hour)
+	writeTestFile(t, certFile, first.cert)
+	writeTestFile(t, keyFile, first.key)
+	l := newTestLoader(t, "", certFile, keyFile)
+	trigger := make(chan struct{}, 1)
+	go l.reloadOnTrigger(trigger, testLogger)
+	// The certificate and key are replaced one after the other. Loading only
+	// the certificate would fail.
+	writeTestFile(t, certFile, second.cert)
+	notify(trigger)
+	time.Sleep(reloadDelay / 4)
+	writeTestFile(t, keyFile, second.key)
+	notify(trigger)
+	timeout := time.Now().Add(10 * time.Second)
+	for {
+		if certificateTime, _ := l.getTimes(); certificateTime.Equal(
+			second.expires) {
+			break
+		}
+		if time.Now().After(timeout) {
+			t.Fatal("new pair not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	l.rwLock.RLock()
+	defer l.rwLock.RUnlock()
+	if l.numErrors != 0 || l.numReloads != 1 {
+		t.Errorf("reloads: %d, errors: %d", l.numReloads, l.numErrors)
+	}
+}
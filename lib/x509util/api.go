@@ -3,7 +3,17 @@
 */
 package x509util
 
-import "crypto/x509"
+import (
+	"crypto"
+	"crypto/x509"
+)
+
+// GetGroups decodes the list of groups (or roles) to which the certificate
+// holder belongs. The groups are returned as keys in a map. If there is a
+// problem parsing the information an error is returned.
+func GetGroups(cert *x509.Certificate) (map[string]struct{}, error) {
+	return getGroups(cert)
+}
 
 // GetPermittedMethods decodes the list of permitted methods in the certificate.
 // The permitted methods are returned as keys in a map. An empty map indicates
@@ -18,3 +28,15 @@ func GetPermittedMethods(cert *x509.Certificate) (map[string]struct{}, error) {
 func GetUsername(cert *x509.Certificate) (string, error) {
 	return getUsername(cert)
 }
+
+// LoadPrivateKey reads a PEM encoded private key (PKCS#1, PKCS#8 or EC) from
+// the file specified by filename. The key is returned as a crypto.Signer.
+func LoadPrivateKey(filename string) (crypto.Signer, error) {
+	return loadPrivateKey(filename)
+}
+
+// LoadPublicKey reads a PEM encoded public key or certificate from the file
+// specified by filename and returns the public key.
+func LoadPublicKey(filename string) (crypto.PublicKey, error) {
+	return loadPublicKey(filename)
+}
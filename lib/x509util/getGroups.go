@@ -0,0 +1,34 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/constants"
+)
+
+func getGroups(cert *x509.Certificate) (map[string]struct{}, error) {
+	groups := make(map[string]struct{})
+	for _, extension := range cert.Extensions {
+		if extension.Id.String() != constants.GroupListOID {
+			continue
+		}
+		var lines []string
+		rest, err := asn1.Unmarshal(extension.Value, &lines)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("%d extra bytes in group extension",
+				len(rest))
+		}
+		for _, group := range lines {
+			if group == "" {
+				return nil, fmt.Errorf("empty group name")
+			}
+			groups[group] = struct{}{}
+		}
+		return groups, nil
+	}
+	return groups, nil
+}
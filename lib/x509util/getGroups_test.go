@@ -0,0 +1,82 @@
+package x509util
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"github.com/Symantec/Dominator/lib/constants"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func getGroupListOID(t *testing.T) asn1.ObjectIdentifier {
+	var oid asn1.ObjectIdentifier
+	for _, field := range strings.Split(constants.GroupListOID, ".") {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oid = append(oid, value)
+	}
+	return oid
+}
+
+func makeGroupExtension(t *testing.T, groups []string,
+	extra []byte) pkix.Extension {
+	value, err := asn1.Marshal(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: getGroupListOID(t),
+		Value: append(value, extra...)}
+}
+
+func TestGetGroups(t *testing.T) {
+	otherExtension := pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3},
+		Value: []byte{0}}
+	var tests = []struct {
+		name       string
+		extensions []pkix.Extension
+		wantGroups []string
+		wantError  bool
+	}{
+		{"no extensions", nil, nil, false},
+		{"other extension", []pkix.Extension{otherExtension}, nil, false},
+		{"groups", []pkix.Extension{otherExtension,
+			makeGroupExtension(t, []string{"admins", "release"}, nil)},
+			[]string{"admins", "release"}, false},
+		{"no groups", []pkix.Extension{
+			makeGroupExtension(t, []string{}, nil)}, nil, false},
+		{"empty group", []pkix.Extension{
+			makeGroupExtension(t, []string{"admins", ""}, nil)}, nil, true},
+		{"extra bytes", []pkix.Extension{
+			makeGroupExtension(t, []string{"admins"}, []byte{0})}, nil,
+			true},
+		{"bad encoding", []pkix.Extension{{Id: getGroupListOID(t),
+			Value: []byte{0xff}}}, nil, true},
+	}
+	for _, test := range tests {
+		groups, err := GetGroups(&x509.Certificate{
+			Extensions: test.extensions})
+		if test.wantError {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		wantGroups := make(map[string]struct{})
+		for _, group := range test.wantGroups {
+			wantGroups[group] = struct{}{}
+		}
+		if !reflect.DeepEqual(groups, wantGroups) {
+			t.Errorf("%s: groups: %v, want: %v", test.name, groups,
+				wantGroups)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package x509util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoadPrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaBytes, err := x509.MarshalECPrivateKey(ecdsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Bytes, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		pemType   string
+		data      []byte
+		wantKey   crypto.Signer
+		wantError bool
+	}{
+		{"RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey), rsaKey, false},
+		{"EC PRIVATE KEY", ecdsaBytes, ecdsaKey, false},
+		{"PRIVATE KEY", ed25519Bytes, ed25519Key, false},
+		{"PRIVATE KEY", []byte("garbage"), nil, true},
+		{"CERTIFICATE", []byte("garbage"), nil, true},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		filename := path.Join(dir, "key.pem")
+		err := ioutil.WriteFile(filename, pem.EncodeToMemory(
+			&pem.Block{Type: test.pemType, Bytes: test.data}), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := LoadPrivateKey(filename)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("%s: no error for bad key", test.pemType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.pemType, err)
+		} else if !reflect.DeepEqual(key.Public(), test.wantKey.Public()) {
+			t.Errorf("%s: wrong key loaded", test.pemType)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package rpcd
 
 import (
+	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/objectserver"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/tricorder/go/tricorder"
@@ -9,14 +10,39 @@ import (
 	"log"
 )
 
+// defaultGetObjectsPolicy applies if Params.MethodPolicies has no policy for
+// GetObjects().
+var defaultGetObjectsPolicy = srpc.MethodPolicy{
+	MaxConcurrentCalls: 100,
+	QueueWhenLimited:   true,
+}
+
 type srpcType struct {
-	objectServer objectserver.ObjectServer
-	getSemaphore chan bool
-	logger       *log.Logger
+	objectServer   objectserver.ObjectServer
+	params         Params
+	logger         *log.Logger
+	numGetRequests int64 // Atomic: GetObjects() calls in progress.
+}
+
+// Params holds optional parameters for SetupWithParams.
+type Params struct {
+	// DeleteObjects, if not nil, is called by the DeleteObjects() RPC instead
+	// of deleting from the object server. It must refuse to delete objects
+	// which are in use (such as those used by images), checking and deleting
+	// atomically. The sizes freed are returned.
+	DeleteObjects func(hashes []hash.Hash) ([]uint64, error)
+	// MaxVerifyBytesPerSecond limits the read rate of VerifyObjects() calls,
+	// including those which ask for no limit. The default is 64 MiB/s.
+	MaxVerifyBytesPerSecond uint64
+	// MethodPolicies limits calls to the methods. The key is the method name.
+	// If there is no policy for GetObjects(), up to 100 calls may be in
+	// progress and further calls wait.
+	MethodPolicies map[string]srpc.MethodPolicy
 }
 
 type htmlWriter struct {
-	getSemaphore chan bool
+	srpcObj          *srpcType
+	getObjectsPolicy srpc.MethodPolicy
 }
 
 func (hw *htmlWriter) WriteHtml(writer io.Writer) {
@@ -24,11 +50,27 @@ func (hw *htmlWriter) WriteHtml(writer io.Writer) {
 }
 
 func Setup(objSrv objectserver.ObjectServer, logger *log.Logger) *htmlWriter {
-	getSemaphore := make(chan bool, 100)
-	srpcObj := &srpcType{objSrv, getSemaphore, logger}
-	srpc.RegisterName("ObjectServer", srpcObj)
+	return SetupWithParams(objSrv, Params{}, logger)
+}
+
+func SetupWithParams(objSrv objectserver.ObjectServer, params Params,
+	logger *log.Logger) *htmlWriter {
+	policies := make(map[string]srpc.MethodPolicy)
+	for method, policy := range params.MethodPolicies {
+		policies[method] = policy
+	}
+	if _, ok := policies["GetObjects"]; !ok {
+		policies["GetObjects"] = defaultGetObjectsPolicy
+	}
+	srpcObj := &srpcType{
+		objectServer: objSrv,
+		params:       params,
+		logger:       logger,
+	}
+	srpc.RegisterNameWithOptions("ObjectServer", srpcObj,
+		srpc.ReceiverOptions{MethodPolicies: policies})
 	tricorder.RegisterMetric("/get-requests",
-		func() uint { return uint(len(getSemaphore)) },
+		func() uint { return srpcObj.getNumGetRequests() },
 		units.None, "number of GetObjects() requests in progress")
-	return &htmlWriter{getSemaphore}
+	return &htmlWriter{srpcObj, policies["GetObjects"]}
 }
@@ -0,0 +1,57 @@
+package rpcd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/srpc"
+	proto "github.com/Symantec/Dominator/proto/objectserver"
+)
+
+func (t *srpcType) DeleteObjects(conn *srpc.Conn,
+	request proto.DeleteObjectsRequest,
+	reply *proto.DeleteObjectsResponse) error {
+	username := conn.Username()
+	if username == "" {
+		return errors.New("deleting objects requires authentication")
+	}
+	deleteObjects := t.params.DeleteObjects
+	if deleteObjects == nil {
+		deleter, ok := t.objectServer.(objectserver.ObjectDeleter)
+		if !ok {
+			return errors.New("deleting objects not supported")
+		}
+		deleteObjects = func(hashes []hash.Hash) ([]uint64, error) {
+			return deleteFromObjectServer(deleter, hashes)
+		}
+	}
+	sizes, err := deleteObjects(request.Hashes)
+	for index, size := range sizes {
+		if size > 0 {
+			t.logger.Printf("DeleteObject(%x) by %s\n", request.Hashes[index],
+				username)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	reply.SizesFreed = sizes
+	return nil
+}
+
+// deleteFromObjectServer deletes the objects without checking whether they are
+// in use. The sizes of the objects deleted before any error are returned.
+func deleteFromObjectServer(deleter objectserver.ObjectDeleter,
+	hashes []hash.Hash) ([]uint64, error) {
+	sizes := make([]uint64, 0, len(hashes))
+	for _, hashVal := range hashes {
+		size, err := deleter.DeleteObject(hashVal)
+		if err != nil {
+			return sizes, fmt.Errorf("error deleting object: %x: %s", hashVal,
+				err)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
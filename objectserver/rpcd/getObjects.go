@@ -4,26 +4,33 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver"
 	"github.com/Symantec/Dominator/lib/srpc"
-	"github.com/Symantec/Dominator/proto/objectserver"
+	proto "github.com/Symantec/Dominator/proto/objectserver"
 	"io"
 	"sync"
+	"sync/atomic"
 )
 
 var exclusive sync.RWMutex
 
+func (objSrv *srpcType) getNumGetRequests() uint {
+	return uint(atomic.LoadInt64(&objSrv.numGetRequests))
+}
+
 func (objSrv *srpcType) GetObjects(conn *srpc.Conn) error {
+	atomic.AddInt64(&objSrv.numGetRequests, 1)
+	defer atomic.AddInt64(&objSrv.numGetRequests, -1)
 	defer conn.Flush()
-	var request objectserver.GetObjectsRequest
-	var response objectserver.GetObjectsResponse
+	var request proto.GetObjectsRequest
+	var response proto.GetObjectsResponse
 	if request.Exclusive {
 		exclusive.Lock()
 		defer exclusive.Unlock()
 	} else {
 		exclusive.RLock()
 		defer exclusive.RUnlock()
-		objSrv.getSemaphore <- true
-		defer releaseSemaphore(objSrv.getSemaphore)
 	}
 	decoder := gob.NewDecoder(conn)
 	encoder := gob.NewEncoder(conn)
@@ -50,10 +57,19 @@ func (objSrv *srpcType) GetObjects(conn *srpc.Conn) error {
 		return encoder.Encode(response)
 	}
 	defer objectsReader.Close()
+	compressedReader, ok :=
+		objectsReader.(objectserver.CompressedObjectsReader)
+	if request.AcceptCompressed && ok {
+		response.Compressed = true
+	}
 	if err := encoder.Encode(response); err != nil {
 		return err
 	}
 	conn.Flush()
+	if response.Compressed {
+		return objSrv.sendCompressedObjects(conn, encoder, compressedReader,
+			request.Hashes)
+	}
 	for _, hash := range request.Hashes {
 		length, reader, err := objectsReader.NextObject()
 		if err != nil {
@@ -77,6 +93,35 @@ func (objSrv *srpcType) GetObjects(conn *srpc.Conn) error {
 	return nil
 }
 
-func releaseSemaphore(semaphore <-chan bool) {
-	<-semaphore
+func (objSrv *srpcType) sendCompressedObjects(conn *srpc.Conn,
+	encoder *gob.Encoder, objectsReader objectserver.CompressedObjectsReader,
+	hashes []hash.Hash) error {
+	for _, hash := range hashes {
+		length, compression, reader, err :=
+			objectsReader.NextCompressedObject()
+		if err != nil {
+			objSrv.logger.Println(err)
+			return err
+		}
+		header := proto.GetObjectHeader{Compression: compression,
+			Length: length}
+		if err := encoder.Encode(header); err != nil {
+			reader.Close()
+			return err
+		}
+		nCopied, err := io.Copy(conn.Writer, reader)
+		reader.Close()
+		if err != nil {
+			objSrv.logger.Printf("Error copying:\t%s\n", err)
+			return err
+		}
+		if nCopied != int64(length) {
+			txt := fmt.Sprintf("Expected length: %d, got: %d for: %x",
+				length, nCopied, hash)
+			objSrv.logger.Println(txt)
+			return errors.New(txt)
+		}
+	}
+	objSrv.logger.Printf("GetObjects() sent: %d objects\n", len(hashes))
+	return nil
 }
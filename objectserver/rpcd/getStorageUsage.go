@@ -0,0 +1,30 @@
+package rpcd
+
+import (
+	"errors"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/srpc"
+	proto "github.com/Symantec/Dominator/proto/objectserver"
+)
+
+func (t *srpcType) GetStorageUsage(conn *srpc.Conn,
+	request proto.GetStorageUsageRequest,
+	reply *proto.GetStorageUsageResponse) error {
+	reporter, ok := t.objectServer.(objectserver.StorageUsageReporter)
+	if !ok {
+		return errors.New("reporting storage usage not supported")
+	}
+	usage, err := reporter.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	*reply = proto.GetStorageUsageResponse{
+		NumObjects:          usage.NumObjects,
+		NumCompressed:       usage.NumCompressed,
+		ObjectBytes:         usage.ObjectBytes,
+		StoredBytes:         usage.StoredBytes,
+		FileSystemBytes:     usage.FileSystemBytes,
+		FileSystemFreeBytes: usage.FileSystemFreeBytes,
+	}
+	return nil
+}
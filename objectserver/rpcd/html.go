@@ -6,6 +6,16 @@ import (
 )
 
 func (hw *htmlWriter) writeHtml(writer io.Writer) {
-	fmt.Fprintf(writer, "GetObjects() RPC slots: %d out of %d<br>\n",
-		len(hw.getSemaphore), cap(hw.getSemaphore))
+	fmt.Fprintf(writer, "GetObjects() RPCs in progress: %d<br>\n",
+		hw.srpcObj.getNumGetRequests())
+	policy := hw.getObjectsPolicy
+	if policy.MaxConcurrentCalls > 0 {
+		fmt.Fprintf(writer, "GetObjects() RPC concurrency limit: %d<br>\n",
+			policy.MaxConcurrentCalls)
+	}
+	if policy.MaxCallsPerUserPerSecond > 0 {
+		fmt.Fprintf(writer,
+			"GetObjects() RPC rate limit: %g calls/s for each user<br>\n",
+			policy.MaxCallsPerUserPerSecond)
+	}
 }
@@ -0,0 +1,38 @@
+package rpcd
+
+import (
+	"encoding/gob"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/srpc"
+	proto "github.com/Symantec/Dominator/proto/objectserver"
+)
+
+const listObjectsBatchSize = 1024
+
+func (t *srpcType) ListObjects(conn *srpc.Conn) error {
+	defer conn.Flush()
+	encoder := gob.NewEncoder(conn)
+	lister, ok := t.objectServer.(objectserver.ObjectLister)
+	if !ok {
+		return encoder.Encode(proto.ListObjectsResponse{
+			Error: "listing objects not supported"})
+	}
+	objects := make([]proto.ObjectInfo, 0, listObjectsBatchSize)
+	for hashVal, size := range lister.ListObjectSizes() {
+		objects = append(objects, proto.ObjectInfo{Hash: hashVal, Size: size})
+		if len(objects) >= listObjectsBatchSize {
+			err := encoder.Encode(proto.ListObjectsResponse{Objects: objects})
+			if err != nil {
+				return err
+			}
+			objects = objects[:0]
+		}
+	}
+	if len(objects) > 0 {
+		err := encoder.Encode(proto.ListObjectsResponse{Objects: objects})
+		if err != nil {
+			return err
+		}
+	}
+	return encoder.Encode(proto.ListObjectsResponse{})
+}
@@ -0,0 +1,75 @@
+package rpcd
+
+import (
+	"encoding/gob"
+	"errors"
+	"github.com/Symantec/Dominator/lib/objectserver"
+	"github.com/Symantec/Dominator/lib/rateio"
+	"github.com/Symantec/Dominator/lib/srpc"
+	proto "github.com/Symantec/Dominator/proto/objectserver"
+	"os"
+)
+
+const defaultMaxVerifyBytesPerSecond = 64 << 20
+
+func (t *srpcType) VerifyObjects(conn *srpc.Conn) error {
+	defer conn.Flush()
+	var request proto.VerifyObjectsRequest
+	if err := gob.NewDecoder(conn).Decode(&request); err != nil {
+		return errors.New("error decoding: " + err.Error())
+	}
+	encoder := gob.NewEncoder(conn)
+	verifier, ok := t.objectServer.(objectserver.ObjectVerifier)
+	if !ok {
+		return encoder.Encode(proto.VerifyObjectsResponse{
+			Done:  true,
+			Error: "verifying objects not supported",
+		})
+	}
+	hashes := request.Hashes
+	verifyAll := len(hashes) < 1
+	if verifyAll {
+		lister, ok := t.objectServer.(objectserver.ObjectLister)
+		if !ok {
+			return encoder.Encode(proto.VerifyObjectsResponse{
+				Done:  true,
+				Error: "listing objects not supported",
+			})
+		}
+		for hashVal := range lister.ListObjectSizes() {
+			hashes = append(hashes, hashVal)
+		}
+	}
+	maxBytesPerSecond := t.params.MaxVerifyBytesPerSecond
+	if maxBytesPerSecond < 1 {
+		maxBytesPerSecond = defaultMaxVerifyBytesPerSecond
+	}
+	if request.MaxBytesPerSecond > 0 &&
+		request.MaxBytesPerSecond < maxBytesPerSecond {
+		maxBytesPerSecond = request.MaxBytesPerSecond
+	}
+	// Limit to 50% of twice the rate, since the reader context does not limit
+	// at all at 100%.
+	readerContext := rateio.NewReaderContext(maxBytesPerSecond*2, 50,
+		&rateio.ReadMeasurer{})
+	final := proto.VerifyObjectsResponse{Done: true}
+	for _, hashVal := range hashes {
+		nRead, err := verifier.VerifyObject(hashVal, readerContext)
+		if err != nil {
+			if verifyAll && os.IsNotExist(err) {
+				continue // Deleted since being listed.
+			}
+			err := encoder.Encode(proto.VerifyObjectsResponse{
+				Error: err.Error(),
+				Hash:  hashVal,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		final.NumVerified++
+		final.NumBytes += nRead
+	}
+	return encoder.Encode(final)
+}
@@ -0,0 +1,134 @@
+package rpcd
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Symantec/Dominator/lib/hash"
+	"github.com/Symantec/Dominator/lib/objectserver/client"
+	"github.com/Symantec/Dominator/lib/objectserver/memory"
+	"github.com/Symantec/Dominator/lib/rateio"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testObjectServer fails verification of the objects in corrupt.
+type testObjectServer struct {
+	*memory.ObjectServer
+	corrupt map[hash.Hash]struct{}
+}
+
+func (objSrv *testObjectServer) VerifyObject(hashVal hash.Hash,
+	readerContext *rateio.ReaderContext) (uint64, error) {
+	_, file, err := objSrv.GetObject(hashVal)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if readerContext != nil {
+		reader = readerContext.NewReader(file)
+	}
+	nRead, err := io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		return uint64(nRead), err
+	}
+	if _, ok := objSrv.corrupt[hashVal]; ok {
+		return uint64(nRead), errors.New("hash mismatch")
+	}
+	return uint64(nRead), nil
+}
+
+// startTestServer serves the ObjectServer methods, with a maximum verify rate
+// of 1000 bytes per second. Methods may only be registered once, so all tests
+// share the server.
+func startTestServer(t *testing.T) (*testObjectServer, string) {
+	objSrv := &testObjectServer{
+		ObjectServer: memory.NewObjectServer(),
+		corrupt:      make(map[hash.Hash]struct{}),
+	}
+	SetupWithParams(objSrv, Params{MaxVerifyBytesPerSecond: 1000},
+		log.New(ioutil.Discard, "", 0))
+	server := httptest.NewServer(http.DefaultServeMux)
+	t.Cleanup(server.Close)
+	return objSrv, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (objSrv *testObjectServer) addObject(t *testing.T,
+	data string) hash.Hash {
+	hashVal, _, err := objSrv.AddObject(bytes.NewBufferString(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashVal
+}
+
+func TestVerifyObjects(t *testing.T) {
+	objSrv, address := startTestServer(t)
+	good := objSrv.addObject(t, strings.Repeat("g", 150))
+	bad := objSrv.addObject(t, strings.Repeat("b", 150))
+	objSrv.corrupt[bad] = struct{}{}
+	missing := hash.Hash{1}
+	// Reading a good object takes at least 150ms at the server maximum.
+	var tests = []struct {
+		name              string
+		hashes            []hash.Hash
+		maxBytesPerSecond uint64
+		wantVerified      uint64
+		wantFailed        []hash.Hash
+		minDuration       time.Duration
+	}{
+		{"all", nil, 0, 1, []hash.Hash{bad}, 100 * time.Millisecond},
+		{"missing", []hash.Hash{good, missing}, 0, 1, []hash.Hash{missing},
+			100 * time.Millisecond},
+		{"above server limit", []hash.Hash{good}, 1 << 30, 1, nil,
+			100 * time.Millisecond},
+		{"below server limit", []hash.Hash{good}, 300, 1, nil,
+			400 * time.Millisecond},
+	}
+	objClient := client.NewObjectClient(address)
+	for _, test := range tests {
+		var failed []hash.Hash
+		startTime := time.Now()
+		numVerified, err := objClient.VerifyObjects(test.hashes,
+			test.maxBytesPerSecond,
+			func(hashVal hash.Hash, err error) {
+				failed = append(failed, hashVal)
+			})
+		duration := time.Since(startTime)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if numVerified != test.wantVerified {
+			t.Errorf("%s: verified: %d, want: %d", test.name, numVerified,
+				test.wantVerified)
+		}
+		sort.Slice(failed, func(i, j int) bool {
+			return bytes.Compare(failed[i][:], failed[j][:]) < 0
+		})
+		if len(failed) != len(test.wantFailed) {
+			t.Errorf("%s: failed: %x, want: %x", test.name, failed,
+				test.wantFailed)
+		} else {
+			for index, hashVal := range failed {
+				if hashVal != test.wantFailed[index] {
+					t.Errorf("%s: failed: %x, want: %x", test.name, failed,
+						test.wantFailed)
+					break
+				}
+			}
+		}
+		if duration < test.minDuration {
+			t.Errorf("%s: took: %s, want at least: %s", test.name, duration,
+				test.minDuration)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package imageserver
 
 import (
+	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/image"
+	"github.com/Symantec/Dominator/lib/image/lint"
 )
 
 type AddImageRequest struct {
@@ -9,7 +11,9 @@ type AddImageRequest struct {
 	Image     *image.Image
 }
 
-type AddImageResponse struct{}
+type AddImageResponse struct {
+	Warnings []lint.Violation // Policy violations which did not reject.
+}
 
 type ChangeOwnerRequest struct {
 	DirectoryName string
@@ -26,12 +30,61 @@ type CheckImageResponse struct {
 	ImageExists bool
 }
 
+type DeleteChannelRequest struct {
+	ChannelName string
+}
+
+type DeleteChannelResponse struct{}
+
 type DeleteImageRequest struct {
 	ImageName string
 }
 
 type DeleteImageResponse struct{}
 
+// If both Pathname and Object are specified, images must contain both.
+type FindImagesContainingRequest struct {
+	Pathname string
+	Object   *hash.Hash
+}
+
+type FindImagesContainingResponse struct {
+	ImageNames []string
+}
+
+type GetChannelRequest struct {
+	ChannelName string
+}
+
+type GetChannelResponse struct {
+	Channel *image.Channel // nil if the channel does not exist.
+}
+
+// The ExportImage() RPC is fully streamed.
+// The client sends an ExportImageRequest message.
+// The server sends a stream of ExportImageChunk messages containing the
+// archive. A chunk with an empty Data field signifies the end of the archive.
+// If Error is not empty, the export failed and the archive is incomplete.
+
+type ExportImageRequest struct {
+	ImageName    string
+	Type         string // "tar" or "oci".
+	Architecture string // Required for "oci".
+}
+
+type ExportImageChunk struct {
+	Data  []byte
+	Error string
+}
+
+type FindImagesRequest struct {
+	Labels map[string]string // An empty value matches any value for the key.
+}
+
+type FindImagesResponse struct {
+	ImageNames []string
+}
+
 type GetImageRequest struct {
 	ImageName string
 }
@@ -44,18 +97,30 @@ const (
 	OperationAddImage = iota
 	OperationDeleteImage
 	OperationMakeDirectory
+	OperationUpdateChannel
+	OperationDeleteChannel
 )
 
 // The GetImageUpdates() RPC is fully streamed.
 // The client sends no information to the server.
 // The server sends a stream of ImageUpdate messages.
+// The initial list contains all directories, images and channels (with their
+// history). Every change to a channel is sent with the complete channel. A
+// deleted channel is sent with OperationDeleteChannel and the channel name.
 
 type ImageUpdate struct {
 	Name      string // "" signifies initial list is sent, changes to follow.
 	Directory *image.Directory
+	Channel   *image.Channel
 	Operation uint
 }
 
+type ListChannelsRequest struct{}
+
+type ListChannelsResponse struct {
+	ChannelNames []string
+}
+
 // The ListDirectories() RPC is fully streamed.
 // The client sends no information to the server.
 // The server sends a stream of image.Directory values with an empty string
@@ -71,3 +136,19 @@ type MakeDirectoryRequest struct {
 }
 
 type MakeDirectoryResponse struct{}
+
+type RollbackChannelRequest struct {
+	ChannelName string
+	ImageName   string // If empty, the image prior to the current image.
+}
+
+type RollbackChannelResponse struct {
+	ImageName string
+}
+
+type SetChannelRequest struct {
+	ChannelName string
+	ImageName   string
+}
+
+type SetChannelResponse struct{}
@@ -29,12 +29,73 @@ type CheckObjectsResponse struct {
 }
 
 // This is used in the special GetObjects streaming HTTP/RPC protocol.
+// If AcceptCompressed is true, the server may send objects in their stored
+// (possibly compressed) form. In that case the response has Compressed set and
+// each object is preceded by a GetObjectHeader in Gob format.
 type GetObjectsRequest struct {
-	Exclusive bool // For initial performance benchmarking only.
-	Hashes    []hash.Hash
+	AcceptCompressed bool
+	Exclusive        bool // For initial performance benchmarking only.
+	Hashes           []hash.Hash
 }
 
 type GetObjectsResponse struct {
+	Compressed     bool
 	ResponseString string
-	ObjectSizes    []uint64
+	ObjectSizes    []uint64 // Uncompressed sizes.
 } // Object datas are streamed afterwards.
+
+type GetObjectHeader struct {
+	Compression uint   // One of the lib/objectserver.Compression* codecs.
+	Length      uint64 // Number of bytes which follow.
+}
+
+// The DeleteObjects() RPC requires an authenticated connection.
+type DeleteObjectsRequest struct {
+	Hashes []hash.Hash
+}
+
+type DeleteObjectsResponse struct {
+	SizesFreed []uint64 // size == 0: object not found.
+}
+
+type GetStorageUsageRequest struct{}
+
+type GetStorageUsageResponse struct {
+	NumObjects          uint64
+	NumCompressed       uint64
+	ObjectBytes         uint64 // Total uncompressed size of objects.
+	StoredBytes         uint64 // Total size of stored objects.
+	FileSystemBytes     uint64
+	FileSystemFreeBytes uint64
+}
+
+// The ListObjects() RPC is a streaming RPC. The server sends a stream of
+// ListObjectsResponse objects in Gob format. The end of the stream is
+// signified by a response with no objects. If .Error is not empty, the server
+// failed and the stream is ended.
+type ListObjectsResponse struct {
+	Error   string
+	Objects []ObjectInfo
+}
+
+type ObjectInfo struct {
+	Hash hash.Hash
+	Size uint64 // Uncompressed size.
+}
+
+// The VerifyObjects() RPC requires the client to send a VerifyObjectsRequest
+// in Gob format. If .Hashes is empty, all objects are verified. The server
+// sends a VerifyObjectsResponse for each object which fails verification,
+// followed by a final response with .Done set.
+type VerifyObjectsRequest struct {
+	Hashes            []hash.Hash
+	MaxBytesPerSecond uint64 // 0: the server maximum.
+}
+
+type VerifyObjectsResponse struct {
+	Done        bool
+	Error       string // Why the object failed, or the request failed if Done.
+	Hash        hash.Hash
+	NumVerified uint64 // Only set if Done.
+	NumBytes    uint64 // Only set if Done.
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/sub"
@@ -8,12 +9,26 @@ import (
 )
 
 func Cleanup(client *srpc.Client, hashes []hash.Hash) error {
-	return cleanup(client, hashes)
+	return cleanup(context.Background(), client, hashes)
+}
+
+// CleanupContext is like Cleanup, except that the call is abandoned if ctx is
+// cancelled or its deadline passes.
+func CleanupContext(ctx context.Context, client *srpc.Client,
+	hashes []hash.Hash) error {
+	return cleanup(ctx, client, hashes)
 }
 
 func Fetch(client *srpc.Client, serverAddress string,
 	hashes []hash.Hash) error {
-	return fetch(client, serverAddress, hashes)
+	return fetch(context.Background(), client, serverAddress, hashes)
+}
+
+// FetchContext is like Fetch, except that the call is abandoned if ctx is
+// cancelled or its deadline passes.
+func FetchContext(ctx context.Context, client *srpc.Client,
+	serverAddress string, hashes []hash.Hash) error {
+	return fetch(ctx, client, serverAddress, hashes)
 }
 
 func GetConfiguration(client *srpc.Client) (sub.Configuration, error) {
@@ -22,7 +37,14 @@ func GetConfiguration(client *srpc.Client) (sub.Configuration, error) {
 
 func CallPoll(client *srpc.Client, request sub.PollRequest,
 	reply *sub.PollResponse) error {
-	return callPoll(client, request, reply)
+	return callPoll(context.Background(), client, request, reply)
+}
+
+// CallPollContext is like CallPoll, except that the call is abandoned if ctx
+// is cancelled or its deadline passes.
+func CallPollContext(ctx context.Context, client *srpc.Client,
+	request sub.PollRequest, reply *sub.PollResponse) error {
+	return callPoll(ctx, client, request, reply)
 }
 
 func SetConfiguration(client *srpc.Client, config sub.Configuration) error {
@@ -31,7 +53,14 @@ func SetConfiguration(client *srpc.Client, config sub.Configuration) error {
 
 func CallUpdate(client *srpc.Client, request sub.UpdateRequest,
 	reply *sub.UpdateResponse) error {
-	return callUpdate(client, request, reply)
+	return callUpdate(context.Background(), client, request, reply)
+}
+
+// CallUpdateContext is like CallUpdate, except that the call is abandoned if
+// ctx is cancelled or its deadline passes.
+func CallUpdateContext(ctx context.Context, client *srpc.Client,
+	request sub.UpdateRequest, reply *sub.UpdateResponse) error {
+	return callUpdate(ctx, client, request, reply)
 }
 
 func GetFiles(client *srpc.Client, filenames []string,
@@ -1,13 +1,15 @@
 package client
 
 import (
+	"context"
 	"github.com/Symantec/Dominator/lib/hash"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/sub"
 )
 
-func cleanup(client *srpc.Client, hashes []hash.Hash) error {
+func cleanup(ctx context.Context, client *srpc.Client,
+	hashes []hash.Hash) error {
 	request := sub.CleanupRequest{hashes}
 	var reply sub.CleanupResponse
-	return client.RequestReply("Subd.Cleanup", request, &reply)
+	return client.RequestReplyContext(ctx, "Subd.Cleanup", request, &reply)
 }
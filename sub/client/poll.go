@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/gob"
 	"errors"
 	"github.com/Symantec/Dominator/lib/filesystem"
@@ -9,9 +10,18 @@ import (
 	"github.com/Symantec/Dominator/proto/sub"
 )
 
-func callPoll(client *srpc.Client, request sub.PollRequest,
-	reply *sub.PollResponse) error {
-	conn, err := client.Call("Subd.Poll")
+func callPoll(ctx context.Context, client *srpc.Client,
+	request sub.PollRequest, reply *sub.PollResponse) error {
+	err := callPollWithContext(ctx, client, request, reply)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func callPollWithContext(ctx context.Context, client *srpc.Client,
+	request sub.PollRequest, reply *sub.PollResponse) error {
+	conn, err := client.CallContext(ctx, "Subd.Poll")
 	if err != nil {
 		return err
 	}
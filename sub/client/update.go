@@ -1,11 +1,12 @@
 package client
 
 import (
+	"context"
 	"github.com/Symantec/Dominator/lib/srpc"
 	"github.com/Symantec/Dominator/proto/sub"
 )
 
-func callUpdate(client *srpc.Client, request sub.UpdateRequest,
-	reply *sub.UpdateResponse) error {
-	return client.RequestReply("Subd.Update", request, reply)
+func callUpdate(ctx context.Context, client *srpc.Client,
+	request sub.UpdateRequest, reply *sub.UpdateResponse) error {
+	return client.RequestReplyContext(ctx, "Subd.Update", request, reply)
 }